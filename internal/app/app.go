@@ -12,11 +12,17 @@ import (
 	"github.com/vovakirdan/wirechat-server/internal/callengine/livekit"
 	"github.com/vovakirdan/wirechat-server/internal/config"
 	"github.com/vovakirdan/wirechat-server/internal/core"
+	"github.com/vovakirdan/wirechat-server/internal/mail"
+	"github.com/vovakirdan/wirechat-server/internal/mail/devmail"
 	"github.com/vovakirdan/wirechat-server/internal/service/calls"
 	"github.com/vovakirdan/wirechat-server/internal/service/friends"
+	"github.com/vovakirdan/wirechat-server/internal/service/presence"
 	"github.com/vovakirdan/wirechat-server/internal/store"
 	"github.com/vovakirdan/wirechat-server/internal/store/sqlite"
 	transporthttp "github.com/vovakirdan/wirechat-server/internal/transport/http"
+	"github.com/vovakirdan/wirechat-server/internal/uploads"
+	"github.com/vovakirdan/wirechat-server/internal/uploads/local"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // App wires together core and transport layers.
@@ -37,18 +43,93 @@ func New(cfg *config.Config, logger *zerolog.Logger) (*App, error) {
 	}
 
 	logger.Info().Str("db_path", cfg.DatabasePath).Msg("database initialized")
+	if !st.SearchEnabled() {
+		logger.Warn().Msg("sqlite built without FTS5, message search is disabled; rebuild with -tags sqlite_fts5")
+	}
 
 	// Create JWT config
 	jwtConfig := &auth.JWTConfig{
-		Secret:   []byte(cfg.JWTSecret),
-		Issuer:   cfg.JWTIssuer,
-		Audience: cfg.JWTAudience,
-		TTL:      24 * time.Hour, // 24 hour token expiry
+		Secret:     []byte(cfg.JWTSecret),
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		TTL:        cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}
+	for _, kc := range cfg.JWTKeys {
+		key, err := auth.LoadSigningKey(kc.ID, kc.File)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key: %w", err)
+		}
+		jwtConfig.Keys = append(jwtConfig.Keys, key)
+	}
+	jwtConfig.SigningKeyID = cfg.JWTSigningKey
+	if err := jwtConfig.Check(); err != nil {
+		return nil, fmt.Errorf("jwt config: %w", err)
+	}
+	if jwtConfig.SigningKeyID != "" {
+		logger.Info().
+			Str("kid", jwtConfig.SigningKeyID).
+			Int("keys", len(jwtConfig.Keys)).
+			Bool("hs256", len(jwtConfig.Secret) > 0).
+			Msg("asymmetric jwt signing enabled")
 	}
 
 	// Create auth service
 	authService := auth.NewService(st, jwtConfig)
 
+	if cfg.Password.BcryptCost < bcrypt.MinCost || cfg.Password.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("password bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if cfg.LoginProtection.Enabled {
+		if cfg.LoginProtection.LockoutDuration <= 0 {
+			return nil, fmt.Errorf("login_protection is enabled but lockout_duration is not set")
+		}
+		authService.SetLoginThrottle(auth.LoginThrottleConfig{
+			FreeAttempts:     cfg.LoginProtection.FreeAttempts,
+			BaseDelay:        cfg.LoginProtection.BaseDelay,
+			MaxDelay:         cfg.LoginProtection.MaxDelay,
+			MaxFailures:      cfg.LoginProtection.MaxFailures,
+			MaxFailuresPerIP: cfg.LoginProtection.MaxFailuresPerIP,
+			LockoutDuration:  cfg.LoginProtection.LockoutDuration,
+		})
+		logger.Info().
+			Int("max_failures", cfg.LoginProtection.MaxFailures).
+			Int("max_failures_per_ip", cfg.LoginProtection.MaxFailuresPerIP).
+			Dur("lockout_duration", cfg.LoginProtection.LockoutDuration).
+			Msg("login protection enabled")
+	} else {
+		logger.Warn().Msg("login protection disabled")
+	}
+
+	var mailer mail.Mailer
+	switch cfg.Mail.Backend {
+	case "":
+		logger.Info().Msg("mail disabled, password reset unavailable")
+	case "log":
+		mailer = devmail.NewLog(cfg.Mail.From, logger)
+		logger.Warn().Msg("mail backend \"log\" writes mails to the log; use it for development only")
+	case "file":
+		fileMailer, err := devmail.NewFile(cfg.Mail.From, cfg.Mail.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("init mail: %w", err)
+		}
+		mailer = fileMailer
+		logger.Info().Str("dir", cfg.Mail.Dir).Msg("file mail backend initialized")
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.Mail.Backend)
+	}
+	authService.SetPasswordConfig(auth.PasswordConfig{
+		Policy: auth.PasswordPolicy{
+			MinLength:      cfg.Password.MinLength,
+			MinClasses:     cfg.Password.MinClasses,
+			RejectUsername: cfg.Password.RejectUsername,
+		},
+		BcryptCost: cfg.Password.BcryptCost,
+		ResetTTL:   cfg.Password.ResetTTL,
+		ResetURL:   cfg.Password.ResetURL,
+		Mailer:     mailer,
+	})
+
 	// Create services
 	friendsService := friends.New(st)
 
@@ -66,12 +147,38 @@ func New(cfg *config.Config, logger *zerolog.Logger) (*App, error) {
 		logger.Info().Msg("LiveKit integration disabled")
 	}
 
+	if cfg.OIDC.Enabled {
+		if cfg.OIDC.Issuer == "" || cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc is enabled but issuer, client_id or redirect_url is not set")
+		}
+		if cfg.OIDC.StateKey == "" && cfg.JWTSecret == "" {
+			return nil, fmt.Errorf("oidc is enabled but neither oidc.state_key nor jwt_secret is set")
+		}
+		logger.Info().Str("issuer", cfg.OIDC.Issuer).Msg("OIDC login enabled")
+	}
+
 	callsService := calls.New(st, callEngine, friendsService)
 
 	// Pass callsService as core.CallService to Hub
 	// If LiveKit is disabled, callsService won't be nil but its methods will return errors
-	hub := core.NewHub(st, callsService)
-	server := transporthttp.NewServer(hub, authService, st, friendsService, callsService, cfg, logger)
+	presenceService := presence.New(st, friendsService)
+
+	// Create upload storage
+	var uploadStorage uploads.Storage
+	switch cfg.Uploads.Backend {
+	case "local":
+		localStorage, err := local.New(cfg.Uploads.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("init upload storage: %w", err)
+		}
+		uploadStorage = localStorage
+		logger.Info().Str("dir", cfg.Uploads.Dir).Msg("local upload storage initialized")
+	default:
+		return nil, fmt.Errorf("unknown uploads backend %q", cfg.Uploads.Backend)
+	}
+
+	hub := core.NewHub(st, callsService, presenceService)
+	server := transporthttp.NewServer(hub, authService, st, friendsService, callsService, presenceService, uploadStorage, cfg, logger)
 
 	return &App{
 		server:          server,
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	wcmail "github.com/vovakirdan/wirechat-server/internal/mail"
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+var (
+	// ErrInvalidEmail is returned when an email address cannot be parsed.
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrEmailTaken is returned when another user already has the email address.
+	ErrEmailTaken = errors.New("email already in use")
+	// ErrResetUnavailable is returned when password resets are not configured.
+	ErrResetUnavailable = errors.New("password reset is not available")
+	// ErrInvalidResetToken is returned when a reset token is unknown, expired or used.
+	ErrInvalidResetToken = errors.New("invalid reset token")
+)
+
+// maxResetsPerHour bounds the reset mails one user can be sent, so the form cannot flood an inbox.
+const maxResetsPerHour = 3
+
+// ChangePassword replaces a user's password after checking the current one.
+// Every other session of the user is revoked, and pending reset links stop working.
+func (s *Service) ChangePassword(ctx context.Context, userID, sessionID int64, current, next string) error {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if ComparePassword(user.PasswordHash, current) != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.passwords.Policy.Check(next, user.Username); err != nil {
+		return err
+	}
+
+	hashed, err := hashPassword(next, s.bcryptCost())
+	if err != nil {
+		return err
+	}
+	if err := s.store.UpdatePasswordHash(ctx, userID, hashed); err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.store.CancelPasswordResets(ctx, userID, now); err != nil {
+		return fmt.Errorf("cancel password resets: %w", err)
+	}
+	revoked, err := s.store.RevokeUserSessions(ctx, userID, sessionID, now)
+	if err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	s.notifyRevoked(revoked)
+	return nil
+}
+
+// SetEmail sets the address password reset links are sent to, after checking
+// the user's password. An empty email removes it.
+func (s *Service) SetEmail(ctx context.Context, userID int64, password, email string) error {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if ComparePassword(user.PasswordHash, password) != nil {
+		return ErrInvalidCredentials
+	}
+
+	email = strings.TrimSpace(email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return ErrInvalidEmail
+		}
+		other, err := s.store.GetUserByEmail(ctx, email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("get user by email: %w", err)
+		}
+		if other != nil && other.ID != userID {
+			return ErrEmailTaken
+		}
+	}
+
+	if err := s.store.UpdateUserEmail(ctx, userID, email); err != nil {
+		return fmt.Errorf("update email: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a reset link to the user with the given username
+// or email. Unknown users and users without an email are silently ignored, so
+// the result does not reveal which accounts exist.
+func (s *Service) RequestPasswordReset(ctx context.Context, login string) error {
+	if s.passwords.Mailer == nil {
+		return ErrResetUnavailable
+	}
+
+	login = strings.TrimSpace(login)
+	var user *store.User
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = s.store.GetUserByEmail(ctx, login)
+	} else {
+		user, err = s.store.GetUserByUsername(ctx, login)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user.Email == "" {
+		return nil
+	}
+
+	now := time.Now()
+	recent, err := s.store.CountPasswordResetsSince(ctx, user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if recent >= maxResetsPerHour {
+		return nil
+	}
+
+	// Same format as refresh tokens: random, and only the hash is stored
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		return fmt.Errorf("generate reset token: %w", err)
+	}
+	ttl := s.passwords.ResetTTL
+	if ttl <= 0 {
+		ttl = DefaultResetTTL
+	}
+	if err := s.store.CreatePasswordReset(ctx, &store.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return fmt.Errorf("create password reset: %w", err)
+	}
+
+	link := token
+	if s.passwords.ResetURL != "" {
+		sep := "?"
+		if strings.Contains(s.passwords.ResetURL, "?") {
+			sep = "&"
+		}
+		link = s.passwords.ResetURL + sep + url.Values{"token": {token}}.Encode()
+	}
+	msg := wcmail.Message{
+		To:      user.Email,
+		Subject: "Reset your WireChat password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your WireChat account. To choose a new password, use:\n\n"+
+			"%s\n\n"+
+			"This link works once and expires in %s. If you did not ask for it, ignore this email.\n",
+			user.Username, link, ttl),
+	}
+	if err := s.passwords.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("send reset mail: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a token from a reset mail. The token
+// works once, and every session of the user is revoked.
+func (s *Service) ResetPassword(ctx context.Context, token, next string) error {
+	hash := hashRefreshToken(token)
+	reset, err := s.store.GetPasswordReset(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("get password reset: %w", err)
+	}
+	now := time.Now()
+	if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.store.GetUserByID(ctx, reset.UserID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+	if err := s.passwords.Policy.Check(next, user.Username); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(next, s.bcryptCost())
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.store.ResetPassword(ctx, hash, hashed, now)
+	if err != nil {
+		return fmt.Errorf("reset password: %w", err)
+	}
+	if !ok {
+		return ErrInvalidResetToken // used concurrently
+	}
+
+	revoked, err := s.store.RevokeUserSessions(ctx, user.ID, 0, now)
+	if err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	s.notifyRevoked(revoked)
+	return nil
+}
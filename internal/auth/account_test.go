@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vovakirdan/wirechat-server/internal/mail"
+)
+
+// captureMailer keeps sent messages for inspection.
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *captureMailer) Send(_ context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *captureMailer) messages() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.sent...)
+}
+
+// resetToken extracts the token from the link in a reset mail.
+func resetToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	for _, field := range strings.Fields(msg.Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no reset link in %q", msg.Body)
+	return ""
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MinClasses: 3, RejectUsername: true}
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"Ab1!", false},                    // too short
+		{"abcdefgh", false},                // one class
+		{"abcdefg1", false},                // two classes
+		{"abcdef1!", true},                 // three classes
+		{"Abcdef12", true},                 // three classes
+		{"xAlice123!", false},              // contains the username
+		{"пароль1Пароль", true},            // letters count in any script
+		{strings.Repeat("aA1", 25), false}, // longer than bcrypt accepts
+	}
+	for _, tt := range tests {
+		err := policy.Check(tt.password, "alice")
+		if (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok=%v", tt.password, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("Check(%q) = %v, want an ErrInvalidPassword", tt.password, err)
+		}
+	}
+
+	// The zero policy keeps the old six character minimum
+	if err := (PasswordPolicy{}).Check("12345", ""); err == nil {
+		t.Error("zero policy accepted a five character password")
+	}
+	if err := (PasswordPolicy{}).Check("123456", ""); err != nil {
+		t.Errorf("zero policy rejected a six character password: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+	svc.SetPasswordConfig(PasswordConfig{Policy: PasswordPolicy{MinLength: 8}})
+
+	phone, err := svc.Register(ctx, "alice", "password123", Device{UserAgent: "phone"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	laptop, err := svc.Login(ctx, "alice", "password123", Device{UserAgent: "laptop"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, phone.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	if err := svc.ChangePassword(ctx, claims.UserID, claims.SessionID, "wrong", "new-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for a wrong current password, got %v", err)
+	}
+	if err := svc.ChangePassword(ctx, claims.UserID, claims.SessionID, "password123", "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword for a short password, got %v", err)
+	}
+	if err := svc.ChangePassword(ctx, claims.UserID, claims.SessionID, "password123", "new-password"); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+
+	if _, err := svc.Login(ctx, "alice", "password123", Device{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("old password still works: %v", err)
+	}
+	if _, err := svc.Login(ctx, "alice", "new-password", Device{}); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+
+	// The session that changed the password survives, the others are signed out
+	if _, err := authenticate(ctx, svc, phone.AccessToken); err != nil {
+		t.Fatalf("current session revoked: %v", err)
+	}
+	if _, err := authenticate(ctx, svc, laptop.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected the other session to be revoked, got %v", err)
+	}
+}
+
+func TestLoginRehashesOnCostChange(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+	svc.SetPasswordConfig(PasswordConfig{BcryptCost: bcrypt.MinCost})
+
+	if _, err := svc.Register(ctx, "alice", "password123", Device{}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	cost := func() int {
+		user, err := svc.store.GetUserByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatalf("get user: %v", err)
+		}
+		c, err := bcrypt.Cost([]byte(user.PasswordHash))
+		if err != nil {
+			t.Fatalf("hash cost: %v", err)
+		}
+		return c
+	}
+	if got := cost(); got != bcrypt.MinCost {
+		t.Fatalf("expected cost %d after register, got %d", bcrypt.MinCost, got)
+	}
+
+	// A failed login leaves the hash alone
+	svc.SetPasswordConfig(PasswordConfig{BcryptCost: bcrypt.MinCost + 1})
+	if _, err := svc.Login(ctx, "alice", "wrong", Device{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if got := cost(); got != bcrypt.MinCost {
+		t.Fatalf("failed login rehashed to cost %d", got)
+	}
+
+	if _, err := svc.Login(ctx, "alice", "password123", Device{}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if got := cost(); got != bcrypt.MinCost+1 {
+		t.Fatalf("expected cost %d after login, got %d", bcrypt.MinCost+1, got)
+	}
+	if _, err := svc.Login(ctx, "alice", "password123", Device{}); err != nil {
+		t.Fatalf("login after rehash: %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+
+	// Without a mailer resets are unavailable
+	if err := svc.RequestPasswordReset(ctx, "alice"); !errors.Is(err, ErrResetUnavailable) {
+		t.Fatalf("expected ErrResetUnavailable, got %v", err)
+	}
+
+	mailer := &captureMailer{}
+	svc.SetPasswordConfig(PasswordConfig{ResetURL: "https://chat.example/reset", Mailer: mailer})
+
+	registered, err := svc.Register(ctx, "alice", "password123", Device{})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, registered.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if _, err := svc.Register(ctx, "bob", "password123", Device{}); err != nil {
+		t.Fatalf("register bob: %v", err)
+	}
+
+	// No email yet: nothing is sent, and the caller cannot tell
+	if err := svc.RequestPasswordReset(ctx, "alice"); err != nil {
+		t.Fatalf("reset without email: %v", err)
+	}
+	if err := svc.RequestPasswordReset(ctx, "nobody"); err != nil {
+		t.Fatalf("reset for unknown user: %v", err)
+	}
+	if n := len(mailer.messages()); n != 0 {
+		t.Fatalf("expected no mail, got %d", n)
+	}
+
+	if err := svc.SetEmail(ctx, claims.UserID, "wrong", "alice@example.com"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := svc.SetEmail(ctx, claims.UserID, "password123", "not an email"); !errors.Is(err, ErrInvalidEmail) {
+		t.Fatalf("expected ErrInvalidEmail, got %v", err)
+	}
+	if err := svc.SetEmail(ctx, claims.UserID, "password123", "alice@example.com"); err != nil {
+		t.Fatalf("set email: %v", err)
+	}
+	bob, err := svc.store.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatalf("get bob: %v", err)
+	}
+	if err := svc.SetEmail(ctx, bob.ID, "password123", "Alice@Example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+
+	// Request by email, case-insensitively
+	if err := svc.RequestPasswordReset(ctx, "ALICE@example.com"); err != nil {
+		t.Fatalf("request reset: %v", err)
+	}
+	sent := mailer.messages()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("expected one mail to alice, got %+v", sent)
+	}
+	token := resetToken(t, sent[0])
+
+	if err := svc.ResetPassword(ctx, "bogus", "new-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken, got %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "short"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "another-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected a used token to be rejected, got %v", err)
+	}
+
+	if _, err := svc.Login(ctx, "alice", "new-password", Device{}); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+	if _, err := authenticate(ctx, svc, registered.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected sessions to be revoked by the reset, got %v", err)
+	}
+
+	// Requests are capped per hour (one was used above)
+	for i := 0; i < maxResetsPerHour+2; i++ {
+		if err := svc.RequestPasswordReset(ctx, "alice"); err != nil {
+			t.Fatalf("request reset %d: %v", i, err)
+		}
+	}
+	if n := len(mailer.messages()); n != maxResetsPerHour {
+		t.Fatalf("expected %d mails in an hour, got %d", maxResetsPerHour, n)
+	}
+
+	// Changing the password invalidates outstanding links
+	pending := resetToken(t, mailer.messages()[maxResetsPerHour-1])
+	tokens, err := svc.Login(ctx, "alice", "new-password", Device{})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	current, err := authenticate(ctx, svc, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if err := svc.ChangePassword(ctx, current.UserID, current.SessionID, "new-password", "newer-password"); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, pending, "another-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected a cancelled token to be rejected, got %v", err)
+	}
+}
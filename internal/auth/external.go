@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// ErrNoLinkedAccount is returned when an external identity has no user and may not get one.
+var ErrNoLinkedAccount = errors.New("no account linked to this identity")
+
+// maxUsernameAttempts bounds the suffixed usernames tried for a new external user.
+const maxUsernameAttempts = 5
+
+// ExternalIdentity is a user as asserted by an external identity provider.
+type ExternalIdentity struct {
+	Issuer   string
+	Subject  string // stable account ID at the issuer
+	Username string // preferred username; may be empty or taken
+}
+
+// ExternalLoginOptions controls what happens to identities without a linked user.
+type ExternalLoginOptions struct {
+	// LinkExisting links the identity to the registered user whose username
+	// equals the provider username exactly. Only safe if the provider does not
+	// let users pick their username.
+	LinkExisting bool
+	// AutoProvision creates a new user, without a password, for the identity.
+	AutoProvision bool
+}
+
+// LoginExternal signs in the user linked to an external identity and starts a
+// session on device, linking or creating the user first as opts allow.
+func (s *Service) LoginExternal(ctx context.Context, identity ExternalIdentity, opts ExternalLoginOptions, device Device) (*Tokens, error) {
+	user, err := s.store.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return s.startSession(ctx, user, device)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get user by identity: %w", err)
+	}
+
+	// Only the exact claim links. A name derived from it, like the local part of
+	// admin@evil.example, could be anyone's.
+	if opts.LinkExisting && identity.Username != "" {
+		existing, err := s.store.GetUserByUsername(ctx, identity.Username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user by username: %w", err)
+		}
+		if existing != nil {
+			linked, err := s.store.LinkIdentity(ctx, existing.ID, identity.Issuer, identity.Subject)
+			if err != nil {
+				return nil, fmt.Errorf("link identity: %w", err)
+			}
+			if linked {
+				return s.startSession(ctx, existing, device)
+			}
+		}
+	}
+
+	if !opts.AutoProvision {
+		return nil, ErrNoLinkedAccount
+	}
+
+	user, err = s.provisionExternalUser(ctx, externalUsername(identity.Username), identity)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user, device)
+}
+
+// provisionExternalUser creates the user for an identity, suffixing the username while it is taken.
+func (s *Service) provisionExternalUser(ctx context.Context, username string, identity ExternalIdentity) (*store.User, error) {
+	if username == "" {
+		username = "user"
+	}
+
+	candidate := username
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		if attempt > 0 {
+			suffix, err := randomSuffix()
+			if err != nil {
+				return nil, err
+			}
+			candidate = truncateUsername(username, 32-len(suffix)-1) + "-" + suffix
+		}
+
+		if _, err := s.store.GetUserByUsername(ctx, candidate); err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user by username: %w", err)
+		}
+
+		user, err := s.store.CreateUserWithIdentity(ctx, candidate, identity.Issuer, identity.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("create user: %w", err)
+		}
+		return user, nil
+	}
+	return nil, fmt.Errorf("no free username for %q", username)
+}
+
+// externalUsername fits a provider username to the username constraints of
+// Register. Returns "" if nothing usable is left.
+func externalUsername(name string) string {
+	name = strings.TrimSpace(name)
+	// Email-style names keep their local part
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	name = strings.Join(strings.Fields(name), "_")
+	name = truncateUsername(name, 32)
+	if len(name) < 3 {
+		return ""
+	}
+	return name
+}
+
+// truncateUsername cuts name to at most n bytes without splitting a character.
+func truncateUsername(name string, n int) string {
+	for len(name) > n {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 2)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate username suffix: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
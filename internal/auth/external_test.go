@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLoginExternal_LinkAndProvision(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+
+	registered, err := svc.Register(ctx, "bob", "password123", Device{})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	bob, err := authenticate(ctx, svc, registered.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	identity := ExternalIdentity{Issuer: "https://idp.example", Subject: "42", Username: "bob"}
+
+	// Without linking or provisioning an unknown identity cannot sign in
+	if _, err := svc.LoginExternal(ctx, identity, ExternalLoginOptions{}, Device{}); !errors.Is(err, ErrNoLinkedAccount) {
+		t.Fatalf("expected ErrNoLinkedAccount, got %v", err)
+	}
+
+	// Linking matches the exact username
+	tokens, err := svc.LoginExternal(ctx, identity, ExternalLoginOptions{LinkExisting: true}, Device{})
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, tokens.AccessToken)
+	if err != nil || claims.UserID != bob.UserID {
+		t.Fatalf("expected linked user %d, got %+v, %v", bob.UserID, claims, err)
+	}
+
+	// Once linked the identity signs in without any options, and the password still works
+	if _, err := svc.LoginExternal(ctx, identity, ExternalLoginOptions{}, Device{}); err != nil {
+		t.Fatalf("linked login: %v", err)
+	}
+	if _, err := svc.Login(ctx, "bob", "password123", Device{}); err != nil {
+		t.Fatalf("password login after linking: %v", err)
+	}
+
+	// bob already has an account at this issuer, so another one is not linked to him
+	second := ExternalIdentity{Issuer: "https://idp.example", Subject: "43", Username: "bob"}
+	if _, err := svc.LoginExternal(ctx, second, ExternalLoginOptions{LinkExisting: true}, Device{}); !errors.Is(err, ErrNoLinkedAccount) {
+		t.Fatalf("expected ErrNoLinkedAccount for a second account, got %v", err)
+	}
+	tokens, err = svc.LoginExternal(ctx, second, ExternalLoginOptions{LinkExisting: true, AutoProvision: true}, Device{})
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	claims, err = authenticate(ctx, svc, tokens.AccessToken)
+	if err != nil || claims.UserID == bob.UserID || len(claims.Username) <= len("bob") {
+		t.Fatalf("expected a new suffixed user, got %+v, %v", claims, err)
+	}
+
+	// Provisioned users have no password
+	if _, err := svc.Login(ctx, claims.Username, "", Device{}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for a provisioned user, got %v", err)
+	}
+}
+
+func TestLoginExternal_EmailDoesNotLink(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+
+	registered, err := svc.Register(ctx, "admin", "password123", Device{})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	admin, err := authenticate(ctx, svc, registered.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	// Anyone can own admin@evil.example; its local part must not take over admin
+	identity := ExternalIdentity{Issuer: "https://idp.example", Subject: "66", Username: "admin@evil.example"}
+	if _, err := svc.LoginExternal(ctx, identity, ExternalLoginOptions{LinkExisting: true}, Device{}); !errors.Is(err, ErrNoLinkedAccount) {
+		t.Fatalf("expected ErrNoLinkedAccount, got %v", err)
+	}
+	tokens, err := svc.LoginExternal(ctx, identity, ExternalLoginOptions{LinkExisting: true, AutoProvision: true}, Device{})
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, tokens.AccessToken)
+	if err != nil || claims.UserID == admin.UserID || claims.Username == "admin" {
+		t.Fatalf("expected a new user, got %+v, %v", claims, err)
+	}
+}
+
+func TestExternalUsername(t *testing.T) {
+	tests := map[string]string{
+		"alice":                                "alice",
+		"  alice smith ":                       "alice_smith",
+		"alice@example.com":                    "alice",
+		"al":                                   "",
+		"@example.com":                         "",
+		"abcdefghijklmnopqrstuvwxyz0123456789": "abcdefghijklmnopqrstuvwxyz012345",
+	}
+	for in, want := range tests {
+		if got := externalUsername(in); got != want {
+			t.Errorf("externalUsername(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
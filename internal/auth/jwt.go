@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -12,24 +13,87 @@ type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
 	IsGuest  bool   `json:"is_guest"`
+	// SessionID is the login session the token was issued for. Tokens minted
+	// elsewhere with the shared secret have none and cannot be revoked.
+	SessionID int64 `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // JWTConfig holds JWT configuration.
 type JWTConfig struct {
+	// Secret signs and verifies HS256 tokens. Empty rejects HS256 tokens, so
+	// tokens can only be minted by holders of Keys.
 	Secret   []byte
 	Issuer   string
 	Audience string
-	TTL      time.Duration
+	TTL      time.Duration // access token lifetime
+	// RefreshTTL is how long a session survives without a refresh; every refresh
+	// extends it. Zero means DefaultRefreshTTL.
+	RefreshTTL time.Duration
+	// Keys are the asymmetric keys tokens are verified with, matched by their
+	// "kid" header. Keep a retired key here until its tokens have expired.
+	Keys []*SigningKey
+	// SigningKeyID names the key of Keys new tokens are signed with.
+	// Empty signs with Secret (HS256).
+	SigningKeyID string
 }
 
-// GenerateToken creates a new JWT token for the given user.
-func GenerateToken(cfg *JWTConfig, userID int64, username string, isGuest bool) (string, error) {
+// Check reports configuration that cannot sign tokens.
+func (cfg *JWTConfig) Check() error {
+	seen := make(map[string]bool, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		if seen[k.ID] {
+			return fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+	}
+
+	if cfg.SigningKeyID == "" {
+		if len(cfg.Secret) == 0 {
+			return errors.New("neither a secret nor a signing key is configured")
+		}
+		return nil
+	}
+	k := cfg.key(cfg.SigningKeyID)
+	if k == nil {
+		return fmt.Errorf("signing key %q is not configured", cfg.SigningKeyID)
+	}
+	if !k.CanSign() {
+		return fmt.Errorf("signing key %q has no private key", cfg.SigningKeyID)
+	}
+	return nil
+}
+
+// key returns the key with the given id, or nil.
+func (cfg *JWTConfig) key(kid string) *SigningKey {
+	for _, k := range cfg.Keys {
+		if k.ID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// JWKS returns the public keys tokens are verified with. HS256 has none to publish.
+func (cfg *JWTConfig) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(cfg.Keys))}
+	for _, k := range cfg.Keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	return set
+}
+
+// DefaultRefreshTTL is the session lifetime used when JWTConfig.RefreshTTL is not set.
+const DefaultRefreshTTL = 30 * 24 * time.Hour
+
+// GenerateToken creates a new JWT access token for the given user and session.
+func GenerateToken(cfg *JWTConfig, userID int64, username string, isGuest bool, sessionID int64) (string, error) {
 	now := time.Now()
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		IsGuest:  isGuest,
+		UserID:    userID,
+		Username:  username,
+		IsGuest:   isGuest,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    cfg.Issuer,
 			Audience:  jwt.ClaimStrings{cfg.Audience},
@@ -38,17 +102,40 @@ func GenerateToken(cfg *JWTConfig, userID int64, username string, isGuest bool)
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(cfg.Secret)
+	if cfg.SigningKeyID == "" {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(cfg.Secret)
+	}
+
+	k := cfg.key(cfg.SigningKeyID)
+	if k == nil || !k.CanSign() {
+		return "", fmt.Errorf("signing key %q is not available", cfg.SigningKeyID)
+	}
+	token := jwt.NewWithClaims(k.Method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.private)
 }
 
 // ValidateToken parses and validates a JWT token.
 func ValidateToken(cfg *JWTConfig, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if len(cfg.Secret) == 0 {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return cfg.Secret, nil
+		}
+
+		// Pin the algorithm to the key, so a key is never used with another method
+		kid, _ := token.Header["kid"].(string)
+		k := cfg.key(kid)
+		if k == nil {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
 		}
-		return cfg.Secret, nil
+		return k.public, nil
 	})
 
 	if err != nil {
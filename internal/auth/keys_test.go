@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKeyPEM writes key as a PEM file and returns its path.
+func writeKeyPEM(t *testing.T, name string, key any) string {
+	t.Helper()
+
+	var block *pem.Block
+	switch key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("marshal public key: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return path
+}
+
+func TestSigningKeys_RotationAndAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+
+	oldKey, err := LoadSigningKey("2024-10", writeKeyPEM(t, "old.pem", rsaKey))
+	if err != nil {
+		t.Fatalf("load rsa key: %v", err)
+	}
+	newKey, err := LoadSigningKey("2025-01", writeKeyPEM(t, "new.pem", edKey))
+	if err != nil {
+		t.Fatalf("load ed25519 key: %v", err)
+	}
+	if oldKey.Method != jwt.SigningMethodRS256 || newKey.Method != jwt.SigningMethodEdDSA {
+		t.Fatalf("unexpected methods %s, %s", oldKey.Method.Alg(), newKey.Method.Alg())
+	}
+
+	cfg := &JWTConfig{
+		Secret:       []byte("legacy-secret"),
+		Audience:     "test",
+		TTL:          time.Hour,
+		Keys:         []*SigningKey{oldKey},
+		SigningKeyID: "2024-10",
+	}
+	if err := cfg.Check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	oldToken, err := GenerateToken(cfg, 1, "alice", false, 0)
+	if err != nil {
+		t.Fatalf("sign with rsa: %v", err)
+	}
+	legacyToken, err := GenerateToken(&JWTConfig{Secret: cfg.Secret, Audience: "test", TTL: time.Hour}, 1, "alice", false, 0)
+	if err != nil {
+		t.Fatalf("sign with secret: %v", err)
+	}
+
+	// Rotate: the new key signs, the old one only verifies until its tokens expire
+	oldPublic, err := LoadSigningKey("2024-10", writeKeyPEM(t, "old.pub.pem", &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatalf("load rsa public key: %v", err)
+	}
+	cfg.Keys = []*SigningKey{newKey, oldPublic}
+	cfg.SigningKeyID = "2025-01"
+	newToken, err := GenerateToken(cfg, 2, "bob", false, 0)
+	if err != nil {
+		t.Fatalf("sign with ed25519: %v", err)
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken, "legacy": legacyToken} {
+		if _, err := ValidateToken(cfg, token); err != nil {
+			t.Errorf("validate %s token: %v", name, err)
+		}
+	}
+
+	cfg.SigningKeyID = "2024-10"
+	if err := cfg.Check(); err == nil {
+		t.Error("expected a verify-only key to be rejected for signing")
+	}
+	cfg.SigningKeyID = "2025-01"
+
+	// Dropping the secret stops HS256 tokens, and unknown kids never verify
+	cfg.Secret = nil
+	if _, err := ValidateToken(cfg, legacyToken); err == nil {
+		t.Error("expected HS256 token to be rejected without a secret")
+	}
+	cfg.Keys = []*SigningKey{newKey}
+	if _, err := ValidateToken(cfg, oldToken); err == nil {
+		t.Error("expected token of a removed key to be rejected")
+	}
+
+	// The algorithm is pinned to the key named by kid
+	mislabeled := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{UserID: 3, Username: "mallory"})
+	mislabeled.Header["kid"] = "2025-01"
+	mislabeledToken, err := mislabeled.SignedString(rsaKey)
+	if err != nil {
+		t.Fatalf("sign mislabeled token: %v", err)
+	}
+	if _, err := ValidateToken(cfg, mislabeledToken); err == nil {
+		t.Error("expected a token with another key's algorithm to be rejected")
+	}
+}
+
+func TestJWKS_VerifiesTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	key, err := NewSigningKey("k1", rsaKey)
+	if err != nil {
+		t.Fatalf("new signing key: %v", err)
+	}
+	cfg := &JWTConfig{TTL: time.Hour, Keys: []*SigningKey{key}, SigningKeyID: "k1"}
+
+	set := cfg.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(set.Keys))
+	}
+	jwk := set.Keys[0]
+	if jwk.KeyType != "RSA" || jwk.KeyID != "k1" || jwk.Algorithm != "RS256" || jwk.Use != "sig" {
+		t.Fatalf("unexpected jwk %+v", jwk)
+	}
+
+	// A verifier that only has the JWKS can check our tokens
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		t.Fatalf("decode n: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		t.Fatalf("decode e: %v", err)
+	}
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	token, err := GenerateToken(cfg, 1, "alice", false, 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (any, error) {
+		if token.Header["kid"] != jwk.KeyID {
+			t.Errorf("unexpected kid %v", token.Header["kid"])
+		}
+		return public, nil
+	}, jwt.WithValidMethods([]string{jwk.Algorithm}))
+	if err != nil || parsed.Claims.(*Claims).Username != "alice" {
+		t.Fatalf("verify with jwks key: %v", err)
+	}
+
+	if _, err := NewSigningKey("weak", &rsa.PublicKey{N: big.NewInt(1 << 62), E: 65537}); err == nil {
+		t.Error("expected short rsa key to be rejected")
+	}
+}
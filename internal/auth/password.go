@@ -2,19 +2,113 @@ package auth
 
 import (
 	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vovakirdan/wirechat-server/internal/mail"
 )
 
 const (
 	// bcryptCost is the default cost for bcrypt hashing.
 	// Cost of 10 provides a good balance between security and performance.
 	bcryptCost = 10
+
+	// DefaultMinPasswordLength is the minimum password length when the policy sets none.
+	DefaultMinPasswordLength = 6
+	// maxPasswordBytes is the longest password bcrypt can hash.
+	maxPasswordBytes = 72
+
+	// DefaultResetTTL is how long a password reset link works when not configured.
+	DefaultResetTTL = time.Hour
 )
 
+// PasswordPolicy is what a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength int // in characters; 0 means DefaultMinPasswordLength
+	// MinClasses is how many of lowercase letters, uppercase letters, digits and
+	// other characters a password must mix.
+	MinClasses int
+	// RejectUsername rejects passwords that contain the username.
+	RejectUsername bool
+}
+
+// PasswordConfig holds password policy, hashing and reset settings.
+type PasswordConfig struct {
+	Policy PasswordPolicy
+	// BcryptCost is used for new hashes; 0 means the default. Existing hashes
+	// with another cost are rehashed on the next successful login.
+	BcryptCost int
+	ResetTTL   time.Duration // 0 means DefaultResetTTL
+	// ResetURL is the page reset links point to; the token is added as ?token=.
+	// Empty mails the bare token.
+	ResetURL string
+	Mailer   mail.Mailer // nil disables password resets
+}
+
+// PasswordPolicyError explains why a password was rejected. It matches ErrInvalidPassword.
+type PasswordPolicyError struct {
+	Reason string // e.g. "must be at least 8 characters"
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + e.Reason
+}
+
+// Is makes errors.Is(err, ErrInvalidPassword) hold for policy errors.
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrInvalidPassword
+}
+
+// Check reports whether password satisfies the policy for username.
+func (p PasswordPolicy) Check(password, username string) error {
+	minLength := p.MinLength
+	if minLength <= 0 {
+		minLength = DefaultMinPasswordLength
+	}
+	if utf8.RuneCountInString(password) < minLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at least %d characters", minLength)}
+	}
+	if len(password) > maxPasswordBytes {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at most %d bytes", maxPasswordBytes)}
+	}
+
+	if p.MinClasses > 1 {
+		var lower, upper, digit, other int
+		for _, r := range password {
+			switch {
+			case unicode.IsLower(r):
+				lower = 1
+			case unicode.IsUpper(r):
+				upper = 1
+			case unicode.IsDigit(r):
+				digit = 1
+			default:
+				other = 1
+			}
+		}
+		if lower+upper+digit+other < p.MinClasses {
+			return &PasswordPolicyError{Reason: fmt.Sprintf(
+				"must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)}
+		}
+	}
+
+	if p.RejectUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &PasswordPolicyError{Reason: "must not contain the username"}
+	}
+	return nil
+}
+
 // HashPassword generates a bcrypt hash of the password.
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return hashPassword(password, bcryptCost)
+}
+
+func hashPassword(password string, cost int) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", fmt.Errorf("hash password: %w", err)
 	}
@@ -25,3 +119,9 @@ func HashPassword(password string) (string, error) {
 func ComparePassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// needsRehash reports whether a hash was made with another cost than cost.
+func needsRehash(hashedPassword string, cost int) bool {
+	current, err := bcrypt.Cost([]byte(hashedPassword))
+	return err == nil && current != cost
+}
@@ -3,10 +3,12 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/vovakirdan/wirechat-server/internal/store"
 )
@@ -22,100 +24,149 @@ var (
 	ErrInvalidPassword = errors.New("invalid password")
 )
 
+// Store is the persistence the authentication service needs.
+type Store interface {
+	store.UserStore
+	store.SessionStore
+	store.IdentityStore
+	store.PasswordResetStore
+	store.LoginAuditStore
+}
+
 // Service provides authentication operations.
 type Service struct {
-	store     store.UserStore
+	store     Store
 	jwtConfig *JWTConfig
+	passwords PasswordConfig
+	throttle  *loginThrottle // nil when login throttling is off
+
+	hooksMu     sync.RWMutex
+	revokeHooks []func(sessionIDs []int64)
 }
 
 // NewService creates a new authentication service.
-func NewService(userStore store.UserStore, jwtConfig *JWTConfig) *Service {
+func NewService(st Store, jwtConfig *JWTConfig) *Service {
 	return &Service{
-		store:     userStore,
+		store:     st,
 		jwtConfig: jwtConfig,
 	}
 }
 
-// Register creates a new user with hashed password and returns a JWT token.
-func (s *Service) Register(ctx context.Context, username, password string) (string, error) {
+// SetPasswordConfig sets the password policy, hashing cost and reset settings.
+// Must be called before the service is used.
+func (s *Service) SetPasswordConfig(cfg PasswordConfig) {
+	s.passwords = cfg
+}
+
+// SetLoginThrottle enables backoff and lockout after failed logins.
+// Must be called before the service is used.
+func (s *Service) SetLoginThrottle(cfg LoginThrottleConfig) {
+	s.throttle = newLoginThrottle(cfg)
+}
+
+// bcryptCost returns the cost new password hashes are made with.
+func (s *Service) bcryptCost() int {
+	if s.passwords.BcryptCost > 0 {
+		return s.passwords.BcryptCost
+	}
+	return bcryptCost
+}
+
+// Register creates a new user with hashed password and signs them in on device.
+func (s *Service) Register(ctx context.Context, username, password string, device Device) (*Tokens, error) {
 	username = strings.TrimSpace(username)
 	if len(username) < 3 || len(username) > 32 {
-		return "", ErrInvalidUsername
+		return nil, ErrInvalidUsername
 	}
-	if len(password) < 6 {
-		return "", ErrInvalidPassword
+	if err := s.passwords.Policy.Check(password, username); err != nil {
+		return nil, err
 	}
 
 	// Check if user already exists
 	existing, err := s.store.GetUserByUsername(ctx, username)
 	if err == nil && existing != nil {
-		return "", ErrUserExists
+		return nil, ErrUserExists
 	}
 
 	// Hash password
-	hashedPassword, err := HashPassword(password)
+	hashedPassword, err := hashPassword(password, s.bcryptCost())
 	if err != nil {
-		return "", fmt.Errorf("hash password: %w", err)
+		return nil, fmt.Errorf("hash password: %w", err)
 	}
 
 	// Create user
 	user, err := s.store.CreateUser(ctx, username, hashedPassword)
 	if err != nil {
-		return "", fmt.Errorf("create user: %w", err)
+		return nil, fmt.Errorf("create user: %w", err)
 	}
 
-	// Generate JWT token
-	token, err := GenerateToken(s.jwtConfig, user.ID, user.Username, false)
-	if err != nil {
-		return "", fmt.Errorf("generate token: %w", err)
-	}
-
-	return token, nil
+	return s.startSession(ctx, user, device)
 }
 
-// Login validates credentials and returns a JWT token.
-func (s *Service) Login(ctx context.Context, username, password string) (string, error) {
+// Login validates credentials and starts a session on device. After repeated
+// failures for the username or device IP it returns a LoginThrottledError
+// without checking the password.
+func (s *Service) Login(ctx context.Context, username, password string, device Device) (*Tokens, error) {
+	// Normalize like Register, so variants of one name share a throttle count
+	username = truncateUsername(strings.TrimSpace(username), maxAuditUsername)
+	if err := s.throttle.check(username, device.IP); err != nil {
+		return nil, err
+	}
+
 	// Get user by username
 	user, err := s.store.GetUserByUsername(ctx, username)
 	if err != nil {
-		return "", ErrInvalidCredentials
+		if errors.Is(err, sql.ErrNoRows) {
+			s.loginFailed(ctx, username, nil, device, store.LoginFailureUnknownUser)
+		} else {
+			s.throttle.abort(username, device.IP)
+		}
+		return nil, ErrInvalidCredentials
 	}
 
 	// Compare password
 	if errPwd := ComparePassword(user.PasswordHash, password); errPwd != nil {
-		return "", ErrInvalidCredentials
+		s.loginFailed(ctx, username, &user.ID, device, store.LoginFailureBadPassword)
+		return nil, ErrInvalidCredentials
 	}
-
-	// Generate JWT token
-	token, err := GenerateToken(s.jwtConfig, user.ID, user.Username, false)
-	if err != nil {
-		return "", fmt.Errorf("generate token: %w", err)
+	s.throttle.success(username, device.IP)
+
+	// Upgrade hashes made with an outdated cost while the password is at hand
+	if needsRehash(user.PasswordHash, s.bcryptCost()) {
+		if rehashed, err := hashPassword(password, s.bcryptCost()); err == nil {
+			// Best effort: the old hash keeps working, the next login retries
+			_ = s.store.UpdatePasswordHash(ctx, user.ID, rehashed) //nolint:errcheck // see above
+		}
 	}
 
-	return token, nil
+	return s.startSession(ctx, user, device)
 }
 
-// CreateGuestUser creates a temporary guest user and returns a JWT token.
-func (s *Service) CreateGuestUser(ctx context.Context) (token, sessionID string, err error) {
+// CreateGuestUser creates a temporary guest user and starts a session for it.
+// guestID identifies the guest user for the guest_session cookie.
+func (s *Service) CreateGuestUser(ctx context.Context, device Device) (tokens *Tokens, guestID string, err error) {
 	// Generate random session ID
-	sessionID, err = generateSessionID()
+	guestID, err = generateSessionID()
 	if err != nil {
-		return "", "", fmt.Errorf("generate session ID: %w", err)
+		return nil, "", fmt.Errorf("generate session ID: %w", err)
 	}
 
 	// Create guest user
-	user, err := s.store.CreateGuestUser(ctx, sessionID)
+	user, err := s.store.CreateGuestUser(ctx, guestID)
 	if err != nil {
-		return "", "", fmt.Errorf("create guest user: %w", err)
+		return nil, "", fmt.Errorf("create guest user: %w", err)
 	}
 
-	// Generate JWT token
-	token, err = GenerateToken(s.jwtConfig, user.ID, user.Username, true)
+	tokens, err = s.startSession(ctx, user, device)
 	if err != nil {
-		return "", "", fmt.Errorf("generate token: %w", err)
+		return nil, "", err
 	}
+	return tokens, guestID, nil
+}
 
-	return token, sessionID, nil
+// JWKS returns the public keys tokens are verified with.
+func (s *Service) JWKS() JWKS {
+	return s.jwtConfig.JWKS()
 }
 
 // ValidateToken validates a JWT token and returns the claims.
@@ -21,8 +21,48 @@ func newTestAuthService(t *testing.T) *Service {
 			password_hash TEXT NOT NULL,
 			is_guest      BOOLEAN NOT NULL DEFAULT 0,
 			session_id    TEXT,
+			email         TEXT,
 			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
+		CREATE TABLE sessions (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id           INTEGER NOT NULL,
+			refresh_hash      TEXT NOT NULL UNIQUE,
+			prev_refresh_hash TEXT,
+			user_agent        TEXT NOT NULL DEFAULT '',
+			ip                TEXT NOT NULL DEFAULT '',
+			created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at        DATETIME NOT NULL,
+			revoked_at        DATETIME
+		);
+		CREATE TABLE password_resets (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			used_at    DATETIME
+		);
+		CREATE TABLE login_failures (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			username   TEXT NOT NULL,
+			user_id    INTEGER,
+			ip         TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			reason     TEXT NOT NULL,
+			locked     BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE user_identities (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id    INTEGER NOT NULL,
+			issuer     TEXT NOT NULL,
+			subject    TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (issuer, subject),
+			UNIQUE (user_id, issuer)
+		);
 		`
 		_, err := db.Exec(schema)
 		return err
@@ -46,12 +86,12 @@ func TestRegister_RejectsInvalidUsername(t *testing.T) {
 	svc := newTestAuthService(t)
 	ctx := context.Background()
 
-	if _, err := svc.Register(ctx, "ab", "password123"); !errors.Is(err, ErrInvalidUsername) {
+	if _, err := svc.Register(ctx, "ab", "password123", Device{}); !errors.Is(err, ErrInvalidUsername) {
 		t.Fatalf("expected ErrInvalidUsername, got %v", err)
 	}
 
 	// Should be validated after trimming whitespace.
-	if _, err := svc.Register(ctx, " ab ", "password123"); !errors.Is(err, ErrInvalidUsername) {
+	if _, err := svc.Register(ctx, " ab ", "password123", Device{}); !errors.Is(err, ErrInvalidUsername) {
 		t.Fatalf("expected ErrInvalidUsername, got %v", err)
 	}
 }
@@ -60,7 +100,7 @@ func TestRegister_RejectsInvalidPassword(t *testing.T) {
 	svc := newTestAuthService(t)
 	ctx := context.Background()
 
-	if _, err := svc.Register(ctx, "abc", "12345"); !errors.Is(err, ErrInvalidPassword) {
+	if _, err := svc.Register(ctx, "abc", "12345", Device{}); !errors.Is(err, ErrInvalidPassword) {
 		t.Fatalf("expected ErrInvalidPassword, got %v", err)
 	}
 }
@@ -69,16 +109,16 @@ func TestRegister_TrimsUsernameAndCreatesUser(t *testing.T) {
 	svc := newTestAuthService(t)
 	ctx := context.Background()
 
-	token, err := svc.Register(ctx, " alice ", "password123")
+	tokens, err := svc.Register(ctx, " alice ", "password123", Device{})
 	if err != nil {
 		t.Fatalf("expected registration success, got %v", err)
 	}
-	if token == "" {
-		t.Fatalf("expected non-empty token")
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("expected non-empty tokens")
 	}
 
 	// Should collide because the stored username is trimmed.
-	if _, err := svc.Register(ctx, "alice", "password123"); !errors.Is(err, ErrUserExists) {
+	if _, err := svc.Register(ctx, "alice", "password123", Device{}); !errors.Is(err, ErrUserExists) {
 		t.Fatalf("expected ErrUserExists, got %v", err)
 	}
 }
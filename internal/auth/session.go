@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired,
+	// revoked or was already used.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrSessionRevoked is returned when an access token's session is no longer active.
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrSessionNotFound is returned when a user has no active session with the given ID.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+const (
+	// refreshTokenBytes is the amount of randomness in a refresh token.
+	refreshTokenBytes = 32
+	// maxUserAgentLength bounds the user agent stored with a session.
+	maxUserAgentLength = 256
+)
+
+// Device describes the client a session is created from.
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+// Tokens is what a client receives when it signs in or refreshes: a short-lived
+// access token and the refresh token of its session.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration // access token lifetime
+	SessionID    int64
+}
+
+// newRefreshToken generates a refresh token and the hash stored in its place.
+func newRefreshToken() (token, hash string, err error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken returns the stored form of a refresh token.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) refreshTTL() time.Duration {
+	if s.jwtConfig.RefreshTTL > 0 {
+		return s.jwtConfig.RefreshTTL
+	}
+	return DefaultRefreshTTL
+}
+
+// startSession creates a session for the user and issues its first tokens.
+func (s *Service) startSession(ctx context.Context, user *store.User, device Device) (*Tokens, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	userAgent := device.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+	session := &store.Session{
+		UserID:      user.ID,
+		RefreshHash: hash,
+		UserAgent:   userAgent,
+		IP:          device.IP,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.refreshTTL()),
+	}
+	if err := s.store.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+
+	return s.issueTokens(user, session.ID, refreshToken)
+}
+
+// issueTokens signs an access token for the session and pairs it with refreshToken.
+func (s *Service) issueTokens(user *store.User, sessionID int64, refreshToken string) (*Tokens, error) {
+	accessToken, err := GenerateToken(s.jwtConfig, user.ID, user.Username, user.IsGuest, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.jwtConfig.TTL,
+		SessionID:    sessionID,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Every refresh token works once: presenting one that was already rotated out means
+// it leaked, so the whole session is revoked.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := hashRefreshToken(refreshToken)
+
+	session, err := s.store.FindSessionByRefreshHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("find session: %w", err)
+	}
+
+	now := time.Now()
+	if !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RefreshHash != hash {
+		// A replayed token: whoever holds the current one may be an attacker, so end the session.
+		if err := s.RevokeSession(ctx, session.UserID, session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, fmt.Errorf("revoke reused session: %w", err)
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.store.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+	rotated, err := s.store.RotateSession(ctx, session.ID, hash, newHash, now, now.Add(s.refreshTTL()))
+	if err != nil {
+		return nil, fmt.Errorf("rotate session: %w", err)
+	}
+	if !rotated {
+		// A concurrent refresh or a revocation won
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(user, session.ID, newToken)
+}
+
+// CheckSession returns ErrSessionRevoked unless the session the claims were issued
+// for is still active. Claims without a session always pass.
+func (s *Service) CheckSession(ctx context.Context, claims *Claims) error {
+	if claims.SessionID == 0 {
+		return nil
+	}
+	session, err := s.store.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSessionRevoked
+		}
+		return fmt.Errorf("get session: %w", err)
+	}
+	if session.UserID != claims.UserID || !session.Active(time.Now()) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// ListSessions lists a user's active sessions, most recently used first.
+func (s *Service) ListSessions(ctx context.Context, userID int64) ([]*store.Session, error) {
+	sessions, err := s.store.ListActiveSessions(ctx, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends one of a user's sessions, e.g. on logout.
+// Returns ErrSessionNotFound if the user has no such active session.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	revoked, err := s.store.RevokeSession(ctx, userID, sessionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	s.notifyRevoked([]int64{sessionID})
+	return nil
+}
+
+// RevokeOtherSessions ends all of a user's sessions except keepID (0 to end all of them).
+// Returns how many sessions were revoked.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, keepID int64) (int, error) {
+	ids, err := s.store.RevokeUserSessions(ctx, userID, keepID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("revoke sessions: %w", err)
+	}
+	if len(ids) > 0 {
+		s.notifyRevoked(ids)
+	}
+	return len(ids), nil
+}
+
+// OnSessionsRevoked registers fn to be called with the IDs of revoked sessions,
+// so live connections authenticated by them can be closed. fn must not block.
+func (s *Service) OnSessionsRevoked(fn func(sessionIDs []int64)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.revokeHooks = append(s.revokeHooks, fn)
+}
+
+func (s *Service) notifyRevoked(sessionIDs []int64) {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	for _, fn := range s.revokeHooks {
+		fn(sessionIDs)
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// authenticate validates an access token the way the HTTP middleware does.
+func authenticate(ctx context.Context, svc *Service, token string) (*Claims, error) {
+	claims, err := svc.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.CheckSession(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func TestRefresh_RotatesAndDetectsReuse(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+
+	var revoked []int64
+	svc.OnSessionsRevoked(func(ids []int64) { revoked = append(revoked, ids...) })
+
+	first, err := svc.Register(ctx, "alice", "password123", Device{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	second, err := svc.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a rotated token for the same session, got %+v", second)
+	}
+	claims, err := authenticate(ctx, svc, second.AccessToken)
+	if err != nil || claims.SessionID != first.SessionID || claims.Username != "alice" {
+		t.Fatalf("authenticate refreshed token: %+v, %v", claims, err)
+	}
+
+	// Replaying the rotated-out token ends the session for everyone
+	if _, err := svc.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken on reuse, got %v", err)
+	}
+	if len(revoked) != 1 || revoked[0] != first.SessionID {
+		t.Fatalf("expected session %d to be reported revoked, got %v", first.SessionID, revoked)
+	}
+	if _, err := svc.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken after revocation, got %v", err)
+	}
+	if _, err := authenticate(ctx, svc, second.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked, got %v", err)
+	}
+
+	if _, err := svc.Refresh(ctx, "not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken for unknown token, got %v", err)
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+
+	phone, err := svc.Register(ctx, "alice", "password123", Device{UserAgent: "phone"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	laptop, err := svc.Login(ctx, "alice", "password123", Device{UserAgent: "laptop"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	tablet, err := svc.Login(ctx, "alice", "password123", Device{UserAgent: "tablet"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	bob, err := svc.Register(ctx, "bob", "password123", Device{})
+	if err != nil {
+		t.Fatalf("register bob: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, phone.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	sessions, err := svc.ListSessions(ctx, claims.UserID)
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %d (%v)", len(sessions), err)
+	}
+
+	// Nobody can end someone else's session
+	if err := svc.RevokeSession(ctx, claims.UserID, bob.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := svc.RevokeSession(ctx, claims.UserID, laptop.SessionID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := authenticate(ctx, svc, laptop.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked, got %v", err)
+	}
+
+	n, err := svc.RevokeOtherSessions(ctx, claims.UserID, phone.SessionID)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 other session revoked, got %d (%v)", n, err)
+	}
+	if _, err := authenticate(ctx, svc, tablet.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked, got %v", err)
+	}
+	if _, err := authenticate(ctx, svc, phone.AccessToken); err != nil {
+		t.Fatalf("kept session should still work: %v", err)
+	}
+	if _, err := authenticate(ctx, svc, bob.AccessToken); err != nil {
+		t.Fatalf("other user's session should still work: %v", err)
+	}
+}
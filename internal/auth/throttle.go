@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// ErrLoginThrottled is matched by LoginThrottledError.
+var ErrLoginThrottled = errors.New("too many failed logins")
+
+const (
+	// minThrottleSweep is the entry count below which forgotten failures are not swept.
+	minThrottleSweep = 1024
+	// maxAuditUsername bounds the login usernames kept in memory and in the audit trail.
+	maxAuditUsername = 64
+	// inFlightRetry is the RetryAfter for attempts refused while earlier attempts
+	// are still being checked. A password comparison takes well under that.
+	inFlightRetry = time.Second
+)
+
+// LoginThrottleConfig controls the backoff and lockout after failed logins.
+// Failures are counted per username and per client IP.
+type LoginThrottleConfig struct {
+	// FreeAttempts is how many failures are allowed before logins are delayed.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure beyond FreeAttempts; it
+	// doubles with every further failure, up to MaxDelay. 0 never delays.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxFailures locks a username for LockoutDuration; 0 never locks.
+	MaxFailures int
+	// MaxFailuresPerIP locks a client IP for LockoutDuration; 0 never locks.
+	// Keep it well above MaxFailures, many users can share an IP.
+	MaxFailuresPerIP int
+	// LockoutDuration is how long a lockout lasts. Failures older than this
+	// are forgotten.
+	LockoutDuration time.Duration
+}
+
+// LoginThrottledError is returned when a login is refused without checking the
+// password, because of recent failures. It matches ErrLoginThrottled.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // reached MaxFailures or MaxFailuresPerIP, rather than backing off
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed logins, locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrLoginThrottled) hold for throttling errors.
+func (e *LoginThrottledError) Is(target error) bool {
+	return target == ErrLoginThrottled
+}
+
+// failureCount is the recent failed logins of one username or IP.
+type failureCount struct {
+	failures int
+	last     time.Time
+	inFlight int // attempts that passed check and are not settled yet
+}
+
+// loginThrottle tracks failed logins in memory. A nil throttle allows everything.
+type loginThrottle struct {
+	cfg LoginThrottleConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	counts  map[string]*failureCount // by "user:" or "ip:" key
+	sweepAt int
+}
+
+func newLoginThrottle(cfg LoginThrottleConfig) *loginThrottle {
+	return &loginThrottle{
+		cfg:     cfg,
+		now:     time.Now,
+		counts:  make(map[string]*failureCount),
+		sweepAt: minThrottleSweep,
+	}
+}
+
+// throttleKey is a username or IP that failures are counted for.
+type throttleKey struct {
+	key         string
+	maxFailures int
+	// serial makes attempts beyond FreeAttempts wait for the ones in flight.
+	// Not for IPs: many users can log in at once from one IP.
+	serial bool
+}
+
+func (t *loginThrottle) keys(username, ip string) []throttleKey {
+	keys := []throttleKey{{"user:" + username, t.cfg.MaxFailures, true}}
+	if ip != "" {
+		keys = append(keys, throttleKey{"ip:" + ip, t.cfg.MaxFailuresPerIP, false})
+	}
+	return keys
+}
+
+// check returns a LoginThrottledError if username or ip must not try to log in yet.
+// Otherwise it reserves the attempt, which must then be settled with failure,
+// success or release. Reserved attempts count as failures until they settle, so
+// a burst of concurrent attempts cannot slip past the limits.
+func (t *loginThrottle) check(username, ip string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	keys := t.keys(username, ip)
+	var worst *LoginThrottledError
+	for _, k := range keys {
+		wait, locked := t.wait(t.counts[k.key], k, now)
+		if wait > 0 && (worst == nil || wait > worst.RetryAfter) {
+			worst = &LoginThrottledError{RetryAfter: wait, Locked: locked}
+		}
+	}
+	if worst != nil {
+		return worst
+	}
+
+	if len(t.counts) >= t.sweepAt {
+		t.sweep(now)
+	}
+	for _, k := range keys {
+		c := t.counts[k.key]
+		if c == nil {
+			c = &failureCount{}
+			t.counts[k.key] = c
+		}
+		c.inFlight++
+	}
+	return nil
+}
+
+// failure counts a failed login. Returns true if it locked username or ip.
+func (t *loginThrottle) failure(username, ip string) (locked bool) {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if len(t.counts) >= t.sweepAt {
+		t.sweep(now)
+	}
+	for _, k := range t.keys(username, ip) {
+		c := t.counts[k.key]
+		if c == nil {
+			c = &failureCount{}
+			t.counts[k.key] = c
+		}
+		if t.forgotten(c, now) {
+			c.failures = 0
+		}
+		c.settle()
+		c.failures++
+		c.last = now
+		if k.maxFailures > 0 && c.failures == k.maxFailures {
+			locked = true
+		}
+	}
+	return locked
+}
+
+// success settles the attempt and forgets the failures of username. Failures of
+// the IP are kept, so one valid account does not reset the count for guessing others.
+func (t *loginThrottle) success(username, ip string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, k := range t.keys(username, ip) {
+		if c := t.counts[k.key]; c != nil {
+			if k.key == "user:"+username {
+				c.failures = 0
+			}
+			c.settle()
+		}
+	}
+	t.release(username, ip)
+}
+
+// abort settles an attempt that ended without checking the password, e.g. on a
+// store error. It counts neither as a failure nor as a success.
+func (t *loginThrottle) abort(username, ip string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, k := range t.keys(username, ip) {
+		if c := t.counts[k.key]; c != nil {
+			c.settle()
+		}
+	}
+	t.release(username, ip)
+}
+
+// release drops the entries of username and ip that hold nothing any more.
+func (t *loginThrottle) release(username, ip string) {
+	for _, k := range t.keys(username, ip) {
+		if c := t.counts[k.key]; c != nil && c.failures == 0 && c.inFlight == 0 {
+			delete(t.counts, k.key)
+		}
+	}
+}
+
+// settle ends one reserved attempt. Attempts that were never reserved (or whose
+// entry was replaced meanwhile) are ignored.
+func (c *failureCount) settle() {
+	if c.inFlight > 0 {
+		c.inFlight--
+	}
+}
+
+// wait returns how long c must wait before its next attempt, and whether that is a lockout.
+func (t *loginThrottle) wait(c *failureCount, k throttleKey, now time.Time) (time.Duration, bool) {
+	if c == nil {
+		return 0, false
+	}
+	failures := c.failures
+	if t.forgotten(c, now) {
+		failures = 0
+	}
+	if k.maxFailures > 0 && failures >= k.maxFailures {
+		return c.last.Add(t.cfg.LockoutDuration).Sub(now), true
+	}
+
+	// Should the attempts in flight all fail, would this one be over the limit,
+	// or delayed? Then it waits for them to settle.
+	if pending := failures + c.inFlight; c.inFlight > 0 {
+		if k.maxFailures > 0 && pending >= k.maxFailures {
+			return inFlightRetry, false
+		}
+		if k.serial && t.cfg.BaseDelay > 0 && t.cfg.MaxDelay > 0 && pending > t.cfg.FreeAttempts {
+			return inFlightRetry, false
+		}
+	}
+	if failures == 0 {
+		return 0, false
+	}
+
+	over := failures - t.cfg.FreeAttempts
+	if over <= 0 || t.cfg.BaseDelay <= 0 || t.cfg.MaxDelay <= 0 {
+		return 0, false
+	}
+	delay := t.cfg.MaxDelay
+	if over <= 30 { // beyond that the shift overflows
+		if d := t.cfg.BaseDelay << (over - 1); d > 0 && d < delay {
+			delay = d
+		}
+	}
+	if wait := c.last.Add(delay).Sub(now); wait > 0 {
+		return wait, false
+	}
+	return 0, false
+}
+
+func (t *loginThrottle) forgotten(c *failureCount, now time.Time) bool {
+	return now.Sub(c.last) >= t.cfg.LockoutDuration
+}
+
+// sweep drops forgotten failures. The next sweep happens once the map has doubled.
+func (t *loginThrottle) sweep(now time.Time) {
+	for key, c := range t.counts {
+		if c.inFlight == 0 && t.forgotten(c, now) {
+			delete(t.counts, key)
+		}
+	}
+	t.sweepAt = max(2*len(t.counts), minThrottleSweep)
+}
+
+// loginFailed counts a failed login towards throttling and adds it to the audit trail.
+func (s *Service) loginFailed(ctx context.Context, username string, userID *int64, device Device, reason store.LoginFailureReason) {
+	locked := s.throttle.failure(username, device.IP)
+	// Best effort: the login has failed either way
+	_ = s.store.RecordLoginFailure(ctx, &store.LoginFailure{ //nolint:errcheck // see above
+		Username:  username,
+		UserID:    userID,
+		IP:        device.IP,
+		UserAgent: device.UserAgent,
+		Reason:    reason,
+		Locked:    locked,
+		CreatedAt: time.Now(),
+	})
+}
+
+// ListLoginFailures lists the most recent failed logins on a user's account.
+func (s *Service) ListLoginFailures(ctx context.Context, userID int64, limit int) ([]*store.LoginFailure, error) {
+	failures, err := s.store.ListLoginFailures(ctx, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list login failures: %w", err)
+	}
+	return failures, nil
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	throttle := newLoginThrottle(LoginThrottleConfig{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		MaxFailures:      7,
+		MaxFailuresPerIP: 20,
+		LockoutDuration:  time.Minute,
+	})
+	throttle.now = func() time.Time { return now }
+
+	retryAfter := func(username, ip string) (time.Duration, bool) {
+		t.Helper()
+		err := throttle.check(username, ip)
+		if err == nil {
+			throttle.abort(username, ip) // only peeking
+			return 0, false
+		}
+		var throttled *LoginThrottledError
+		if !errors.As(err, &throttled) || !errors.Is(err, ErrLoginThrottled) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return throttled.RetryAfter, throttled.Locked
+	}
+
+	// Free attempts, then 1s, 2s, 4s, 4s (capped), then a lockout
+	for i, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if wait, _ := retryAfter("alice", "10.0.0.1"); wait != 0 {
+			t.Fatalf("failure %d: still throttled for %s", i, wait)
+		}
+		throttle.failure("alice", "10.0.0.1")
+		if wait, locked := retryAfter("alice", "10.0.0.1"); wait != want || locked {
+			t.Fatalf("after failure %d: expected %s, got %s (locked %v)", i+1, want, wait, locked)
+		}
+		now = now.Add(want)
+	}
+
+	// The IP is fine for other usernames
+	if wait, _ := retryAfter("bob", "10.0.0.1"); wait != 0 {
+		t.Fatalf("other username throttled for %s", wait)
+	}
+
+	if locked := throttle.failure("alice", "10.0.0.1"); !locked {
+		t.Fatal("expected the failure to lock the username")
+	}
+	if wait, locked := retryAfter("alice", "10.0.0.2"); wait != time.Minute || !locked {
+		t.Fatalf("expected a one minute lockout from any IP, got %s (locked %v)", wait, locked)
+	}
+
+	// The lockout ends and the failures are forgotten
+	now = now.Add(time.Minute)
+	if wait, _ := retryAfter("alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("still throttled after the lockout: %s", wait)
+	}
+	throttle.failure("alice", "10.0.0.1")
+	if wait, _ := retryAfter("alice", "10.0.0.1"); wait != 0 {
+		t.Fatalf("first failure after the lockout throttled for %s", wait)
+	}
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	throttle := newLoginThrottle(LoginThrottleConfig{
+		FreeAttempts:     100,
+		MaxFailures:      3,
+		MaxFailuresPerIP: 5,
+		LockoutDuration:  time.Minute,
+	})
+	throttle.now = func() time.Time { return now }
+
+	// Spraying one password over many usernames locks the IP
+	for i := 0; i < 5; i++ {
+		throttle.failure(string(rune('a'+i))+"-user", "10.0.0.1")
+	}
+	if err := throttle.check("zoe", "10.0.0.1"); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected the IP to be locked, got %v", err)
+	}
+	if err := throttle.check("zoe", "10.0.0.2"); err != nil {
+		t.Fatalf("other IP throttled: %v", err)
+	}
+	throttle.abort("zoe", "10.0.0.2")
+
+	// A success resets the username but not the IP
+	throttle.failure("carol", "10.0.0.3")
+	throttle.failure("carol", "10.0.0.4")
+	throttle.success("carol", "10.0.0.4")
+	throttle.failure("carol", "10.0.0.5")
+	throttle.failure("carol", "10.0.0.6")
+	if err := throttle.check("carol", "10.0.0.7"); err != nil {
+		t.Fatalf("username still counts failures from before its success: %v", err)
+	}
+	throttle.abort("carol", "10.0.0.7")
+	throttle.success("a-user", "10.0.0.1")
+	if err := throttle.check("zoe", "10.0.0.1"); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("a success unlocked the IP: %v", err)
+	}
+
+	// Successful logins settle their attempt on the IP too, so they never add up
+	for i := 0; i < 2*throttle.cfg.MaxFailuresPerIP; i++ {
+		if err := throttle.check("erin", "10.0.0.9"); err != nil {
+			t.Fatalf("login %d from a busy IP throttled: %v", i+1, err)
+		}
+		throttle.success("erin", "10.0.0.9")
+	}
+	if c := throttle.counts["ip:10.0.0.9"]; c != nil {
+		t.Fatalf("expected nothing left for the IP after successes, got %+v", c)
+	}
+
+	// Forgotten entries are swept once the map grows
+	now = now.Add(time.Minute)
+	throttle.sweepAt = 0
+	throttle.failure("dave", "10.0.0.8")
+	if len(throttle.counts) != 2 {
+		t.Fatalf("expected only dave's entries after the sweep, got %d", len(throttle.counts))
+	}
+}
+
+func TestLoginThrottledAndAudited(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+	svc.SetLoginThrottle(LoginThrottleConfig{FreeAttempts: 5, MaxFailures: 3, LockoutDuration: time.Hour})
+
+	registered, err := svc.Register(ctx, "alice", "password123", Device{})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	claims, err := authenticate(ctx, svc, registered.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	// A success in between resets the count. Padded usernames count as alice
+	device := Device{UserAgent: "curl", IP: "203.0.113.7"}
+	for i, password := range []string{"wrong", "wrong", "password123", "wrong", "wrong"} {
+		username := "alice"
+		if i%2 == 1 {
+			username = " alice "
+		}
+		_, err := svc.Login(ctx, username, password, device)
+		if password == "password123" && err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if password != "password123" && !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+	if _, err := svc.Login(ctx, "alice", "wrong", device); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected the third failure to be checked, got %v", err)
+	}
+
+	// Locked: even the right password is refused
+	if _, err := svc.Login(ctx, "alice", "password123", device); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected ErrLoginThrottled, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "nobody", "wrong", device); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: expected ErrInvalidCredentials, got %v", err)
+	}
+
+	failures, err := svc.ListLoginFailures(ctx, claims.UserID, 10)
+	if err != nil {
+		t.Fatalf("list login failures: %v", err)
+	}
+	if len(failures) != 5 {
+		t.Fatalf("expected 5 failures on alice's account, got %d", len(failures))
+	}
+	latest := failures[0]
+	if !latest.Locked || latest.Username != "alice" || latest.Reason != store.LoginFailureBadPassword || latest.IP != device.IP || latest.UserAgent != device.UserAgent {
+		t.Fatalf("unexpected latest failure %+v", latest)
+	}
+	for _, f := range failures[1:] {
+		if f.Locked || f.Username != "alice" {
+			t.Fatalf("expected an unlocked failure for alice: %+v", f)
+		}
+	}
+}
+
+func TestLoginThrottleConcurrentFailures(t *testing.T) {
+	svc := newTestAuthService(t)
+	ctx := context.Background()
+	svc.SetLoginThrottle(LoginThrottleConfig{FreeAttempts: 100, MaxFailures: 3, LockoutDuration: time.Hour})
+
+	if _, err := svc.Register(ctx, "alice", "password123", Device{}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	// Attempts in flight count as failures, so a burst cannot outrun the lockout
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Login(ctx, "alice", "wrong", Device{IP: "203.0.113.7"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	checked := 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			checked++
+		case !errors.Is(err, ErrLoginThrottled):
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if checked != 3 {
+		t.Fatalf("expected 3 passwords to be checked, got %d", checked)
+	}
+	if _, err := svc.Login(ctx, "alice", "password123", Device{}); !errors.Is(err, ErrLoginThrottled) {
+		t.Fatalf("expected alice to be locked, got %v", err)
+	}
+}
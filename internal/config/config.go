@@ -10,46 +10,175 @@ type LiveKitConfig struct {
 	WSURL     string `mapstructure:"ws_url" yaml:"ws_url"`
 }
 
+// JWTKeyConfig names a PEM key file for asymmetric JWT signing.
+type JWTKeyConfig struct {
+	ID   string `mapstructure:"kid" yaml:"kid"`
+	File string `mapstructure:"file" yaml:"file"` // private key (RSA or Ed25519), or public key to only verify
+}
+
+// OIDCConfig holds single sign-on settings for an OpenID Connect provider.
+type OIDCConfig struct {
+	Enabled      bool     `mapstructure:"enabled" yaml:"enabled"`
+	Issuer       string   `mapstructure:"issuer" yaml:"issuer"`
+	ClientID     string   `mapstructure:"client_id" yaml:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret" yaml:"client_secret"` // empty for public clients
+	RedirectURL  string   `mapstructure:"redirect_url" yaml:"redirect_url"`   // this server's /api/oidc/callback as registered at the provider
+	Scopes       []string `mapstructure:"scopes" yaml:"scopes"`
+	// UsernameClaim is the ID token claim new users are named after.
+	UsernameClaim string `mapstructure:"username_claim" yaml:"username_claim"`
+	// AutoProvision creates a user on first login; otherwise only linked users can sign in.
+	AutoProvision bool `mapstructure:"auto_provision" yaml:"auto_provision"`
+	// LinkExisting links a first login to the registered user whose username equals the claim exactly.
+	LinkExisting bool `mapstructure:"link_existing" yaml:"link_existing"`
+	// ClientRedirectURL receives the browser after login, with the tokens in the
+	// URL fragment. Empty answers the callback with JSON instead.
+	ClientRedirectURL string `mapstructure:"client_redirect_url" yaml:"client_redirect_url"`
+	// StateKey is the secret state cookies of logins in progress are sealed with.
+	// Every replica needs the same one. Empty uses jwt_secret.
+	StateKey string `mapstructure:"state_key" yaml:"state_key"`
+}
+
+// PasswordConfig holds password policy, hashing and reset settings.
+type PasswordConfig struct {
+	MinLength  int `mapstructure:"min_length" yaml:"min_length"`
+	MinClasses int `mapstructure:"min_classes" yaml:"min_classes"` // of lowercase, uppercase, digits and symbols
+	// RejectUsername rejects passwords that contain the username.
+	RejectUsername bool `mapstructure:"reject_username" yaml:"reject_username"`
+	// BcryptCost applies to new hashes; older hashes are upgraded on login.
+	BcryptCost int           `mapstructure:"bcrypt_cost" yaml:"bcrypt_cost"`
+	ResetTTL   time.Duration `mapstructure:"reset_ttl" yaml:"reset_ttl"`
+	// ResetURL is the client page reset links open, with ?token= added. Empty mails the bare token.
+	ResetURL string `mapstructure:"reset_url" yaml:"reset_url"`
+}
+
+// LoginProtectionConfig holds brute-force protection settings for password logins.
+// Failures are counted per username and per client IP.
+type LoginProtectionConfig struct {
+	Enabled      bool `mapstructure:"enabled" yaml:"enabled"`
+	FreeAttempts int  `mapstructure:"free_attempts" yaml:"free_attempts"` // failures before logins are delayed
+	// BaseDelay is the delay after the first failure beyond FreeAttempts; it doubles with every further failure.
+	BaseDelay        time.Duration `mapstructure:"base_delay" yaml:"base_delay"`
+	MaxDelay         time.Duration `mapstructure:"max_delay" yaml:"max_delay"`
+	MaxFailures      int           `mapstructure:"max_failures" yaml:"max_failures"`               // per username, then locked; 0 never locks
+	MaxFailuresPerIP int           `mapstructure:"max_failures_per_ip" yaml:"max_failures_per_ip"` // per client IP, then locked; 0 never locks
+	LockoutDuration  time.Duration `mapstructure:"lockout_duration" yaml:"lockout_duration"`       // also how long failures are remembered
+}
+
+// MailConfig holds outbound email settings.
+type MailConfig struct {
+	Backend string `mapstructure:"backend" yaml:"backend"` // "log", "file", or empty to disable email
+	Dir     string `mapstructure:"dir" yaml:"dir"`         // output directory of the file backend
+	From    string `mapstructure:"from" yaml:"from"`
+}
+
+// UploadsConfig holds file upload settings.
+type UploadsConfig struct {
+	Backend  string `mapstructure:"backend" yaml:"backend"` // storage backend, only "local" for now
+	Dir      string `mapstructure:"dir" yaml:"dir"`         // root directory of the local backend
+	MaxBytes int64  `mapstructure:"max_bytes" yaml:"max_bytes"`
+	// AllowedTypes lists accepted MIME types; "image/*" style wildcards match a whole type.
+	AllowedTypes []string `mapstructure:"allowed_types" yaml:"allowed_types"`
+}
+
 // Config holds server configuration values.
 type Config struct {
-	Addr                string        `mapstructure:"addr" yaml:"addr"`
-	DatabasePath        string        `mapstructure:"database_path" yaml:"database_path"`
-	ReadHeaderTimeout   time.Duration `mapstructure:"read_header_timeout" yaml:"read_header_timeout"`
-	ShutdownTimeout     time.Duration `mapstructure:"shutdown_timeout" yaml:"shutdown_timeout"`
-	MaxMessageBytes     int64         `mapstructure:"max_message_bytes" yaml:"max_message_bytes"`
-	RateLimitJoinPerMin int           `mapstructure:"rate_limit_join_per_min" yaml:"rate_limit_join_per_min"`
-	RateLimitMsgPerMin  int           `mapstructure:"rate_limit_msg_per_min" yaml:"rate_limit_msg_per_min"`
-	PingInterval        time.Duration `mapstructure:"ping_interval" yaml:"ping_interval"`
-	ClientIdleTimeout   time.Duration `mapstructure:"client_idle_timeout" yaml:"client_idle_timeout"`
-	JWTSecret           string        `mapstructure:"jwt_secret" yaml:"jwt_secret"`
-	JWTAudience         string        `mapstructure:"jwt_audience" yaml:"jwt_audience"`
-	JWTIssuer           string        `mapstructure:"jwt_issuer" yaml:"jwt_issuer"`
-	JWTRequired         bool          `mapstructure:"jwt_required" yaml:"jwt_required"`
-	LiveKit             LiveKitConfig `mapstructure:"livekit" yaml:"livekit"`
+	Addr                    string                `mapstructure:"addr" yaml:"addr"`
+	DatabasePath            string                `mapstructure:"database_path" yaml:"database_path"`
+	ReadHeaderTimeout       time.Duration         `mapstructure:"read_header_timeout" yaml:"read_header_timeout"`
+	ShutdownTimeout         time.Duration         `mapstructure:"shutdown_timeout" yaml:"shutdown_timeout"`
+	MaxMessageBytes         int64                 `mapstructure:"max_message_bytes" yaml:"max_message_bytes"`
+	RateLimitJoinPerMin     int                   `mapstructure:"rate_limit_join_per_min" yaml:"rate_limit_join_per_min"`
+	RateLimitMsgPerMin      int                   `mapstructure:"rate_limit_msg_per_min" yaml:"rate_limit_msg_per_min"`
+	RateLimitTypingPerMin   int                   `mapstructure:"rate_limit_typing_per_min" yaml:"rate_limit_typing_per_min"`
+	RateLimitPresencePerMin int                   `mapstructure:"rate_limit_presence_per_min" yaml:"rate_limit_presence_per_min"`
+	PingInterval            time.Duration         `mapstructure:"ping_interval" yaml:"ping_interval"`
+	ClientIdleTimeout       time.Duration         `mapstructure:"client_idle_timeout" yaml:"client_idle_timeout"`
+	ClientQueueSize         int                   `mapstructure:"client_queue_size" yaml:"client_queue_size"`
+	SlowConsumerPolicy      string                `mapstructure:"slow_consumer_policy" yaml:"slow_consumer_policy"` // "disconnect" or "gap"
+	JWTSecret               string                `mapstructure:"jwt_secret" yaml:"jwt_secret"`
+	JWTAudience             string                `mapstructure:"jwt_audience" yaml:"jwt_audience"`
+	JWTIssuer               string                `mapstructure:"jwt_issuer" yaml:"jwt_issuer"`
+	JWTRequired             bool                  `mapstructure:"jwt_required" yaml:"jwt_required"`
+	JWTKeys                 []JWTKeyConfig        `mapstructure:"jwt_keys" yaml:"jwt_keys"`
+	JWTSigningKey           string                `mapstructure:"jwt_signing_key" yaml:"jwt_signing_key"` // kid of jwt_keys to sign with; empty signs with jwt_secret
+	AccessTokenTTL          time.Duration         `mapstructure:"access_token_ttl" yaml:"access_token_ttl"`
+	RefreshTokenTTL         time.Duration         `mapstructure:"refresh_token_ttl" yaml:"refresh_token_ttl"`
+	LiveKit                 LiveKitConfig         `mapstructure:"livekit" yaml:"livekit"`
+	Uploads                 UploadsConfig         `mapstructure:"uploads" yaml:"uploads"`
+	OIDC                    OIDCConfig            `mapstructure:"oidc" yaml:"oidc"`
+	Password                PasswordConfig        `mapstructure:"password" yaml:"password"`
+	Mail                    MailConfig            `mapstructure:"mail" yaml:"mail"`
+	LoginProtection         LoginProtectionConfig `mapstructure:"login_protection" yaml:"login_protection"`
+	// TrustedProxies lists the proxies (IPs or CIDRs) whose X-Forwarded-For is
+	// believed when determining client IPs. Empty trusts none.
+	TrustedProxies []string `mapstructure:"trusted_proxies" yaml:"trusted_proxies"`
 }
 
 // Default returns configuration with reasonable starter defaults.
 func Default() Config {
 	return Config{
-		Addr:                ":8080",
-		DatabasePath:        "data/wirechat.db",
-		ReadHeaderTimeout:   5 * time.Second,
-		ShutdownTimeout:     5 * time.Second,
-		MaxMessageBytes:     1 << 20, // 1MB
-		RateLimitJoinPerMin: 60,
-		RateLimitMsgPerMin:  300,
-		PingInterval:        30 * time.Second,
-		ClientIdleTimeout:   90 * time.Second,                  // 3x ping interval - buffer for ping/pong cycles
-		JWTSecret:           "dev-secret-change-in-production", // IMPORTANT: Change in production!
-		JWTAudience:         "wirechat",
-		JWTIssuer:           "wirechat-server",
-		JWTRequired:         false,
+		Addr:                    ":8080",
+		DatabasePath:            "data/wirechat.db",
+		ReadHeaderTimeout:       5 * time.Second,
+		ShutdownTimeout:         5 * time.Second,
+		MaxMessageBytes:         1 << 20, // 1MB
+		RateLimitJoinPerMin:     60,
+		RateLimitMsgPerMin:      300,
+		RateLimitTypingPerMin:   60,
+		RateLimitPresencePerMin: 30,
+		PingInterval:            30 * time.Second,
+		ClientIdleTimeout:       90 * time.Second, // 3x ping interval - buffer for ping/pong cycles
+		ClientQueueSize:         64,
+		SlowConsumerPolicy:      "disconnect",
+		JWTSecret:               "dev-secret-change-in-production", // IMPORTANT: Change in production!
+		JWTAudience:             "wirechat",
+		JWTIssuer:               "wirechat-server",
+		JWTRequired:             false,
+		AccessTokenTTL:          15 * time.Minute,
+		RefreshTokenTTL:         30 * 24 * time.Hour, // sliding: every refresh extends the session
 		LiveKit: LiveKitConfig{
 			Enabled:   false,
 			APIKey:    "",
 			APISecret: "",
 			WSURL:     "ws://localhost:7880",
 		},
+		Uploads: UploadsConfig{
+			Backend:  "local",
+			Dir:      "data/uploads",
+			MaxBytes: 10 << 20, // 10MB
+			AllowedTypes: []string{
+				"image/*", "audio/*", "video/*",
+				"text/plain", "application/pdf", "application/zip",
+			},
+		},
+		OIDC: OIDCConfig{
+			Enabled:       false,
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "preferred_username",
+			AutoProvision: true,
+			LinkExisting:  false,
+		},
+		Password: PasswordConfig{
+			MinLength:  6,
+			MinClasses: 1,
+			BcryptCost: 10,
+			ResetTTL:   time.Hour,
+		},
+		Mail: MailConfig{
+			Backend: "", // disabled: password resets are unavailable
+			Dir:     "data/mail",
+			From:    "WireChat <noreply@localhost>",
+		},
+		LoginProtection: LoginProtectionConfig{
+			Enabled:          true,
+			FreeAttempts:     3,
+			BaseDelay:        time.Second,
+			MaxDelay:         time.Minute,
+			MaxFailures:      10,
+			MaxFailuresPerIP: 100,
+			LockoutDuration:  15 * time.Minute,
+		},
+		TrustedProxies: []string{"127.0.0.1", "::1"},
 	}
 }
 
@@ -79,12 +208,24 @@ func (c *Config) UpdateFrom(other *Config) {
 	if other.RateLimitMsgPerMin != 0 {
 		c.RateLimitMsgPerMin = other.RateLimitMsgPerMin
 	}
+	if other.RateLimitTypingPerMin != 0 {
+		c.RateLimitTypingPerMin = other.RateLimitTypingPerMin
+	}
+	if other.RateLimitPresencePerMin != 0 {
+		c.RateLimitPresencePerMin = other.RateLimitPresencePerMin
+	}
 	if other.PingInterval != 0 {
 		c.PingInterval = other.PingInterval
 	}
 	if other.ClientIdleTimeout != 0 {
 		c.ClientIdleTimeout = other.ClientIdleTimeout
 	}
+	if other.ClientQueueSize != 0 {
+		c.ClientQueueSize = other.ClientQueueSize
+	}
+	if other.SlowConsumerPolicy != "" {
+		c.SlowConsumerPolicy = other.SlowConsumerPolicy
+	}
 	if other.JWTSecret != "" {
 		c.JWTSecret = other.JWTSecret
 	}
@@ -97,6 +238,18 @@ func (c *Config) UpdateFrom(other *Config) {
 	if other.JWTRequired {
 		c.JWTRequired = other.JWTRequired
 	}
+	if len(other.JWTKeys) > 0 {
+		c.JWTKeys = other.JWTKeys
+	}
+	if other.JWTSigningKey != "" {
+		c.JWTSigningKey = other.JWTSigningKey
+	}
+	if other.AccessTokenTTL != 0 {
+		c.AccessTokenTTL = other.AccessTokenTTL
+	}
+	if other.RefreshTokenTTL != 0 {
+		c.RefreshTokenTTL = other.RefreshTokenTTL
+	}
 	// LiveKit config
 	if other.LiveKit.Enabled {
 		c.LiveKit.Enabled = other.LiveKit.Enabled
@@ -110,4 +263,105 @@ func (c *Config) UpdateFrom(other *Config) {
 	if other.LiveKit.WSURL != "" {
 		c.LiveKit.WSURL = other.LiveKit.WSURL
 	}
+	// Uploads config
+	if other.Uploads.Backend != "" {
+		c.Uploads.Backend = other.Uploads.Backend
+	}
+	if other.Uploads.Dir != "" {
+		c.Uploads.Dir = other.Uploads.Dir
+	}
+	if other.Uploads.MaxBytes != 0 {
+		c.Uploads.MaxBytes = other.Uploads.MaxBytes
+	}
+	if len(other.Uploads.AllowedTypes) > 0 {
+		c.Uploads.AllowedTypes = other.Uploads.AllowedTypes
+	}
+	// OIDC config
+	if other.OIDC.Enabled {
+		c.OIDC.Enabled = other.OIDC.Enabled
+	}
+	if other.OIDC.Issuer != "" {
+		c.OIDC.Issuer = other.OIDC.Issuer
+	}
+	if other.OIDC.ClientID != "" {
+		c.OIDC.ClientID = other.OIDC.ClientID
+	}
+	if other.OIDC.ClientSecret != "" {
+		c.OIDC.ClientSecret = other.OIDC.ClientSecret
+	}
+	if other.OIDC.RedirectURL != "" {
+		c.OIDC.RedirectURL = other.OIDC.RedirectURL
+	}
+	if len(other.OIDC.Scopes) > 0 {
+		c.OIDC.Scopes = other.OIDC.Scopes
+	}
+	if other.OIDC.UsernameClaim != "" {
+		c.OIDC.UsernameClaim = other.OIDC.UsernameClaim
+	}
+	if other.OIDC.AutoProvision {
+		c.OIDC.AutoProvision = other.OIDC.AutoProvision
+	}
+	if other.OIDC.LinkExisting {
+		c.OIDC.LinkExisting = other.OIDC.LinkExisting
+	}
+	if other.OIDC.ClientRedirectURL != "" {
+		c.OIDC.ClientRedirectURL = other.OIDC.ClientRedirectURL
+	}
+	if other.OIDC.StateKey != "" {
+		c.OIDC.StateKey = other.OIDC.StateKey
+	}
+	// Password config
+	if other.Password.MinLength != 0 {
+		c.Password.MinLength = other.Password.MinLength
+	}
+	if other.Password.MinClasses != 0 {
+		c.Password.MinClasses = other.Password.MinClasses
+	}
+	if other.Password.RejectUsername {
+		c.Password.RejectUsername = other.Password.RejectUsername
+	}
+	if other.Password.BcryptCost != 0 {
+		c.Password.BcryptCost = other.Password.BcryptCost
+	}
+	if other.Password.ResetTTL != 0 {
+		c.Password.ResetTTL = other.Password.ResetTTL
+	}
+	if other.Password.ResetURL != "" {
+		c.Password.ResetURL = other.Password.ResetURL
+	}
+	// Mail config
+	if other.Mail.Backend != "" {
+		c.Mail.Backend = other.Mail.Backend
+	}
+	if other.Mail.Dir != "" {
+		c.Mail.Dir = other.Mail.Dir
+	}
+	if other.Mail.From != "" {
+		c.Mail.From = other.Mail.From
+	}
+	// Login protection config
+	if other.LoginProtection.Enabled {
+		c.LoginProtection.Enabled = other.LoginProtection.Enabled
+	}
+	if other.LoginProtection.FreeAttempts != 0 {
+		c.LoginProtection.FreeAttempts = other.LoginProtection.FreeAttempts
+	}
+	if other.LoginProtection.BaseDelay != 0 {
+		c.LoginProtection.BaseDelay = other.LoginProtection.BaseDelay
+	}
+	if other.LoginProtection.MaxDelay != 0 {
+		c.LoginProtection.MaxDelay = other.LoginProtection.MaxDelay
+	}
+	if other.LoginProtection.MaxFailures != 0 {
+		c.LoginProtection.MaxFailures = other.LoginProtection.MaxFailures
+	}
+	if other.LoginProtection.MaxFailuresPerIP != 0 {
+		c.LoginProtection.MaxFailuresPerIP = other.LoginProtection.MaxFailuresPerIP
+	}
+	if other.LoginProtection.LockoutDuration != 0 {
+		c.LoginProtection.LockoutDuration = other.LoginProtection.LockoutDuration
+	}
+	if len(other.TrustedProxies) > 0 {
+		c.TrustedProxies = other.TrustedProxies
+	}
 }
@@ -31,12 +31,50 @@ func Load(logger *zerolog.Logger, explicitPath string) (*Config, string, error)
 	v.SetDefault("max_message_bytes", cfg.MaxMessageBytes)
 	v.SetDefault("rate_limit_join_per_min", cfg.RateLimitJoinPerMin)
 	v.SetDefault("rate_limit_msg_per_min", cfg.RateLimitMsgPerMin)
+	v.SetDefault("rate_limit_typing_per_min", cfg.RateLimitTypingPerMin)
+	v.SetDefault("rate_limit_presence_per_min", cfg.RateLimitPresencePerMin)
 	v.SetDefault("ping_interval", cfg.PingInterval)
 	v.SetDefault("client_idle_timeout", cfg.ClientIdleTimeout)
+	v.SetDefault("client_queue_size", cfg.ClientQueueSize)
+	v.SetDefault("slow_consumer_policy", cfg.SlowConsumerPolicy)
+	v.SetDefault("access_token_ttl", cfg.AccessTokenTTL)
+	v.SetDefault("refresh_token_ttl", cfg.RefreshTokenTTL)
 	v.SetDefault("livekit.enabled", cfg.LiveKit.Enabled)
 	v.SetDefault("livekit.api_key", cfg.LiveKit.APIKey)
 	v.SetDefault("livekit.api_secret", cfg.LiveKit.APISecret)
 	v.SetDefault("livekit.ws_url", cfg.LiveKit.WSURL)
+	v.SetDefault("uploads.backend", cfg.Uploads.Backend)
+	v.SetDefault("uploads.dir", cfg.Uploads.Dir)
+	v.SetDefault("uploads.max_bytes", cfg.Uploads.MaxBytes)
+	v.SetDefault("uploads.allowed_types", cfg.Uploads.AllowedTypes)
+	v.SetDefault("oidc.enabled", cfg.OIDC.Enabled)
+	v.SetDefault("oidc.issuer", cfg.OIDC.Issuer)
+	v.SetDefault("oidc.client_id", cfg.OIDC.ClientID)
+	v.SetDefault("oidc.client_secret", cfg.OIDC.ClientSecret)
+	v.SetDefault("oidc.redirect_url", cfg.OIDC.RedirectURL)
+	v.SetDefault("oidc.scopes", cfg.OIDC.Scopes)
+	v.SetDefault("oidc.username_claim", cfg.OIDC.UsernameClaim)
+	v.SetDefault("oidc.auto_provision", cfg.OIDC.AutoProvision)
+	v.SetDefault("oidc.link_existing", cfg.OIDC.LinkExisting)
+	v.SetDefault("oidc.client_redirect_url", cfg.OIDC.ClientRedirectURL)
+	v.SetDefault("oidc.state_key", cfg.OIDC.StateKey)
+	v.SetDefault("password.min_length", cfg.Password.MinLength)
+	v.SetDefault("password.min_classes", cfg.Password.MinClasses)
+	v.SetDefault("password.reject_username", cfg.Password.RejectUsername)
+	v.SetDefault("password.bcrypt_cost", cfg.Password.BcryptCost)
+	v.SetDefault("password.reset_ttl", cfg.Password.ResetTTL)
+	v.SetDefault("password.reset_url", cfg.Password.ResetURL)
+	v.SetDefault("mail.backend", cfg.Mail.Backend)
+	v.SetDefault("mail.dir", cfg.Mail.Dir)
+	v.SetDefault("mail.from", cfg.Mail.From)
+	v.SetDefault("login_protection.enabled", cfg.LoginProtection.Enabled)
+	v.SetDefault("login_protection.free_attempts", cfg.LoginProtection.FreeAttempts)
+	v.SetDefault("login_protection.base_delay", cfg.LoginProtection.BaseDelay)
+	v.SetDefault("login_protection.max_delay", cfg.LoginProtection.MaxDelay)
+	v.SetDefault("login_protection.max_failures", cfg.LoginProtection.MaxFailures)
+	v.SetDefault("login_protection.max_failures_per_ip", cfg.LoginProtection.MaxFailuresPerIP)
+	v.SetDefault("login_protection.lockout_duration", cfg.LoginProtection.LockoutDuration)
+	v.SetDefault("trusted_proxies", cfg.TrustedProxies)
 
 	v.SetEnvPrefix("WIRECHAT")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
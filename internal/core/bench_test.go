@@ -9,7 +9,7 @@ func benchmarkRoomBroadcast(b *testing.B, recipients int) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	hub := NewHub(nil, nil) // No store or call service needed for benchmark
+	hub := NewHub(nil, nil, nil) // No store or call service needed for benchmark
 	go hub.Run(ctx)
 
 	sender := NewClient("sender", "sender", 0, false)
@@ -1,28 +1,134 @@
 package core
 
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultQueueSize is the outbound event buffer of a client when none is configured.
+const DefaultQueueSize = 64
+
+// SlowConsumerPolicy decides what happens when a client's outbound queue is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerDisconnect signals the transport to close the connection,
+	// so the client reconnects and resumes from its last seen message.
+	SlowConsumerDisconnect SlowConsumerPolicy = iota
+	// SlowConsumerGap drops events and queues an EventGap once there is room again,
+	// telling the client which rooms to refetch.
+	SlowConsumerGap
+)
+
 // Client is a chat participant as seen by the core layer.
 type Client struct {
-	ID       string
-	UserID   int64 // Database user ID (0 for unauthenticated)
-	Name     string
-	IsGuest  bool
-	Commands chan *Command
-	Events   chan *Event
-	Rooms    map[string]struct{}
+	ID         string
+	UserID     int64 // Database user ID (0 for unauthenticated)
+	Name       string
+	IsGuest    bool
+	Commands   chan *Command
+	Events     chan *Event
+	Rooms      map[string]struct{}
+	SlowPolicy SlowConsumerPolicy
+
+	slow     chan struct{} // closed once the client overflows under SlowConsumerDisconnect
+	slowOnce sync.Once
+
+	// User the hub indexed the client under; only touched by the hub goroutine.
+	trackedUserID int64
+
+	// Pending gap under SlowConsumerGap; only touched by the hub goroutine.
+	gapDropped int
+	gapRooms   map[string]struct{}
 }
 
-// NewClient constructs a client with initialized channels.
+// NewClient constructs a client with initialized channels and the default queue size.
 func NewClient(id, name string, userID int64, isGuest bool) *Client {
+	return NewClientWithQueue(id, name, userID, isGuest, DefaultQueueSize)
+}
+
+// NewClientWithQueue constructs a client whose outbound queue holds queueSize events.
+// A non-positive queueSize falls back to DefaultQueueSize.
+func NewClientWithQueue(id, name string, userID int64, isGuest bool, queueSize int) *Client {
 	if name == "" {
 		name = id
 	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
 	return &Client{
 		ID:       id,
 		UserID:   userID,
 		Name:     name,
 		IsGuest:  isGuest,
 		Commands: make(chan *Command, 8),
-		Events:   make(chan *Event, 8),
+		Events:   make(chan *Event, queueSize),
 		Rooms:    make(map[string]struct{}),
+		slow:     make(chan struct{}),
+		gapRooms: make(map[string]struct{}),
+	}
+}
+
+// Slow is closed when the client fell behind under SlowConsumerDisconnect.
+// The transport should then close the connection.
+func (c *Client) Slow() <-chan struct{} {
+	return c.slow
+}
+
+// deliver queues an event without blocking. Every send from the hub goes through it,
+// so a client that stops reading cannot stall the hub. Returns false if the event was dropped because the queue is full.
+func (c *Client) deliver(event *Event) bool {
+	// A pending gap must reach the client before anything newer.
+	if !c.flushGap() {
+		c.recordDrop(event)
+		return false
+	}
+	select {
+	case c.Events <- event:
+		return true
+	default:
+		c.recordDrop(event)
+		return false
+	}
+}
+
+// recordDrop counts a dropped event and applies the client's slow-consumer policy.
+func (c *Client) recordDrop(event *Event) {
+	metrics.eventsDropped.Add(1)
+
+	if c.SlowPolicy == SlowConsumerGap {
+		c.gapDropped++
+		if event.Room != "" {
+			c.gapRooms[event.Room] = struct{}{}
+		}
+		return
+	}
+	c.slowOnce.Do(func() {
+		metrics.slowDisconnects.Add(1)
+		close(c.slow)
+	})
+}
+
+// flushGap queues the pending gap event, if any.
+// Returns true if no gap is pending afterwards.
+func (c *Client) flushGap() bool {
+	if c.gapDropped == 0 {
+		return true
+	}
+
+	rooms := make([]string, 0, len(c.gapRooms))
+	for room := range c.gapRooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	select {
+	case c.Events <- &Event{Kind: EventGap, Gap: &GapEvent{Rooms: rooms, Dropped: c.gapDropped}}:
+		metrics.gapsSent.Add(1)
+		c.gapDropped = 0
+		c.gapRooms = make(map[string]struct{})
+		return true
+	default:
+		return false
 	}
 }
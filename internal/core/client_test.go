@@ -0,0 +1,62 @@
+package core
+
+import "testing"
+
+func TestClientSlowConsumerDisconnect(t *testing.T) {
+	client := NewClientWithQueue("a", "alice", 0, false, 1)
+	room := NewRoom("general")
+	room.AddClient(client)
+
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general"})
+	select {
+	case <-client.Slow():
+		t.Fatal("client marked slow before its queue was full")
+	default:
+	}
+
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general"})
+	select {
+	case <-client.Slow():
+	default:
+		t.Fatal("expected client to be marked slow after overflow")
+	}
+}
+
+func TestClientSlowConsumerGap(t *testing.T) {
+	client := NewClientWithQueue("a", "alice", 0, false, 1)
+	client.SlowPolicy = SlowConsumerGap
+	room := NewRoom("general")
+	room.AddClient(client)
+
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general", Message: Message{ID: 1}})
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general", Message: Message{ID: 2}})
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general", Message: Message{ID: 3}})
+
+	if ev := <-client.Events; ev.Message.ID != 1 {
+		t.Fatalf("expected first message, got %+v", ev)
+	}
+
+	// The next delivery first queues the gap; the new event no longer fits and is dropped too.
+	room.Broadcast(&Event{Kind: EventRoomMessage, Room: "general", Message: Message{ID: 4}})
+	gap := <-client.Events
+	if gap.Kind != EventGap || gap.Gap == nil {
+		t.Fatalf("expected gap event, got %+v", gap)
+	}
+	if gap.Gap.Dropped != 2 || len(gap.Gap.Rooms) != 1 || gap.Gap.Rooms[0] != "general" {
+		t.Fatalf("unexpected gap: %+v", gap.Gap)
+	}
+
+	// With room in the queue again the pending gap for message 4 goes out on flush.
+	if !client.flushGap() {
+		t.Fatal("expected pending gap to be flushed")
+	}
+	if ev := <-client.Events; ev.Kind != EventGap || ev.Gap.Dropped != 1 {
+		t.Fatalf("expected second gap event, got %+v", ev)
+	}
+
+	select {
+	case <-client.Slow():
+		t.Fatal("gap policy must not disconnect the client")
+	default:
+	}
+}
@@ -10,6 +10,25 @@ const (
 	CommandJoinRoom
 	// CommandLeaveRoom unsubscribes the client from a room.
 	CommandLeaveRoom
+	// CommandIdentify tells the hub that the client has authenticated,
+	// so it can be reached by user-targeted events.
+	CommandIdentify
+	// CommandEditMessage replaces the text of a previously sent message.
+	CommandEditMessage
+	// CommandDeleteMessage removes a previously sent message.
+	CommandDeleteMessage
+	// CommandAddReaction adds the client's emoji reaction to a message.
+	CommandAddReaction
+	// CommandRemoveReaction removes the client's emoji reaction from a message.
+	CommandRemoveReaction
+	// CommandMarkRead records that the client has read a room up to Message.ID.
+	CommandMarkRead
+	// CommandTypingStart announces (or refreshes) that the client is typing in a room.
+	CommandTypingStart
+	// CommandTypingStop announces that the client stopped typing in a room.
+	CommandTypingStop
+	// CommandSetPresence sets the user's manual presence status (online/away/dnd).
+	CommandSetPresence
 
 	// Call commands
 	// CommandCallInvite initiates a call (direct or room).
@@ -30,7 +49,10 @@ const (
 type Command struct {
 	Kind    CommandKind
 	Room    string
-	Message Message
+	Message Message      // For edit/delete/reactions/read, Message.ID identifies the target message
+	Emoji   string       // For reaction commands
+	Status  string       // For presence commands
+	Since   int64        // For join: resume cursor, replay persisted messages with ID > Since
 	Call    *CallCommand // non-nil for call commands
 }
 
@@ -9,13 +9,20 @@ const (
 	ErrCodeNotInRoom     = "not_in_room"
 	ErrCodeBadRequest    = "bad_request"
 	ErrCodeUnauthorized  = "unauthorized"
+	ErrCodeForbidden     = "forbidden"
+	ErrCodeInternal      = "internal_error"
+	ErrCodeBanned        = "banned"
+	ErrCodeMuted         = "muted"
+
+	// Message-related error codes
+	ErrCodeMessageNotFound = "message_not_found"
 
 	// Call-related error codes
-	ErrCodeCallsDisabled = "calls_disabled"
-	ErrCodeCallNotFound  = "call_not_found"
-	ErrCodeCallEnded     = "call_ended"
+	ErrCodeCallsDisabled  = "calls_disabled"
+	ErrCodeCallNotFound   = "call_not_found"
+	ErrCodeCallEnded      = "call_ended"
 	ErrCodeNotParticipant = "not_participant"
-	ErrCodeCallError     = "call_error"
+	ErrCodeCallError      = "call_error"
 )
 
 var (
@@ -23,6 +30,11 @@ var (
 	ErrAlreadyJoined = errors.New("already joined")
 	ErrNotInRoom     = errors.New("not in room")
 	ErrBadRequest    = errors.New("bad request")
+	ErrForbidden     = errors.New("forbidden")
+
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrHubBusy is returned when the hub does not accept a request in time.
+	ErrHubBusy = errors.New("hub busy")
 )
 
 // CoreError wraps a code and human-readable message.
@@ -1,5 +1,7 @@
 package core
 
+import "time"
+
 // EventKind is a notification the core emits to clients.
 type EventKind int
 
@@ -14,6 +16,36 @@ const (
 	EventHistory
 	// EventError notifies clients about a domain error.
 	EventError
+	// EventMessageEdited notifies room members that a message was edited.
+	EventMessageEdited
+	// EventMessageDeleted notifies room members that a message was deleted.
+	EventMessageDeleted
+	// EventReactionUpdated notifies room members that a message's reactions changed.
+	EventReactionUpdated
+	// EventReadReceipt notifies that a user has read a room up to Message.ID.
+	EventReadReceipt
+	// EventUserTyping notifies room members that a user started typing.
+	EventUserTyping
+	// EventTypingStopped notifies room members that a user stopped typing (explicitly or by timeout).
+	EventTypingStopped
+	// EventPresenceChanged notifies friends that a user's presence status changed.
+	EventPresenceChanged
+	// EventMessageAck confirms to the sender that a message with a client_msg_id was accepted.
+	EventMessageAck
+	// EventMessageNack tells the sender that a message with a client_msg_id was rejected.
+	EventMessageNack
+	// EventGap tells a slow client that events were dropped and history must be refetched.
+	EventGap
+	// EventUserKicked notifies a room that a moderator removed a user from it.
+	EventUserKicked
+	// EventRoomUpdated notifies room members that the room's metadata changed.
+	EventRoomUpdated
+	// EventMessagePinned notifies room members that a message was pinned.
+	EventMessagePinned
+	// EventMessageUnpinned notifies room members that a message was unpinned.
+	EventMessageUnpinned
+	// EventMention notifies a user that a room message mentioned them.
+	EventMention
 
 	// Call events
 	// EventCallIncoming notifies target user(s) of an incoming call.
@@ -32,17 +64,72 @@ const (
 	EventCallParticipantLeft
 	// EventCallEnded notifies all participants that the call has ended.
 	EventCallEnded
+	// EventCallAnsweredElsewhere notifies a user's other devices that the call was accepted on another one.
+	EventCallAnsweredElsewhere
 )
 
 // Event is sent to clients to describe what happened in the system.
 type Event struct {
-	Kind     EventKind
-	Room     string
-	User     string
-	Message  Message
-	Messages []Message // For EventHistory
-	Error    *CoreError
-	Call     *CallEvent // non-nil for call events
+	Kind      EventKind
+	Room      string
+	User      string
+	UserID    int64 // acting user, set for events that identify users by ID
+	Message   Message
+	Messages  []Message // For EventHistory
+	Since     int64     // For EventHistory: resume cursor the replay starts after (0 for plain history)
+	HasMore   bool      // For EventHistory: another replay page follows
+	Truncated bool      // For EventHistory: the replay stopped early, fetch the rest over REST
+	Duplicate bool      // For EventMessageAck: the message had already been stored by an earlier send
+	Error     *CoreError
+	Call      *CallEvent     // non-nil for call events
+	Reaction  *ReactionEvent // non-nil for EventReactionUpdated
+	Presence  *PresenceEvent // non-nil for EventPresenceChanged
+	Gap       *GapEvent      // non-nil for EventGap
+	Kick      *KickEvent     // non-nil for EventUserKicked
+	RoomInfo  *RoomInfo      // non-nil for EventRoomUpdated
+	Mention   *MentionEvent  // non-nil for EventMention
+}
+
+// MentionEvent describes a stored mention of the receiving user.
+// Event.User is the message author and Event.Message the mentioning message.
+type MentionEvent struct {
+	ID   int64  // notification ID, used to mark it read
+	Kind string // "user" for @username, "room" for @room
+}
+
+// RoomInfo is a room's editable metadata after an update.
+// Event.User identifies who changed it.
+type RoomInfo struct {
+	Topic       string
+	Description string
+	AvatarURL   string
+}
+
+// KickEvent describes a moderator removing a user from a room.
+// Event.User and Event.UserID identify the removed user.
+type KickEvent struct {
+	By     string // moderator's username
+	Reason string
+	Banned bool // the user was banned, not just kicked
+}
+
+// GapEvent describes events a slow client missed.
+type GapEvent struct {
+	Rooms   []string // rooms whose events were dropped, sorted
+	Dropped int      // number of dropped events, including ones without a room
+}
+
+// PresenceEvent describes a user's new presence status.
+type PresenceEvent struct {
+	Status     string    // "online", "away", "dnd" or "offline"
+	LastSeenAt time.Time // set when Status is "offline"
+}
+
+// ReactionEvent describes a single reaction change.
+// The resulting totals are carried in Event.Message.Reactions.
+type ReactionEvent struct {
+	Emoji string
+	Added bool // false if the reaction was removed
 }
 
 // CallEvent holds data specific to call events.
@@ -11,18 +11,62 @@ import (
 type Hub interface {
 	RegisterClient(*Client)
 	UnregisterClient(*Client)
+	// BroadcastToRoom delivers an event to every client currently in the named room.
+	// Used by non-WebSocket entry points (e.g. REST) to notify live clients.
+	BroadcastToRoom(room string, event *Event)
+	// KickFromRoom delivers event to the named room, then unsubscribes every
+	// connection of userID from it. Used after a REST kick or ban.
+	// Unlike a broadcast a kick is never dropped: it waits for the hub until ctx
+	// is done or kickTimeout passes, and then returns ErrHubBusy.
+	KickFromRoom(ctx context.Context, room string, userID int64, event *Event) error
 	Run(ctx context.Context)
 }
 
 type coreHub struct {
-	register    chan *Client
+	register    chan clientRegistration
 	unregister  chan *Client
 	commands    chan clientCommand
+	broadcasts  chan roomBroadcast
+	kicks       chan roomKick
 	clients     map[*Client]struct{}
 	rooms       map[string]*Room
 	store       store.Store
-	userClients map[int64]*Client // Maps authenticated user IDs to their connected clients
-	callService CallService       // For processing call commands (nil if calls disabled)
+	userClients map[int64]map[*Client]struct{} // Maps authenticated user IDs to all their connected clients
+	callService CallService                    // For processing call commands (nil if calls disabled)
+	presence    PresenceService                // For online/away/offline tracking (nil if disabled)
+
+	// Typing indicators are ephemeral and live only in the hub, never in the store.
+	typing        map[typingKey]time.Time // deadline after which typing_stopped is emitted
+	typingTimeout time.Duration
+}
+
+// typingKey identifies one client typing in one room.
+type typingKey struct {
+	room   string
+	client *Client
+}
+
+// defaultTypingTimeout is how long a typing indicator lives without a refresh.
+const defaultTypingTimeout = 6 * time.Second
+
+// kickTimeout bounds how long KickFromRoom waits for the hub.
+const kickTimeout = 5 * time.Second
+
+const (
+	// joinHistoryLimit is how many recent messages a plain join receives.
+	joinHistoryLimit = 20
+	// resumePageSize is the number of messages per history event during a resume replay.
+	resumePageSize = 100
+	// maxReplayPages bounds a resume replay; the client fetches the rest over REST.
+	maxReplayPages = 10
+)
+
+// clientRegistration is a client to register. identified is read by the
+// registering goroutine: after that, the client's user fields belong to its
+// connection until it sends CommandIdentify.
+type clientRegistration struct {
+	client     *Client
+	identified bool
 }
 
 type clientCommand struct {
@@ -30,36 +74,63 @@ type clientCommand struct {
 	cmd    *Command
 }
 
+type roomBroadcast struct {
+	room  string
+	event *Event
+}
+
+type roomKick struct {
+	room   string
+	userID int64
+	event  *Event
+}
+
 // NewHub creates a new chat hub instance.
 // callSvc can be nil if calls are disabled.
-func NewHub(st store.Store, callSvc CallService) Hub {
+func NewHub(st store.Store, callSvc CallService, presenceSvc PresenceService) Hub {
 	return &coreHub{
-		register:    make(chan *Client, 16),
+		register:    make(chan clientRegistration, 16),
 		unregister:  make(chan *Client, 16),
 		commands:    make(chan clientCommand, 64),
+		broadcasts:  make(chan roomBroadcast, 64),
+		kicks:       make(chan roomKick, 16),
 		clients:     make(map[*Client]struct{}),
 		rooms:       make(map[string]*Room),
 		store:       st,
-		userClients: make(map[int64]*Client),
+		userClients: make(map[int64]map[*Client]struct{}),
 		callService: callSvc,
+		presence:    presenceSvc,
+
+		typing:        make(map[typingKey]time.Time),
+		typingTimeout: defaultTypingTimeout,
 	}
 }
 
 // Run starts the main event loop until context cancellation.
 func (h *coreHub) Run(ctx context.Context) {
+	typingSweep := time.NewTicker(h.typingTimeout / 4)
+	defer typingSweep.Stop()
+
 	for {
 		select {
-		case client := <-h.register:
-			h.clients[client] = struct{}{}
+		case reg := <-h.register:
+			h.clients[reg.client] = struct{}{}
 			// Track authenticated users by userID for targeted events (e.g., calls)
-			if client.UserID > 0 {
-				h.userClients[client.UserID] = client
+			if reg.identified {
+				h.trackUserClient(reg.client)
 			}
-			go h.consumeCommands(ctx, client)
+			go h.consumeCommands(ctx, reg.client)
 		case client := <-h.unregister:
 			h.removeClient(client)
 		case cmd := <-h.commands:
 			h.handleCommand(cmd.client, cmd.cmd)
+		case b := <-h.broadcasts:
+			h.broadcastToRoom(b.room, b.event)
+		case k := <-h.kicks:
+			h.kickFromRoom(k.room, k.userID, k.event)
+		case now := <-typingSweep.C:
+			h.expireTyping(now)
+			h.flushGaps()
 		case <-ctx.Done():
 			h.shutdown()
 			return
@@ -71,7 +142,7 @@ func (h *coreHub) Run(ctx context.Context) {
 // Non-blocking: если канал заполнен или hub остановлен, регистрация пропускается.
 func (h *coreHub) RegisterClient(client *Client) {
 	select {
-	case h.register <- client:
+	case h.register <- clientRegistration{client: client, identified: client.UserID > 0}:
 	default:
 		// Канал заполнен или hub остановлен - пропускаем регистрацию.
 	}
@@ -89,6 +160,32 @@ func (h *coreHub) UnregisterClient(client *Client) {
 	}
 }
 
+// BroadcastToRoom schedules an event for delivery to a room.
+// Non-blocking: если канал заполнен или hub остановлен, событие пропускается.
+func (h *coreHub) BroadcastToRoom(room string, event *Event) {
+	select {
+	case h.broadcasts <- roomBroadcast{room: room, event: event}:
+	default:
+		// Канал заполнен или hub остановлен - пропускаем событие.
+	}
+}
+
+// KickFromRoom schedules a user's removal from a room.
+// Блокирующий: кик нельзя потерять, иначе выгнанный пользователь продолжит
+// получать сообщения комнаты. Ожидание ограничено ctx и kickTimeout.
+func (h *coreHub) KickFromRoom(ctx context.Context, room string, userID int64, event *Event) error {
+	timer := time.NewTimer(kickTimeout)
+	defer timer.Stop()
+	select {
+	case h.kicks <- roomKick{room: room, userID: userID, event: event}:
+		return nil
+	case <-ctx.Done():
+		return ErrHubBusy
+	case <-timer.C:
+		return ErrHubBusy
+	}
+}
+
 func (h *coreHub) consumeCommands(ctx context.Context, client *Client) {
 	for {
 		select {
@@ -109,12 +206,30 @@ func (h *coreHub) consumeCommands(ctx context.Context, client *Client) {
 
 func (h *coreHub) handleCommand(client *Client, cmd *Command) {
 	switch cmd.Kind {
+	case CommandIdentify:
+		h.trackUserClient(client)
 	case CommandJoinRoom:
-		h.joinRoom(client, cmd.Room)
+		h.joinRoom(client, cmd.Room, cmd.Since)
 	case CommandLeaveRoom:
 		h.leaveRoom(client, cmd.Room)
 	case CommandSendRoomMessage:
 		h.sendRoomMessage(client, cmd)
+	case CommandEditMessage:
+		h.editMessage(client, cmd)
+	case CommandDeleteMessage:
+		h.deleteMessage(client, cmd)
+	case CommandAddReaction:
+		h.updateReaction(client, cmd, true)
+	case CommandRemoveReaction:
+		h.updateReaction(client, cmd, false)
+	case CommandMarkRead:
+		h.markRead(client, cmd)
+	case CommandSetPresence:
+		h.setPresence(client, cmd.Status)
+	case CommandTypingStart:
+		h.handleTyping(client, cmd.Room, true)
+	case CommandTypingStop:
+		h.handleTyping(client, cmd.Room, false)
 	// Call commands
 	case CommandCallInvite:
 		h.handleCallInvite(client, cmd.Call)
@@ -133,37 +248,138 @@ func (h *coreHub) handleCommand(client *Client, cmd *Command) {
 	}
 }
 
-// sendToUser sends an event to a specific user by their ID.
-// Returns true if the user is connected and the event was sent.
-func (h *coreHub) sendToUser(userID int64, event *Event) bool {
-	client, ok := h.userClients[userID]
+// trackUserClient indexes an authenticated client by its user ID.
+// A user may have several live connections (tabs, devices); all of them are kept.
+// A client is indexed once: later identifies are ignored.
+func (h *coreHub) trackUserClient(client *Client) {
+	if client.UserID <= 0 || client.trackedUserID != 0 {
+		return
+	}
+	if _, ok := h.clients[client]; !ok {
+		return // Already removed
+	}
+	client.trackedUserID = client.UserID
+	set, ok := h.userClients[client.UserID]
 	if !ok {
-		return false // User not connected
+		set = make(map[*Client]struct{})
+		h.userClients[client.UserID] = set
 	}
-	select {
-	case client.Events <- event:
-		return true
-	default:
-		return false // Channel full
+	set[client] = struct{}{}
+
+	// First connection of this user: they just came online.
+	if !ok && h.presence != nil && !client.IsGuest {
+		if h.presence.SetOnline(context.Background(), client.UserID) {
+			h.notifyPresence(client.UserID, client.Name, "online", time.Time{})
+		}
+	}
+}
+
+// untrackUserClient removes a client from the user index.
+// The user entry is dropped only when its last connection goes away.
+func (h *coreHub) untrackUserClient(client *Client) {
+	userID := client.trackedUserID
+	if userID <= 0 {
+		return
+	}
+	set, ok := h.userClients[userID]
+	if !ok {
+		return
+	}
+	delete(set, client)
+	if len(set) == 0 {
+		delete(h.userClients, userID)
+
+		// Last connection closed: the user is now offline.
+		if h.presence != nil && !client.IsGuest {
+			changed, err := h.presence.SetOffline(context.Background(), userID)
+			if changed || err != nil {
+				// Even if last_seen_at failed to persist, watchers must learn the user left.
+				h.notifyPresence(userID, client.Name, "offline", time.Now())
+			}
+		}
+	}
+}
+
+// setPresence applies a manual presence status requested by the client.
+func (h *coreHub) setPresence(client *Client, status string) {
+	if client.IsGuest || client.UserID == 0 || h.presence == nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Error: coreError(ErrCodeUnauthorized, "authentication required"),
+		})
+		return
+	}
+	changed, err := h.presence.SetStatus(context.Background(), client.UserID, status)
+	if err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Error: coreError(ErrCodeBadRequest, err.Error()),
+		})
+		return
+	}
+	if changed {
+		h.notifyPresence(client.UserID, client.Name, status, time.Time{})
 	}
 }
 
-func (h *coreHub) joinRoom(client *Client, roomName string) {
+// notifyPresence sends presence_changed to the user's watchers (friends)
+// and to the user's own connections so their devices stay in sync.
+func (h *coreHub) notifyPresence(userID int64, username, status string, lastSeen time.Time) {
+	event := &Event{
+		Kind:     EventPresenceChanged,
+		User:     username,
+		UserID:   userID,
+		Presence: &PresenceEvent{Status: status, LastSeenAt: lastSeen},
+	}
+	watchers, err := h.presence.ListWatchers(context.Background(), userID)
+	if err == nil {
+		for _, watcherID := range watchers {
+			h.sendToUser(watcherID, event)
+		}
+	}
+	h.sendToUser(userID, event)
+}
+
+// sendToUser sends an event to every connection of a specific user.
+// Returns true if the event was delivered to at least one connection.
+func (h *coreHub) sendToUser(userID int64, event *Event) bool {
+	return h.sendToUserExcept(userID, nil, event)
+}
+
+// sendToUserExcept sends an event to every connection of a user except the given client.
+// Returns true if the event was delivered to at least one connection.
+func (h *coreHub) sendToUserExcept(userID int64, except *Client, event *Event) bool {
+	delivered := false
+	for client := range h.userClients[userID] {
+		if client == except {
+			continue
+		}
+		if client.deliver(event) {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+// joinRoom subscribes the client to a room and sends it history.
+// With since > 0 every persisted message newer than since is replayed instead of
+// the latest page, so a reconnecting client does not miss anything.
+func (h *coreHub) joinRoom(client *Client, roomName string, since int64) {
 	if roomName == "" {
-		client.Events <- &Event{
+		client.deliver(&Event{
 			Kind:  EventError,
 			Room:  roomName,
 			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
-		}
+		})
 		return
 	}
 	room := h.ensureRoom(roomName)
 	if !room.AddClient(client) {
-		client.Events <- &Event{
+		client.deliver(&Event{
 			Kind:  EventError,
 			Room:  roomName,
 			Error: coreError(ErrCodeAlreadyJoined, ErrAlreadyJoined.Error()),
-		}
+		})
 		return
 	}
 	client.Rooms[roomName] = struct{}{}
@@ -180,59 +396,107 @@ func (h *coreHub) joinRoom(client *Client, roomName string) {
 		// Try to get room from database
 		dbRoom, err := h.store.GetRoomByName(ctx, roomName)
 		if err == nil {
-			// Room exists in database, fetch last 20 messages
-			messages, err := h.store.ListMessages(ctx, dbRoom.ID, 20, nil)
-			if err == nil && len(messages) > 0 {
-				// Convert store.Message to core.Message
-				coreMessages := make([]Message, 0, len(messages))
-				for _, msg := range messages {
-					// Get username for the message
-					user, err := h.store.GetUserByID(ctx, msg.UserID)
-					username := "unknown"
-					if err == nil {
-						username = user.Username
-					}
-
-					coreMessages = append(coreMessages, Message{
-						ID:        msg.ID,
-						Room:      roomName,
-						From:      username,
-						Text:      msg.Body,
-						CreatedAt: msg.CreatedAt,
-					})
-				}
+			if since > 0 {
+				h.replayHistory(ctx, client, dbRoom.ID, roomName, since)
+				return
+			}
 
+			// Room exists in database, fetch the latest messages
+			messages, err := h.store.ListMessages(ctx, dbRoom.ID, joinHistoryLimit, nil)
+			if err == nil && len(messages) > 0 {
 				// Send history event to this client only
-				client.Events <- &Event{
+				client.deliver(&Event{
 					Kind:     EventHistory,
 					Room:     roomName,
-					Messages: coreMessages,
-				}
+					Messages: h.historyFromStore(ctx, messages, roomName),
+				})
 			}
 		}
 		// Ignore errors - history is optional, don't fail join if history fetch fails
 	}
 }
 
+// replayHistory sends the persisted messages newer than since, oldest first,
+// in pages of resumePageSize. HasMore marks every page but the last, and the last
+// page always goes out (possibly empty) so the client knows the replay is complete.
+// Runs on the hub goroutine, so no live message can slip in between replay and broadcast.
+// To keep the hub responsive the replay stops after maxReplayPages, with Truncated
+// set on the last page, or as soon as the client's queue is full.
+func (h *coreHub) replayHistory(ctx context.Context, client *Client, roomID int64, roomName string, since int64) {
+	cursor := since
+	for page := 1; ; page++ {
+		messages, err := h.store.ListMessagesAfter(ctx, roomID, cursor, resumePageSize+1)
+		if err != nil {
+			client.deliver(&Event{
+				Kind:  EventError,
+				Room:  roomName,
+				Error: coreError(ErrCodeInternal, "failed to replay history"),
+			})
+			return
+		}
+
+		more := len(messages) > resumePageSize
+		if more {
+			messages = messages[:resumePageSize]
+		}
+
+		truncated := more && page == maxReplayPages
+		if !client.deliver(&Event{
+			Kind:      EventHistory,
+			Room:      roomName,
+			Messages:  h.historyFromStore(ctx, messages, roomName),
+			Since:     since,
+			HasMore:   more,
+			Truncated: truncated,
+		}) {
+			return // the slow-consumer policy has taken over
+		}
+		if !more || truncated {
+			return
+		}
+		cursor = messages[len(messages)-1].ID
+	}
+}
+
+// historyFromStore converts persisted messages for a history event.
+func (h *coreHub) historyFromStore(ctx context.Context, messages []*store.Message, roomName string) []Message {
+	coreMessages := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		// Get username for the message
+		user, err := h.store.GetUserByID(ctx, msg.UserID)
+		username := "unknown"
+		if err == nil {
+			username = user.Username
+		}
+
+		coreMessages = append(coreMessages, messageFromStore(msg, roomName, username))
+	}
+
+	h.attachReactions(ctx, coreMessages)
+	h.attachFiles(ctx, coreMessages)
+	return coreMessages
+}
+
 func (h *coreHub) leaveRoom(client *Client, roomName string) {
 	room, ok := h.rooms[roomName]
 	if !ok {
-		client.Events <- &Event{
+		client.deliver(&Event{
 			Kind:  EventError,
 			Room:  roomName,
 			Error: coreError(ErrCodeRoomNotFound, ErrRoomNotFound.Error()),
-		}
+		})
 		return
 	}
 	if !room.RemoveClient(client) {
-		client.Events <- &Event{
+		client.deliver(&Event{
 			Kind:  EventError,
 			Room:  roomName,
 			Error: coreError(ErrCodeNotInRoom, ErrNotInRoom.Error()),
-		}
+		})
 		return
 	}
 	delete(client.Rooms, roomName)
+	h.stopTyping(client, roomName)
 	h.broadcastToRoom(roomName, &Event{
 		Kind: EventUserLeft,
 		Room: roomName,
@@ -243,25 +507,86 @@ func (h *coreHub) leaveRoom(client *Client, roomName string) {
 	}
 }
 
+// kickFromRoom notifies the room (the kicked user included) and then
+// unsubscribes all of the user's connections from it.
+func (h *coreHub) kickFromRoom(roomName string, userID int64, event *Event) {
+	room, ok := h.rooms[roomName]
+	if !ok {
+		return
+	}
+	room.Broadcast(event)
+	for client := range h.userClients[userID] {
+		if !room.RemoveClient(client) {
+			continue
+		}
+		delete(client.Rooms, roomName)
+		h.stopTyping(client, roomName)
+	}
+	if room.Empty() {
+		delete(h.rooms, roomName)
+	}
+}
+
 func (h *coreHub) sendRoomMessage(client *Client, cmd *Command) {
 	if cmd.Room == "" {
-		client.Events <- &Event{
-			Kind:  EventError,
-			Room:  cmd.Room,
-			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
-		}
+		h.rejectMessage(client, cmd, ErrCodeBadRequest, ErrBadRequest.Error())
 		return
 	}
 	if _, ok := client.Rooms[cmd.Room]; !ok {
-		client.Events <- &Event{
-			Kind:  EventError,
-			Room:  cmd.Room,
-			Error: coreError(ErrCodeNotInRoom, ErrNotInRoom.Error()),
-		}
+		h.rejectMessage(client, cmd, ErrCodeNotInRoom, ErrNotInRoom.Error())
 		return
 	}
 
 	msg := cmd.Message
+	persist := !client.IsGuest && client.UserID > 0 && h.store != nil
+
+	// A retried send: acknowledge the stored copy instead of saving and broadcasting it again.
+	if persist && msg.ClientMsgID != "" {
+		existing, err := h.store.GetMessageByClientID(context.Background(), client.UserID, msg.ClientMsgID)
+		if err != nil {
+			h.rejectMessage(client, cmd, ErrCodeInternal, "failed to store message")
+			return
+		}
+		if existing != nil {
+			client.deliver(&Event{
+				Kind:      EventMessageAck,
+				Room:      cmd.Room,
+				Message:   Message{ID: existing.ID, Room: cmd.Room, CreatedAt: existing.CreatedAt, ClientMsgID: msg.ClientMsgID},
+				Duplicate: true,
+			})
+			return
+		}
+	}
+
+	// Rooms that exist only in memory have no posting rules and are not persisted
+	var room *store.Room
+	if h.store != nil {
+		if dbRoom, err := h.store.GetRoomByName(context.Background(), cmd.Room); err == nil {
+			room = dbRoom
+		}
+	}
+	if room != nil && !h.checkCanPost(client, cmd, room) {
+		return
+	}
+
+	if msg.ReplyTo > 0 && !h.validReplyTarget(cmd.Room, msg.ReplyTo) {
+		h.rejectMessage(client, cmd, ErrCodeMessageNotFound, "reply_to message not found in this room")
+		return
+	}
+
+	if len(msg.Attachments) > 0 {
+		if !persist || room == nil {
+			h.rejectMessage(client, cmd, ErrCodeBadRequest, "attachments need a signed-in user and a persisted room")
+			return
+		}
+		attachments, ok := h.loadAttachments(client.UserID, msg.Attachments)
+		if !ok {
+			h.rejectMessage(client, cmd, ErrCodeBadRequest, "attachment not found or already used")
+			return
+		}
+		msg.Attachments = attachments
+	}
+
 	if msg.CreatedAt.IsZero() {
 		msg.CreatedAt = time.Now()
 	}
@@ -271,12 +596,10 @@ func (h *coreHub) sendRoomMessage(client *Client, cmd *Command) {
 	msg.Room = cmd.Room
 
 	// Save to database if authenticated user and store is available
-	if !client.IsGuest && client.UserID > 0 && h.store != nil {
+	if persist {
 		ctx := context.Background()
 
-		// Get room from database to obtain room ID
-		room, err := h.store.GetRoomByName(ctx, cmd.Room)
-		if err == nil {
+		if room != nil {
 			// Room exists in database, save message
 			storeMsg := &store.Message{
 				RoomID:    room.ID,
@@ -284,21 +607,626 @@ func (h *coreHub) sendRoomMessage(client *Client, cmd *Command) {
 				Body:      msg.Text,
 				CreatedAt: msg.CreatedAt,
 			}
+			if msg.ReplyTo > 0 {
+				storeMsg.ReplyTo = &msg.ReplyTo
+			}
+			if msg.ClientMsgID != "" {
+				storeMsg.ClientMsgID = &msg.ClientMsgID
+			}
+			for _, a := range msg.Attachments {
+				storeMsg.AttachmentIDs = append(storeMsg.AttachmentIDs, a.ID)
+			}
 
 			if err := h.store.SaveMessage(ctx, storeMsg); err == nil {
 				// Message saved successfully, use real ID from database
 				msg.ID = storeMsg.ID
+			} else if msg.ClientMsgID != "" || len(msg.Attachments) > 0 {
+				// The sender asked for delivery confirmation, or the attachments were
+				// not linked: let it retry instead of broadcasting a message that was
+				// never stored.
+				h.rejectMessage(client, cmd, ErrCodeInternal, "failed to store message")
+				return
 			}
 			// If save fails, continue with ID=0 (message will still be broadcast)
 		}
 		// If room not found in database, continue without saving (in-memory only room)
 	}
 
+	// Sending a message implicitly ends the sender's typing indicator.
+	h.stopTyping(client, cmd.Room)
+
 	h.broadcastToRoom(cmd.Room, &Event{
 		Kind:    EventRoomMessage,
 		Room:    cmd.Room,
 		Message: msg,
 	})
+
+	if msg.ClientMsgID != "" {
+		client.deliver(&Event{
+			Kind:    EventMessageAck,
+			Room:    cmd.Room,
+			Message: Message{ID: msg.ID, Room: cmd.Room, CreatedAt: msg.CreatedAt, ClientMsgID: msg.ClientMsgID},
+		})
+	}
+
+	if msg.ID > 0 && room != nil {
+		h.notifyMentions(client, room, msg)
+	}
+}
+
+// notifyMentions stores a mention for every room member the message pings and
+// sends each of them an EventMention, whether or not they joined the room over
+// WebSocket. Only members are notified; the author never is. Best-effort: the
+// message has already been delivered.
+func (h *coreHub) notifyMentions(client *Client, room *store.Room, msg Message) {
+	usernames, all := parseMentions(msg.Text)
+	if len(usernames) == 0 && !all {
+		return
+	}
+
+	ctx := context.Background()
+	kinds := make(map[int64]store.MentionKind)
+	if all {
+		members, err := h.store.ListMembers(ctx, room.ID)
+		if err != nil {
+			return
+		}
+		for _, memberID := range members {
+			kinds[memberID] = store.MentionRoom
+		}
+	}
+	for _, username := range usernames {
+		user, err := h.store.GetUserByUsername(ctx, username)
+		if err != nil {
+			continue
+		}
+		if member, err := h.store.IsMember(ctx, user.ID, room.ID); err != nil || !member {
+			continue
+		}
+		// A direct mention wins over @room
+		kinds[user.ID] = store.MentionUser
+	}
+	delete(kinds, client.UserID)
+	if len(kinds) == 0 {
+		return
+	}
+
+	mentions := make([]*store.Mention, 0, len(kinds))
+	for userID, kind := range kinds {
+		mentions = append(mentions, &store.Mention{
+			UserID:    userID,
+			MessageID: msg.ID,
+			RoomID:    room.ID,
+			AuthorID:  client.UserID,
+			Kind:      kind,
+			CreatedAt: msg.CreatedAt,
+		})
+	}
+	if err := h.store.CreateMentions(ctx, mentions); err != nil {
+		return
+	}
+
+	for _, m := range mentions {
+		if m.ID == 0 {
+			// Already stored for this message
+			continue
+		}
+		h.sendToUser(m.UserID, &Event{
+			Kind:    EventMention,
+			Room:    msg.Room,
+			User:    client.Name,
+			UserID:  client.UserID,
+			Message: msg,
+			Mention: &MentionEvent{ID: m.ID, Kind: string(m.Kind)},
+		})
+	}
+}
+
+// checkCanPost enforces posting rules in a persisted room: channels only accept
+// posts from members whose role grants RoomPermPublish, and muted users cannot
+// post anywhere. Rejects the send and returns false if the client may not post.
+func (h *coreHub) checkCanPost(client *Client, cmd *Command, room *store.Room) bool {
+	ctx := context.Background()
+	if room.Type == store.RoomTypeChannel {
+		var role store.RoomRole
+		if client.UserID > 0 {
+			var err error
+			if role, err = h.store.GetMemberRole(ctx, client.UserID, room.ID); err != nil {
+				h.rejectMessage(client, cmd, ErrCodeInternal, "failed to check room role")
+				return false
+			}
+		}
+		if !role.Can(store.RoomPermPublish) {
+			h.rejectMessage(client, cmd, ErrCodeForbidden, "only channel publishers can post")
+			return false
+		}
+	}
+	if client.UserID > 0 {
+		mute, err := h.store.GetActiveMute(ctx, client.UserID, room.ID, time.Now())
+		if err != nil {
+			h.rejectMessage(client, cmd, ErrCodeInternal, "failed to check mute")
+			return false
+		}
+		if mute != nil {
+			h.rejectMessage(client, cmd, ErrCodeMuted, "muted until "+mute.ExpiresAt.UTC().Format(time.RFC3339))
+			return false
+		}
+	}
+	return true
+}
+
+// rejectMessage reports a failed send. Messages carrying a client_msg_id get a
+// nack the sender can match to its pending send; others get a plain error.
+func (h *coreHub) rejectMessage(client *Client, cmd *Command, code, message string) {
+	if cmd.Message.ClientMsgID == "" {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(code, message),
+		})
+		return
+	}
+	client.deliver(&Event{
+		Kind:    EventMessageNack,
+		Room:    cmd.Room,
+		Message: Message{Room: cmd.Room, ClientMsgID: cmd.Message.ClientMsgID},
+		Error:   coreError(code, message),
+	})
+}
+
+// validReplyTarget reports whether parentID is a live persisted message in the named room.
+func (h *coreHub) validReplyTarget(roomName string, parentID int64) bool {
+	if h.store == nil {
+		return false
+	}
+	ctx := context.Background()
+	room, err := h.store.GetRoomByName(ctx, roomName)
+	if err != nil {
+		return false
+	}
+	parent, err := h.store.GetMessage(ctx, parentID)
+	if err != nil {
+		return false
+	}
+	return parent.RoomID == room.ID && parent.DeletedAt == nil
+}
+
+// loadAttachments resolves the uploads a user wants to share in a new message.
+// Fails if any of them is missing, belongs to someone else or is already in use.
+func (h *coreHub) loadAttachments(userID int64, refs []Attachment) ([]Attachment, bool) {
+	ctx := context.Background()
+	seen := make(map[int64]bool, len(refs))
+	attachments := make([]Attachment, 0, len(refs))
+	for _, ref := range refs {
+		if seen[ref.ID] {
+			return nil, false
+		}
+		seen[ref.ID] = true
+
+		a, err := h.store.GetAttachment(ctx, ref.ID)
+		if err != nil || a.UserID != userID || a.MessageID != nil {
+			return nil, false
+		}
+		attachments = append(attachments, attachmentFromStore(a))
+	}
+	return attachments, true
+}
+
+// attachmentFromStore converts attachment metadata into the core domain model.
+func attachmentFromStore(a *store.Attachment) Attachment {
+	return Attachment{ID: a.ID, Filename: a.Filename, ContentType: a.ContentType, Size: a.Size}
+}
+
+// messageFromStore converts a persisted message into the core domain model.
+func messageFromStore(msg *store.Message, roomName, username string) Message {
+	m := Message{
+		ID:        msg.ID,
+		Room:      roomName,
+		From:      username,
+		Text:      msg.Body,
+		CreatedAt: msg.CreatedAt,
+		Deleted:   msg.DeletedAt != nil,
+	}
+	if msg.EditedAt != nil {
+		m.EditedAt = *msg.EditedAt
+	}
+	if msg.ReplyTo != nil {
+		m.ReplyTo = *msg.ReplyTo
+	}
+	return m
+}
+
+// loadRoomMessage validates an edit/delete command and returns the target message.
+// Sends an error event to the client and returns nil if the command cannot proceed.
+func (h *coreHub) loadRoomMessage(ctx context.Context, client *Client, cmd *Command) (*store.Room, *store.Message) {
+	if cmd.Room == "" || cmd.Message.ID <= 0 {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
+		})
+		return nil, nil
+	}
+	if client.IsGuest || client.UserID == 0 || h.store == nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeUnauthorized, "authentication required"),
+		})
+		return nil, nil
+	}
+	if _, ok := client.Rooms[cmd.Room]; !ok {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeNotInRoom, ErrNotInRoom.Error()),
+		})
+		return nil, nil
+	}
+
+	room, err := h.store.GetRoomByName(ctx, cmd.Room)
+	if err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeRoomNotFound, ErrRoomNotFound.Error()),
+		})
+		return nil, nil
+	}
+	msg, err := h.store.GetMessage(ctx, cmd.Message.ID)
+	if err != nil || msg.RoomID != room.ID || msg.DeletedAt != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeMessageNotFound, ErrMessageNotFound.Error()),
+		})
+		return nil, nil
+	}
+	return room, msg
+}
+
+// editMessage replaces the text of a message. Only the author may edit.
+func (h *coreHub) editMessage(client *Client, cmd *Command) {
+	if cmd.Message.Text == "" {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
+		})
+		return
+	}
+	ctx := context.Background()
+	_, msg := h.loadRoomMessage(ctx, client, cmd)
+	if msg == nil {
+		return
+	}
+	if msg.UserID != client.UserID {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeForbidden, "only the author can edit a message"),
+		})
+		return
+	}
+
+	editedAt := time.Now()
+	if err := h.store.EditMessage(ctx, msg.ID, cmd.Message.Text, editedAt); err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeMessageNotFound, ErrMessageNotFound.Error()),
+		})
+		return
+	}
+
+	h.broadcastToRoom(cmd.Room, &Event{
+		Kind: EventMessageEdited,
+		Room: cmd.Room,
+		Message: Message{
+			ID:        msg.ID,
+			Room:      cmd.Room,
+			From:      client.Name,
+			Text:      cmd.Message.Text,
+			CreatedAt: msg.CreatedAt,
+			EditedAt:  editedAt,
+		},
+	})
+}
+
+// deleteMessage soft-deletes a message. The author may delete, and so may
+// anyone whose room role grants RoomPermDeleteMessages.
+func (h *coreHub) deleteMessage(client *Client, cmd *Command) {
+	ctx := context.Background()
+	room, msg := h.loadRoomMessage(ctx, client, cmd)
+	if msg == nil {
+		return
+	}
+	if msg.UserID != client.UserID {
+		role, err := h.store.GetMemberRole(ctx, client.UserID, room.ID)
+		if err != nil {
+			client.deliver(&Event{
+				Kind:  EventError,
+				Room:  cmd.Room,
+				Error: coreError(ErrCodeInternal, "failed to check room role"),
+			})
+			return
+		}
+		if !role.Can(store.RoomPermDeleteMessages) {
+			client.deliver(&Event{
+				Kind:  EventError,
+				Room:  cmd.Room,
+				Error: coreError(ErrCodeForbidden, "only the author or a room moderator can delete a message"),
+			})
+			return
+		}
+	}
+
+	if err := h.store.DeleteMessage(ctx, msg.ID, time.Now()); err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeMessageNotFound, ErrMessageNotFound.Error()),
+		})
+		return
+	}
+
+	h.broadcastToRoom(cmd.Room, &Event{
+		Kind: EventMessageDeleted,
+		Room: cmd.Room,
+		User: client.Name,
+		Message: Message{
+			ID:      msg.ID,
+			Room:    cmd.Room,
+			Deleted: true,
+		},
+	})
+}
+
+// updateReaction adds or removes the client's emoji reaction on a message
+// and broadcasts the new totals to the room.
+func (h *coreHub) updateReaction(client *Client, cmd *Command, add bool) {
+	if cmd.Emoji == "" {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
+		})
+		return
+	}
+	ctx := context.Background()
+	_, msg := h.loadRoomMessage(ctx, client, cmd)
+	if msg == nil {
+		return
+	}
+
+	var changed bool
+	var err error
+	if add {
+		changed, err = h.store.AddReaction(ctx, msg.ID, client.UserID, cmd.Emoji)
+	} else {
+		changed, err = h.store.RemoveReaction(ctx, msg.ID, client.UserID, cmd.Emoji)
+	}
+	if err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeInternal, "failed to update reaction"),
+		})
+		return
+	}
+	if !changed {
+		// Idempotent: nothing to announce.
+		return
+	}
+
+	reactions := []Message{{ID: msg.ID, Room: cmd.Room}}
+	h.attachReactions(ctx, reactions)
+
+	h.broadcastToRoom(cmd.Room, &Event{
+		Kind:     EventReactionUpdated,
+		Room:     cmd.Room,
+		User:     client.Name,
+		Message:  reactions[0],
+		Reaction: &ReactionEvent{Emoji: cmd.Emoji, Added: add},
+	})
+}
+
+// markRead advances the client's read position in a room.
+// The reader's other devices are notified so they can clear unread badges;
+// in direct rooms the partner is notified too, so they can show "seen".
+func (h *coreHub) markRead(client *Client, cmd *Command) {
+	if cmd.Room == "" || cmd.Message.ID <= 0 {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
+		})
+		return
+	}
+	if client.IsGuest || client.UserID == 0 || h.store == nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeUnauthorized, "authentication required"),
+		})
+		return
+	}
+	if _, ok := client.Rooms[cmd.Room]; !ok {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeNotInRoom, ErrNotInRoom.Error()),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	room, err := h.store.GetRoomByName(ctx, cmd.Room)
+	if err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeRoomNotFound, ErrRoomNotFound.Error()),
+		})
+		return
+	}
+	// Deleted messages are valid read positions: the latest message may have been removed.
+	msg, err := h.store.GetMessage(ctx, cmd.Message.ID)
+	if err != nil || msg.RoomID != room.ID {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeMessageNotFound, ErrMessageNotFound.Error()),
+		})
+		return
+	}
+
+	advanced, err := h.store.MarkRoomRead(ctx, client.UserID, room.ID, msg.ID)
+	if err != nil {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  cmd.Room,
+			Error: coreError(ErrCodeInternal, "failed to mark room read"),
+		})
+		return
+	}
+	if !advanced {
+		// Read positions only move forward; nothing to announce.
+		return
+	}
+
+	receipt := &Event{
+		Kind:    EventReadReceipt,
+		Room:    cmd.Room,
+		User:    client.Name,
+		UserID:  client.UserID,
+		Message: Message{ID: msg.ID, Room: cmd.Room},
+	}
+	h.sendToUserExcept(client.UserID, client, receipt)
+
+	if room.Type == store.RoomTypeDirect || room.Type == store.RoomTypeGroup {
+		members, err := h.store.ListMembers(ctx, room.ID)
+		if err != nil {
+			return
+		}
+		for _, memberID := range members {
+			if memberID != client.UserID {
+				h.sendToUser(memberID, receipt)
+			}
+		}
+	}
+}
+
+// attachReactions fills Reactions for persisted messages in place (best-effort).
+func (h *coreHub) attachReactions(ctx context.Context, messages []Message) {
+	if h.store == nil || len(messages) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		if m.ID > 0 {
+			ids = append(ids, m.ID)
+		}
+	}
+	counts, err := h.store.ListReactionCounts(ctx, ids)
+	if err != nil {
+		return
+	}
+	for i := range messages {
+		for _, rc := range counts[messages[i].ID] {
+			messages[i].Reactions = append(messages[i].Reactions, Reaction{Emoji: rc.Emoji, Count: rc.Count})
+		}
+	}
+}
+
+// attachFiles fills Attachments for persisted messages in place (best-effort).
+func (h *coreHub) attachFiles(ctx context.Context, messages []Message) {
+	if h.store == nil || len(messages) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		if m.ID > 0 {
+			ids = append(ids, m.ID)
+		}
+	}
+	attachments, err := h.store.ListAttachments(ctx, ids)
+	if err != nil {
+		return
+	}
+	for i := range messages {
+		for _, a := range attachments[messages[i].ID] {
+			messages[i].Attachments = append(messages[i].Attachments, attachmentFromStore(a))
+		}
+	}
+}
+
+// handleTyping starts, refreshes or stops the client's typing indicator in a room.
+// Only transitions are broadcast; a refresh just extends the deadline.
+func (h *coreHub) handleTyping(client *Client, roomName string, typing bool) {
+	if roomName == "" {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  roomName,
+			Error: coreError(ErrCodeBadRequest, ErrBadRequest.Error()),
+		})
+		return
+	}
+	if _, ok := client.Rooms[roomName]; !ok {
+		client.deliver(&Event{
+			Kind:  EventError,
+			Room:  roomName,
+			Error: coreError(ErrCodeNotInRoom, ErrNotInRoom.Error()),
+		})
+		return
+	}
+
+	if !typing {
+		h.stopTyping(client, roomName)
+		return
+	}
+
+	key := typingKey{room: roomName, client: client}
+	_, already := h.typing[key]
+	h.typing[key] = time.Now().Add(h.typingTimeout)
+	if already {
+		return
+	}
+	if room, ok := h.rooms[roomName]; ok {
+		room.BroadcastExcept(&Event{
+			Kind:   EventUserTyping,
+			Room:   roomName,
+			User:   client.Name,
+			UserID: client.UserID,
+		}, client)
+	}
+}
+
+// stopTyping clears the client's typing indicator in a room and notifies
+// the other members. No-op if the client was not typing.
+func (h *coreHub) stopTyping(client *Client, roomName string) {
+	key := typingKey{room: roomName, client: client}
+	if _, ok := h.typing[key]; !ok {
+		return
+	}
+	delete(h.typing, key)
+	if room, ok := h.rooms[roomName]; ok {
+		room.BroadcastExcept(&Event{
+			Kind:   EventTypingStopped,
+			Room:   roomName,
+			User:   client.Name,
+			UserID: client.UserID,
+		}, client)
+	}
+}
+
+// expireTyping stops typing indicators whose deadline has passed.
+func (h *coreHub) expireTyping(now time.Time) {
+	for key, deadline := range h.typing {
+		if now.After(deadline) {
+			h.stopTyping(key.client, key.room)
+		}
+	}
 }
 
 func (h *coreHub) removeClient(client *Client) {
@@ -308,14 +1236,20 @@ func (h *coreHub) removeClient(client *Client) {
 	for roomName := range client.Rooms {
 		h.leaveRoom(client, roomName)
 	}
+	// Remove from userClients index (other devices of the same user stay connected)
+	h.untrackUserClient(client)
 	delete(h.clients, client)
-	// Remove from userClients map
-	if client.UserID > 0 {
-		delete(h.userClients, client.UserID)
-	}
 	close(client.Events)
 }
 
+// flushGaps delivers pending gap events to slow clients that have drained
+// their queue but received nothing new since.
+func (h *coreHub) flushGaps() {
+	for client := range h.clients {
+		client.flushGap()
+	}
+}
+
 func (h *coreHub) shutdown() {
 	for client := range h.clients {
 		close(client.Events)
@@ -344,10 +1278,10 @@ func (h *coreHub) broadcastToRoom(roomName string, event *Event) {
 
 // sendCallError sends a call-related error to the client.
 func (h *coreHub) sendCallError(client *Client, code, msg string) {
-	client.Events <- &Event{
+	client.deliver(&Event{
 		Kind:  EventError,
 		Error: coreError(code, msg),
-	}
+	})
 }
 
 func (h *coreHub) handleCallInvite(client *Client, callCmd *CallCommand) {
@@ -380,14 +1314,14 @@ func (h *coreHub) handleCallInvite(client *Client, callCmd *CallCommand) {
 		}
 
 		// Send call.ringing to initiator
-		client.Events <- &Event{
+		client.deliver(&Event{
 			Kind: EventCallRinging,
 			Call: &CallEvent{
 				CallID:     call.ID,
 				ToUserID:   callCmd.ToUserID,
 				ToUsername: toUsername,
 			},
-		}
+		})
 
 		// Send call.incoming to target user
 		h.sendToUser(callCmd.ToUserID, &Event{
@@ -466,7 +1400,7 @@ func (h *coreHub) handleCallAccept(client *Client, callCmd *CallCommand) {
 	}
 
 	// Send call.join-info to acceptor
-	client.Events <- &Event{
+	client.deliver(&Event{
 		Kind: EventCallJoinInfo,
 		Call: &CallEvent{
 			CallID: callCmd.CallID,
@@ -477,7 +1411,15 @@ func (h *coreHub) handleCallAccept(client *Client, callCmd *CallCommand) {
 				Identity: joinInfo.Identity,
 			},
 		},
-	}
+	})
+
+	// Let the acceptor's other devices stop ringing
+	h.sendToUserExcept(client.UserID, client, &Event{
+		Kind: EventCallAnsweredElsewhere,
+		Call: &CallEvent{
+			CallID: callCmd.CallID,
+		},
+	})
 
 	// Send call.accepted to initiator
 	h.sendToUser(call.InitiatorUserID, &Event{
@@ -580,7 +1522,7 @@ func (h *coreHub) handleCallJoin(client *Client, callCmd *CallCommand) {
 	}
 
 	// Send call.join-info to the joining user
-	client.Events <- &Event{
+	client.deliver(&Event{
 		Kind: EventCallJoinInfo,
 		Call: &CallEvent{
 			CallID: callCmd.CallID,
@@ -591,7 +1533,7 @@ func (h *coreHub) handleCallJoin(client *Client, callCmd *CallCommand) {
 				Identity: joinInfo.Identity,
 			},
 		},
-	}
+	})
 
 	// TODO: Send call.participant-joined to other participants
 	// This requires tracking active call participants in the hub
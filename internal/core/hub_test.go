@@ -2,15 +2,19 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/callengine"
+	"github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 func TestHubJoinBroadcastAndLeave(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	hub := NewHub(nil, nil) // No store or call service needed for this test
+	hub := NewHub(nil, nil, nil) // No store or call service needed for this test
 	go hub.Run(ctx)
 
 	alice := NewClient("a", "alice", 0, false)
@@ -54,7 +58,7 @@ func TestHubDoubleJoinProducesError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	hub := NewHub(nil, nil) // No store or call service needed for this test
+	hub := NewHub(nil, nil, nil) // No store or call service needed for this test
 	go hub.Run(ctx)
 
 	alice := NewClient("a", "alice", 0, false)
@@ -73,7 +77,7 @@ func TestHubSendWithoutJoinProducesError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	hub := NewHub(nil, nil) // No store or call service needed for this test
+	hub := NewHub(nil, nil, nil) // No store or call service needed for this test
 	go hub.Run(ctx)
 
 	alice := NewClient("a", "alice", 0, false)
@@ -91,11 +95,81 @@ func TestHubSendWithoutJoinProducesError(t *testing.T) {
 	}
 }
 
+func TestHubTypingExpiresWithoutRefresh(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, nil, nil).(*coreHub)
+	hub.typingTimeout = 100 * time.Millisecond
+	go hub.Run(ctx)
+
+	alice := NewClient("a", "alice", 0, false)
+	bob := NewClient("b", "bob", 0, false)
+	hub.RegisterClient(alice)
+	hub.RegisterClient(bob)
+
+	alice.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	bob.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	mustEvent(t, alice.Events, EventUserJoined)
+	mustEvent(t, bob.Events, EventUserJoined)
+
+	alice.Commands <- &Command{Kind: CommandTypingStart, Room: "general"}
+	typingEv := mustEvent(t, bob.Events, EventUserTyping)
+	if typingEv.User != "alice" || typingEv.Room != "general" {
+		t.Fatalf("unexpected typing event: %+v", typingEv)
+	}
+
+	// No refresh arrives, so the hub stops the indicator on its own.
+	stoppedEv := mustEvent(t, bob.Events, EventTypingStopped)
+	if stoppedEv.User != "alice" {
+		t.Fatalf("unexpected typing_stopped event: %+v", stoppedEv)
+	}
+
+	// The sender never sees its own typing events.
+	for {
+		select {
+		case ev := <-alice.Events:
+			if ev.Kind == EventUserTyping || ev.Kind == EventTypingStopped {
+				t.Fatalf("sender received its own typing event: %+v", ev)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestHubTypingClearedOnLeave(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, nil, nil)
+	go hub.Run(ctx)
+
+	alice := NewClient("a", "alice", 0, false)
+	bob := NewClient("b", "bob", 0, false)
+	hub.RegisterClient(alice)
+	hub.RegisterClient(bob)
+
+	alice.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	bob.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	mustEvent(t, bob.Events, EventUserJoined)
+
+	alice.Commands <- &Command{Kind: CommandTypingStart, Room: "general"}
+	mustEvent(t, bob.Events, EventUserTyping)
+
+	alice.Commands <- &Command{Kind: CommandLeaveRoom, Room: "general"}
+	stoppedEv := mustEvent(t, bob.Events, EventTypingStopped)
+	if stoppedEv.User != "alice" {
+		t.Fatalf("unexpected typing_stopped event: %+v", stoppedEv)
+	}
+	mustEvent(t, bob.Events, EventUserLeft)
+}
+
 func TestHubLeaveUnknownRoomError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	hub := NewHub(nil, nil) // No store or call service needed for this test
+	hub := NewHub(nil, nil, nil) // No store or call service needed for this test
 	go hub.Run(ctx)
 
 	alice := NewClient("a", "alice", 0, false)
@@ -108,3 +182,332 @@ func TestHubLeaveUnknownRoomError(t *testing.T) {
 		t.Fatalf("expected room_not_found error, got %+v", ev)
 	}
 }
+
+func TestHubErrorsToNonReadingClientDoNotBlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, nil, nil) // No store or call service needed for this test
+	go hub.Run(ctx)
+
+	// Mallory never reads her events
+	mallory := NewClientWithQueue("m", "mallory", 0, false, 1)
+	alice := NewClient("a", "alice", 0, false)
+	bob := NewClient("b", "bob", 0, false)
+	hub.RegisterClient(mallory)
+	hub.RegisterClient(alice)
+	hub.RegisterClient(bob)
+
+	for i := 0; i < 5; i++ {
+		mallory.Commands <- &Command{Kind: CommandLeaveRoom, Room: "ghost"}
+	}
+	select {
+	case <-mallory.Slow():
+	case <-ctx.Done():
+		t.Fatal("expected the non-reading client to be marked slow")
+	}
+
+	// The hub keeps serving everyone else
+	alice.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	bob.Commands <- &Command{Kind: CommandJoinRoom, Room: "general"}
+	mustEvent(t, alice.Events, EventUserJoined)
+	alice.Commands <- &Command{Kind: CommandSendRoomMessage, Room: "general", Message: Message{Text: "still here"}}
+	if ev := mustEvent(t, bob.Events, EventRoomMessage); ev.Message.Text != "still here" {
+		t.Fatalf("unexpected message event: %+v", ev)
+	}
+}
+
+// replayStore serves a resume replay from memory. Other store methods are not implemented.
+type replayStore struct {
+	store.Store
+	messages []*store.Message
+	pages    int // ListMessagesAfter calls
+}
+
+func newReplayStore(n int) *replayStore {
+	st := &replayStore{}
+	for i := 1; i <= n; i++ {
+		st.messages = append(st.messages, &store.Message{ID: int64(i), RoomID: 1, UserID: 1, Body: fmt.Sprintf("m%d", i)})
+	}
+	return st
+}
+
+func (s *replayStore) GetRoomByName(_ context.Context, name string) (*store.Room, error) {
+	return &store.Room{ID: 1, Name: name}, nil
+}
+
+func (s *replayStore) ListMessages(context.Context, int64, int, *int64) ([]*store.Message, error) {
+	return nil, nil
+}
+
+func (s *replayStore) ListMessagesAfter(_ context.Context, _, afterID int64, limit int) ([]*store.Message, error) {
+	s.pages++
+	var page []*store.Message
+	for _, m := range s.messages {
+		if m.ID > afterID && len(page) < limit {
+			page = append(page, m)
+		}
+	}
+	return page, nil
+}
+
+func (s *replayStore) GetUserByID(_ context.Context, id int64) (*store.User, error) {
+	return &store.User{ID: id, Username: "alice"}, nil
+}
+
+func (s *replayStore) ListReactionCounts(context.Context, []int64) (map[int64][]store.ReactionCount, error) {
+	return nil, nil
+}
+
+func (s *replayStore) ListAttachments(context.Context, []int64) (map[int64][]*store.Attachment, error) {
+	return nil, nil
+}
+
+func TestHubReplayStopsAtPageLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	total := (maxReplayPages + 2) * resumePageSize
+	hub := NewHub(newReplayStore(total), nil, nil)
+	go hub.Run(ctx)
+
+	bob := NewClientWithQueue("b", "bob", 2, false, maxReplayPages+1)
+	hub.RegisterClient(bob)
+	bob.Commands <- &Command{Kind: CommandJoinRoom, Room: "general", Since: 5}
+	mustEvent(t, bob.Events, EventUserJoined)
+
+	var last *Event
+	for i := 0; i < maxReplayPages; i++ {
+		last = mustEvent(t, bob.Events, EventHistory)
+		if !last.HasMore || last.Truncated != (i == maxReplayPages-1) {
+			t.Fatalf("page %d: unexpected has_more %v, truncated %v", i, last.HasMore, last.Truncated)
+		}
+	}
+	if got := last.Messages[len(last.Messages)-1].ID; got != int64(5+maxReplayPages*resumePageSize) {
+		t.Fatalf("expected the replay to stop at message %d, got %d", 5+maxReplayPages*resumePageSize, got)
+	}
+	select {
+	case ev := <-bob.Events:
+		t.Fatalf("unexpected event after a truncated replay: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHubReplayToNonReadingClientDoesNotBlock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	st := newReplayStore(maxReplayPages * resumePageSize)
+	hub := NewHub(st, nil, nil)
+	go hub.Run(ctx)
+
+	// Mallory resumes from the start and never reads: the join event and the
+	// first page fill her queue
+	mallory := NewClientWithQueue("m", "mallory", 3, false, 2)
+	alice := NewClient("a", "alice", 1, false)
+	hub.RegisterClient(mallory)
+	hub.RegisterClient(alice)
+	mallory.Commands <- &Command{Kind: CommandJoinRoom, Room: "general", Since: 1}
+	select {
+	case <-mallory.Slow():
+	case <-ctx.Done():
+		t.Fatal("expected the non-reading client to be marked slow")
+	}
+
+	alice.Commands <- &Command{Kind: CommandJoinRoom, Room: "lobby"}
+	mustEvent(t, alice.Events, EventUserJoined)
+	if st.pages != 2 {
+		t.Fatalf("expected the replay to stop after the dropped page, got %d queries", st.pages)
+	}
+}
+
+// fakeCallService is a minimal in-memory CallService for hub tests.
+type fakeCallService struct {
+	call *store.Call
+}
+
+func (f *fakeCallService) CreateDirectCall(_ context.Context, fromUserID, _ int64) (*store.Call, error) {
+	f.call = &store.Call{ID: "call-1", Type: store.CallTypeDirect, InitiatorUserID: fromUserID, CreatedAt: time.Now()}
+	return f.call, nil
+}
+
+func (f *fakeCallService) CreateRoomCall(_ context.Context, initiatorUserID, roomID int64) (*store.Call, error) {
+	f.call = &store.Call{ID: "call-1", Type: store.CallTypeRoom, InitiatorUserID: initiatorUserID, RoomID: &roomID, CreatedAt: time.Now()}
+	return f.call, nil
+}
+
+func (f *fakeCallService) GetCall(context.Context, string) (*store.Call, error) {
+	return f.call, nil
+}
+
+func (f *fakeCallService) GetJoinInfo(_ context.Context, callID string, userID int64) (*callengine.JoinInfo, error) {
+	return &callengine.JoinInfo{URL: "ws://test", Token: "token", RoomName: callID, Identity: fmt.Sprintf("user-%d", userID)}, nil
+}
+
+func (f *fakeCallService) EndCall(context.Context, string, int64) error { return nil }
+
+func (f *fakeCallService) RejectCall(context.Context, string, int64, string) error { return nil }
+
+func (f *fakeCallService) LeaveCall(context.Context, string, int64) error { return nil }
+
+func (f *fakeCallService) GetTargetUser(context.Context, int64) (string, error) { return "bob", nil }
+
+func (f *fakeCallService) ListRoomMembers(context.Context, int64) ([]int64, error) { return nil, nil }
+
+func (f *fakeCallService) GetRoomInfo(context.Context, int64) (string, error) { return "", nil }
+
+func TestHubTargetedEventsReachEveryDevice(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, &fakeCallService{}, nil)
+	go hub.Run(ctx)
+
+	alice := NewClient("a", "alice", 1, false)
+	bobPhone := NewClient("b1", "bob", 2, false)
+	bobLaptop := NewClient("b2", "bob", 2, false)
+	hub.RegisterClient(alice)
+	hub.RegisterClient(bobPhone)
+	hub.RegisterClient(bobLaptop)
+
+	alice.Commands <- &Command{
+		Kind: CommandCallInvite,
+		Call: &CallCommand{CallType: "direct", ToUserID: 2},
+	}
+
+	for _, device := range []*Client{bobPhone, bobLaptop} {
+		ev := mustEvent(t, device.Events, EventCallIncoming)
+		if ev.Call == nil || ev.Call.CallID != "call-1" || ev.Call.FromUserID != 1 {
+			t.Fatalf("unexpected call.incoming on %s: %+v", device.ID, ev.Call)
+		}
+	}
+
+	// Bob answers on the phone; the laptop should be told to stop ringing.
+	bobPhone.Commands <- &Command{Kind: CommandCallAccept, Call: &CallCommand{CallID: "call-1"}}
+
+	mustEvent(t, bobPhone.Events, EventCallJoinInfo)
+	ev := mustEvent(t, bobLaptop.Events, EventCallAnsweredElsewhere)
+	if ev.Call == nil || ev.Call.CallID != "call-1" {
+		t.Fatalf("unexpected answered-elsewhere event: %+v", ev.Call)
+	}
+	mustEvent(t, alice.Events, EventCallAccepted)
+}
+
+func TestHubRemoveOneDeviceKeepsOthers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hub := NewHub(nil, &fakeCallService{}, nil)
+	go hub.Run(ctx)
+
+	alice := NewClient("a", "alice", 1, false)
+	bobPhone := NewClient("b1", "bob", 2, false)
+	bobLaptop := NewClient("b2", "bob", 2, false)
+	hub.RegisterClient(alice)
+	hub.RegisterClient(bobPhone)
+	hub.RegisterClient(bobLaptop)
+
+	// Disconnect the phone; its Events channel is closed by the hub.
+	close(bobPhone.Commands)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := <-bobPhone.Events; !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("phone events channel was not closed")
+		}
+	}
+
+	alice.Commands <- &Command{
+		Kind: CommandCallInvite,
+		Call: &CallCommand{CallType: "direct", ToUserID: 2},
+	}
+
+	mustEvent(t, bobLaptop.Events, EventCallIncoming)
+}
+
+type fakePresenceService struct {
+	status   map[int64]string
+	watchers map[int64][]int64
+}
+
+func (f *fakePresenceService) SetOnline(_ context.Context, userID int64) bool {
+	if _, ok := f.status[userID]; ok {
+		return false
+	}
+	f.status[userID] = "online"
+	return true
+}
+
+func (f *fakePresenceService) SetOffline(_ context.Context, userID int64) (bool, error) {
+	if _, ok := f.status[userID]; !ok {
+		return false, nil
+	}
+	delete(f.status, userID)
+	return true, nil
+}
+
+func (f *fakePresenceService) SetStatus(_ context.Context, userID int64, status string) (bool, error) {
+	if status != "online" && status != "away" && status != "dnd" {
+		return false, fmt.Errorf("invalid presence status")
+	}
+	if f.status[userID] == status {
+		return false, nil
+	}
+	f.status[userID] = status
+	return true, nil
+}
+
+func (f *fakePresenceService) ListWatchers(_ context.Context, userID int64) ([]int64, error) {
+	return f.watchers[userID], nil
+}
+
+func TestHubPresenceNotifiesWatchers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	presenceSvc := &fakePresenceService{
+		status:   make(map[int64]string),
+		watchers: map[int64][]int64{1: {2}, 2: {1}},
+	}
+	hub := NewHub(nil, nil, presenceSvc)
+	go hub.Run(ctx)
+
+	bob := NewClient("b", "bob", 2, false)
+	hub.RegisterClient(bob)
+	// Bob's own devices learn about his status too.
+	if ev := mustEvent(t, bob.Events, EventPresenceChanged); ev.UserID != 2 {
+		t.Fatalf("unexpected presence event: %+v", ev)
+	}
+
+	alice := NewClient("a", "alice", 1, false)
+	hub.RegisterClient(alice)
+	onlineEv := mustEvent(t, bob.Events, EventPresenceChanged)
+	if onlineEv.UserID != 1 || onlineEv.Presence == nil || onlineEv.Presence.Status != "online" {
+		t.Fatalf("unexpected online event: %+v", onlineEv)
+	}
+
+	// A second connection of the same user does not re-announce presence.
+	aliceTab := NewClient("a2", "alice", 1, false)
+	hub.RegisterClient(aliceTab)
+
+	alice.Commands <- &Command{Kind: CommandSetPresence, Status: "away"}
+	awayEv := mustEvent(t, bob.Events, EventPresenceChanged)
+	if awayEv.UserID != 1 || awayEv.Presence.Status != "away" {
+		t.Fatalf("unexpected away event: %+v", awayEv)
+	}
+
+	alice.Commands <- &Command{Kind: CommandSetPresence, Status: "sleeping"}
+	if errEv := mustEvent(t, alice.Events, EventError); errEv.Error.Code != ErrCodeBadRequest {
+		t.Fatalf("expected bad_request, got %+v", errEv.Error)
+	}
+
+	// Closing one of two connections keeps the user online.
+	hub.UnregisterClient(aliceTab)
+	hub.UnregisterClient(alice)
+	offlineEv := mustEvent(t, bob.Events, EventPresenceChanged)
+	if offlineEv.UserID != 1 || offlineEv.Presence.Status != "offline" || offlineEv.Presence.LastSeenAt.IsZero() {
+		t.Fatalf("unexpected offline event: %+v", offlineEv)
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MentionAll is the mention that pings every member of a room.
+const MentionAll = "room"
+
+// maxMentionsPerMessage caps how many distinct usernames one message can ping.
+const maxMentionsPerMessage = 20
+
+// parseMentions extracts mentioned usernames from message text, in order of first
+// appearance and without duplicates, and reports whether @room was used.
+// A mention is an @ at the start of the text or after whitespace or an opening
+// bracket, so e-mail addresses are ignored. Trailing punctuation is not part of it.
+func parseMentions(text string) (usernames []string, all bool) {
+	seen := make(map[string]bool)
+	for i := 0; i < len(text); i++ {
+		if text[i] != '@' {
+			continue
+		}
+		if i > 0 {
+			prev := rune(text[i-1])
+			if !unicode.IsSpace(prev) && !strings.ContainsRune("([{<", prev) {
+				continue
+			}
+		}
+		end := i + 1
+		for end < len(text) && !unicode.IsSpace(rune(text[end])) && text[end] != '@' {
+			end++
+		}
+		name := strings.TrimRight(text[i+1:end], ".,!?;:)]}>'\"")
+		i = end - 1
+		switch {
+		case name == "":
+			continue
+		case name == MentionAll:
+			all = true
+		case !seen[name] && len(usernames) < maxMentionsPerMessage:
+			seen[name] = true
+			usernames = append(usernames, name)
+		}
+	}
+	return usernames, all
+}
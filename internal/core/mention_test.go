@@ -0,0 +1,29 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text  string
+		names []string
+		all   bool
+	}{
+		{"hello", nil, false},
+		{"@alice look", []string{"alice"}, false},
+		{"ping @bob, @carol! and @bob again", []string{"bob", "carol"}, false},
+		{"(@dave) mail me at eve@example.com", []string{"dave"}, false},
+		{"heads up @room", nil, true},
+		{"@room: @alice.", []string{"alice"}, true},
+		{"@ alone and @@double", nil, false},
+	}
+
+	for _, tt := range tests {
+		names, all := parseMentions(tt.text)
+		if !reflect.DeepEqual(names, tt.names) || all != tt.all {
+			t.Errorf("parseMentions(%q) = %v, %v; want %v, %v", tt.text, names, all, tt.names, tt.all)
+		}
+	}
+}
@@ -9,4 +9,27 @@ type Message struct {
 	From      string
 	Text      string
 	CreatedAt time.Time
+	EditedAt  time.Time // zero if never edited
+	Deleted   bool
+	ReplyTo   int64 // ID of the parent message, 0 for top-level messages
+	Reactions []Reaction
+	// Attachments are the files shared with the message. On a send command only
+	// the IDs are set; the hub fills in the rest after checking them.
+	Attachments []Attachment
+	// ClientMsgID is the sender-generated idempotency key; set only on live sends.
+	ClientMsgID string
+}
+
+// Reaction is the aggregated count of one emoji on a message.
+type Reaction struct {
+	Emoji string
+	Count int
+}
+
+// Attachment describes an uploaded file shared in a message.
+type Attachment struct {
+	ID          int64
+	Filename    string
+	ContentType string
+	Size        int64
 }
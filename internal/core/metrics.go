@@ -0,0 +1,15 @@
+package core
+
+import "expvar"
+
+// metrics counts slow-consumer outcomes. The counters are published through
+// expvar, so they appear under /debug/vars.
+var metrics = struct {
+	eventsDropped   *expvar.Int
+	slowDisconnects *expvar.Int
+	gapsSent        *expvar.Int
+}{
+	eventsDropped:   expvar.NewInt("wirechat_events_dropped_total"),
+	slowDisconnects: expvar.NewInt("wirechat_slow_consumer_disconnects_total"),
+	gapsSent:        expvar.NewInt("wirechat_gap_events_total"),
+}
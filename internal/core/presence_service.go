@@ -0,0 +1,23 @@
+package core
+
+import "context"
+
+// PresenceService abstracts presence tracking for the Hub.
+// The Hub reports connection transitions and manual status changes;
+// the service owns the resulting state and decides who is notified.
+type PresenceService interface {
+	// SetOnline marks a user as online when their first connection appears.
+	// Returns false if the user was already connected.
+	SetOnline(ctx context.Context, userID int64) bool
+
+	// SetOffline marks a user as offline when their last connection closes.
+	// Returns false if the user was not connected.
+	SetOffline(ctx context.Context, userID int64) (bool, error)
+
+	// SetStatus sets a manual status ("online", "away" or "dnd").
+	// Returns false if the status did not change.
+	SetStatus(ctx context.Context, userID int64, status string) (bool, error)
+
+	// ListWatchers returns user IDs that should receive the user's presence changes.
+	ListWatchers(ctx context.Context, userID int64) ([]int64, error)
+}
@@ -33,13 +33,20 @@ func (r *Room) RemoveClient(c *Client) bool {
 }
 
 // Broadcast sends an event to all clients in the room.
+// Slow consumers are handled by their SlowPolicy instead of blocking the hub.
 func (r *Room) Broadcast(event *Event) {
 	for client := range r.clients {
-		select {
-		case client.Events <- event:
-		default:
-			// Drop if slow consumer.
+		client.deliver(event)
+	}
+}
+
+// BroadcastExcept sends an event to all clients in the room except one.
+func (r *Room) BroadcastExcept(event *Event, except *Client) {
+	for client := range r.clients {
+		if client == except {
+			continue
 		}
+		client.deliver(event)
 	}
 }
 
@@ -0,0 +1,86 @@
+// Package devmail provides mailers for development that do not send anything:
+// one writes messages to the log, the other to .eml files.
+package devmail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/vovakirdan/wirechat-server/internal/mail"
+)
+
+// Log implements mail.Mailer by logging every message, body included.
+// Never use it in production: password reset links end up in the logs.
+type Log struct {
+	from string
+	log  *zerolog.Logger
+}
+
+// NewLog creates a mailer that logs messages sent as from.
+func NewLog(from string, logger *zerolog.Logger) *Log {
+	return &Log{from: from, log: logger}
+}
+
+// Send logs msg.
+func (m *Log) Send(_ context.Context, msg mail.Message) error {
+	m.log.Info().
+		Str("from", m.from).
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("mail sent")
+	return nil
+}
+
+// File implements mail.Mailer by writing every message to its own .eml file,
+// which most mail clients can open.
+type File struct {
+	from string
+	dir  string
+}
+
+// NewFile creates a mailer that writes messages sent as from into dir, creating it if needed.
+func NewFile(from, dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create mail dir: %w", err)
+	}
+	return &File{from: from, dir: dir}, nil
+}
+
+// Send writes msg to a new file named after the current time.
+func (m *File) Send(_ context.Context, msg mail.Message) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("generate mail file name: %w", err)
+	}
+	now := time.Now()
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(m.from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	return nil
+}
+
+// headerValue keeps a value on one header line.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
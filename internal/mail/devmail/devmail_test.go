@@ -0,0 +1,48 @@
+package devmail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vovakirdan/wirechat-server/internal/mail"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFile("WireChat <noreply@example.com>", dir)
+	if err != nil {
+		t.Fatalf("failed to create mailer: %v", err)
+	}
+
+	msg := mail.Message{
+		To:      "alice@example.com",
+		Subject: "Hello\r\nBcc: mallory@example.com",
+		Body:    "line one\nline two",
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 mail file, got %v, %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read mail file: %v", err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"From: WireChat <noreply@example.com>\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: Hello  Bcc: mallory@example.com\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("mail file missing %q:\n%s", want, text)
+		}
+	}
+}
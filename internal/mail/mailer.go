@@ -0,0 +1,17 @@
+package mail
+
+import "context"
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer abstracts how outbound email is delivered.
+// The sender address is part of the backend's configuration.
+type Mailer interface {
+	// Send delivers msg, or returns an error if it could not be handed off.
+	Send(ctx context.Context, msg Message) error
+}
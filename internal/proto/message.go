@@ -17,6 +17,23 @@ const (
 	InboundTypeLeave = "leave"
 	InboundTypeMsg   = "msg"
 
+	// Message mutation inbound types
+	InboundTypeMsgEdit   = "msg.edit"
+	InboundTypeMsgDelete = "msg.delete"
+
+	// Reaction inbound types
+	InboundTypeReactionAdd    = "reaction.add"
+	InboundTypeReactionRemove = "reaction.remove"
+
+	// Read receipts inbound type
+	InboundTypeRead = "read"
+
+	// Typing indicator inbound type
+	InboundTypeTyping = "typing"
+
+	// Presence inbound type
+	InboundTypePresence = "presence"
+
 	// Call inbound types
 	InboundTypeCallInvite = "call.invite"
 	InboundTypeCallAccept = "call.accept"
@@ -37,6 +54,7 @@ const (
 	EventTypeCallParticipantJoined = "call.participant-joined"
 	EventTypeCallParticipantLeft   = "call.participant-left"
 	EventTypeCallEnded             = "call.ended"
+	EventTypeCallAnsweredElsewhere = "call.answered-elsewhere"
 )
 
 // HelloData is sent by the client to introduce itself.
@@ -49,14 +67,62 @@ type HelloData struct {
 // JoinData requests to join a specific room.
 type JoinData struct {
 	Room string `json:"room"`
+	// Since resumes after a reconnect: every persisted message with a greater ID
+	// is replayed instead of the latest page. Only used by join.
+	Since int64 `json:"since,omitempty"`
 }
 
 // MsgData is a chat message from the client.
 type MsgData struct {
+	Room    string `json:"room"`
+	Text    string `json:"text"`
+	ReplyTo int64  `json:"reply_to,omitempty"` // ID of the message being replied to
+	// ClientMsgID is an optional sender-generated ID (e.g. a UUID). Resending with the
+	// same ID never stores the message twice, and the sender gets msg_ack or msg_nack.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Attachments are IDs of the sender's own uploads (POST /api/uploads) not yet
+	// used in another message.
+	Attachments []int64 `json:"attachments,omitempty"`
+}
+
+// MsgEditData replaces the text of an existing message.
+type MsgEditData struct {
 	Room string `json:"room"`
+	ID   int64  `json:"id"`
 	Text string `json:"text"`
 }
 
+// MsgDeleteData deletes an existing message.
+type MsgDeleteData struct {
+	Room string `json:"room"`
+	ID   int64  `json:"id"`
+}
+
+// ReactionData adds or removes an emoji reaction on a message.
+type ReactionData struct {
+	Room  string `json:"room"`
+	ID    int64  `json:"id"`
+	Emoji string `json:"emoji"`
+}
+
+// ReadData marks a room as read up to (and including) a message.
+type ReadData struct {
+	Room       string `json:"room"`
+	LastReadID int64  `json:"last_read_id"`
+}
+
+// TypingData announces that the user is typing in a room.
+// Clients refresh it every few seconds while typing; Stop ends the indicator early.
+type TypingData struct {
+	Room string `json:"room"`
+	Stop bool   `json:"stop,omitempty"`
+}
+
+// PresenceData sets the user's manual presence status: "online", "away" or "dnd".
+type PresenceData struct {
+	Status string `json:"status"`
+}
+
 // Outbound is the envelope for messages sent to the client.
 type Outbound struct {
 	Type  string `json:"type"`
@@ -72,6 +138,68 @@ type EventMessage struct {
 	User string `json:"user"`
 	Text string `json:"text"`
 	TS   int64  `json:"ts"`
+	// EditedAt is the unix time of the last edit, omitted if never edited.
+	EditedAt int64 `json:"edited_at,omitempty"`
+	// Deleted marks a message that was removed; Text is empty in that case.
+	Deleted bool `json:"deleted,omitempty"`
+	// ReplyTo is the ID of the parent message for threaded replies.
+	ReplyTo int64 `json:"reply_to,omitempty"`
+	// Reactions lists aggregated emoji reactions, omitted if there are none.
+	Reactions []Reaction `json:"reactions,omitempty"`
+	// Attachments lists the files shared with the message, omitted if there are none.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// ClientMsgID echoes the sender's client_msg_id on live messages.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+// EventMsgAck confirms to the sender that a message was accepted.
+type EventMsgAck struct {
+	Room        string `json:"room"`
+	ClientMsgID string `json:"client_msg_id"`
+	ID          int64  `json:"id,omitempty"` // server message ID, omitted if the message was not persisted
+	TS          int64  `json:"ts"`
+	Duplicate   bool   `json:"duplicate,omitempty"` // true if an earlier send already stored this message
+}
+
+// EventMsgNack tells the sender that a message was rejected.
+type EventMsgNack struct {
+	Room        string `json:"room"`
+	ClientMsgID string `json:"client_msg_id"`
+	Code        string `json:"code"`
+	Msg         string `json:"msg"`
+}
+
+// Reaction is the aggregated count of one emoji on a message.
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// Attachment describes a file shared in a message. URL is a server-relative
+// download path that needs the usual Authorization header.
+type Attachment struct {
+	ID          int64  `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// EventReactionUpdated notifies that reactions on a message changed.
+type EventReactionUpdated struct {
+	ID        int64      `json:"id"`
+	Room      string     `json:"room"`
+	User      string     `json:"user"`
+	Emoji     string     `json:"emoji"`
+	Action    string     `json:"action"` // "added" or "removed"
+	Reactions []Reaction `json:"reactions"`
+}
+
+// EventMessageDeleted notifies that a message was deleted.
+type EventMessageDeleted struct {
+	ID   int64  `json:"id"`
+	Room string `json:"room"`
+	User string `json:"user"`
 }
 
 // EventUserJoined notifies that a user joined a room.
@@ -86,10 +214,89 @@ type EventUserLeft struct {
 	User string `json:"user"`
 }
 
+// EventReadReceipt notifies that a user has read a room up to a message.
+type EventReadReceipt struct {
+	Room       string `json:"room"`
+	User       string `json:"user"`
+	UserID     int64  `json:"user_id"`
+	LastReadID int64  `json:"last_read_id"`
+}
+
+// EventTyping is used for both user_typing and typing_stopped events.
+type EventTyping struct {
+	Room   string `json:"room"`
+	User   string `json:"user"`
+	UserID int64  `json:"user_id,omitempty"`
+}
+
+// EventPresenceChanged is sent to friends when a user's presence changes.
+// LastSeenAt is set only when Status is "offline".
+type EventPresenceChanged struct {
+	UserID     int64  `json:"user_id"`
+	User       string `json:"user"`
+	Status     string `json:"status"`
+	LastSeenAt string `json:"last_seen_at,omitempty"`
+}
+
+// EventUserKicked notifies a room that a moderator removed a user.
+// The removed user receives it too, just before being unsubscribed.
+type EventUserKicked struct {
+	Room   string `json:"room"`
+	User   string `json:"user"`
+	UserID int64  `json:"user_id"`
+	By     string `json:"by"`
+	Reason string `json:"reason,omitempty"`
+	Banned bool   `json:"banned,omitempty"`
+}
+
+// EventRoomUpdated notifies that a room's metadata changed.
+// All fields are sent, changed or not; empty strings mean unset.
+type EventRoomUpdated struct {
+	Room        string `json:"room"`
+	User        string `json:"user"`
+	Topic       string `json:"topic"`
+	Description string `json:"description"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// EventMessagePinned notifies that a message was pinned.
+type EventMessagePinned struct {
+	Room    string       `json:"room"`
+	User    string       `json:"user"` // who pinned it
+	Message EventMessage `json:"message"`
+}
+
+// EventMessageUnpinned notifies that a message was unpinned.
+type EventMessageUnpinned struct {
+	ID   int64  `json:"id"`
+	Room string `json:"room"`
+	User string `json:"user"` // who unpinned it
+}
+
+// EventMention notifies a user that a room message mentioned them.
+// It is sent to every connection of the user, joined to the room or not.
+type EventMention struct {
+	ID      int64        `json:"id"`   // notification ID for POST /api/notifications/read
+	Kind    string       `json:"kind"` // "user" or "room"
+	Room    string       `json:"room"`
+	User    string       `json:"user"` // message author
+	Message EventMessage `json:"message"`
+}
+
+// EventGap tells a slow client that events were dropped.
+// The client should refetch history for Rooms (e.g. re-join with since).
+type EventGap struct {
+	Rooms   []string `json:"rooms"`
+	Dropped int      `json:"dropped"`
+}
+
 // EventHistory delivers message history upon joining a room.
 type EventHistory struct {
-	Room     string         `json:"room"`
-	Messages []EventMessage `json:"messages"`
+	Room      string         `json:"room"`
+	Messages  []EventMessage `json:"messages"`
+	Since     int64          `json:"since,omitempty"`     // set when replaying after a join with since
+	HasMore   bool           `json:"has_more,omitempty"`  // another replay page follows
+	Truncated bool           `json:"truncated,omitempty"` // the replay stopped early, fetch the rest over REST
 }
 
 // Error describes a protocol-level error response.
@@ -171,6 +378,11 @@ type EventCallParticipantLeft struct {
 	Reason   string `json:"reason,omitempty"`
 }
 
+// EventCallAnsweredElsewhere tells a user's other devices that the call was accepted on another device.
+type EventCallAnsweredElsewhere struct {
+	CallID string `json:"call_id"`
+}
+
 // EventCallEnded notifies all participants that the call ended.
 type EventCallEnded struct {
 	CallID        string `json:"call_id"`
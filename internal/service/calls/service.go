@@ -22,6 +22,7 @@ var (
 	ErrCallsNotAllowed   = errors.New("user does not accept calls from non-friends")
 	ErrRoomNotFound      = errors.New("room not found")
 	ErrNotRoomMember     = errors.New("not a member of this room")
+	ErrCannotStartCall   = errors.New("room role does not allow starting calls")
 	ErrCannotCallSelf    = errors.New("cannot call yourself")
 	ErrLiveKitNotEnabled = errors.New("livekit is not enabled")
 )
@@ -132,11 +133,11 @@ func (s *Service) CreateRoomCall(ctx context.Context, initiatorUserID, roomID in
 	}
 
 	// Check if user is a member of the room
-	isMember, err := s.store.IsMember(ctx, initiatorUserID, roomID)
+	role, err := s.store.GetMemberRole(ctx, initiatorUserID, roomID)
 	if err != nil {
 		return nil, fmt.Errorf("check membership: %w", err)
 	}
-	if !isMember {
+	if role == "" {
 		return nil, ErrNotRoomMember
 	}
 
@@ -162,6 +163,11 @@ func (s *Service) CreateRoomCall(ctx context.Context, initiatorUserID, roomID in
 		return existingCall, nil
 	}
 
+	// Starting a new call depends on the room role; joining an existing one does not
+	if !role.Can(store.RoomPermStartCall) {
+		return nil, ErrCannotStartCall
+	}
+
 	// Generate call ID
 	callID := uuid.New().String()
 
@@ -0,0 +1,154 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/service/friends"
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// Status is a user's presence state.
+type Status string
+
+const (
+	StatusOnline  Status = "online"
+	StatusAway    Status = "away"
+	StatusDND     Status = "dnd"
+	StatusOffline Status = "offline"
+)
+
+// Common errors for presence operations.
+var (
+	ErrInvalidStatus = errors.New("invalid presence status")
+	ErrNotConnected  = errors.New("user is not connected")
+)
+
+// Presence describes a user's current presence.
+type Presence struct {
+	UserID     int64
+	Status     Status
+	LastSeenAt *time.Time // set only when offline and the user has connected before
+}
+
+// Service tracks presence of connected users.
+// Connection state is reported by the hub; the service keeps the resulting
+// status in memory and persists last_seen_at when a user goes offline.
+// Safe for concurrent use: the hub writes, REST handlers read.
+type Service struct {
+	store   store.Store
+	friends *friends.Service
+
+	mu     sync.RWMutex
+	status map[int64]Status // connected users only; absent means offline
+}
+
+// New creates a new presence service.
+func New(st store.Store, friendsSvc *friends.Service) *Service {
+	return &Service{
+		store:   st,
+		friends: friendsSvc,
+		status:  make(map[int64]Status),
+	}
+}
+
+// SetOnline marks a user as online when their first connection appears.
+// Returns false if the user was already connected.
+func (s *Service) SetOnline(_ context.Context, userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.status[userID]; ok {
+		return false
+	}
+	s.status[userID] = StatusOnline
+	return true
+}
+
+// SetOffline marks a user as offline when their last connection closes
+// and records last_seen_at. Returns false if the user was not connected.
+func (s *Service) SetOffline(ctx context.Context, userID int64) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.status[userID]
+	delete(s.status, userID)
+	s.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	if err := s.store.UpdateUserLastSeen(ctx, userID, time.Now()); err != nil {
+		return true, fmt.Errorf("update last seen: %w", err)
+	}
+	return true, nil
+}
+
+// SetStatus sets a manual status ("online", "away" or "dnd") for a connected user.
+// Returns false if the status did not change.
+func (s *Service) SetStatus(_ context.Context, userID int64, value string) (bool, error) {
+	status := Status(value)
+	switch status {
+	case StatusOnline, StatusAway, StatusDND:
+	default:
+		return false, ErrInvalidStatus
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.status[userID]
+	if !ok {
+		return false, ErrNotConnected
+	}
+	if current == status {
+		return false, nil
+	}
+	s.status[userID] = status
+	return true, nil
+}
+
+// Get returns a user's presence.
+func (s *Service) Get(ctx context.Context, userID int64) (*Presence, error) {
+	s.mu.RLock()
+	status, ok := s.status[userID]
+	s.mu.RUnlock()
+
+	if ok {
+		return &Presence{UserID: userID, Status: status}, nil
+	}
+
+	lastSeen, err := s.store.GetUserLastSeen(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get last seen: %w", err)
+	}
+	return &Presence{UserID: userID, Status: StatusOffline, LastSeenAt: lastSeen}, nil
+}
+
+// ListWatchers returns users who should be told about userID's presence changes:
+// their accepted friends.
+func (s *Service) ListWatchers(ctx context.Context, userID int64) ([]int64, error) {
+	friendsList, err := s.friends.ListFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	watchers := make([]int64, 0, len(friendsList))
+	for _, f := range friendsList {
+		if f.UserID == userID {
+			watchers = append(watchers, f.FriendID)
+		} else {
+			watchers = append(watchers, f.UserID)
+		}
+	}
+	return watchers, nil
+}
+
+// CanView reports whether viewerID may see targetID's presence:
+// users can see their own presence and that of accepted friends.
+func (s *Service) CanView(ctx context.Context, viewerID, targetID int64) (bool, error) {
+	if viewerID == targetID {
+		return true, nil
+	}
+	return s.friends.IsFriend(ctx, viewerID, targetID)
+}
@@ -0,0 +1,903 @@
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// Common errors for room access checks.
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrAccessDenied = errors.New("access denied")
+	ErrNotMember    = errors.New("user is not a member of this room")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrBanned       = errors.New("user is banned from this room")
+	ErrNotBanned    = errors.New("user is not banned from this room")
+	ErrNotMuted     = errors.New("user is not muted in this room")
+	ErrInvalidMute  = errors.New("invalid mute duration")
+
+	ErrInvalidAvatarURL = errors.New("invalid avatar url")
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrAlreadyPinned    = errors.New("message is already pinned")
+	ErrNotPinned        = errors.New("message is not pinned")
+	ErrTooManyPins      = errors.New("too many pinned messages")
+
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteInvalid  = errors.New("invite is expired, used up or revoked")
+	ErrInvalidInvite  = errors.New("invalid invite settings")
+
+	ErrInvalidGroup = errors.New("invalid group participants")
+	ErrUserNotFound = errors.New("user not found")
+	ErrGroupFull    = errors.New("group is full")
+	ErrNotGroup     = errors.New("room is not a group")
+	ErrNameTaken    = errors.New("room name is taken")
+)
+
+// MaxMuteDuration caps how long a single mute may last.
+const MaxMuteDuration = 365 * 24 * time.Hour
+
+// MaxPins caps how many messages a room may have pinned at once.
+const MaxPins = 50
+
+// Group DM sizes, counting the creator.
+const (
+	MinGroupSize = 3
+	MaxGroupSize = 10
+)
+
+// Invite link lifetimes.
+const (
+	DefaultInviteTTL = 7 * 24 * time.Hour
+	MaxInviteTTL     = 30 * 24 * time.Hour
+)
+
+// Service decides who may access a room and what its members may do there.
+// It is shared by the REST handlers and the WebSocket join path,
+// so both enforce the same rules and report the same errors.
+type Service struct {
+	store store.Store
+}
+
+// New creates a new rooms service.
+func New(st store.Store) *Service {
+	return &Service{
+		store: st,
+	}
+}
+
+// GetRoom loads a room by ID without any access check.
+// Returns ErrRoomNotFound if it does not exist.
+func (s *Service) GetRoom(ctx context.Context, roomID int64) (*store.Room, error) {
+	room, err := s.store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("get room: %w", err)
+	}
+	return room, nil
+}
+
+// AuthorizeRead checks that a user may read a room: see its history and
+// threads, act on its messages and subscribe to it over WebSocket.
+// Public rooms and channels are open to everyone; private and direct rooms to members only.
+func (s *Service) AuthorizeRead(ctx context.Context, userID, roomID int64) (*store.Room, error) {
+	room, err := s.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRead(ctx, userID, room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// AuthorizeReadByName is AuthorizeRead for rooms addressed by name (WebSocket join).
+func (s *Service) AuthorizeReadByName(ctx context.Context, userID int64, name string) (*store.Room, error) {
+	room, err := s.store.GetRoomByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, fmt.Errorf("get room: %w", err)
+	}
+	if err := s.checkRead(ctx, userID, room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// AuthorizeSelfJoin checks that a user may add themselves to a room's members.
+// Only public rooms and channels can be joined this way; private and direct rooms need an existing member.
+func (s *Service) AuthorizeSelfJoin(ctx context.Context, userID, roomID int64) (*store.Room, error) {
+	room, err := s.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room.Type != store.RoomTypePublic && room.Type != store.RoomTypeChannel {
+		return nil, ErrAccessDenied
+	}
+	if err := s.checkBan(ctx, userID, room.ID); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// checkRead applies the read rule to a loaded room.
+// Banned users are kept out of every room type.
+func (s *Service) checkRead(ctx context.Context, userID int64, room *store.Room) error {
+	if err := s.checkBan(ctx, userID, room.ID); err != nil {
+		return err
+	}
+	switch room.Type {
+	case store.RoomTypePublic, store.RoomTypeChannel:
+		return nil
+	case store.RoomTypePrivate, store.RoomTypeDirect, store.RoomTypeGroup:
+		if userID <= 0 {
+			return ErrAccessDenied
+		}
+		isMember, err := s.store.IsMember(ctx, userID, room.ID)
+		if err != nil {
+			return fmt.Errorf("check membership: %w", err)
+		}
+		if !isMember {
+			return ErrAccessDenied
+		}
+		return nil
+	default:
+		// Unsupported room types are closed until they get their own rules.
+		return ErrAccessDenied
+	}
+}
+
+// checkBan returns ErrBanned if the user is banned from the room.
+func (s *Service) checkBan(ctx context.Context, userID, roomID int64) error {
+	if userID <= 0 {
+		return nil
+	}
+	banned, err := s.store.IsBanned(ctx, userID, roomID)
+	if err != nil {
+		return fmt.Errorf("check ban: %w", err)
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+// Authorize checks that a user holds a permission in a room according to their role.
+// Returns the room and the user's role, or ErrAccessDenied if the role does not grant perm.
+func (s *Service) Authorize(ctx context.Context, userID, roomID int64, perm store.RoomPermission) (*store.Room, store.RoomRole, error) {
+	room, err := s.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := s.store.GetMemberRole(ctx, userID, roomID)
+	if err != nil {
+		return nil, "", fmt.Errorf("get member role: %w", err)
+	}
+	if !role.Can(perm) {
+		return nil, "", ErrAccessDenied
+	}
+	return room, role, nil
+}
+
+// AddMember adds a user to a room on behalf of actorID, who needs the invite permission.
+// Direct rooms never take extra members. Groups have no roles: any participant may add
+// people until the group holds MaxGroupSize members.
+func (s *Service) AddMember(ctx context.Context, actorID, roomID, userID int64) (*store.Room, error) {
+	room, err := s.GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	switch room.Type {
+	case store.RoomTypeDirect:
+		return nil, ErrAccessDenied
+	case store.RoomTypeGroup:
+		isMember, err := s.store.IsMember(ctx, actorID, roomID)
+		if err != nil {
+			return nil, fmt.Errorf("check membership: %w", err)
+		}
+		if !isMember {
+			return nil, ErrAccessDenied
+		}
+	default:
+		if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermInvite); err != nil {
+			return nil, err
+		}
+	}
+	// A ban has to be lifted explicitly before the user can be invited back
+	if err := s.checkBan(ctx, userID, roomID); err != nil {
+		return nil, err
+	}
+	if room.Type == store.RoomTypeGroup {
+		if err := s.addGroupMember(ctx, room, userID); err != nil {
+			return nil, err
+		}
+	} else if err := s.store.AddMember(ctx, userID, roomID); err != nil {
+		return nil, fmt.Errorf("add member: %w", err)
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditInvite, userID, "", ""); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// Kick removes a user from a room on behalf of actorID, who needs the kick
+// permission and must outrank the user. Kicking a non-member is still recorded,
+// since they may be connected to a public room without a membership row.
+// Live connections are not touched here; the caller disconnects them from the hub.
+func (s *Service) Kick(ctx context.Context, actorID, roomID, userID int64, reason string) (*store.Room, error) {
+	room, err := s.authorizeAgainst(ctx, actorID, roomID, userID, store.RoomPermKick)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.RemoveMember(ctx, userID, roomID); err != nil {
+		return nil, fmt.Errorf("remove member: %w", err)
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditKick, userID, reason, ""); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// Ban removes a user from a room and keeps them out until Unban.
+// Same rank rules as Kick, but requires the ban permission.
+func (s *Service) Ban(ctx context.Context, actorID, roomID, userID int64, reason string) (*store.Room, error) {
+	room, err := s.authorizeAgainst(ctx, actorID, roomID, userID, store.RoomPermBan)
+	if err != nil {
+		return nil, err
+	}
+	if room.Type == store.RoomTypeDirect {
+		return nil, ErrAccessDenied
+	}
+	if err := s.store.RemoveMember(ctx, userID, roomID); err != nil {
+		return nil, fmt.Errorf("remove member: %w", err)
+	}
+	if err := s.store.BanUser(ctx, &store.RoomBan{
+		RoomID:   roomID,
+		UserID:   userID,
+		BannedBy: actorID,
+		Reason:   reason,
+	}); err != nil {
+		return nil, fmt.Errorf("ban user: %w", err)
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditBan, userID, reason, ""); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// Unban lifts a ban. The user is not re-added; they can join or be invited again.
+func (s *Service) Unban(ctx context.Context, actorID, roomID, userID int64) (*store.Room, error) {
+	room, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermBan)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.store.UnbanUser(ctx, userID, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("unban user: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotBanned
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditUnban, userID, "", ""); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// ListBans lists a room's bans for a user with the ban permission.
+func (s *Service) ListBans(ctx context.Context, actorID, roomID int64) ([]*store.RoomBan, error) {
+	if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermBan); err != nil {
+		return nil, err
+	}
+	bans, err := s.store.ListBans(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("list bans: %w", err)
+	}
+	return bans, nil
+}
+
+// Mute stops a user from posting in a room for the given duration.
+// Same rank rules as Kick, but requires the mute permission.
+func (s *Service) Mute(ctx context.Context, actorID, roomID, userID int64, duration time.Duration, reason string) (*store.RoomMute, error) {
+	if duration <= 0 || duration > MaxMuteDuration {
+		return nil, ErrInvalidMute
+	}
+	if _, err := s.authorizeAgainst(ctx, actorID, roomID, userID, store.RoomPermMute); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	mute := &store.RoomMute{
+		RoomID:    roomID,
+		UserID:    userID,
+		MutedBy:   actorID,
+		Reason:    reason,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}
+	if err := s.store.MuteUser(ctx, mute); err != nil {
+		return nil, fmt.Errorf("mute user: %w", err)
+	}
+	details := "until " + mute.ExpiresAt.UTC().Format(time.RFC3339)
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditMute, userID, reason, details); err != nil {
+		return nil, err
+	}
+	return mute, nil
+}
+
+// Unmute lifts a mute before it expires.
+func (s *Service) Unmute(ctx context.Context, actorID, roomID, userID int64) error {
+	if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermMute); err != nil {
+		return err
+	}
+	ok, err := s.store.UnmuteUser(ctx, userID, roomID)
+	if err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+	if !ok {
+		return ErrNotMuted
+	}
+	return s.audit(ctx, roomID, actorID, store.RoomAuditUnmute, userID, "", "")
+}
+
+// ListAudit returns a page of a room's audit log, newest first,
+// for a user with the view_audit permission.
+func (s *Service) ListAudit(ctx context.Context, actorID, roomID int64, limit int, beforeID *int64) ([]*store.RoomAuditEntry, error) {
+	if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermViewAudit); err != nil {
+		return nil, err
+	}
+	entries, err := s.store.ListAuditEntries(ctx, roomID, limit, beforeID)
+	if err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// authorizeAgainst checks that actorID holds perm and outranks userID in the room.
+func (s *Service) authorizeAgainst(ctx context.Context, actorID, roomID, userID int64, perm store.RoomPermission) (*store.Room, error) {
+	room, actorRole, err := s.Authorize(ctx, actorID, roomID, perm)
+	if err != nil {
+		return nil, err
+	}
+	targetRole, err := s.store.GetMemberRole(ctx, userID, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("get member role: %w", err)
+	}
+	if actorID == userID || !actorRole.Outranks(targetRole) {
+		return nil, ErrAccessDenied
+	}
+	return room, nil
+}
+
+// audit appends a moderation action to the room's audit log.
+func (s *Service) audit(ctx context.Context, roomID, actorID int64, action store.RoomAuditAction, targetID int64, reason, details string) error {
+	if err := s.store.AddAuditEntry(ctx, &store.RoomAuditEntry{
+		RoomID:   roomID,
+		ActorID:  actorID,
+		Action:   action,
+		TargetID: targetID,
+		Reason:   reason,
+		Details:  details,
+	}); err != nil {
+		return fmt.Errorf("record audit entry: %w", err)
+	}
+	return nil
+}
+
+// SetRole promotes or demotes a member on behalf of actorID, who needs the manage_roles
+// permission and must outrank both the member's current role and the new one.
+// Ownership cannot be assigned this way.
+func (s *Service) SetRole(ctx context.Context, actorID, roomID, userID int64, role store.RoomRole) (*store.Room, error) {
+	if !role.Valid() || role == store.RoomRoleOwner {
+		return nil, ErrInvalidRole
+	}
+	room, actorRole, err := s.Authorize(ctx, actorID, roomID, store.RoomPermManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	targetRole, err := s.store.GetMemberRole(ctx, userID, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("get member role: %w", err)
+	}
+	if targetRole == "" {
+		return nil, ErrNotMember
+	}
+	if !actorRole.Outranks(targetRole) || !actorRole.Outranks(role) {
+		return nil, ErrAccessDenied
+	}
+	ok, err := s.store.SetMemberRole(ctx, userID, roomID, role)
+	if err != nil {
+		return nil, fmt.Errorf("set member role: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotMember
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditRoleChange, userID, "", string(role)); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// MetadataUpdate lists the room metadata fields to change; nil fields are left as they are.
+type MetadataUpdate struct {
+	Topic       *string
+	Description *string
+	AvatarURL   *string
+}
+
+// UpdateMetadata changes a room's topic, description and avatar on behalf of actorID,
+// who needs the edit_settings permission. The avatar must be an http(s) URL or empty.
+func (s *Service) UpdateMetadata(ctx context.Context, actorID, roomID int64, upd MetadataUpdate) (*store.Room, error) {
+	room, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermEditSettings)
+	if err != nil {
+		return nil, err
+	}
+	if upd.AvatarURL != nil && *upd.AvatarURL != "" {
+		u, err := url.Parse(*upd.AvatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, ErrInvalidAvatarURL
+		}
+	}
+
+	var changed []string
+	if upd.Topic != nil && *upd.Topic != room.Topic {
+		room.Topic = *upd.Topic
+		changed = append(changed, "topic")
+	}
+	if upd.Description != nil && *upd.Description != room.Description {
+		room.Description = *upd.Description
+		changed = append(changed, "description")
+	}
+	if upd.AvatarURL != nil && *upd.AvatarURL != room.AvatarURL {
+		room.AvatarURL = *upd.AvatarURL
+		changed = append(changed, "avatar_url")
+	}
+	if len(changed) == 0 {
+		return room, nil
+	}
+
+	if err := s.store.UpdateRoomMetadata(ctx, roomID, room.Topic, room.Description, room.AvatarURL); err != nil {
+		return nil, fmt.Errorf("update room metadata: %w", err)
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditSettings, 0, "", strings.Join(changed, ",")); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// ListPins returns a room's pinned messages, newest pin first, for a user who may read the room.
+func (s *Service) ListPins(ctx context.Context, userID, roomID int64) ([]*store.RoomPin, error) {
+	if _, err := s.AuthorizeRead(ctx, userID, roomID); err != nil {
+		return nil, err
+	}
+	pins, err := s.store.ListPins(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("list pins: %w", err)
+	}
+	return pins, nil
+}
+
+// Pin pins a message on behalf of actorID, who needs the pin_messages permission.
+// Returns the room and the pinned message.
+func (s *Service) Pin(ctx context.Context, actorID, roomID, messageID int64) (*store.Room, *store.Message, error) {
+	room, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermPinMessages)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := s.getMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+	pins, err := s.store.ListPins(ctx, roomID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list pins: %w", err)
+	}
+	if len(pins) >= MaxPins {
+		return nil, nil, ErrTooManyPins
+	}
+
+	ok, err := s.store.PinMessage(ctx, &store.RoomPin{RoomID: roomID, MessageID: messageID, PinnedBy: actorID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("pin message: %w", err)
+	}
+	if !ok {
+		return nil, nil, ErrAlreadyPinned
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditPin, msg.UserID, "", strconv.FormatInt(messageID, 10)); err != nil {
+		return nil, nil, err
+	}
+	return room, msg, nil
+}
+
+// Unpin unpins a message on behalf of actorID, who needs the pin_messages permission.
+func (s *Service) Unpin(ctx context.Context, actorID, roomID, messageID int64) (*store.Room, error) {
+	room, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermPinMessages)
+	if err != nil {
+		return nil, err
+	}
+	// Deleted messages can still be unpinned
+	msg, err := s.getMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.store.UnpinMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("unpin message: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotPinned
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditUnpin, msg.UserID, "", strconv.FormatInt(messageID, 10)); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// getMessage loads a message and checks that it belongs to the room.
+func (s *Service) getMessage(ctx context.Context, roomID, messageID int64) (*store.Message, error) {
+	msg, err := s.store.GetMessage(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+	if msg.RoomID != roomID {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// CreateInvite creates an invite link on behalf of actorID, who needs the invite permission.
+// ttl of 0 means DefaultInviteTTL; maxUses of 0 means unlimited. Direct rooms cannot be invited to.
+func (s *Service) CreateInvite(ctx context.Context, actorID, roomID int64, maxUses int, ttl time.Duration) (*store.RoomInvite, error) {
+	if ttl == 0 {
+		ttl = DefaultInviteTTL
+	}
+	if ttl < 0 || ttl > MaxInviteTTL || maxUses < 0 {
+		return nil, ErrInvalidInvite
+	}
+	room, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermInvite)
+	if err != nil {
+		return nil, err
+	}
+	if room.Type == store.RoomTypeDirect {
+		return nil, ErrAccessDenied
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, fmt.Errorf("generate invite code: %w", err)
+	}
+	now := time.Now()
+	invite := &store.RoomInvite{
+		Code:      code,
+		RoomID:    roomID,
+		CreatedBy: actorID,
+		MaxUses:   maxUses,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.store.CreateInvite(ctx, invite); err != nil {
+		return nil, fmt.Errorf("create invite: %w", err)
+	}
+	return invite, nil
+}
+
+// ListInvites returns a room's usable invites, newest first, for a user with the manage_invites permission.
+func (s *Service) ListInvites(ctx context.Context, actorID, roomID int64) ([]*store.RoomInvite, error) {
+	if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermManageInvites); err != nil {
+		return nil, err
+	}
+	invites, err := s.store.ListActiveInvites(ctx, roomID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("list invites: %w", err)
+	}
+	return invites, nil
+}
+
+// RevokeInvite revokes one of a room's invites. Its creator may revoke it;
+// anyone else needs the manage_invites permission.
+func (s *Service) RevokeInvite(ctx context.Context, actorID, roomID int64, code string) error {
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return err
+	}
+	if invite.RoomID != roomID {
+		return ErrInviteNotFound
+	}
+	if invite.CreatedBy != actorID {
+		if _, _, err := s.Authorize(ctx, actorID, roomID, store.RoomPermManageInvites); err != nil {
+			return err
+		}
+	}
+	ok, err := s.store.RevokeInvite(ctx, code, time.Now())
+	if err != nil {
+		return fmt.Errorf("revoke invite: %w", err)
+	}
+	if !ok {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// AcceptInvite adds userID to the invite's room. The membership goes through AddMember
+// on behalf of the invite's creator, so invites stop working once the creator loses
+// the invite permission, and bans still apply. Accepting a room the user is already
+// a member of does not use up the invite, and neither does an accept that fails to
+// add the member.
+func (s *Service) AcceptInvite(ctx context.Context, userID int64, code string) (*store.Room, error) {
+	invite, err := s.getInvite(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !invite.Usable(now) {
+		return nil, ErrInviteInvalid
+	}
+	room, _, err := s.Authorize(ctx, invite.CreatedBy, invite.RoomID, store.RoomPermInvite)
+	if err != nil {
+		if errors.Is(err, ErrAccessDenied) {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+	if err := s.checkBan(ctx, userID, room.ID); err != nil {
+		return nil, err
+	}
+	isMember, err := s.store.IsMember(ctx, userID, room.ID)
+	if err != nil {
+		return nil, fmt.Errorf("check membership: %w", err)
+	}
+	if isMember {
+		return room, nil
+	}
+
+	ok, err := s.store.UseInvite(ctx, code, now)
+	if err != nil {
+		return nil, fmt.Errorf("use invite: %w", err)
+	}
+	if !ok {
+		// Another accept took the last use
+		return nil, ErrInviteInvalid
+	}
+	room, err = s.AddMember(ctx, invite.CreatedBy, room.ID, userID)
+	if err != nil {
+		return nil, s.returnInviteUse(ctx, code, userID, invite.RoomID, err)
+	}
+	return room, nil
+}
+
+// returnInviteUse gives back the invite use of an accept that failed with err,
+// unless the user got in anyway (e.g. only the audit entry failed). Returns err.
+func (s *Service) returnInviteUse(ctx context.Context, code string, userID, roomID int64, err error) error {
+	// The accept may have failed because ctx is done; the use is returned regardless
+	ctx = context.WithoutCancel(ctx)
+	isMember, memberErr := s.store.IsMember(ctx, userID, roomID)
+	if memberErr != nil {
+		return errors.Join(err, fmt.Errorf("check membership: %w", memberErr))
+	}
+	if isMember {
+		return err
+	}
+	if returnErr := s.store.ReturnInviteUse(ctx, code); returnErr != nil {
+		return errors.Join(err, returnErr)
+	}
+	return err
+}
+
+// getInvite loads an invite by code, whatever its state.
+func (s *Service) getInvite(ctx context.Context, code string) (*store.RoomInvite, error) {
+	invite, err := s.store.GetInvite(ctx, code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInviteNotFound
+		}
+		return nil, fmt.Errorf("get invite: %w", err)
+	}
+	return invite, nil
+}
+
+// generateInviteCode returns a random, URL-safe invite code.
+// Unlike utils.NewID it never falls back to a guessable value.
+func generateInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// groupKey is the deduplication key of a group DM: its sorted, distinct participants.
+func groupKey(userIDs []int64) string {
+	var b strings.Builder
+	b.WriteString("group")
+	for _, id := range userIDs {
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatInt(id, 10))
+	}
+	return b.String()
+}
+
+// CreateGroup creates a group DM between creatorID and userIDs, or returns the existing
+// group with exactly the same participants. The group must have between MinGroupSize
+// and MaxGroupSize participants, the creator included, and all of them must exist.
+func (s *Service) CreateGroup(ctx context.Context, creatorID int64, userIDs []int64) (*store.Room, error) {
+	seen := map[int64]bool{creatorID: true}
+	participants := []int64{creatorID}
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	if len(participants) < MinGroupSize || len(participants) > MaxGroupSize {
+		return nil, ErrInvalidGroup
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i] < participants[j] })
+	for _, id := range participants {
+		if _, err := s.store.GetUserByID(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrUserNotFound
+			}
+			return nil, fmt.Errorf("get user: %w", err)
+		}
+	}
+
+	room, err := s.store.CreateGroupRoom(ctx, groupKey(participants), creatorID, participants)
+	if err != nil {
+		return nil, fmt.Errorf("create group room: %w", err)
+	}
+	return room, nil
+}
+
+// addGroupMember adds a user to a group and moves the group's key to the new participant
+// set, so that creating a group with the same people finds this one. If another group
+// already holds that key, this group keeps its history but drops out of deduplication.
+func (s *Service) addGroupMember(ctx context.Context, room *store.Room, userID int64) error {
+	members, err := s.store.ListMembers(ctx, room.ID)
+	if err != nil {
+		return fmt.Errorf("list members: %w", err)
+	}
+	for _, id := range members {
+		if id == userID {
+			return nil
+		}
+	}
+	if len(members) >= MaxGroupSize {
+		return ErrGroupFull
+	}
+	if err := s.store.AddMember(ctx, userID, room.ID); err != nil {
+		return fmt.Errorf("add member: %w", err)
+	}
+
+	members = append(members, userID)
+	sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+	key := groupKey(members)
+	var newKey *string
+	if _, err := s.store.GetRoomByDirectKey(ctx, key); errors.Is(err, sql.ErrNoRows) {
+		newKey = &key
+	} else if err != nil {
+		return fmt.Errorf("check group key: %w", err)
+	}
+	if err := s.store.SetRoomDirectKey(ctx, room.ID, newKey); err != nil {
+		return fmt.Errorf("set group key: %w", err)
+	}
+	return nil
+}
+
+// ConvertGroup turns a group DM into a private room named name. Only the group's
+// creator may convert it, and only while still a participant; they become the owner
+// and the other participants stay on as members.
+// Once converted, the room follows private-room rules: roles, invites and no size cap.
+func (s *Service) ConvertGroup(ctx context.Context, actorID, roomID int64, name string) (*store.Room, error) {
+	room, err := s.AuthorizeRead(ctx, actorID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if room.Type != store.RoomTypeGroup {
+		return nil, ErrNotGroup
+	}
+	if room.CreatedBy == nil || *room.CreatedBy != actorID {
+		return nil, ErrAccessDenied
+	}
+	if _, err := s.store.GetRoomByName(ctx, name); err == nil {
+		return nil, ErrNameTaken
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("check room name: %w", err)
+	}
+
+	if err := s.store.ConvertToPrivateRoom(ctx, roomID, name, actorID); err != nil {
+		return nil, fmt.Errorf("convert room: %w", err)
+	}
+	if _, err := s.store.SetMemberRole(ctx, actorID, roomID, store.RoomRoleOwner); err != nil {
+		return nil, fmt.Errorf("set owner role: %w", err)
+	}
+	if err := s.audit(ctx, roomID, actorID, store.RoomAuditSettings, 0, "", "type,name"); err != nil {
+		return nil, err
+	}
+	return s.GetRoom(ctx, roomID)
+}
+
+// SearchMessages runs a full-text message search limited to rooms userID can read.
+// If roomID is non-zero only that room is searched; otherwise the search covers
+// every room the user lists, minus the ones they are banned from.
+func (s *Service) SearchMessages(ctx context.Context, userID, roomID int64, search store.MessageSearch) ([]*store.MessageSearchHit, error) {
+	if roomID != 0 {
+		if _, err := s.AuthorizeRead(ctx, userID, roomID); err != nil {
+			return nil, err
+		}
+		search.RoomIDs = []int64{roomID}
+	} else {
+		roomIDs, err := s.readableRoomIDs(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		search.RoomIDs = roomIDs
+	}
+
+	hits, err := s.store.SearchMessages(ctx, search)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+	return hits, nil
+}
+
+// readableRoomIDs lists the rooms userID may read, batching the checks checkRead
+// performs one room at a time.
+func (s *Service) readableRoomIDs(ctx context.Context, userID int64) ([]int64, error) {
+	rooms, err := s.store.ListRooms(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list rooms: %w", err)
+	}
+	banned, err := s.store.ListBannedRoomIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list bans: %w", err)
+	}
+	bannedSet := make(map[int64]bool, len(banned))
+	for _, id := range banned {
+		bannedSet[id] = true
+	}
+
+	roomIDs := make([]int64, 0, len(rooms))
+	for _, room := range rooms {
+		if bannedSet[room.ID] {
+			continue
+		}
+		switch room.Type {
+		case store.RoomTypePublic, store.RoomTypeChannel:
+			roomIDs = append(roomIDs, room.ID)
+		case store.RoomTypePrivate, store.RoomTypeDirect, store.RoomTypeGroup:
+			// ListRooms also lists rooms the user owns, but like checkRead only
+			// members may read these. Rooms listed for membership need no check.
+			if room.OwnerID != nil && *room.OwnerID == userID {
+				isMember, err := s.store.IsMember(ctx, userID, room.ID)
+				if err != nil {
+					return nil, fmt.Errorf("check membership: %w", err)
+				}
+				if !isMember {
+					continue
+				}
+			}
+			roomIDs = append(roomIDs, room.ID)
+		}
+	}
+	return roomIDs, nil
+}
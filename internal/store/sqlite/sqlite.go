@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/vovakirdan/wirechat-server/internal/store"
@@ -12,7 +14,8 @@ import (
 
 // SQLiteStore implements store.Store for SQLite.
 type SQLiteStore struct {
-	db *sql.DB
+	db     *sql.DB
+	search bool // FTS5 is available, see initSearch
 }
 
 // New creates a new SQLite store.
@@ -28,11 +31,90 @@ func New(dbPath string) (*SQLiteStore, error) {
 		return nil, fmt.Errorf("ping sqlite: %w", err)
 	}
 
+	search, err := initSearch(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	// Set connection pool limits
 	db.SetMaxOpenConns(1) // SQLite works best with single connection
 	db.SetMaxIdleConns(1)
 
-	return &SQLiteStore{db: db}, nil
+	return &SQLiteStore{db: db, search: search}, nil
+}
+
+// searchTriggers keep messages_fts in sync with messages. They mirror
+// migrations/016_add_message_search.sql.
+var searchTriggers = map[string]string{
+	"messages_fts_insert": `CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+	END`,
+	"messages_fts_delete": `CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+	END`,
+	"messages_fts_update": `CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF body ON messages BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+		INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+	END`,
+}
+
+// initSearch reports whether message search is available, which needs a driver
+// built with FTS5 (-tags sqlite_fts5). Without FTS5 it drops the index triggers,
+// which would otherwise make every message write fail. Once FTS5 is back it
+// restores them and rebuilds the index, which missed the writes in between.
+func initSearch(db *sql.DB) (bool, error) {
+	var enabled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("check fts5: %w", err)
+	}
+	if !enabled {
+		for name := range searchTriggers {
+			if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return false, fmt.Errorf("drop search trigger: %w", err)
+			}
+		}
+		return false, nil
+	}
+
+	var tables, triggers int
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'),
+			(SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN ('messages_fts_insert', 'messages_fts_delete', 'messages_fts_update'))
+	`).Scan(&tables, &triggers)
+	if err != nil {
+		return false, fmt.Errorf("check search index: %w", err)
+	}
+	if tables == 0 || triggers == len(searchTriggers) {
+		return true, nil // not migrated yet, or in sync
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+	for _, query := range searchTriggers {
+		if _, err := tx.Exec(query); err != nil {
+			return false, fmt.Errorf("create search trigger: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO messages_fts (messages_fts) VALUES ('rebuild')`); err != nil {
+		return false, fmt.Errorf("rebuild search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// SearchEnabled reports whether SearchMessages works. It is false when the
+// driver was built without FTS5.
+func (s *SQLiteStore) SearchEnabled() bool {
+	return s.search
 }
 
 // NewWithSetup creates a new SQLite store and runs a setup function.
@@ -61,7 +143,13 @@ func NewWithSetup(dbPath string, setup func(*sql.DB) error) (*SQLiteStore, error
 		return nil, fmt.Errorf("ping sqlite: %w", err)
 	}
 
-	return &SQLiteStore{db: db}, nil
+	search, err := initSearch(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db, search: search}, nil
 }
 
 // Close closes the database connection.
@@ -115,7 +203,7 @@ func (s *SQLiteStore) CreateGuestUser(ctx context.Context, sessionID string) (*s
 // GetUserByID retrieves a user by ID.
 func (s *SQLiteStore) GetUserByID(ctx context.Context, id int64) (*store.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), created_at
+		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), COALESCE(email, ''), created_at
 		FROM users
 		WHERE id = ?
 	`
@@ -126,6 +214,7 @@ func (s *SQLiteStore) GetUserByID(ctx context.Context, id int64) (*store.User, e
 		&user.PasswordHash,
 		&user.IsGuest,
 		&user.SessionID,
+		&user.Email,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -141,7 +230,7 @@ func (s *SQLiteStore) GetUserByID(ctx context.Context, id int64) (*store.User, e
 // GetUserByUsername retrieves a user by username.
 func (s *SQLiteStore) GetUserByUsername(ctx context.Context, username string) (*store.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), created_at
+		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), COALESCE(email, ''), created_at
 		FROM users
 		WHERE username = ? AND is_guest = 0
 	`
@@ -152,6 +241,7 @@ func (s *SQLiteStore) GetUserByUsername(ctx context.Context, username string) (*
 		&user.PasswordHash,
 		&user.IsGuest,
 		&user.SessionID,
+		&user.Email,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -167,7 +257,7 @@ func (s *SQLiteStore) GetUserByUsername(ctx context.Context, username string) (*
 // GetUserBySessionID retrieves a guest user by session ID.
 func (s *SQLiteStore) GetUserBySessionID(ctx context.Context, sessionID string) (*store.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), created_at
+		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), COALESCE(email, ''), created_at
 		FROM users
 		WHERE session_id = ? AND is_guest = 1
 	`
@@ -178,6 +268,7 @@ func (s *SQLiteStore) GetUserBySessionID(ctx context.Context, sessionID string)
 		&user.PasswordHash,
 		&user.IsGuest,
 		&user.SessionID,
+		&user.Email,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -193,7 +284,7 @@ func (s *SQLiteStore) GetUserBySessionID(ctx context.Context, sessionID string)
 // SearchUsers searches for users by username.
 func (s *SQLiteStore) SearchUsers(ctx context.Context, queryStr string) ([]*store.User, error) {
 	query := `
-		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), created_at
+		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), COALESCE(email, ''), created_at
 		FROM users
 		WHERE username LIKE ? AND is_guest = 0
 		ORDER BY username ASC
@@ -217,6 +308,7 @@ func (s *SQLiteStore) SearchUsers(ctx context.Context, queryStr string) ([]*stor
 			&user.PasswordHash,
 			&user.IsGuest,
 			&user.SessionID,
+			&user.Email,
 			&user.CreatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan user: %w", err)
@@ -248,59 +340,48 @@ func (s *SQLiteStore) CreateRoom(ctx context.Context, name string, roomType stor
 	return s.GetRoomByID(ctx, id)
 }
 
-// GetRoomByID retrieves a room by ID.
-func (s *SQLiteStore) GetRoomByID(ctx context.Context, id int64) (*store.Room, error) {
-	query := `
-		SELECT id, name, type, owner_id, direct_key, created_at
-		FROM rooms
-		WHERE id = ?
-	`
+// roomColumns is the column list shared by all room queries; see scanRoom.
+const roomColumns = `id, name, type, owner_id, direct_key, created_by, topic, description, avatar_url, created_at`
+
+// scanRoom scans a row selected with roomColumns.
+func scanRoom(row rowScanner) (*store.Room, error) {
 	var room store.Room
 	var ownerID sql.NullInt64
 	var directKey sql.NullString
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	var createdBy sql.NullInt64
+	if err := row.Scan(
 		&room.ID,
 		&room.Name,
 		&room.Type,
 		&ownerID,
 		&directKey,
+		&createdBy,
+		&room.Topic,
+		&room.Description,
+		&room.AvatarURL,
 		&room.CreatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("room not found: %w", err)
-		}
-		return nil, fmt.Errorf("query room: %w", err)
+	); err != nil {
+		return nil, err
 	}
-
 	if ownerID.Valid {
 		room.OwnerID = &ownerID.Int64
 	}
 	if directKey.Valid {
 		room.DirectKey = &directKey.String
 	}
-
+	if createdBy.Valid {
+		room.CreatedBy = &createdBy.Int64
+	}
 	return &room, nil
 }
 
-// GetRoomByName retrieves a room by name.
-func (s *SQLiteStore) GetRoomByName(ctx context.Context, name string) (*store.Room, error) {
+// getRoomWhere retrieves the single room matching filter.
+func (s *SQLiteStore) getRoomWhere(ctx context.Context, filter string, arg any) (*store.Room, error) {
 	query := `
-		SELECT id, name, type, owner_id, direct_key, created_at
+		SELECT ` + roomColumns + `
 		FROM rooms
-		WHERE name = ?
-	`
-	var room store.Room
-	var ownerID sql.NullInt64
-	var directKey sql.NullString
-	err := s.db.QueryRowContext(ctx, query, name).Scan(
-		&room.ID,
-		&room.Name,
-		&room.Type,
-		&ownerID,
-		&directKey,
-		&room.CreatedAt,
-	)
+		WHERE ` + filter
+	room, err := scanRoom(s.db.QueryRowContext(ctx, query, arg))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("room not found: %w", err)
@@ -308,26 +389,28 @@ func (s *SQLiteStore) GetRoomByName(ctx context.Context, name string) (*store.Ro
 		return nil, fmt.Errorf("query room: %w", err)
 	}
 
-	if ownerID.Valid {
-		room.OwnerID = &ownerID.Int64
-	}
-	if directKey.Valid {
-		room.DirectKey = &directKey.String
-	}
+	return room, nil
+}
 
-	return &room, nil
+// GetRoomByID retrieves a room by ID.
+func (s *SQLiteStore) GetRoomByID(ctx context.Context, id int64) (*store.Room, error) {
+	return s.getRoomWhere(ctx, "id = ?", id)
+}
+
+// GetRoomByName retrieves a room by name.
+func (s *SQLiteStore) GetRoomByName(ctx context.Context, name string) (*store.Room, error) {
+	return s.getRoomWhere(ctx, "name = ?", name)
 }
 
 // ListRooms lists all accessible rooms for a user.
 func (s *SQLiteStore) ListRooms(ctx context.Context, userID int64) ([]*store.Room, error) {
 	query := `
-		SELECT DISTINCT r.id, r.name, r.type, r.owner_id, r.direct_key, r.created_at
-		FROM rooms r
-		LEFT JOIN room_members rm ON r.id = rm.room_id
-		WHERE r.type = 'public'
-		   OR rm.user_id = ?
-		   OR r.owner_id = ?
-		ORDER BY r.created_at DESC
+		SELECT ` + roomColumns + `
+		FROM rooms
+		WHERE type IN ('public', 'channel')
+		   OR owner_id = ?
+		   OR id IN (SELECT room_id FROM room_members WHERE user_id = ?)
+		ORDER BY created_at DESC
 	`
 	rows, err := s.db.QueryContext(ctx, query, userID, userID)
 	if err != nil {
@@ -337,19 +420,11 @@ func (s *SQLiteStore) ListRooms(ctx context.Context, userID int64) ([]*store.Roo
 
 	var rooms []*store.Room
 	for rows.Next() {
-		var room store.Room
-		var ownerID sql.NullInt64
-		var directKey sql.NullString
-		if err := rows.Scan(&room.ID, &room.Name, &room.Type, &ownerID, &directKey, &room.CreatedAt); err != nil {
+		room, err := scanRoom(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan room: %w", err)
 		}
-		if ownerID.Valid {
-			room.OwnerID = &ownerID.Int64
-		}
-		if directKey.Valid {
-			room.DirectKey = &directKey.String
-		}
-		rooms = append(rooms, &room)
+		rooms = append(rooms, room)
 	}
 
 	return rooms, rows.Err()
@@ -357,37 +432,21 @@ func (s *SQLiteStore) ListRooms(ctx context.Context, userID int64) ([]*store.Roo
 
 // GetRoomByDirectKey retrieves a direct room by its direct_key.
 func (s *SQLiteStore) GetRoomByDirectKey(ctx context.Context, directKey string) (*store.Room, error) {
+	return s.getRoomWhere(ctx, "direct_key = ?", directKey)
+}
+
+// UpdateRoomMetadata replaces a room's topic, description and avatar URL.
+func (s *SQLiteStore) UpdateRoomMetadata(ctx context.Context, roomID int64, topic, description, avatarURL string) error {
 	query := `
-		SELECT id, name, type, owner_id, direct_key, created_at
-		FROM rooms
-		WHERE direct_key = ?
+		UPDATE rooms
+		SET topic = ?, description = ?, avatar_url = ?
+		WHERE id = ?
 	`
-	var room store.Room
-	var ownerID sql.NullInt64
-	var directKeyNullable sql.NullString
-	err := s.db.QueryRowContext(ctx, query, directKey).Scan(
-		&room.ID,
-		&room.Name,
-		&room.Type,
-		&ownerID,
-		&directKeyNullable,
-		&room.CreatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("room not found: %w", err)
-		}
-		return nil, fmt.Errorf("query room: %w", err)
-	}
-
-	if ownerID.Valid {
-		room.OwnerID = &ownerID.Int64
-	}
-	if directKeyNullable.Valid {
-		room.DirectKey = &directKeyNullable.String
+	if _, err := s.db.ExecContext(ctx, query, topic, description, avatarURL, roomID); err != nil {
+		return fmt.Errorf("update room metadata: %w", err)
 	}
 
-	return &room, nil
+	return nil
 }
 
 // CreateDirectRoom creates a direct message room between two users.
@@ -452,6 +511,78 @@ func (s *SQLiteStore) CreateDirectRoom(ctx context.Context, directKey string, us
 	return s.GetRoomByID(ctx, roomID)
 }
 
+// CreateGroupRoom creates a group DM between userIDs, or returns the group that
+// already holds groupKey. All users are added as members.
+func (s *SQLiteStore) CreateGroupRoom(ctx context.Context, groupKey string, creatorID int64, userIDs []int64) (*store.Room, error) {
+	// Check if room already exists
+	room, err := s.GetRoomByDirectKey(ctx, groupKey)
+	if err == nil {
+		return room, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("check existing room: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	// The key is only a placeholder name: groups can gain members later,
+	// so they are renamed to group-{id} once the ID is known
+	query := `
+		INSERT INTO rooms (name, type, owner_id, direct_key, created_by)
+		VALUES (?, 'group', NULL, ?, ?)
+	`
+	result, err := tx.ExecContext(ctx, query, groupKey, groupKey, creatorID)
+	if err != nil {
+		return nil, fmt.Errorf("insert room: %w", err)
+	}
+	roomID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get last insert id: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE rooms SET name = ? WHERE id = ?`, fmt.Sprintf("group-%d", roomID), roomID); err != nil {
+		return nil, fmt.Errorf("name room: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO room_members (user_id, room_id) VALUES (?, ?)`, userID, roomID); err != nil {
+			return nil, fmt.Errorf("add user %d to members: %w", userID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return s.GetRoomByID(ctx, roomID)
+}
+
+// SetRoomDirectKey replaces a room's direct key; nil clears it.
+func (s *SQLiteStore) SetRoomDirectKey(ctx context.Context, roomID int64, key *string) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE rooms SET direct_key = ? WHERE id = ?`, key, roomID); err != nil {
+		return fmt.Errorf("update direct key: %w", err)
+	}
+	return nil
+}
+
+// ConvertToPrivateRoom turns a room into a private room named name and owned by ownerID.
+func (s *SQLiteStore) ConvertToPrivateRoom(ctx context.Context, roomID int64, name string, ownerID int64) error {
+	query := `
+		UPDATE rooms
+		SET type = 'private', name = ?, owner_id = ?, direct_key = NULL
+		WHERE id = ?
+	`
+	if _, err := s.db.ExecContext(ctx, query, name, ownerID, roomID); err != nil {
+		return fmt.Errorf("convert room: %w", err)
+	}
+	return nil
+}
+
 // AddMember adds a user to a room.
 func (s *SQLiteStore) AddMember(ctx context.Context, userID, roomID int64) error {
 	query := `
@@ -523,107 +654,1856 @@ func (s *SQLiteStore) ListMembers(ctx context.Context, roomID int64) ([]int64, e
 	return members, rows.Err()
 }
 
-// ==== MessageStore implementation ====
+// CountMembers returns the number of members of each given room, keyed by room ID.
+func (s *SQLiteStore) CountMembers(ctx context.Context, roomIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return counts, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(roomIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]interface{}, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		args = append(args, id)
+		counts[id] = 0
+	}
 
-// SaveMessage persists a message to storage.
-func (s *SQLiteStore) SaveMessage(ctx context.Context, msg *store.Message) error {
 	query := `
-		INSERT INTO messages (room_id, user_id, body, created_at)
-		VALUES (?, ?, ?, ?)
+		SELECT room_id, COUNT(*)
+		FROM room_members
+		WHERE room_id IN (` + placeholders + `)
+		GROUP BY room_id
 	`
-	result, err := s.db.ExecContext(ctx, query, msg.RoomID, msg.UserID, msg.Body, msg.CreatedAt)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("insert message: %w", err)
+		return nil, fmt.Errorf("count members: %w", err)
 	}
+	defer rows.Close()
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return fmt.Errorf("get last insert id: %w", err)
+	for rows.Next() {
+		var roomID int64
+		var count int
+		if err := rows.Scan(&roomID, &count); err != nil {
+			return nil, fmt.Errorf("scan member count: %w", err)
+		}
+		counts[roomID] = count
 	}
 
-	msg.ID = id
-	return nil
+	return counts, rows.Err()
 }
 
-// ListMessages retrieves messages from a room with pagination.
-func (s *SQLiteStore) ListMessages(ctx context.Context, roomID int64, limit int, beforeID *int64) ([]*store.Message, error) {
-	var query string
-	var args []interface{}
+// ListMemberNames returns the members of each given room with their usernames, ordered by username.
+func (s *SQLiteStore) ListMemberNames(ctx context.Context, roomIDs []int64) (map[int64][]store.RoomMemberName, error) {
+	names := make(map[int64][]store.RoomMemberName, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return names, nil
+	}
 
-	if beforeID != nil {
-		query = `
-			SELECT id, room_id, user_id, body, created_at
-			FROM messages
-			WHERE room_id = ? AND id < ?
-			ORDER BY id DESC
-			LIMIT ?
-		`
-		args = []interface{}{roomID, *beforeID, limit}
-	} else {
-		query = `
-			SELECT id, room_id, user_id, body, created_at
-			FROM messages
-			WHERE room_id = ?
-			ORDER BY id DESC
-			LIMIT ?
-		`
-		args = []interface{}{roomID, limit}
+	placeholders := strings.Repeat("?,", len(roomIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]interface{}, 0, len(roomIDs))
+	for _, id := range roomIDs {
+		args = append(args, id)
 	}
 
+	query := `
+		SELECT rm.room_id, u.id, u.username
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE rm.room_id IN (` + placeholders + `)
+		ORDER BY rm.room_id, u.username
+	`
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query messages: %w", err)
+		return nil, fmt.Errorf("query member names: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*store.Message
 	for rows.Next() {
-		var msg store.Message
-		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.Body, &msg.CreatedAt); err != nil {
-			return nil, fmt.Errorf("scan message: %w", err)
+		var roomID int64
+		var member store.RoomMemberName
+		if err := rows.Scan(&roomID, &member.UserID, &member.Username); err != nil {
+			return nil, fmt.Errorf("scan member name: %w", err)
 		}
-		messages = append(messages, &msg)
+		names[roomID] = append(names[roomID], member)
 	}
 
-	// Reverse to get chronological order
-	for i := range len(messages) / 2 {
-		messages[i], messages[len(messages)-1-i] = messages[len(messages)-1-i], messages[i]
+	return names, rows.Err()
+}
+
+// ListRoomMembers lists all members of a room with their roles, oldest first.
+func (s *SQLiteStore) ListRoomMembers(ctx context.Context, roomID int64) ([]*store.RoomMember, error) {
+	query := `
+		SELECT rm.user_id, rm.room_id,
+		       CASE WHEN r.owner_id = rm.user_id THEN 'owner' ELSE rm.role END,
+		       rm.joined_at
+		FROM room_members rm
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE rm.room_id = ?
+		ORDER BY rm.joined_at ASC, rm.user_id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("query members: %w", err)
 	}
+	defer rows.Close()
 
-	return messages, rows.Err()
-}
+	var members []*store.RoomMember
+	for rows.Next() {
+		var m store.RoomMember
+		if err := rows.Scan(&m.UserID, &m.RoomID, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("scan member: %w", err)
+		}
+		members = append(members, &m)
+	}
 
-// ==== UserStore additions ====
+	return members, rows.Err()
+}
 
-// GetUserCallSettings retrieves user's call privacy settings.
-func (s *SQLiteStore) GetUserCallSettings(ctx context.Context, userID int64) (store.AllowCallsFrom, error) {
-	query := `SELECT allow_calls_from FROM users WHERE id = ?`
-	var setting string
-	err := s.db.QueryRowContext(ctx, query, userID).Scan(&setting)
+// GetMemberRole returns the user's role in a room, or "" if they are not a member.
+func (s *SQLiteStore) GetMemberRole(ctx context.Context, userID, roomID int64) (store.RoomRole, error) {
+	query := `
+		SELECT CASE WHEN r.owner_id = ? THEN 'owner' ELSE rm.role END
+		FROM rooms r
+		LEFT JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = ?
+		WHERE r.id = ?
+	`
+	var role sql.NullString
+	err := s.db.QueryRowContext(ctx, query, userID, userID, roomID).Scan(&role)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", fmt.Errorf("user not found: %w", err)
+			return "", nil
 		}
-		return "", fmt.Errorf("query user settings: %w", err)
+		return "", fmt.Errorf("query member role: %w", err)
 	}
-	return store.AllowCallsFrom(setting), nil
+
+	return store.RoomRole(role.String), nil
 }
 
-// UpdateUserCallSettings updates user's call privacy settings.
-func (s *SQLiteStore) UpdateUserCallSettings(ctx context.Context, userID int64, setting store.AllowCallsFrom) error {
-	query := `UPDATE users SET allow_calls_from = ? WHERE id = ?`
-	result, err := s.db.ExecContext(ctx, query, string(setting), userID)
+// SetMemberRole changes a member's role. Returns false if the user is not a member.
+func (s *SQLiteStore) SetMemberRole(ctx context.Context, userID, roomID int64, role store.RoomRole) (bool, error) {
+	query := `
+		UPDATE room_members SET role = ?
+		WHERE user_id = ? AND room_id = ?
+	`
+	result, err := s.db.ExecContext(ctx, query, role, userID, roomID)
 	if err != nil {
-		return fmt.Errorf("update user settings: %w", err)
+		return false, fmt.Errorf("update member role: %w", err)
 	}
-	rows, err := result.RowsAffected()
+	n, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("get rows affected: %w", err)
+		return false, fmt.Errorf("get rows affected: %w", err)
 	}
-	if rows == 0 {
-		return fmt.Errorf("user not found")
+
+	return n > 0, nil
+}
+
+// ==== MessageStore implementation ====
+
+// messageColumns is the column list shared by all message queries; see scanMessage.
+const messageColumns = `id, room_id, user_id, body, created_at, edited_at, deleted_at, reply_to`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage scans a row selected with messageColumns.
+func scanMessage(row rowScanner) (*store.Message, error) {
+	var msg store.Message
+	var editedAt, deletedAt sql.NullTime
+	var replyTo sql.NullInt64
+	if err := row.Scan(
+		&msg.ID,
+		&msg.RoomID,
+		&msg.UserID,
+		&msg.Body,
+		&msg.CreatedAt,
+		&editedAt,
+		&deletedAt,
+		&replyTo,
+	); err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		msg.DeletedAt = &deletedAt.Time
+	}
+	if replyTo.Valid {
+		msg.ReplyTo = &replyTo.Int64
+	}
+	return &msg, nil
+}
+
+// SaveMessage persists a message to storage and links its attachments.
+func (s *SQLiteStore) SaveMessage(ctx context.Context, msg *store.Message) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
 	}
-	return nil
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	query := `
+		INSERT INTO messages (room_id, user_id, body, created_at, reply_to, client_msg_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	var replyTo sql.NullInt64
+	if msg.ReplyTo != nil {
+		replyTo = sql.NullInt64{Int64: *msg.ReplyTo, Valid: true}
+	}
+	var clientMsgID sql.NullString
+	if msg.ClientMsgID != nil {
+		clientMsgID = sql.NullString{String: *msg.ClientMsgID, Valid: true}
+	}
+	result, err := tx.ExecContext(ctx, query, msg.RoomID, msg.UserID, msg.Body, msg.CreatedAt, replyTo, clientMsgID)
+	if err != nil {
+		return fmt.Errorf("insert message: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	for position, attachmentID := range msg.AttachmentIDs {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE attachments
+			SET message_id = ?, position = ?
+			WHERE id = ? AND user_id = ? AND message_id IS NULL
+		`, id, position, attachmentID, msg.UserID)
+		if err != nil {
+			return fmt.Errorf("link attachment: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get rows affected: %w", err)
+		}
+		if rows == 0 {
+			return fmt.Errorf("attachment %d is not available: %w", attachmentID, sql.ErrNoRows)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	msg.ID = id
+	return nil
+}
+
+// ListMessages retrieves messages from a room with pagination.
+func (s *SQLiteStore) ListMessages(ctx context.Context, roomID int64, limit int, beforeID *int64) ([]*store.Message, error) {
+	return s.listMessagesWhere(ctx, "room_id = ?", roomID, limit, beforeID)
+}
+
+// ListMessagesAfter retrieves messages newer than afterID in chronological order.
+func (s *SQLiteStore) ListMessagesAfter(ctx context.Context, roomID, afterID int64, limit int) ([]*store.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE room_id = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, roomID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*store.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// ListReplies retrieves direct replies to a root message with pagination.
+func (s *SQLiteStore) ListReplies(ctx context.Context, rootID int64, limit int, beforeID *int64) ([]*store.Message, error) {
+	return s.listMessagesWhere(ctx, "reply_to = ?", rootID, limit, beforeID)
+}
+
+// listMessagesWhere pages through messages matching a single-argument filter.
+// Returns up to limit messages older than beforeID (if set) in chronological order.
+func (s *SQLiteStore) listMessagesWhere(ctx context.Context, filter string, arg int64, limit int, beforeID *int64) ([]*store.Message, error) {
+	var query string
+	var args []interface{}
+
+	if beforeID != nil {
+		query = `
+			SELECT ` + messageColumns + `
+			FROM messages
+			WHERE ` + filter + ` AND id < ?
+			ORDER BY id DESC
+			LIMIT ?
+		`
+		args = []interface{}{arg, *beforeID, limit}
+	} else {
+		query = `
+			SELECT ` + messageColumns + `
+			FROM messages
+			WHERE ` + filter + `
+			ORDER BY id DESC
+			LIMIT ?
+		`
+		args = []interface{}{arg, limit}
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*store.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	// Reverse to get chronological order
+	for i := range len(messages) / 2 {
+		messages[i], messages[len(messages)-1-i] = messages[len(messages)-1-i], messages[i]
+	}
+
+	return messages, rows.Err()
+}
+
+// GetMessage retrieves a single message by ID.
+func (s *SQLiteStore) GetMessage(ctx context.Context, id int64) (*store.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE id = ?
+	`
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("message not found: %w", err)
+		}
+		return nil, fmt.Errorf("query message: %w", err)
+	}
+
+	return msg, nil
+}
+
+// GetMessageByClientID retrieves a user's message by its client-generated ID (nil if not found).
+func (s *SQLiteStore) GetMessageByClientID(ctx context.Context, userID int64, clientMsgID string) (*store.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE user_id = ? AND client_msg_id = ?
+	`
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, query, userID, clientMsgID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query message by client id: %w", err)
+	}
+	msg.ClientMsgID = &clientMsgID
+	return msg, nil
+}
+
+// EditMessage replaces the body of a message and records the edit time.
+func (s *SQLiteStore) EditMessage(ctx context.Context, id int64, body string, editedAt time.Time) error {
+	query := `
+		UPDATE messages
+		SET body = ?, edited_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, query, body, editedAt, id)
+	if err != nil {
+		return fmt.Errorf("update message: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("message not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// DeleteMessage soft-deletes a message: the body is cleared, deleted_at is set
+// and its reactions are removed.
+func (s *SQLiteStore) DeleteMessage(ctx context.Context, id int64, deletedAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	query := `
+		UPDATE messages
+		SET body = '', deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, deletedAt, id)
+	if err != nil {
+		return fmt.Errorf("delete message: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("message not found: %w", sql.ErrNoRows)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_reactions WHERE message_id = ?`, id); err != nil {
+		return fmt.Errorf("delete reactions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// snippetTokens is the approximate number of tokens in a search snippet.
+const snippetTokens = 12
+
+// SearchMessages runs a full-text search over message bodies via the messages_fts index.
+func (s *SQLiteStore) SearchMessages(ctx context.Context, search store.MessageSearch) ([]*store.MessageSearchHit, error) {
+	if !s.search {
+		return nil, store.ErrSearchUnavailable
+	}
+	match := ftsQuery(search.Query)
+	if match == "" || len(search.RoomIDs) == 0 || search.Limit <= 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(search.RoomIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := []interface{}{store.SnippetMatchStart, store.SnippetMatchEnd, snippetTokens, match}
+	for _, id := range search.RoomIDs {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT ` + messageColumns + `, f.snippet
+		FROM messages
+		JOIN (
+			SELECT rowid AS id, snippet(messages_fts, 0, ?, ?, '…', ?) AS snippet
+			FROM messages_fts
+			WHERE messages_fts MATCH ?
+		) f USING (id)
+		WHERE room_id IN (` + placeholders + `) AND deleted_at IS NULL
+	`
+	if search.UserID != nil {
+		query += ` AND user_id = ?`
+		args = append(args, *search.UserID)
+	}
+	if search.BeforeID != nil {
+		query += ` AND id < ?`
+		args = append(args, *search.BeforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, search.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []*store.MessageSearchHit
+	for rows.Next() {
+		var hit store.MessageSearchHit
+		msg, err := scanMessage(trailingScanner{row: rows, extra: []any{&hit.Snippet}})
+		if err != nil {
+			return nil, fmt.Errorf("scan search hit: %w", err)
+		}
+		hit.Message = msg
+		hits = append(hits, &hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// trailingScanner scans extra columns selected after the ones its caller asks for.
+type trailingScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func (t trailingScanner) Scan(dest ...any) error {
+	return t.row.Scan(append(dest, t.extra...)...)
+}
+
+// ftsQuery turns free text into an FTS5 query that cannot fail to parse: every
+// whitespace-separated term is quoted, the terms are ANDed together and the last
+// one matches as a prefix so results update while the user is still typing.
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
+
+// ==== ReactionStore implementation ====
+
+// AddReaction records a user's reaction. Returns false if it already existed.
+func (s *SQLiteStore) AddReaction(ctx context.Context, messageID, userID int64, emoji string) (bool, error) {
+	query := `
+		INSERT OR IGNORE INTO message_reactions (message_id, user_id, emoji)
+		VALUES (?, ?, ?)
+	`
+	result, err := s.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("insert reaction: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// RemoveReaction removes a user's reaction. Returns false if it did not exist.
+func (s *SQLiteStore) RemoveReaction(ctx context.Context, messageID, userID int64, emoji string) (bool, error) {
+	query := `
+		DELETE FROM message_reactions
+		WHERE message_id = ? AND user_id = ? AND emoji = ?
+	`
+	result, err := s.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("delete reaction: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListReactionCounts aggregates reactions for the given messages, keyed by message ID.
+// Emojis are ordered by when they were first used on each message.
+func (s *SQLiteStore) ListReactionCounts(ctx context.Context, messageIDs []int64) (map[int64][]store.ReactionCount, error) {
+	counts := make(map[int64][]store.ReactionCount)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(messageIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT message_id, emoji, COUNT(*)
+		FROM message_reactions
+		WHERE message_id IN (` + placeholders + `)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at), emoji
+	`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var rc store.ReactionCount
+		if err := rows.Scan(&messageID, &rc.Emoji, &rc.Count); err != nil {
+			return nil, fmt.Errorf("scan reaction: %w", err)
+		}
+		counts[messageID] = append(counts[messageID], rc)
+	}
+
+	return counts, rows.Err()
+}
+
+// ==== ReadStateStore implementation ====
+
+// MarkRoomRead moves the user's read position forward to lastReadID.
+// Returns false if the stored position was already at or past lastReadID.
+func (s *SQLiteStore) MarkRoomRead(ctx context.Context, userID, roomID, lastReadID int64) (bool, error) {
+	query := `
+		INSERT INTO room_read_state (user_id, room_id, last_read_id, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, room_id) DO UPDATE
+		SET last_read_id = excluded.last_read_id, updated_at = excluded.updated_at
+		WHERE excluded.last_read_id > room_read_state.last_read_id
+	`
+	result, err := s.db.ExecContext(ctx, query, userID, roomID, lastReadID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("upsert read state: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListReadStates returns read positions and unread counters for the given rooms, keyed by room ID.
+func (s *SQLiteStore) ListReadStates(ctx context.Context, userID int64, roomIDs []int64) (map[int64]store.RoomReadState, error) {
+	states := make(map[int64]store.RoomReadState, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return states, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(roomIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]interface{}, 0, len(roomIDs)+2)
+	args = append(args, userID, userID)
+	for _, id := range roomIDs {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT r.id,
+		       COALESCE(rs.last_read_id, 0),
+		       (SELECT COUNT(*) FROM messages m
+		        WHERE m.room_id = r.id
+		          AND m.id > COALESCE(rs.last_read_id, 0)
+		          AND m.deleted_at IS NULL
+		          AND m.user_id != ?)
+		FROM rooms r
+		LEFT JOIN room_read_state rs ON rs.room_id = r.id AND rs.user_id = ?
+		WHERE r.id IN (` + placeholders + `)
+	`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query read states: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st store.RoomReadState
+		if err := rows.Scan(&st.RoomID, &st.LastReadID, &st.UnreadCount); err != nil {
+			return nil, fmt.Errorf("scan read state: %w", err)
+		}
+		states[st.RoomID] = st
+	}
+
+	return states, rows.Err()
+}
+
+// ==== ModerationStore implementation ====
+
+// BanUser bans a user from a room, replacing any earlier ban.
+func (s *SQLiteStore) BanUser(ctx context.Context, ban *store.RoomBan) error {
+	query := `
+		INSERT INTO room_bans (room_id, user_id, banned_by, reason, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(room_id, user_id) DO UPDATE
+		SET banned_by = excluded.banned_by, reason = excluded.reason, created_at = excluded.created_at
+	`
+	if ban.CreatedAt.IsZero() {
+		ban.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, query, ban.RoomID, ban.UserID, ban.BannedBy, ban.Reason, ban.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert room ban: %w", err)
+	}
+
+	return nil
+}
+
+// UnbanUser lifts a ban. Returns false if the user was not banned.
+func (s *SQLiteStore) UnbanUser(ctx context.Context, userID, roomID int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM room_bans WHERE user_id = ? AND room_id = ?`, userID, roomID)
+	if err != nil {
+		return false, fmt.Errorf("delete room ban: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// IsBanned checks if a user is banned from a room.
+func (s *SQLiteStore) IsBanned(ctx context.Context, userID, roomID int64) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, `SELECT 1 FROM room_bans WHERE user_id = ? AND room_id = ?`, userID, roomID).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("query room ban: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListBans lists a room's bans, newest first.
+func (s *SQLiteStore) ListBans(ctx context.Context, roomID int64) ([]*store.RoomBan, error) {
+	query := `
+		SELECT room_id, user_id, banned_by, reason, created_at
+		FROM room_bans
+		WHERE room_id = ?
+		ORDER BY created_at DESC, user_id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("query room bans: %w", err)
+	}
+	defer rows.Close()
+
+	var bans []*store.RoomBan
+	for rows.Next() {
+		var ban store.RoomBan
+		if err := rows.Scan(&ban.RoomID, &ban.UserID, &ban.BannedBy, &ban.Reason, &ban.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan room ban: %w", err)
+		}
+		bans = append(bans, &ban)
+	}
+
+	return bans, rows.Err()
+}
+
+// ListBannedRoomIDs lists the rooms a user is banned from.
+func (s *SQLiteStore) ListBannedRoomIDs(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT room_id FROM room_bans WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query room bans: %w", err)
+	}
+	defer rows.Close()
+
+	var roomIDs []int64
+	for rows.Next() {
+		var roomID int64
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, fmt.Errorf("scan room ban: %w", err)
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+
+	return roomIDs, rows.Err()
+}
+
+// MuteUser mutes a user in a room, replacing any earlier mute.
+func (s *SQLiteStore) MuteUser(ctx context.Context, mute *store.RoomMute) error {
+	query := `
+		INSERT INTO room_mutes (room_id, user_id, muted_by, reason, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(room_id, user_id) DO UPDATE
+		SET muted_by = excluded.muted_by, reason = excluded.reason,
+		    expires_at = excluded.expires_at, created_at = excluded.created_at
+	`
+	if mute.CreatedAt.IsZero() {
+		mute.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, query, mute.RoomID, mute.UserID, mute.MutedBy, mute.Reason, mute.ExpiresAt, mute.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("upsert room mute: %w", err)
+	}
+
+	return nil
+}
+
+// UnmuteUser lifts a mute. Returns false if the user was not muted.
+func (s *SQLiteStore) UnmuteUser(ctx context.Context, userID, roomID int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM room_mutes WHERE user_id = ? AND room_id = ?`, userID, roomID)
+	if err != nil {
+		return false, fmt.Errorf("delete room mute: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// GetActiveMute returns the user's mute in a room if it expires after now, or nil.
+func (s *SQLiteStore) GetActiveMute(ctx context.Context, userID, roomID int64, now time.Time) (*store.RoomMute, error) {
+	query := `
+		SELECT room_id, user_id, muted_by, reason, expires_at, created_at
+		FROM room_mutes
+		WHERE user_id = ? AND room_id = ?
+	`
+	var mute store.RoomMute
+	err := s.db.QueryRowContext(ctx, query, userID, roomID).Scan(
+		&mute.RoomID, &mute.UserID, &mute.MutedBy, &mute.Reason, &mute.ExpiresAt, &mute.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query room mute: %w", err)
+	}
+	// Expired mutes are left in place and simply ignored; the next mute overwrites them.
+	if !mute.ExpiresAt.After(now) {
+		return nil, nil
+	}
+
+	return &mute, nil
+}
+
+// AddAuditEntry appends an entry to a room's audit log and sets its ID.
+func (s *SQLiteStore) AddAuditEntry(ctx context.Context, entry *store.RoomAuditEntry) error {
+	query := `
+		INSERT INTO room_audit_log (room_id, actor_id, action, target_id, reason, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	result, err := s.db.ExecContext(ctx, query,
+		entry.RoomID, entry.ActorID, entry.Action, entry.TargetID, entry.Reason, entry.Details, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	entry.ID = id
+
+	return nil
+}
+
+// ListAuditEntries retrieves a room's audit log, newest first.
+func (s *SQLiteStore) ListAuditEntries(ctx context.Context, roomID int64, limit int, beforeID *int64) ([]*store.RoomAuditEntry, error) {
+	query := `
+		SELECT id, room_id, actor_id, action, target_id, reason, details, created_at
+		FROM room_audit_log
+		WHERE room_id = ?
+	`
+	args := []interface{}{roomID}
+	if beforeID != nil {
+		query += ` AND id < ?`
+		args = append(args, *beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*store.RoomAuditEntry
+	for rows.Next() {
+		var e store.RoomAuditEntry
+		if err := rows.Scan(&e.ID, &e.RoomID, &e.ActorID, &e.Action, &e.TargetID, &e.Reason, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
+
+// ==== PinStore implementation ====
+
+// PinMessage pins a message in a room. Returns false if it was already pinned.
+func (s *SQLiteStore) PinMessage(ctx context.Context, pin *store.RoomPin) (bool, error) {
+	query := `
+		INSERT OR IGNORE INTO room_pins (room_id, message_id, pinned_by, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	if pin.CreatedAt.IsZero() {
+		pin.CreatedAt = time.Now()
+	}
+	result, err := s.db.ExecContext(ctx, query, pin.RoomID, pin.MessageID, pin.PinnedBy, pin.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("insert room pin: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// UnpinMessage unpins a message. Returns false if it was not pinned.
+func (s *SQLiteStore) UnpinMessage(ctx context.Context, roomID, messageID int64) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM room_pins WHERE room_id = ? AND message_id = ?`, roomID, messageID)
+	if err != nil {
+		return false, fmt.Errorf("delete room pin: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListPins lists a room's pins, newest first. Pins of deleted messages are skipped.
+func (s *SQLiteStore) ListPins(ctx context.Context, roomID int64) ([]*store.RoomPin, error) {
+	query := `
+		SELECT p.room_id, p.message_id, p.pinned_by, p.created_at
+		FROM room_pins p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.room_id = ? AND m.deleted_at IS NULL
+		ORDER BY p.created_at DESC, p.message_id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("query room pins: %w", err)
+	}
+	defer rows.Close()
+
+	var pins []*store.RoomPin
+	for rows.Next() {
+		var pin store.RoomPin
+		if err := rows.Scan(&pin.RoomID, &pin.MessageID, &pin.PinnedBy, &pin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan room pin: %w", err)
+		}
+		pins = append(pins, &pin)
+	}
+
+	return pins, rows.Err()
+}
+
+// ==== InviteStore implementation ====
+
+// inviteColumns is the column list shared by all invite queries; see scanInvite.
+// Invite times are stored in UTC so that expires_at compares correctly as text in SQL.
+const inviteColumns = `code, room_id, created_by, max_uses, uses, expires_at, revoked_at, created_at`
+
+// scanInvite scans a row selected with inviteColumns.
+func scanInvite(row rowScanner) (*store.RoomInvite, error) {
+	var invite store.RoomInvite
+	var revokedAt sql.NullTime
+	if err := row.Scan(
+		&invite.Code,
+		&invite.RoomID,
+		&invite.CreatedBy,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&revokedAt,
+		&invite.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
+	}
+	return &invite, nil
+}
+
+// CreateInvite stores a new invite.
+func (s *SQLiteStore) CreateInvite(ctx context.Context, invite *store.RoomInvite) error {
+	query := `
+		INSERT INTO room_invites (code, room_id, created_by, max_uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	if invite.CreatedAt.IsZero() {
+		invite.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, query, invite.Code, invite.RoomID, invite.CreatedBy, invite.MaxUses, invite.ExpiresAt.UTC(), invite.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("insert room invite: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvite retrieves an invite by code, whether or not it is still usable.
+func (s *SQLiteStore) GetInvite(ctx context.Context, code string) (*store.RoomInvite, error) {
+	query := `
+		SELECT ` + inviteColumns + `
+		FROM room_invites
+		WHERE code = ?
+	`
+	invite, err := scanInvite(s.db.QueryRowContext(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invite not found: %w", err)
+		}
+		return nil, fmt.Errorf("query room invite: %w", err)
+	}
+
+	return invite, nil
+}
+
+// ListActiveInvites lists a room's invites that are usable at now, newest first.
+func (s *SQLiteStore) ListActiveInvites(ctx context.Context, roomID int64, now time.Time) ([]*store.RoomInvite, error) {
+	query := `
+		SELECT ` + inviteColumns + `
+		FROM room_invites
+		WHERE room_id = ?
+		  AND revoked_at IS NULL
+		  AND expires_at > ?
+		  AND (max_uses = 0 OR uses < max_uses)
+		ORDER BY created_at DESC, code ASC
+	`
+	rows, err := s.db.QueryContext(ctx, query, roomID, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("query room invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*store.RoomInvite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan room invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// UseInvite counts one use of an invite if it is usable at now.
+// The check and the increment are a single statement, so concurrent accepts
+// cannot push an invite past max_uses.
+func (s *SQLiteStore) UseInvite(ctx context.Context, code string, now time.Time) (bool, error) {
+	query := `
+		UPDATE room_invites
+		SET uses = uses + 1
+		WHERE code = ?
+		  AND revoked_at IS NULL
+		  AND expires_at > ?
+		  AND (max_uses = 0 OR uses < max_uses)
+	`
+	result, err := s.db.ExecContext(ctx, query, code, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("use room invite: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ReturnInviteUse gives back a use counted by UseInvite.
+func (s *SQLiteStore) ReturnInviteUse(ctx context.Context, code string) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE room_invites SET uses = uses - 1 WHERE code = ? AND uses > 0`, code); err != nil {
+		return fmt.Errorf("return room invite use: %w", err)
+	}
+	return nil
+}
+
+// RevokeInvite revokes an invite. Returns false if it does not exist or was already revoked.
+func (s *SQLiteStore) RevokeInvite(ctx context.Context, code string, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE room_invites SET revoked_at = ? WHERE code = ? AND revoked_at IS NULL`, now.UTC(), code)
+	if err != nil {
+		return false, fmt.Errorf("revoke room invite: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ==== UserStore additions ====
+
+// GetUserCallSettings retrieves user's call privacy settings.
+func (s *SQLiteStore) GetUserCallSettings(ctx context.Context, userID int64) (store.AllowCallsFrom, error) {
+	query := `SELECT allow_calls_from FROM users WHERE id = ?`
+	var setting string
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&setting)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user not found: %w", err)
+		}
+		return "", fmt.Errorf("query user settings: %w", err)
+	}
+	return store.AllowCallsFrom(setting), nil
+}
+
+// UpdateUserCallSettings updates user's call privacy settings.
+func (s *SQLiteStore) UpdateUserCallSettings(ctx context.Context, userID int64, setting store.AllowCallsFrom) error {
+	query := `UPDATE users SET allow_calls_from = ? WHERE id = ?`
+	result, err := s.db.ExecContext(ctx, query, string(setting), userID)
+	if err != nil {
+		return fmt.Errorf("update user settings: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// GetUserLastSeen retrieves when the user was last connected (nil if never recorded).
+func (s *SQLiteStore) GetUserLastSeen(ctx context.Context, userID int64) (*time.Time, error) {
+	query := `SELECT last_seen_at FROM users WHERE id = ?`
+	var lastSeen sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&lastSeen)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+		return nil, fmt.Errorf("query last seen: %w", err)
+	}
+	if !lastSeen.Valid {
+		return nil, nil
+	}
+	return &lastSeen.Time, nil
+}
+
+// UpdateUserLastSeen records when the user's last connection closed.
+func (s *SQLiteStore) UpdateUserLastSeen(ctx context.Context, userID int64, lastSeen time.Time) error {
+	query := `UPDATE users SET last_seen_at = ? WHERE id = ?`
+	result, err := s.db.ExecContext(ctx, query, lastSeen, userID)
+	if err != nil {
+		return fmt.Errorf("update last seen: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetUserByEmail retrieves a registered user by email, ignoring case.
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	query := `
+		SELECT id, username, password_hash, is_guest, COALESCE(session_id, ''), COALESCE(email, ''), created_at
+		FROM users
+		WHERE email = ? COLLATE NOCASE AND is_guest = 0
+	`
+	var user store.User
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.IsGuest,
+		&user.SessionID,
+		&user.Email,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+		return nil, fmt.Errorf("query user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// UpdateUserEmail sets a user's email; empty clears it.
+func (s *SQLiteStore) UpdateUserEmail(ctx context.Context, userID int64, email string) error {
+	var value any
+	if email != "" {
+		value = email
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET email = ? WHERE id = ?`, value, userID)
+	if err != nil {
+		return fmt.Errorf("update email: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// UpdatePasswordHash replaces a user's password hash.
+func (s *SQLiteStore) UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("update password hash: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ==== AttachmentStore implementation ====
+
+// attachmentColumns is the column list shared by all attachment queries; see scanAttachment.
+const attachmentColumns = `id, user_id, message_id, storage_key, filename, content_type, size, created_at`
+
+// scanAttachment scans a row selected with attachmentColumns.
+func scanAttachment(row rowScanner) (*store.Attachment, error) {
+	var a store.Attachment
+	var messageID sql.NullInt64
+	if err := row.Scan(&a.ID, &a.UserID, &messageID, &a.StorageKey, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	if messageID.Valid {
+		a.MessageID = &messageID.Int64
+	}
+	return &a, nil
+}
+
+// CreateAttachment records a new, unlinked upload and sets its ID.
+func (s *SQLiteStore) CreateAttachment(ctx context.Context, a *store.Attachment) error {
+	query := `
+		INSERT INTO attachments (user_id, storage_key, filename, content_type, size, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.ExecContext(ctx, query, a.UserID, a.StorageKey, a.Filename, a.ContentType, a.Size, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert attachment: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+
+	a.ID = id
+	return nil
+}
+
+// GetAttachment retrieves an attachment by ID.
+func (s *SQLiteStore) GetAttachment(ctx context.Context, id int64) (*store.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = ?`
+	a, err := scanAttachment(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("attachment not found: %w", err)
+		}
+		return nil, fmt.Errorf("query attachment: %w", err)
+	}
+
+	return a, nil
+}
+
+// ListAttachments retrieves the attachments of live messages, keyed by message ID.
+func (s *SQLiteStore) ListAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*store.Attachment, error) {
+	attachments := make(map[int64][]*store.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	placeholders := strings.Repeat("?,", len(messageIDs))
+	placeholders = placeholders[:len(placeholders)-1]
+	args := make([]interface{}, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE message_id IN (` + placeholders + `)
+		  AND message_id IN (SELECT id FROM messages WHERE deleted_at IS NULL)
+		ORDER BY message_id, position
+	`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		attachments[*a.MessageID] = append(attachments[*a.MessageID], a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// ==== MentionStore implementation ====
+
+// visibleMentions restricts a mention query to live messages in rooms the user is
+// still a member of. Takes the user ID as its only argument.
+const visibleMentions = `
+	room_id IN (SELECT room_id FROM room_members WHERE user_id = ?)
+	AND message_id IN (SELECT id FROM messages WHERE deleted_at IS NULL)
+`
+
+// CreateMentions records mentions, skipping users already mentioned by the message.
+func (s *SQLiteStore) CreateMentions(ctx context.Context, mentions []*store.Mention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	query := `
+		INSERT OR IGNORE INTO mentions (user_id, message_id, room_id, author_id, kind, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	for _, m := range mentions {
+		result, err := tx.ExecContext(ctx, query, m.UserID, m.MessageID, m.RoomID, m.AuthorID, m.Kind, m.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("insert mention: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("get rows affected: %w", err)
+		} else if n == 0 {
+			continue
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("get last insert id: %w", err)
+		}
+		m.ID = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListMentions retrieves a user's visible mentions, newest first.
+func (s *SQLiteStore) ListMentions(ctx context.Context, userID int64, unreadOnly bool, limit int, beforeID *int64) ([]*store.Mention, error) {
+	query := `
+		SELECT id, user_id, message_id, room_id, author_id, kind, read_at, created_at
+		FROM mentions
+		WHERE user_id = ? AND ` + visibleMentions
+	args := []interface{}{userID, userID}
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	if beforeID != nil {
+		query += ` AND id < ?`
+		args = append(args, *beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []*store.Mention
+	for rows.Next() {
+		var m store.Mention
+		var readAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.UserID, &m.MessageID, &m.RoomID, &m.AuthorID, &m.Kind, &readAt, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan mention: %w", err)
+		}
+		if readAt.Valid {
+			m.ReadAt = &readAt.Time
+		}
+		mentions = append(mentions, &m)
+	}
+
+	return mentions, rows.Err()
+}
+
+// CountUnreadMentions counts a user's visible unread mentions.
+func (s *SQLiteStore) CountUnreadMentions(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM mentions
+		WHERE user_id = ? AND read_at IS NULL AND ` + visibleMentions
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, userID, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count mentions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkMentionsRead marks a user's mentions as read.
+func (s *SQLiteStore) MarkMentionsRead(ctx context.Context, userID int64, ids []int64, readAt time.Time) (int64, error) {
+	query := `UPDATE mentions SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{readAt, userID}
+	if len(ids) > 0 {
+		placeholders := strings.Repeat("?,", len(ids))
+		query += ` AND id IN (` + placeholders[:len(placeholders)-1] + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark mentions read: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+	return n, nil
+}
+
+// ==== LoginAuditStore implementation ====
+
+// RecordLoginFailure stores a failed login and sets its ID.
+func (s *SQLiteStore) RecordLoginFailure(ctx context.Context, failure *store.LoginFailure) error {
+	query := `
+		INSERT INTO login_failures (username, user_id, ip, user_agent, reason, locked, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if failure.CreatedAt.IsZero() {
+		failure.CreatedAt = time.Now()
+	}
+	result, err := s.db.ExecContext(ctx, query,
+		failure.Username, failure.UserID, failure.IP, failure.UserAgent, failure.Reason, failure.Locked, failure.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("insert login failure: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	failure.ID = id
+	return nil
+}
+
+// ListLoginFailures lists the failed logins on a user's account, newest first.
+func (s *SQLiteStore) ListLoginFailures(ctx context.Context, userID int64, limit int) ([]*store.LoginFailure, error) {
+	query := `
+		SELECT id, username, user_id, ip, user_agent, reason, locked, created_at
+		FROM login_failures
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query login failures: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []*store.LoginFailure
+	for rows.Next() {
+		var f store.LoginFailure
+		if err := rows.Scan(&f.ID, &f.Username, &f.UserID, &f.IP, &f.UserAgent, &f.Reason, &f.Locked, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan login failure: %w", err)
+		}
+		failures = append(failures, &f)
+	}
+
+	return failures, rows.Err()
+}
+
+// ==== PasswordResetStore implementation ====
+
+// CreatePasswordReset stores a new reset token and sets its ID.
+func (s *SQLiteStore) CreatePasswordReset(ctx context.Context, reset *store.PasswordReset) error {
+	query := `
+		INSERT INTO password_resets (user_id, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+	if reset.CreatedAt.IsZero() {
+		reset.CreatedAt = time.Now()
+	}
+	result, err := s.db.ExecContext(ctx, query, reset.UserID, reset.TokenHash, reset.CreatedAt.UTC(), reset.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("insert password reset: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	reset.ID = id
+	return nil
+}
+
+// GetPasswordReset retrieves a reset token by hash.
+func (s *SQLiteStore) GetPasswordReset(ctx context.Context, tokenHash string) (*store.PasswordReset, error) {
+	query := `
+		SELECT id, user_id, token_hash, created_at, expires_at, used_at
+		FROM password_resets
+		WHERE token_hash = ?
+	`
+	var reset store.PasswordReset
+	var usedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&reset.ID,
+		&reset.UserID,
+		&reset.TokenHash,
+		&reset.CreatedAt,
+		&reset.ExpiresAt,
+		&usedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("password reset not found: %w", err)
+		}
+		return nil, fmt.Errorf("query password reset: %w", err)
+	}
+	if usedAt.Valid {
+		reset.UsedAt = &usedAt.Time
+	}
+	return &reset, nil
+}
+
+// CountPasswordResetsSince counts the reset tokens created for a user since the given time.
+func (s *SQLiteStore) CountPasswordResetsSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND created_at >= ?`,
+		userID, since.UTC(),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count password resets: %w", err)
+	}
+	return count, nil
+}
+
+// ResetPassword uses a reset token and sets the user's password hash in one transaction.
+func (s *SQLiteStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_resets SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id
+	`, now.UTC(), tokenHash, now.UTC()).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("use password reset: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return false, fmt.Errorf("update password hash: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`,
+		now.UTC(), userID,
+	); err != nil {
+		return false, fmt.Errorf("cancel password resets: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// CancelPasswordResets makes all unused reset tokens of a user unusable.
+func (s *SQLiteStore) CancelPasswordResets(ctx context.Context, userID int64, now time.Time) error {
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`,
+		now.UTC(), userID,
+	); err != nil {
+		return fmt.Errorf("cancel password resets: %w", err)
+	}
+	return nil
+}
+
+// ==== IdentityStore implementation ====
+
+// GetUserByIdentity retrieves the user linked to subject at issuer.
+func (s *SQLiteStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (*store.User, error) {
+	query := `
+		SELECT u.id, u.username, u.password_hash, u.is_guest, COALESCE(u.session_id, ''), COALESCE(u.email, ''), u.created_at
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ?
+	`
+	var user store.User
+	err := s.db.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.IsGuest,
+		&user.SessionID,
+		&user.Email,
+		&user.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+		return nil, fmt.Errorf("query user by identity: %w", err)
+	}
+
+	return &user, nil
+}
+
+// LinkIdentity links subject at issuer to an existing user.
+func (s *SQLiteStore) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) (bool, error) {
+	query := `
+		INSERT OR IGNORE INTO user_identities (user_id, issuer, subject)
+		VALUES (?, ?, ?)
+	`
+	result, err := s.db.ExecContext(ctx, query, userID, issuer, subject)
+	if err != nil {
+		return false, fmt.Errorf("insert identity: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// CreateUserWithIdentity creates a user without a password, linked to subject at issuer.
+func (s *SQLiteStore) CreateUserWithIdentity(ctx context.Context, username, issuer, subject string) (*store.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	// An empty password hash never matches, so the user can only sign in through the provider
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO users (username, password_hash, is_guest)
+		VALUES (?, '', 0)
+	`, username)
+	if err != nil {
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get last insert id: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject)
+		VALUES (?, ?, ?)
+	`, id, issuer, subject); err != nil {
+		return nil, fmt.Errorf("insert identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return s.GetUserByID(ctx, id)
+}
+
+// ==== SessionStore implementation ====
+
+// sessionColumns is the column list shared by all session queries; see scanSession.
+// Session times are stored in UTC so that expires_at compares correctly as text in SQL.
+const sessionColumns = `id, user_id, refresh_hash, prev_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at`
+
+// scanSession scans a row selected with sessionColumns.
+func scanSession(row rowScanner) (*store.Session, error) {
+	var session store.Session
+	var prevHash sql.NullString
+	var revokedAt sql.NullTime
+	if err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshHash,
+		&prevHash,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&revokedAt,
+	); err != nil {
+		return nil, err
+	}
+	session.PrevRefreshHash = prevHash.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+// CreateSession stores a new session and sets its ID.
+func (s *SQLiteStore) CreateSession(ctx context.Context, session *store.Session) error {
+	query := `
+		INSERT INTO sessions (user_id, refresh_hash, user_agent, ip, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	if session.LastUsedAt.IsZero() {
+		session.LastUsedAt = session.CreatedAt
+	}
+	result, err := s.db.ExecContext(ctx, query,
+		session.UserID,
+		session.RefreshHash,
+		session.UserAgent,
+		session.IP,
+		session.CreatedAt.UTC(),
+		session.LastUsedAt.UTC(),
+		session.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert session: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("get last insert id: %w", err)
+	}
+	session.ID = id
+	return nil
+}
+
+// GetSession retrieves a session by ID, whether or not it is still active.
+func (s *SQLiteStore) GetSession(ctx context.Context, id int64) (*store.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	session, err := scanSession(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session not found: %w", err)
+		}
+		return nil, fmt.Errorf("query session: %w", err)
+	}
+	return session, nil
+}
+
+// FindSessionByRefreshHash retrieves the session whose current or previous refresh token has the given hash.
+func (s *SQLiteStore) FindSessionByRefreshHash(ctx context.Context, hash string) (*store.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE refresh_hash = ? OR prev_refresh_hash = ?
+		ORDER BY refresh_hash = ? DESC
+		LIMIT 1
+	`
+	session, err := scanSession(s.db.QueryRowContext(ctx, query, hash, hash, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("session not found: %w", err)
+		}
+		return nil, fmt.Errorf("query session: %w", err)
+	}
+	return session, nil
+}
+
+// RotateSession replaces the session's refresh hash if it is still oldHash and the session is not revoked.
+func (s *SQLiteStore) RotateSession(ctx context.Context, id int64, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	query := `
+		UPDATE sessions
+		SET refresh_hash = ?, prev_refresh_hash = refresh_hash, last_used_at = ?, expires_at = ?
+		WHERE id = ? AND refresh_hash = ? AND revoked_at IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, query, newHash, usedAt.UTC(), expiresAt.UTC(), id, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("rotate session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListActiveSessions lists a user's sessions that are active at now, most recently used first.
+func (s *SQLiteStore) ListActiveSessions(ctx context.Context, userID int64, now time.Time) ([]*store.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_used_at DESC, id DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*store.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one of a user's sessions.
+func (s *SQLiteStore) RevokeSession(ctx context.Context, userID, id int64, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`, now.UTC(), id, userID)
+	if err != nil {
+		return false, fmt.Errorf("revoke session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// RevokeUserSessions revokes all of a user's sessions except exceptID and returns the revoked IDs.
+func (s *SQLiteStore) RevokeUserSessions(ctx context.Context, userID, exceptID int64, now time.Time) ([]int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() //nolint:errcheck // Rollback is called on defer, error is not critical here
+	}()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM sessions WHERE user_id = ? AND id != ? AND revoked_at IS NULL`, userID, exceptID)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan session id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sessions: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at IS NULL`, now.UTC(), userID, exceptID); err != nil {
+		return nil, fmt.Errorf("revoke sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return ids, nil
 }
 
 // ==== FriendStore implementation ====
@@ -3,7 +3,10 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 func TestSearchUsers(t *testing.T) {
@@ -16,6 +19,7 @@ func TestSearchUsers(t *testing.T) {
 			password_hash TEXT NOT NULL,
 			is_guest      BOOLEAN NOT NULL DEFAULT 0,
 			session_id    TEXT,
+			email         TEXT,
 			allow_calls_from TEXT DEFAULT 'everyone',
 			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);
@@ -103,3 +107,81 @@ func TestSearchUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"release", `"release"*`},
+		{"new  release", `"new" "release"*`},
+		{`say "hi" OR NEAR(`, `"say" """hi""" "OR" "NEAR("*`},
+	}
+
+	for _, tt := range tests {
+		if got := ftsQuery(tt.text); got != tt.expected {
+			t.Errorf("ftsQuery(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestInitSearch(t *testing.T) {
+	// A database migrated with the search index, then written to by a server
+	// without FTS5 (which drops the triggers)
+	var fts5 bool
+	s, err := NewWithSetup(":memory:", func(db *sql.DB) error {
+		if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, body TEXT NOT NULL)`); err != nil {
+			return err
+		}
+		if fts5 {
+			if _, err := db.Exec(`CREATE VIRTUAL TABLE messages_fts USING fts5(body, content = 'messages', content_rowid = 'id')`); err != nil {
+				return err
+			}
+		}
+		for _, query := range searchTriggers {
+			if _, err := db.Exec(query); err != nil {
+				return err
+			}
+		}
+		if _, err := db.Exec(`INSERT INTO messages (body) VALUES ('indexed')`); err != nil && fts5 {
+			return err
+		}
+		if _, err := db.Exec(`DROP TRIGGER messages_fts_insert`); err != nil {
+			return err
+		}
+		_, err := db.Exec(`INSERT INTO messages (body) VALUES ('missed')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	defer s.Close()
+
+	if s.SearchEnabled() != fts5 {
+		t.Fatalf("expected search enabled %v, got %v", fts5, s.SearchEnabled())
+	}
+	// Messages can be written either way
+	if _, err := s.db.Exec(`INSERT INTO messages (body) VALUES ('written')`); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+
+	if !fts5 {
+		_, err := s.SearchMessages(context.Background(), store.MessageSearch{Query: "written", RoomIDs: []int64{1}, Limit: 10})
+		if !errors.Is(err, store.ErrSearchUnavailable) {
+			t.Fatalf("expected ErrSearchUnavailable, got %v", err)
+		}
+		return
+	}
+	// The triggers are back and the index has caught up
+	for _, body := range []string{"indexed", "missed", "written"} {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages_fts WHERE messages_fts MATCH ?`, body).Scan(&n); err != nil || n != 1 {
+			t.Fatalf("expected %q in the index, got %d, %v", body, n, err)
+		}
+	}
+}
@@ -2,9 +2,14 @@ package store
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrSearchUnavailable is returned by SearchMessages when the store cannot search,
+// e.g. because SQLite was built without FTS5.
+var ErrSearchUnavailable = errors.New("message search unavailable")
+
 // User represents a user in the system.
 type User struct {
 	ID           int64
@@ -12,6 +17,7 @@ type User struct {
 	PasswordHash string
 	IsGuest      bool
 	SessionID    string // For guest user session tracking
+	Email        string // optional, for password resets; empty if not set
 	CreatedAt    time.Time
 }
 
@@ -20,9 +26,14 @@ type Room struct {
 	ID        int64
 	Name      string
 	Type      RoomType
-	OwnerID   *int64  // nil for public rooms, set for private/direct
-	DirectKey *string // for direct rooms: "dm:{minUserId}:{maxUserId}"
-	CreatedAt time.Time
+	OwnerID   *int64  // nil for public, direct and group rooms, set for private rooms and channels
+	DirectKey *string // direct rooms: "dm:{minUserId}:{maxUserId}"; group rooms: "group:{id}:{id}:..." over the sorted participants
+	CreatedBy *int64  // group rooms and the private rooms converted from them: the participant who created the group
+	// Metadata editable by members with RoomPermEditSettings; empty when unset
+	Topic       string
+	Description string
+	AvatarURL   string
+	CreatedAt   time.Time
 }
 
 // RoomType defines different types of rooms.
@@ -32,9 +43,16 @@ const (
 	RoomTypePublic  RoomType = "public"
 	RoomTypePrivate RoomType = "private"
 	RoomTypeDirect  RoomType = "direct"
-	RoomTypeChannel RoomType = "channel"
+	RoomTypeChannel RoomType = "channel" // broadcast-only: everyone reads, publishers post
+	RoomTypeGroup   RoomType = "group"   // ad-hoc multi-party DM: no owner, any participant may add people
 )
 
+// RoomMemberName pairs a room member's ID with their username.
+type RoomMemberName struct {
+	UserID   int64
+	Username string
+}
+
 // Message represents a persisted chat message.
 type Message struct {
 	ID        int64
@@ -42,15 +60,298 @@ type Message struct {
 	UserID    int64
 	Body      string
 	CreatedAt time.Time
+	EditedAt  *time.Time // nil if never edited
+	DeletedAt *time.Time // nil if not deleted; deleted messages keep their row with an empty body
+	ReplyTo   *int64     // ID of the message this one replies to, nil for top-level messages
+	// ClientMsgID is the sender-generated idempotency key, unique per user. Write-only:
+	// set it on SaveMessage; it is not loaded back by list/get methods.
+	ClientMsgID *string
+	// AttachmentIDs are uploads to link to the message, in display order. Write-only:
+	// SaveMessage links them; load them back with ListAttachments.
+	AttachmentIDs []int64
+}
+
+// Attachment is an uploaded file. It belongs to its uploader until a message shares it.
+type Attachment struct {
+	ID          int64
+	UserID      int64  // uploader
+	MessageID   *int64 // nil until a message uses the upload
+	StorageKey  string // key of the file contents in the upload storage backend
+	Filename    string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+}
+
+// Snippet highlight markers. SearchMessages wraps each matched term of a
+// MessageSearchHit snippet in these control characters so callers can escape
+// the text and render the highlights in their own markup.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// MessageSearch describes a full-text search over message bodies.
+type MessageSearch struct {
+	Query    string  // free text; every term must match, the last one as a prefix
+	RoomIDs  []int64 // rooms to search; an empty list matches nothing
+	UserID   *int64  // only messages sent by this user, nil for any sender
+	BeforeID *int64  // only messages older than this ID, for pagination
+	Limit    int
+}
+
+// MessageSearchHit is a message matching a search, with a highlighted excerpt of its body.
+type MessageSearchHit struct {
+	Message *Message
+	Snippet string
+}
+
+// MentionKind says how a message mentioned a user.
+type MentionKind string
+
+// Mention kinds.
+const (
+	MentionUser MentionKind = "user" // @username
+	MentionRoom MentionKind = "room" // @room, every member
+)
+
+// Mention is a notification that a message pinged a user.
+type Mention struct {
+	ID        int64
+	UserID    int64 // mentioned user
+	MessageID int64
+	RoomID    int64
+	AuthorID  int64
+	Kind      MentionKind
+	ReadAt    *time.Time // nil while unread
+	CreatedAt time.Time
+}
+
+// Session is a signed-in device. Times are stored in UTC.
+type Session struct {
+	ID              int64
+	UserID          int64
+	RefreshHash     string // SHA-256 of the current refresh token
+	PrevRefreshHash string // hash rotated out by the last refresh, empty before the first one
+	UserAgent       string
+	IP              string
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+	ExpiresAt       time.Time
+	RevokedAt       *time.Time
+}
+
+// Active reports whether the session can still be used at now.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// PasswordReset is a single-use password reset token. Times are stored in UTC.
+type PasswordReset struct {
+	ID        int64
+	UserID    int64
+	TokenHash string // SHA-256 of the token sent by mail
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// LoginFailureReason is why a password login failed.
+type LoginFailureReason string
+
+const (
+	LoginFailureUnknownUser LoginFailureReason = "unknown_user"
+	LoginFailureBadPassword LoginFailureReason = "bad_password"
+)
+
+// LoginFailure is a failed password login in the audit trail. Times are stored in UTC.
+type LoginFailure struct {
+	ID        int64
+	Username  string // as entered
+	UserID    *int64 // nil if no user has the username
+	IP        string
+	UserAgent string
+	Reason    LoginFailureReason
+	Locked    bool // this failure locked the username or IP
+	CreatedAt time.Time
+}
+
+// ReactionCount is the aggregated number of users who reacted to a message with an emoji.
+type ReactionCount struct {
+	Emoji string
+	Count int
+}
+
+// RoomReadState is a user's read position in a room.
+type RoomReadState struct {
+	RoomID      int64
+	LastReadID  int64 // 0 if the user has never read the room
+	UnreadCount int   // non-deleted messages from other users after LastReadID
 }
 
 // RoomMember represents room membership.
 type RoomMember struct {
 	UserID   int64
 	RoomID   int64
+	Role     RoomRole
 	JoinedAt time.Time
 }
 
+// RoomRole defines a member's role in a room.
+type RoomRole string
+
+const (
+	RoomRoleOwner     RoomRole = "owner"
+	RoomRoleAdmin     RoomRole = "admin"
+	RoomRoleModerator RoomRole = "moderator"
+	RoomRoleMember    RoomRole = "member"
+)
+
+// RoomPermission is an action in a room that depends on the member's role.
+type RoomPermission string
+
+const (
+	RoomPermInvite         RoomPermission = "invite"          // add members
+	RoomPermKick           RoomPermission = "kick"            // remove members
+	RoomPermBan            RoomPermission = "ban"             // remove members and keep them out
+	RoomPermDeleteMessages RoomPermission = "delete_messages" // delete other members' messages
+	RoomPermEditSettings   RoomPermission = "edit_settings"   // change room settings
+	RoomPermStartCall      RoomPermission = "start_call"      // start a room call
+	RoomPermManageRoles    RoomPermission = "manage_roles"    // promote and demote members
+	RoomPermMute           RoomPermission = "mute"            // temporarily stop members from posting
+	RoomPermViewAudit      RoomPermission = "view_audit"      // read the moderation audit log
+	RoomPermPublish        RoomPermission = "publish"         // post in a channel; other room types let everyone post
+	RoomPermPinMessages    RoomPermission = "pin_messages"    // pin and unpin messages
+	RoomPermManageInvites  RoomPermission = "manage_invites"  // list and revoke everyone's invite links
+)
+
+// roomRolePermissions is the permission matrix. Anything not listed is denied.
+var roomRolePermissions = map[RoomRole][]RoomPermission{
+	RoomRoleOwner: {
+		RoomPermInvite, RoomPermKick, RoomPermBan, RoomPermDeleteMessages,
+		RoomPermEditSettings, RoomPermStartCall, RoomPermManageRoles,
+		RoomPermMute, RoomPermViewAudit, RoomPermPublish, RoomPermPinMessages,
+		RoomPermManageInvites,
+	},
+	RoomRoleAdmin: {
+		RoomPermInvite, RoomPermKick, RoomPermBan, RoomPermDeleteMessages,
+		RoomPermEditSettings, RoomPermStartCall, RoomPermManageRoles,
+		RoomPermMute, RoomPermViewAudit, RoomPermPublish, RoomPermPinMessages,
+		RoomPermManageInvites,
+	},
+	RoomRoleModerator: {
+		RoomPermInvite, RoomPermKick, RoomPermDeleteMessages, RoomPermStartCall,
+		RoomPermMute, RoomPermPinMessages,
+	},
+	RoomRoleMember: {
+		RoomPermStartCall,
+	},
+}
+
+// roomRoleRanks orders roles from least to most privileged.
+var roomRoleRanks = map[RoomRole]int{
+	RoomRoleMember:    1,
+	RoomRoleModerator: 2,
+	RoomRoleAdmin:     3,
+	RoomRoleOwner:     4,
+}
+
+// Valid reports whether r is a known role.
+func (r RoomRole) Valid() bool {
+	_, ok := roomRoleRanks[r]
+	return ok
+}
+
+// Can reports whether the role grants a permission. The empty role (non-member) grants nothing.
+func (r RoomRole) Can(perm RoomPermission) bool {
+	for _, p := range roomRolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether r is strictly more privileged than other.
+// Members may only act on (kick, promote, demote) members they outrank.
+func (r RoomRole) Outranks(other RoomRole) bool {
+	return roomRoleRanks[r] > roomRoleRanks[other]
+}
+
+// RoomBan keeps a user out of a room until it is lifted.
+type RoomBan struct {
+	RoomID    int64
+	UserID    int64
+	BannedBy  int64
+	Reason    string
+	CreatedAt time.Time
+}
+
+// RoomMute stops a user from posting in a room until ExpiresAt.
+type RoomMute struct {
+	RoomID    int64
+	UserID    int64
+	MutedBy   int64
+	Reason    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// RoomAuditAction is a moderation action recorded in a room's audit log.
+type RoomAuditAction string
+
+const (
+	RoomAuditInvite     RoomAuditAction = "invite"
+	RoomAuditKick       RoomAuditAction = "kick"
+	RoomAuditBan        RoomAuditAction = "ban"
+	RoomAuditUnban      RoomAuditAction = "unban"
+	RoomAuditMute       RoomAuditAction = "mute"
+	RoomAuditUnmute     RoomAuditAction = "unmute"
+	RoomAuditRoleChange RoomAuditAction = "role_change"
+	RoomAuditSettings   RoomAuditAction = "settings_change"
+	RoomAuditPin        RoomAuditAction = "pin"
+	RoomAuditUnpin      RoomAuditAction = "unpin"
+)
+
+// RoomAuditEntry records who did what to whom in a room.
+type RoomAuditEntry struct {
+	ID       int64
+	RoomID   int64
+	ActorID  int64
+	Action   RoomAuditAction
+	TargetID int64  // affected user: the message author for pin and unpin, 0 for settings_change
+	Reason   string // optional, as given by the actor
+	// Action-specific: the new role for role_change, the expiry for mute,
+	// the changed fields for settings_change, the message ID for pin and unpin
+	Details   string
+	CreatedAt time.Time
+}
+
+// RoomPin is a message pinned to the top of a room.
+type RoomPin struct {
+	RoomID    int64
+	MessageID int64
+	PinnedBy  int64
+	CreatedAt time.Time
+}
+
+// RoomInvite is a shareable code that adds whoever accepts it to a room.
+type RoomInvite struct {
+	Code      string
+	RoomID    int64
+	CreatedBy int64
+	MaxUses   int // 0 means unlimited
+	Uses      int
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Usable reports whether the invite can still be accepted at now.
+func (i *RoomInvite) Usable(now time.Time) bool {
+	return i.RevokedAt == nil && now.Before(i.ExpiresAt) && (i.MaxUses == 0 || i.Uses < i.MaxUses)
+}
+
 // FriendStatus defines friend relationship status.
 type FriendStatus string
 
@@ -152,6 +453,21 @@ type UserStore interface {
 
 	// SearchUsers searches for users by username.
 	SearchUsers(ctx context.Context, query string) ([]*User, error)
+
+	// GetUserLastSeen retrieves when the user was last connected (nil if never recorded).
+	GetUserLastSeen(ctx context.Context, userID int64) (*time.Time, error)
+
+	// UpdateUserLastSeen records when the user's last connection closed.
+	UpdateUserLastSeen(ctx context.Context, userID int64, lastSeen time.Time) error
+
+	// GetUserByEmail retrieves a registered user by email, ignoring case.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// UpdateUserEmail sets a user's email; empty clears it.
+	UpdateUserEmail(ctx context.Context, userID int64, email string) error
+
+	// UpdatePasswordHash replaces a user's password hash.
+	UpdatePasswordHash(ctx context.Context, userID int64, passwordHash string) error
 }
 
 // RoomStore handles room persistence.
@@ -163,6 +479,17 @@ type RoomStore interface {
 	// Handles deduplication via directKey and auto-adds both users as members.
 	CreateDirectRoom(ctx context.Context, directKey string, user1ID, user2ID int64) (*Room, error)
 
+	// CreateGroupRoom creates a group DM between userIDs, or returns the group that
+	// already holds groupKey. All users are added as members.
+	CreateGroupRoom(ctx context.Context, groupKey string, creatorID int64, userIDs []int64) (*Room, error)
+
+	// SetRoomDirectKey replaces a room's direct key; nil clears it.
+	SetRoomDirectKey(ctx context.Context, roomID int64, key *string) error
+
+	// ConvertToPrivateRoom turns a room into a private room named name and owned by ownerID,
+	// dropping its direct key. Existing members are kept.
+	ConvertToPrivateRoom(ctx context.Context, roomID int64, name string, ownerID int64) error
+
 	// GetRoomByID retrieves a room by ID.
 	GetRoomByID(ctx context.Context, id int64) (*Room, error)
 
@@ -186,17 +513,159 @@ type RoomStore interface {
 
 	// ListMembers lists all members of a room.
 	ListMembers(ctx context.Context, roomID int64) ([]int64, error)
+
+	// CountMembers returns the number of members of each given room, keyed by room ID.
+	// Every requested room is present, including rooms without members.
+	CountMembers(ctx context.Context, roomIDs []int64) (map[int64]int, error)
+
+	// ListMemberNames returns the members of each given room with their usernames,
+	// ordered by username and keyed by room ID.
+	ListMemberNames(ctx context.Context, roomIDs []int64) (map[int64][]RoomMemberName, error)
+
+	// ListRoomMembers lists all members of a room with their roles, oldest first.
+	ListRoomMembers(ctx context.Context, roomID int64) ([]*RoomMember, error)
+
+	// GetMemberRole returns the user's role in a room, or "" if they are not a member.
+	// The room's owner_id always has RoomRoleOwner, even without a membership row.
+	GetMemberRole(ctx context.Context, userID, roomID int64) (RoomRole, error)
+
+	// SetMemberRole changes a member's role. Returns false if the user is not a member.
+	SetMemberRole(ctx context.Context, userID, roomID int64, role RoomRole) (bool, error)
+
+	// UpdateRoomMetadata replaces a room's topic, description and avatar URL.
+	UpdateRoomMetadata(ctx context.Context, roomID int64, topic, description, avatarURL string) error
 }
 
 // MessageStore handles message persistence.
 type MessageStore interface {
-	// SaveMessage persists a message to storage.
+	// SaveMessage persists a message to storage, linking msg.AttachmentIDs to it.
+	// Fails without saving anything if an attachment does not belong to the sender
+	// or is already linked to another message.
 	SaveMessage(ctx context.Context, msg *Message) error
 
 	// ListMessages retrieves messages from a room with pagination.
 	// If beforeID is provided, returns messages older than that ID.
 	// Limit determines max number of messages to return.
 	ListMessages(ctx context.Context, roomID int64, limit int, beforeID *int64) ([]*Message, error)
+
+	// ListMessagesAfter retrieves up to limit messages from a room with ID greater
+	// than afterID, oldest first. Used to resume after a reconnect.
+	ListMessagesAfter(ctx context.Context, roomID, afterID int64, limit int) ([]*Message, error)
+
+	// ListReplies retrieves direct replies to a root message with pagination.
+	// Same ordering and cursor semantics as ListMessages.
+	ListReplies(ctx context.Context, rootID int64, limit int, beforeID *int64) ([]*Message, error)
+
+	// GetMessage retrieves a single message by ID.
+	GetMessage(ctx context.Context, id int64) (*Message, error)
+
+	// GetMessageByClientID retrieves a user's message by its client-generated ID,
+	// or nil if that user has not sent it yet.
+	GetMessageByClientID(ctx context.Context, userID int64, clientMsgID string) (*Message, error)
+
+	// EditMessage replaces the body of a message and records the edit time.
+	EditMessage(ctx context.Context, id int64, body string, editedAt time.Time) error
+
+	// DeleteMessage soft-deletes a message: the body is cleared, deleted_at is set
+	// and its reactions are removed.
+	DeleteMessage(ctx context.Context, id int64, deletedAt time.Time) error
+
+	// SearchMessages runs a full-text search over the bodies of non-deleted messages,
+	// newest first. Callers are responsible for restricting RoomIDs to rooms the
+	// searching user may read. Returns ErrSearchUnavailable if search is turned off.
+	SearchMessages(ctx context.Context, search MessageSearch) ([]*MessageSearchHit, error)
+}
+
+// ReactionStore handles emoji reactions on messages.
+type ReactionStore interface {
+	// AddReaction records a user's reaction. Returns false if it already existed.
+	AddReaction(ctx context.Context, messageID, userID int64, emoji string) (bool, error)
+
+	// RemoveReaction removes a user's reaction. Returns false if it did not exist.
+	RemoveReaction(ctx context.Context, messageID, userID int64, emoji string) (bool, error)
+
+	// ListReactionCounts aggregates reactions for the given messages, keyed by message ID.
+	// Messages without reactions are absent from the map.
+	ListReactionCounts(ctx context.Context, messageIDs []int64) (map[int64][]ReactionCount, error)
+}
+
+// ReadStateStore tracks how far each user has read in each room.
+type ReadStateStore interface {
+	// MarkRoomRead moves the user's read position forward to lastReadID.
+	// Returns false if the stored position was already at or past lastReadID.
+	MarkRoomRead(ctx context.Context, userID, roomID, lastReadID int64) (bool, error)
+
+	// ListReadStates returns read positions and unread counters for the given rooms, keyed by room ID.
+	// Every requested room is present, including rooms the user has never read.
+	ListReadStates(ctx context.Context, userID int64, roomIDs []int64) (map[int64]RoomReadState, error)
+}
+
+// ModerationStore handles room bans, mutes and the moderation audit log.
+type ModerationStore interface {
+	// BanUser bans a user from a room, replacing any earlier ban.
+	BanUser(ctx context.Context, ban *RoomBan) error
+
+	// UnbanUser lifts a ban. Returns false if the user was not banned.
+	UnbanUser(ctx context.Context, userID, roomID int64) (bool, error)
+
+	// IsBanned checks if a user is banned from a room.
+	IsBanned(ctx context.Context, userID, roomID int64) (bool, error)
+
+	// ListBans lists a room's bans, newest first.
+	ListBans(ctx context.Context, roomID int64) ([]*RoomBan, error)
+
+	// ListBannedRoomIDs lists the rooms a user is banned from.
+	ListBannedRoomIDs(ctx context.Context, userID int64) ([]int64, error)
+
+	// MuteUser mutes a user in a room, replacing any earlier mute.
+	MuteUser(ctx context.Context, mute *RoomMute) error
+
+	// UnmuteUser lifts a mute. Returns false if the user was not muted.
+	UnmuteUser(ctx context.Context, userID, roomID int64) (bool, error)
+
+	// GetActiveMute returns the user's mute in a room if it expires after now, or nil.
+	GetActiveMute(ctx context.Context, userID, roomID int64, now time.Time) (*RoomMute, error)
+
+	// AddAuditEntry appends an entry to a room's audit log and sets its ID.
+	AddAuditEntry(ctx context.Context, entry *RoomAuditEntry) error
+
+	// ListAuditEntries retrieves a room's audit log, newest first.
+	// If beforeID is provided, returns entries older than that ID.
+	ListAuditEntries(ctx context.Context, roomID int64, limit int, beforeID *int64) ([]*RoomAuditEntry, error)
+}
+
+// PinStore handles pinned messages.
+type PinStore interface {
+	// PinMessage pins a message in a room. Returns false if it was already pinned.
+	PinMessage(ctx context.Context, pin *RoomPin) (bool, error)
+
+	// UnpinMessage unpins a message. Returns false if it was not pinned.
+	UnpinMessage(ctx context.Context, roomID, messageID int64) (bool, error)
+
+	// ListPins lists a room's pins, newest first. Pins of deleted messages are skipped.
+	ListPins(ctx context.Context, roomID int64) ([]*RoomPin, error)
+}
+
+// InviteStore handles room invite links.
+type InviteStore interface {
+	// CreateInvite stores a new invite.
+	CreateInvite(ctx context.Context, invite *RoomInvite) error
+
+	// GetInvite retrieves an invite by code, whether or not it is still usable.
+	GetInvite(ctx context.Context, code string) (*RoomInvite, error)
+
+	// ListActiveInvites lists a room's invites that are usable at now, newest first.
+	ListActiveInvites(ctx context.Context, roomID int64, now time.Time) ([]*RoomInvite, error)
+
+	// UseInvite counts one use of an invite if it is usable at now.
+	// Returns false if it is revoked, expired or used up.
+	UseInvite(ctx context.Context, code string, now time.Time) (bool, error)
+
+	// ReturnInviteUse gives back a use counted by UseInvite, for an accept that did not add the member.
+	ReturnInviteUse(ctx context.Context, code string) error
+
+	// RevokeInvite revokes an invite. Returns false if it does not exist or was already revoked.
+	RevokeInvite(ctx context.Context, code string, now time.Time) (bool, error)
 }
 
 // FriendStore handles friend persistence.
@@ -250,11 +719,125 @@ type CallStore interface {
 	ListParticipants(ctx context.Context, callID string) ([]*CallParticipant, error)
 }
 
+// AttachmentStore handles uploaded file metadata.
+type AttachmentStore interface {
+	// CreateAttachment records a new, unlinked upload and sets its ID.
+	CreateAttachment(ctx context.Context, a *Attachment) error
+
+	// GetAttachment retrieves an attachment by ID.
+	GetAttachment(ctx context.Context, id int64) (*Attachment, error)
+
+	// ListAttachments retrieves the attachments of the given messages, keyed by
+	// message ID and in display order. Deleted messages have none.
+	ListAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*Attachment, error)
+}
+
+// MentionStore handles the per-user mention inbox.
+// Listing and counting only include live messages in rooms the user is still a member of.
+type MentionStore interface {
+	// CreateMentions records mentions and sets their IDs. A user mentioned twice by
+	// the same message is recorded once; the duplicate keeps ID 0.
+	CreateMentions(ctx context.Context, mentions []*Mention) error
+
+	// ListMentions retrieves a user's mentions, newest first.
+	// If beforeID is provided, returns mentions older than that ID.
+	ListMentions(ctx context.Context, userID int64, unreadOnly bool, limit int, beforeID *int64) ([]*Mention, error)
+
+	// CountUnreadMentions counts a user's unread mentions.
+	CountUnreadMentions(ctx context.Context, userID int64) (int, error)
+
+	// MarkMentionsRead marks the given mentions of a user as read, or all of them
+	// if ids is empty. Returns how many were newly marked.
+	MarkMentionsRead(ctx context.Context, userID int64, ids []int64, readAt time.Time) (int64, error)
+}
+
+// SessionStore handles login session persistence.
+type SessionStore interface {
+	// CreateSession stores a new session and sets its ID.
+	CreateSession(ctx context.Context, session *Session) error
+
+	// GetSession retrieves a session by ID, whether or not it is still active.
+	GetSession(ctx context.Context, id int64) (*Session, error)
+
+	// FindSessionByRefreshHash retrieves the session whose current or previous
+	// refresh token has the given hash.
+	FindSessionByRefreshHash(ctx context.Context, hash string) (*Session, error)
+
+	// RotateSession replaces the session's refresh hash if it is still oldHash and
+	// the session is not revoked, moving oldHash to the previous hash. Returns false
+	// if another refresh or a revocation got there first.
+	RotateSession(ctx context.Context, id int64, oldHash, newHash string, usedAt, expiresAt time.Time) (bool, error)
+
+	// ListActiveSessions lists a user's sessions that are active at now, most recently used first.
+	ListActiveSessions(ctx context.Context, userID int64, now time.Time) ([]*Session, error)
+
+	// RevokeSession revokes one of a user's sessions. Returns false if it does not
+	// exist, belongs to someone else or was already revoked.
+	RevokeSession(ctx context.Context, userID, id int64, now time.Time) (bool, error)
+
+	// RevokeUserSessions revokes all of a user's sessions except exceptID (0 for none).
+	// Returns the IDs of the sessions it revoked.
+	RevokeUserSessions(ctx context.Context, userID, exceptID int64, now time.Time) ([]int64, error)
+}
+
+// PasswordResetStore handles password reset token persistence.
+type PasswordResetStore interface {
+	// CreatePasswordReset stores a new reset token and sets its ID.
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+
+	// GetPasswordReset retrieves a reset token by hash, whether or not it is still usable.
+	GetPasswordReset(ctx context.Context, tokenHash string) (*PasswordReset, error)
+
+	// CountPasswordResetsSince counts the reset tokens created for a user since the given time.
+	CountPasswordResetsSince(ctx context.Context, userID int64, since time.Time) (int, error)
+
+	// ResetPassword uses the reset token if it is unused and unexpired at now: it
+	// sets the user's password hash and cancels their other reset tokens.
+	// Returns false if the token cannot be used.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, now time.Time) (bool, error)
+
+	// CancelPasswordResets makes all unused reset tokens of a user unusable.
+	CancelPasswordResets(ctx context.Context, userID int64, now time.Time) error
+}
+
+// LoginAuditStore handles the audit trail of failed logins.
+type LoginAuditStore interface {
+	// RecordLoginFailure stores a failed login and sets its ID.
+	RecordLoginFailure(ctx context.Context, failure *LoginFailure) error
+
+	// ListLoginFailures lists the failed logins on a user's account, newest first.
+	ListLoginFailures(ctx context.Context, userID int64, limit int) ([]*LoginFailure, error)
+}
+
+// IdentityStore handles links between users and external identity provider accounts.
+type IdentityStore interface {
+	// GetUserByIdentity retrieves the user linked to subject at issuer.
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*User, error)
+
+	// LinkIdentity links subject at issuer to an existing user. Returns false if
+	// the account is linked already or the user has another account at issuer.
+	LinkIdentity(ctx context.Context, userID int64, issuer, subject string) (bool, error)
+
+	// CreateUserWithIdentity creates a user without a password, linked to subject at issuer.
+	CreateUserWithIdentity(ctx context.Context, username, issuer, subject string) (*User, error)
+}
+
 // Store aggregates all storage interfaces.
 type Store interface {
 	UserStore
 	RoomStore
 	MessageStore
+	ReactionStore
+	ReadStateStore
+	ModerationStore
+	PinStore
+	InviteStore
+	AttachmentStore
+	MentionStore
+	SessionStore
+	IdentityStore
+	PasswordResetStore
+	LoginAuditStore
 	FriendStore
 	CallStore
 
@@ -2,7 +2,10 @@ package http
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -27,7 +30,7 @@ func NewAPIHandlers(authService *auth.Service, logger *zerolog.Logger) *APIHandl
 // RegisterRequest represents the registration request body.
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=32"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // length is checked by the password policy
 }
 
 // LoginRequest represents the login request body.
@@ -36,9 +39,84 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest represents the token refresh request body.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LoginFailureResponse represents a failed login on the caller's account in API responses.
+type LoginFailureResponse struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Reason    string `json:"reason"`
+	Locked    bool   `json:"locked"` // this failure locked the account or IP
+	CreatedAt string `json:"created_at"`
+}
+
+// ChangePasswordRequest represents the password change request body.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// SetEmailRequest represents the email update request body. An empty email removes it.
+type SetEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPasswordRequest represents the password reset request body.
+type ForgotPasswordRequest struct {
+	Login string `json:"login" binding:"required"` // username or email
+}
+
+// ResetPasswordRequest represents the body that sets a new password with a reset token.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
 // AuthResponse represents the authentication response body.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"` // access token
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+// SessionResponse represents a signed-in device in API responses.
+type SessionResponse struct {
+	ID         int64  `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"` // the session of the requesting token
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+func authResponse(tokens *auth.Tokens) AuthResponse {
+	return AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+	}
+}
+
+// deviceFromRequest describes the client of a request for its new session.
+func deviceFromRequest(c *gin.Context) auth.Device {
+	return auth.Device{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
+// passwordErrorMessage tells the client why a new password was rejected.
+func passwordErrorMessage(err error) string {
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Error()
+	}
+	return "invalid password"
 }
 
 // ErrorResponse represents an error response body.
@@ -56,14 +134,14 @@ func (h *APIHandlers) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Register(c.Request.Context(), req.Username, req.Password)
+	tokens, err := h.authService.Register(c.Request.Context(), req.Username, req.Password, deviceFromRequest(c))
 	if err != nil {
 		switch {
 		case errors.Is(err, auth.ErrInvalidUsername):
 			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "username must be 3-32 characters"})
 			return
 		case errors.Is(err, auth.ErrInvalidPassword):
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "password must be at least 6 characters"})
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: passwordErrorMessage(err)})
 			return
 		case errors.Is(err, auth.ErrUserExists):
 			c.JSON(http.StatusConflict, ErrorResponse{Error: "user already exists"})
@@ -75,7 +153,7 @@ func (h *APIHandlers) Register(c *gin.Context) {
 	}
 
 	h.log.Info().Str("username", req.Username).Msg("user registered successfully")
-	c.JSON(http.StatusCreated, AuthResponse{Token: token})
+	c.JSON(http.StatusCreated, authResponse(tokens))
 }
 
 // Login handles user login.
@@ -88,25 +166,37 @@ func (h *APIHandlers) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(c.Request.Context(), req.Username, req.Password)
+	tokens, err := h.authService.Login(c.Request.Context(), req.Username, req.Password, deviceFromRequest(c))
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid credentials"})
 			return
 		}
+		var throttled *auth.LoginThrottledError
+		if errors.As(err, &throttled) {
+			h.log.Warn().
+				Str("username", req.Username).
+				Str("ip", c.ClientIP()).
+				Bool("locked", throttled.Locked).
+				Dur("retry_after", throttled.RetryAfter).
+				Msg("login throttled")
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: throttled.Error()})
+			return
+		}
 		h.log.Error().Err(err).Str("username", req.Username).Msg("failed to login user")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
 		return
 	}
 
 	h.log.Info().Str("username", req.Username).Msg("user logged in successfully")
-	c.JSON(http.StatusOK, AuthResponse{Token: token})
+	c.JSON(http.StatusOK, authResponse(tokens))
 }
 
 // GuestLogin creates a guest user and returns a token.
 // POST /api/guest
 func (h *APIHandlers) GuestLogin(c *gin.Context) {
-	token, sessionID, err := h.authService.CreateGuestUser(c.Request.Context())
+	tokens, sessionID, err := h.authService.CreateGuestUser(c.Request.Context(), deviceFromRequest(c))
 	if err != nil {
 		h.log.Error().Err(err).Msg("failed to create guest user")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
@@ -125,5 +215,369 @@ func (h *APIHandlers) GuestLogin(c *gin.Context) {
 	)
 
 	h.log.Info().Str("session_id", sessionID).Msg("guest user created")
-	c.JSON(http.StatusOK, AuthResponse{Token: token})
+	c.JSON(http.StatusOK, authResponse(tokens))
+}
+
+// JWKS publishes the public keys WireChat tokens are verified with.
+// GET /.well-known/jwks.json
+func (h *APIHandlers) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// Refresh exchanges a refresh token for new tokens. The old refresh token stops
+// working; presenting it again revokes the session.
+// POST /api/token/refresh
+func (h *APIHandlers) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid refresh request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid refresh token"})
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to refresh token")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Debug().Int64("session_id", tokens.SessionID).Msg("token refreshed")
+	c.JSON(http.StatusOK, authResponse(tokens))
+}
+
+// Logout ends the session of the requesting token and closes its WebSocket connections.
+// POST /api/logout
+func (h *APIHandlers) Logout(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	sid := c.GetInt64(ContextKeySessionID) // 0 for tokens issued without a session
+	if sid == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "token has no session"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), uid, sid); err != nil {
+		h.log.Error().Err(err).Int64("session_id", sid).Msg("failed to revoke session")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().Int64("user_id", uid).Int64("session_id", sid).Msg("user logged out")
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// ListSessions lists the caller's signed-in devices, most recently used first.
+// GET /api/sessions
+func (h *APIHandlers) ListSessions(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	sid := c.GetInt64(ContextKeySessionID) // 0 for tokens issued without a session
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), uid)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to list sessions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			Current:    s.ID == sid,
+			CreatedAt:  s.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			LastUsedAt: s.LastUsedAt.Format("2006-01-02T15:04:05Z07:00"),
+			ExpiresAt:  s.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSession ends one of the caller's sessions, e.g. a lost phone.
+// DELETE /api/sessions/:id
+func (h *APIHandlers) RevokeSession(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var id int64
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid session id"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), uid, id); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "session not found"})
+			return
+		}
+		h.log.Error().Err(err).Int64("session_id", id).Msg("failed to revoke session")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().Int64("user_id", uid).Int64("session_id", id).Msg("session revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// RevokeOtherSessions ends every session of the caller except the current one.
+// DELETE /api/sessions
+func (h *APIHandlers) RevokeOtherSessions(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	sid := c.GetInt64(ContextKeySessionID) // 0 for tokens issued without a session
+
+	revoked, err := h.authService.RevokeOtherSessions(c.Request.Context(), uid, sid)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to revoke sessions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().Int64("user_id", uid).Int("revoked", revoked).Msg("other sessions revoked")
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// ChangePassword replaces the caller's password. Every other session is signed out.
+// POST /api/me/password
+func (h *APIHandlers) ChangePassword(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	sid := c.GetInt64(ContextKeySessionID) // 0 for tokens issued without a session
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid change password request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.authService.ChangePassword(c.Request.Context(), uid, sid, req.CurrentPassword, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "current password is incorrect"})
+			return
+		case errors.Is(err, auth.ErrInvalidPassword):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: passwordErrorMessage(err)})
+			return
+		}
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to change password")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().Int64("user_id", uid).Msg("password changed")
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
+
+// SetEmail sets the address the caller's password reset links are sent to.
+// PUT /api/me/email
+func (h *APIHandlers) SetEmail(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var req SetEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid set email request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.authService.SetEmail(c.Request.Context(), uid, req.Password, req.Email); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "password is incorrect"})
+			return
+		case errors.Is(err, auth.ErrInvalidEmail):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid email"})
+			return
+		case errors.Is(err, auth.ErrEmailTaken):
+			c.JSON(http.StatusConflict, ErrorResponse{Error: "email already in use"})
+			return
+		}
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to set email")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email updated"})
+}
+
+// ForgotPassword mails a password reset link. The response is the same whether
+// or not the account exists.
+// POST /api/password/forgot
+func (h *APIHandlers) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid forgot password request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Login); err != nil {
+		if errors.Is(err, auth.ErrResetUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "password reset is not available"})
+			return
+		}
+		// Logged, not returned: the answer must not depend on the account
+		h.log.Error().Err(err).Msg("failed to request password reset")
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account has an email, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password with a token from a reset mail. Every session of the user is signed out.
+// POST /api/password/reset
+func (h *APIHandlers) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid reset password request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidResetToken):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid or expired reset token"})
+			return
+		case errors.Is(err, auth.ErrInvalidPassword):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: passwordErrorMessage(err)})
+			return
+		}
+		h.log.Error().Err(err).Msg("failed to reset password")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+// ListLoginFailures lists recent failed logins on the caller's account, newest first.
+// GET /api/me/login-failures?limit=50
+func (h *APIHandlers) ListLoginFailures(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	limit := 50 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	failures, err := h.authService.ListLoginFailures(c.Request.Context(), uid, limit)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to list login failures")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	response := make([]LoginFailureResponse, 0, len(failures))
+	for _, f := range failures {
+		response = append(response, LoginFailureResponse{
+			IP:        f.IP,
+			UserAgent: f.UserAgent,
+			Reason:    string(f.Reason),
+			Locked:    f.Locked,
+			CreatedAt: f.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"failures": response})
 }
@@ -0,0 +1,493 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/rs/zerolog"
+	"github.com/vovakirdan/wirechat-server/internal/auth"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/core"
+	"github.com/vovakirdan/wirechat-server/internal/mail/devmail"
+	"github.com/vovakirdan/wirechat-server/internal/proto"
+)
+
+func TestSessionsAndRefresh(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	rest := func(method, path, token, userAgent, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+	credentials := `{"username":"alice","password":"password123"}`
+
+	var phone AuthResponse
+	if code := rest(http.MethodPost, "/api/register", "", "phone", credentials, &phone); code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d", code)
+	}
+	if phone.Token == "" || phone.RefreshToken == "" || phone.ExpiresIn != int64((24*time.Hour).Seconds()) {
+		t.Fatalf("unexpected auth response %+v", phone)
+	}
+	var laptop AuthResponse
+	if code := rest(http.MethodPost, "/api/login", "", "laptop", credentials, &laptop); code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", code)
+	}
+
+	var list struct {
+		Sessions []SessionResponse `json:"sessions"`
+	}
+	if code := rest(http.MethodGet, "/api/sessions", phone.Token, "", "", &list); code != http.StatusOK {
+		t.Fatalf("list sessions: expected 200, got %d", code)
+	}
+	if len(list.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", list.Sessions)
+	}
+	var laptopID int64
+	for _, s := range list.Sessions {
+		switch s.UserAgent {
+		case "phone":
+			if !s.Current {
+				t.Fatalf("phone session should be current: %+v", s)
+			}
+		case "laptop":
+			laptopID = s.ID
+			if s.Current {
+				t.Fatalf("laptop session should not be current: %+v", s)
+			}
+		default:
+			t.Fatalf("unexpected session %+v", s)
+		}
+	}
+
+	// Refresh rotates the refresh token; replaying the old one kills the session
+	var refreshed AuthResponse
+	body := fmt.Sprintf(`{"refresh_token":%q}`, phone.RefreshToken)
+	if code := rest(http.MethodPost, "/api/token/refresh", "", "", body, &refreshed); code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d", code)
+	}
+	if refreshed.RefreshToken == phone.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+	if code := rest(http.MethodGet, "/api/sessions", refreshed.Token, "", "", nil); code != http.StatusOK {
+		t.Fatalf("refreshed token: expected 200, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/token/refresh", "", "", body, nil); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: expected 401, got %d", code)
+	}
+	if code := rest(http.MethodGet, "/api/sessions", refreshed.Token, "", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("token of reused session: expected 401, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/token/refresh", "", "", `{}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("refresh without token: expected 400, got %d", code)
+	}
+
+	if code := rest(http.MethodPost, "/api/login", "", "phone", credentials, &phone); code != http.StatusOK {
+		t.Fatalf("login again: expected 200, got %d", code)
+	}
+
+	// The laptop is connected over WebSocket when the phone kills its session
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+	for _, in := range []struct {
+		kind string
+		data any
+	}{
+		{"hello", proto.HelloData{Token: laptop.Token, Protocol: 1}},
+		{"join", proto.JoinData{Room: "general"}},
+	} {
+		raw, _ := json.Marshal(in.data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: in.kind, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", in.kind, writeErr)
+		}
+	}
+	var joined proto.Outbound
+	if readErr := wsjson.Read(wsCtx, conn, &joined); readErr != nil || joined.Event != "user_joined" {
+		t.Fatalf("expected user_joined, got %+v (%v)", joined, readErr)
+	}
+
+	if code := rest(http.MethodDelete, "/api/sessions/999", phone.Token, "", "", nil); code != http.StatusNotFound {
+		t.Fatalf("revoke unknown session: expected 404, got %d", code)
+	}
+	if code := rest(http.MethodDelete, fmt.Sprintf("/api/sessions/%d", laptopID), phone.Token, "", "", nil); code != http.StatusOK {
+		t.Fatalf("revoke laptop: expected 200, got %d", code)
+	}
+	for {
+		var outbound proto.Outbound
+		readErr := wsjson.Read(wsCtx, conn, &outbound)
+		if readErr == nil {
+			continue
+		}
+		if status := websocket.CloseStatus(readErr); status != closeStatusSessionRevoked {
+			t.Fatalf("expected close status %d, got %d (%v)", closeStatusSessionRevoked, status, readErr)
+		}
+		break
+	}
+	if code := rest(http.MethodGet, "/api/sessions", laptop.Token, "", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("revoked laptop token: expected 401, got %d", code)
+	}
+	body = fmt.Sprintf(`{"refresh_token":%q}`, laptop.RefreshToken)
+	if code := rest(http.MethodPost, "/api/token/refresh", "", "", body, nil); code != http.StatusUnauthorized {
+		t.Fatalf("revoked laptop refresh: expected 401, got %d", code)
+	}
+
+	// Logging out everywhere else, then here
+	var tablet AuthResponse
+	rest(http.MethodPost, "/api/login", "", "tablet", credentials, &tablet)
+	var revoked struct {
+		Revoked int `json:"revoked"`
+	}
+	if code := rest(http.MethodDelete, "/api/sessions", phone.Token, "", "", &revoked); code != http.StatusOK || revoked.Revoked != 1 {
+		t.Fatalf("revoke others: expected 200 with 1 revoked, got %d %+v", code, revoked)
+	}
+	if code := rest(http.MethodGet, "/api/sessions", tablet.Token, "", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("tablet token after revoke others: expected 401, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/logout", phone.Token, "", "", nil); code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", code)
+	}
+	if code := rest(http.MethodGet, "/api/sessions", phone.Token, "", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("token after logout: expected 401, got %d", code)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	key, err := auth.NewSigningKey("2025-01", rsaKey)
+	if err != nil {
+		t.Fatalf("new signing key: %v", err)
+	}
+	authService := auth.NewService(testStore, &auth.JWTConfig{
+		Audience:     "test",
+		TTL:          time.Hour,
+		Keys:         []*auth.SigningKey{key},
+		SigningKeyID: "2025-01",
+	})
+
+	disabledLogger := zerolog.New(io.Discard)
+	cfg := config.Config{Addr: ":0", ReadHeaderTimeout: time.Second, MaxMessageBytes: 1 << 20}
+	server := NewServer(core.NewHub(testStore, nil, nil), authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("get jwks: %v", err)
+	}
+	defer resp.Body.Close()
+	var set auth.JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatalf("decode jwks: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(set.Keys) != 1 || set.Keys[0].KeyID != "2025-01" || set.Keys[0].Algorithm != "RS256" {
+		t.Fatalf("unexpected jwks %d %+v", resp.StatusCode, set)
+	}
+
+	// Tokens issued by the server are signed with the published key and still authenticate
+	token, err := registerToken(context.Background(), authService, "alice", "password123")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/sessions", nil)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	sessionsResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+	sessionsResp.Body.Close()
+	if sessionsResp.StatusCode != http.StatusOK {
+		t.Fatalf("list sessions with rs256 token: expected 200, got %d", sessionsResp.StatusCode)
+	}
+}
+
+func TestPasswordEndpoints(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	authService := createTestAuthService(t, testStore, "test-secret")
+	mailDir := t.TempDir()
+	mailer, err := devmail.NewFile("wirechat@example.com", mailDir)
+	if err != nil {
+		t.Fatalf("file mailer: %v", err)
+	}
+	authService.SetPasswordConfig(auth.PasswordConfig{
+		Policy:   auth.PasswordPolicy{MinLength: 8, MinClasses: 2},
+		ResetURL: "https://chat.example/reset",
+		Mailer:   mailer,
+	})
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	rest := func(method, path, token, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	// Registration applies the policy and explains a rejection
+	var failure ErrorResponse
+	if code := rest(http.MethodPost, "/api/register", "", `{"username":"alice","password":"abcdefgh"}`, &failure); code != http.StatusBadRequest {
+		t.Fatalf("register with weak password: expected 400, got %d", code)
+	}
+	if !strings.Contains(failure.Error, "at least 2") {
+		t.Fatalf("expected the policy in the error, got %q", failure.Error)
+	}
+	var alice AuthResponse
+	if code := rest(http.MethodPost, "/api/register", "", `{"username":"alice","password":"password1"}`, &alice); code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d", code)
+	}
+
+	if code := rest(http.MethodPost, "/api/me/password", "", `{"current_password":"password1","new_password":"password2"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("change password without token: expected 401, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/me/password", alice.Token, `{"current_password":"wrong","new_password":"password2"}`, nil); code != http.StatusForbidden {
+		t.Fatalf("change password with wrong current: expected 403, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/me/password", alice.Token, `{"current_password":"password1","new_password":"short"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("change to weak password: expected 400, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/me/password", alice.Token, `{"current_password":"password1","new_password":"password2"}`, nil); code != http.StatusOK {
+		t.Fatalf("change password: expected 200, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/login", "", `{"username":"alice","password":"password2"}`, nil); code != http.StatusOK {
+		t.Fatalf("login with changed password: expected 200, got %d", code)
+	}
+
+	// Reset by mail
+	if code := rest(http.MethodPut, "/api/me/email", alice.Token, `{"email":"alice@example.com","password":"password2"}`, nil); code != http.StatusOK {
+		t.Fatalf("set email: expected 200, got %d", code)
+	}
+	for _, login := range []string{"nobody", "alice"} {
+		var accepted struct {
+			Message string `json:"message"`
+		}
+		if code := rest(http.MethodPost, "/api/password/forgot", "", fmt.Sprintf(`{"login":%q}`, login), &accepted); code != http.StatusAccepted {
+			t.Fatalf("forgot %s: expected 202, got %d", login, code)
+		}
+	}
+	files, err := os.ReadDir(mailDir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one mail, got %d (%v)", len(files), err)
+	}
+	raw, err := os.ReadFile(filepath.Join(mailDir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("read mail: %v", err)
+	}
+	var token string
+	for _, field := range strings.Fields(string(raw)) {
+		if u, parseErr := url.Parse(field); parseErr == nil && u.Query().Get("token") != "" {
+			token = u.Query().Get("token")
+		}
+	}
+	if !strings.Contains(string(raw), "To: alice@example.com") || token == "" {
+		t.Fatalf("unexpected reset mail:\n%s", raw)
+	}
+
+	body := fmt.Sprintf(`{"token":%q,"new_password":"password3"}`, token)
+	if code := rest(http.MethodPost, "/api/password/reset", "", body, nil); code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/password/reset", "", body, nil); code != http.StatusBadRequest {
+		t.Fatalf("reused reset token: expected 400, got %d", code)
+	}
+	if code := rest(http.MethodGet, "/api/sessions", alice.Token, "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("token after reset: expected 401, got %d", code)
+	}
+	if code := rest(http.MethodPost, "/api/login", "", `{"username":"alice","password":"password3"}`, nil); code != http.StatusOK {
+		t.Fatalf("login with reset password: expected 200, got %d", code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	authService := createTestAuthService(t, testStore, "test-secret")
+	authService.SetLoginThrottle(auth.LoginThrottleConfig{FreeAttempts: 5, MaxFailures: 2, LockoutDuration: time.Hour})
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	token, err := registerToken(ctx, authService, "alice", "password123")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	login := func(password, forwardedFor string) *http.Response {
+		body := fmt.Sprintf(`{"username":"alice","password":%q}`, password)
+		req, reqErr := http.NewRequest(http.MethodPost, ts.URL+"/api/login", strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "guesser")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("login: %v", doErr)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := login("wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("failure %d: expected 401, got %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := login("password123", "")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("locked login: expected 429, got %d", resp.StatusCode)
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "3600" {
+		t.Fatalf("expected Retry-After 3600, got %q", retryAfter)
+	}
+
+	// No trusted proxies: a forged X-Forwarded-For does not change the client IP
+	if resp := login("wrong", "198.51.100.1"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("forged client IP: expected 429, got %d", resp.StatusCode)
+	}
+
+	var list struct {
+		Failures []LoginFailureResponse `json:"failures"`
+	}
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/me/login-failures", nil)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	listResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("list login failures: %v", err)
+	}
+	defer listResp.Body.Close()
+	if listResp.StatusCode != http.StatusOK {
+		t.Fatalf("list login failures: expected 200, got %d", listResp.StatusCode)
+	}
+	if err := json.NewDecoder(listResp.Body).Decode(&list); err != nil {
+		t.Fatalf("decode login failures: %v", err)
+	}
+	if len(list.Failures) != 2 || !list.Failures[0].Locked || list.Failures[1].Locked {
+		t.Fatalf("expected two failures, the latest locking, got %+v", list.Failures)
+	}
+	if f := list.Failures[0]; f.IP != "127.0.0.1" || f.UserAgent != "guesser" || f.Reason != "bad_password" {
+		t.Fatalf("unexpected failure %+v", f)
+	}
+}
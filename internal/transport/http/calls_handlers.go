@@ -154,6 +154,8 @@ func (h *CallsHandlers) CreateRoomCall(c *gin.Context) {
 			c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
 		case errors.Is(err, calls.ErrNotRoomMember):
 			c.JSON(http.StatusForbidden, ErrorResponse{Error: "not a member of this room"})
+		case errors.Is(err, calls.ErrCannotStartCall):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "room role does not allow starting calls"})
 		case errors.Is(err, calls.ErrLiveKitNotEnabled):
 			c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "calls are not available"})
 		default:
@@ -9,22 +9,25 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/vovakirdan/wirechat-server/internal/service/friends"
+	"github.com/vovakirdan/wirechat-server/internal/service/presence"
 	"github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 // FriendsHandlers provides HTTP handlers for friend management endpoints.
 type FriendsHandlers struct {
-	service *friends.Service
-	store   store.Store
-	log     *zerolog.Logger
+	service  *friends.Service
+	presence *presence.Service // nil if presence tracking is disabled
+	store    store.Store
+	log      *zerolog.Logger
 }
 
 // NewFriendsHandlers creates a new friends handlers instance.
-func NewFriendsHandlers(svc *friends.Service, st store.Store, logger *zerolog.Logger) *FriendsHandlers {
+func NewFriendsHandlers(svc *friends.Service, presenceSvc *presence.Service, st store.Store, logger *zerolog.Logger) *FriendsHandlers {
 	return &FriendsHandlers{
-		service: svc,
-		store:   st,
-		log:     logger,
+		service:  svc,
+		presence: presenceSvc,
+		store:    st,
+		log:      logger,
 	}
 }
 
@@ -43,6 +46,9 @@ type FriendResponse struct {
 	UpdatedAt string `json:"updated_at"`
 	// Additional fields for context
 	FriendUsername string `json:"friend_username,omitempty"`
+	// Presence of the friend (only in GET /api/friends)
+	Presence   string  `json:"presence,omitempty"`
+	LastSeenAt *string `json:"last_seen_at,omitempty"`
 }
 
 // friendToResponse converts a store.Friend to FriendResponse.
@@ -70,6 +76,29 @@ func (h *FriendsHandlers) friendToResponse(ctx *gin.Context, f *store.Friend, cu
 	return resp
 }
 
+// attachPresence fills in the friend's presence status and last seen time.
+func (h *FriendsHandlers) attachPresence(ctx *gin.Context, resp *FriendResponse, f *store.Friend, currentUserID int64) {
+	if h.presence == nil {
+		return
+	}
+
+	otherUserID := f.FriendID
+	if f.FriendID == currentUserID {
+		otherUserID = f.UserID
+	}
+
+	p, err := h.presence.Get(ctx.Request.Context(), otherUserID)
+	if err != nil {
+		h.log.Warn().Err(err).Int64("user_id", otherUserID).Msg("failed to get presence")
+		return
+	}
+	resp.Presence = string(p.Status)
+	if p.LastSeenAt != nil {
+		lastSeen := p.LastSeenAt.Format("2006-01-02T15:04:05Z07:00")
+		resp.LastSeenAt = &lastSeen
+	}
+}
+
 // SendRequest handles sending a friend request.
 // POST /api/friends/requests
 func (h *FriendsHandlers) SendRequest(c *gin.Context) {
@@ -142,7 +171,9 @@ func (h *FriendsHandlers) ListFriends(c *gin.Context) {
 
 	response := make([]FriendResponse, 0, len(friendsList))
 	for _, f := range friendsList {
-		response = append(response, h.friendToResponse(c, f, uid))
+		resp := h.friendToResponse(c, f, uid)
+		h.attachPresence(c, &resp, f, uid)
+		response = append(response, resp)
 	}
 
 	h.log.Debug().Int64("user_id", uid).Int("friend_count", len(friendsList)).Msg("friends listed")
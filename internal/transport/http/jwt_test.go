@@ -28,13 +28,13 @@ func startJWTTestServer(t *testing.T, cfg config.Config) (*httptest.Server, cont
 	// Create auth service
 	authService := createTestAuthService(t, store, cfg.JWTSecret)
 
-	hub := core.NewHub(store, nil)
+	hub := core.NewHub(store, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	go hub.Run(ctx)
 
 	disabledLogger := zerolog.New(nil)
 
-	server := NewServer(hub, authService, store, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, store, nil, nil, nil, nil, &cfg, &disabledLogger)
 
 	ts := httptest.NewServer(server.Handler)
 	t.Cleanup(ts.Close)
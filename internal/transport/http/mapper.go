@@ -2,7 +2,11 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/vovakirdan/wirechat-server/internal/core"
 	"github.com/vovakirdan/wirechat-server/internal/proto"
@@ -18,9 +22,13 @@ func inboundToCommand(client *core.Client, inbound proto.Inbound) (*core.Command
 		if join.Room == "" {
 			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room is required"}, nil
 		}
+		if join.Since < 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "since must not be negative"}, nil
+		}
 		return &core.Command{
-			Kind: core.CommandJoinRoom,
-			Room: join.Room,
+			Kind:  core.CommandJoinRoom,
+			Room:  join.Room,
+			Since: join.Since,
 		}, nil, nil
 	case proto.InboundTypeLeave:
 		var leave proto.JoinData
@@ -42,17 +50,134 @@ func inboundToCommand(client *core.Client, inbound proto.Inbound) (*core.Command
 		if msg.Room == "" {
 			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room is required"}, nil
 		}
+		if msg.ReplyTo < 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "reply_to must be a message id"}, nil
+		}
+		if len(msg.ClientMsgID) > maxClientMsgIDBytes {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "client_msg_id is too long"}, nil
+		}
+		if len(msg.Attachments) > maxAttachments {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: fmt.Sprintf("at most %d attachments per message", maxAttachments)}, nil
+		}
+		attachments := make([]core.Attachment, 0, len(msg.Attachments))
+		for _, id := range msg.Attachments {
+			if id <= 0 {
+				return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "attachments must be upload ids"}, nil
+			}
+			attachments = append(attachments, core.Attachment{ID: id})
+		}
 		return &core.Command{
 			Kind: core.CommandSendRoomMessage,
 			Room: msg.Room,
 			Message: core.Message{
 				// ID will be set by hub after saving to DB
-				Room:      msg.Room,
-				From:      client.Name,
-				Text:      msg.Text,
-				CreatedAt: time.Now(),
+				Room:        msg.Room,
+				From:        client.Name,
+				Text:        msg.Text,
+				CreatedAt:   time.Now(),
+				ReplyTo:     msg.ReplyTo,
+				ClientMsgID: msg.ClientMsgID,
+				Attachments: attachments,
+			},
+		}, nil, nil
+	case proto.InboundTypeMsgEdit:
+		var edit proto.MsgEditData
+		if err := json.Unmarshal(inbound.Data, &edit); err != nil {
+			return nil, nil, err
+		}
+		if edit.Room == "" || edit.ID <= 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room and id are required"}, nil
+		}
+		if edit.Text == "" {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "text is required"}, nil
+		}
+		return &core.Command{
+			Kind: core.CommandEditMessage,
+			Room: edit.Room,
+			Message: core.Message{
+				ID:   edit.ID,
+				Room: edit.Room,
+				Text: edit.Text,
+			},
+		}, nil, nil
+	case proto.InboundTypeMsgDelete:
+		var del proto.MsgDeleteData
+		if err := json.Unmarshal(inbound.Data, &del); err != nil {
+			return nil, nil, err
+		}
+		if del.Room == "" || del.ID <= 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room and id are required"}, nil
+		}
+		return &core.Command{
+			Kind: core.CommandDeleteMessage,
+			Room: del.Room,
+			Message: core.Message{
+				ID:   del.ID,
+				Room: del.Room,
 			},
 		}, nil, nil
+	case proto.InboundTypeReactionAdd, proto.InboundTypeReactionRemove:
+		var reaction proto.ReactionData
+		if err := json.Unmarshal(inbound.Data, &reaction); err != nil {
+			return nil, nil, err
+		}
+		if reaction.Room == "" || reaction.ID <= 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room and id are required"}, nil
+		}
+		if !validEmoji(reaction.Emoji) {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "emoji is invalid"}, nil
+		}
+		kind := core.CommandAddReaction
+		if inbound.Type == proto.InboundTypeReactionRemove {
+			kind = core.CommandRemoveReaction
+		}
+		return &core.Command{
+			Kind:    kind,
+			Room:    reaction.Room,
+			Message: core.Message{ID: reaction.ID, Room: reaction.Room},
+			Emoji:   reaction.Emoji,
+		}, nil, nil
+	case proto.InboundTypeRead:
+		var read proto.ReadData
+		if err := json.Unmarshal(inbound.Data, &read); err != nil {
+			return nil, nil, err
+		}
+		if read.Room == "" || read.LastReadID <= 0 {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room and last_read_id are required"}, nil
+		}
+		return &core.Command{
+			Kind:    core.CommandMarkRead,
+			Room:    read.Room,
+			Message: core.Message{ID: read.LastReadID, Room: read.Room},
+		}, nil, nil
+	case proto.InboundTypeTyping:
+		var typing proto.TypingData
+		if err := json.Unmarshal(inbound.Data, &typing); err != nil {
+			return nil, nil, err
+		}
+		if typing.Room == "" {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "room is required"}, nil
+		}
+		kind := core.CommandTypingStart
+		if typing.Stop {
+			kind = core.CommandTypingStop
+		}
+		return &core.Command{
+			Kind: kind,
+			Room: typing.Room,
+		}, nil, nil
+	case proto.InboundTypePresence:
+		var presence proto.PresenceData
+		if err := json.Unmarshal(inbound.Data, &presence); err != nil {
+			return nil, nil, err
+		}
+		if presence.Status == "" {
+			return nil, &proto.Error{Code: core.ErrCodeBadRequest, Msg: "status is required"}, nil
+		}
+		return &core.Command{
+			Kind:   core.CommandSetPresence,
+			Status: presence.Status,
+		}, nil, nil
 
 	// --- Call commands ---
 	case proto.InboundTypeCallInvite:
@@ -154,12 +279,22 @@ func outboundFromEvent(event *core.Event) proto.Outbound {
 		return proto.Outbound{
 			Type:  "event",
 			Event: "message",
-			Data: proto.EventMessage{
+			Data:  eventMessageFromCore(event.Message),
+		}
+	case core.EventMessageEdited:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "message_edited",
+			Data:  eventMessageFromCore(event.Message),
+		}
+	case core.EventMessageDeleted:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "message_deleted",
+			Data: proto.EventMessageDeleted{
 				ID:   event.Message.ID,
-				Room: event.Message.Room,
-				User: event.Message.From,
-				Text: event.Message.Text,
-				TS:   event.Message.CreatedAt.Unix(),
+				Room: event.Room,
+				User: event.User,
 			},
 		}
 	case core.EventUserJoined:
@@ -180,24 +315,186 @@ func outboundFromEvent(event *core.Event) proto.Outbound {
 				User: event.User,
 			},
 		}
+	case core.EventReactionUpdated:
+		action := "removed"
+		var emoji string
+		if event.Reaction != nil {
+			emoji = event.Reaction.Emoji
+			if event.Reaction.Added {
+				action = "added"
+			}
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "reaction_updated",
+			Data: proto.EventReactionUpdated{
+				ID:        event.Message.ID,
+				Room:      event.Room,
+				User:      event.User,
+				Emoji:     emoji,
+				Action:    action,
+				Reactions: reactionsFromCore(event.Message.Reactions),
+			},
+		}
+	case core.EventReadReceipt:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "read_receipt",
+			Data: proto.EventReadReceipt{
+				Room:       event.Room,
+				User:       event.User,
+				UserID:     event.UserID,
+				LastReadID: event.Message.ID,
+			},
+		}
+	case core.EventUserTyping, core.EventTypingStopped:
+		name := "user_typing"
+		if event.Kind == core.EventTypingStopped {
+			name = "typing_stopped"
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: name,
+			Data: proto.EventTyping{
+				Room:   event.Room,
+				User:   event.User,
+				UserID: event.UserID,
+			},
+		}
+	case core.EventMessageAck:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "msg_ack",
+			Data: proto.EventMsgAck{
+				Room:        event.Room,
+				ClientMsgID: event.Message.ClientMsgID,
+				ID:          event.Message.ID,
+				TS:          event.Message.CreatedAt.Unix(),
+				Duplicate:   event.Duplicate,
+			},
+		}
+	case core.EventMessageNack:
+		data := proto.EventMsgNack{
+			Room:        event.Room,
+			ClientMsgID: event.Message.ClientMsgID,
+		}
+		if event.Error != nil {
+			data.Code = event.Error.Code
+			data.Msg = event.Error.Message
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "msg_nack",
+			Data:  data,
+		}
+	case core.EventUserKicked:
+		data := proto.EventUserKicked{
+			Room:   event.Room,
+			User:   event.User,
+			UserID: event.UserID,
+		}
+		if event.Kick != nil {
+			data.By = event.Kick.By
+			data.Reason = event.Kick.Reason
+			data.Banned = event.Kick.Banned
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "user_kicked",
+			Data:  data,
+		}
+	case core.EventRoomUpdated:
+		data := proto.EventRoomUpdated{
+			Room: event.Room,
+			User: event.User,
+		}
+		if event.RoomInfo != nil {
+			data.Topic = event.RoomInfo.Topic
+			data.Description = event.RoomInfo.Description
+			data.AvatarURL = event.RoomInfo.AvatarURL
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "room_updated",
+			Data:  data,
+		}
+	case core.EventMessagePinned:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "message_pinned",
+			Data: proto.EventMessagePinned{
+				Room:    event.Room,
+				User:    event.User,
+				Message: eventMessageFromCore(event.Message),
+			},
+		}
+	case core.EventMessageUnpinned:
+		return proto.Outbound{
+			Type:  "event",
+			Event: "message_unpinned",
+			Data: proto.EventMessageUnpinned{
+				ID:   event.Message.ID,
+				Room: event.Room,
+				User: event.User,
+			},
+		}
+	case core.EventMention:
+		data := proto.EventMention{
+			Room:    event.Room,
+			User:    event.User,
+			Message: eventMessageFromCore(event.Message),
+		}
+		if event.Mention != nil {
+			data.ID = event.Mention.ID
+			data.Kind = event.Mention.Kind
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "mention",
+			Data:  data,
+		}
+	case core.EventGap:
+		data := proto.EventGap{Rooms: []string{}}
+		if event.Gap != nil {
+			data.Rooms = append(data.Rooms, event.Gap.Rooms...)
+			data.Dropped = event.Gap.Dropped
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "gap",
+			Data:  data,
+		}
+	case core.EventPresenceChanged:
+		data := proto.EventPresenceChanged{
+			UserID: event.UserID,
+			User:   event.User,
+		}
+		if event.Presence != nil {
+			data.Status = event.Presence.Status
+			if !event.Presence.LastSeenAt.IsZero() {
+				data.LastSeenAt = event.Presence.LastSeenAt.Format("2006-01-02T15:04:05Z07:00")
+			}
+		}
+		return proto.Outbound{
+			Type:  "event",
+			Event: "presence_changed",
+			Data:  data,
+		}
 	case core.EventHistory:
 		// Convert core.Message slice to proto.EventMessage slice
 		messages := make([]proto.EventMessage, 0, len(event.Messages))
 		for _, msg := range event.Messages {
-			messages = append(messages, proto.EventMessage{
-				ID:   msg.ID,
-				Room: msg.Room,
-				User: msg.From,
-				Text: msg.Text,
-				TS:   msg.CreatedAt.Unix(),
-			})
+			messages = append(messages, eventMessageFromCore(msg))
 		}
 		return proto.Outbound{
 			Type:  "event",
 			Event: "history",
 			Data: proto.EventHistory{
-				Room:     event.Room,
-				Messages: messages,
+				Room:      event.Room,
+				Messages:  messages,
+				Since:     event.Since,
+				HasMore:   event.HasMore,
+				Truncated: event.Truncated,
 			},
 		}
 	case core.EventError:
@@ -297,8 +594,99 @@ func outboundFromEvent(event *core.Event) proto.Outbound {
 				Reason:        event.Call.Reason,
 			},
 		}
+	case core.EventCallAnsweredElsewhere:
+		return proto.Outbound{
+			Type:  proto.OutboundTypeEvent,
+			Event: proto.EventTypeCallAnsweredElsewhere,
+			Data: proto.EventCallAnsweredElsewhere{
+				CallID: event.Call.CallID,
+			},
+		}
 
 	default:
 		return proto.Outbound{Type: "event"}
 	}
 }
+
+// eventMessageFromCore converts a core message into its wire representation.
+func eventMessageFromCore(msg core.Message) proto.EventMessage {
+	out := proto.EventMessage{
+		ID:          msg.ID,
+		Room:        msg.Room,
+		User:        msg.From,
+		Text:        msg.Text,
+		TS:          msg.CreatedAt.Unix(),
+		Deleted:     msg.Deleted,
+		ReplyTo:     msg.ReplyTo,
+		ClientMsgID: msg.ClientMsgID,
+	}
+	if !msg.EditedAt.IsZero() {
+		out.EditedAt = msg.EditedAt.Unix()
+	}
+	if len(msg.Reactions) > 0 {
+		out.Reactions = reactionsFromCore(msg.Reactions)
+	}
+	if len(msg.Attachments) > 0 {
+		out.Attachments = attachmentsFromCore(msg.Attachments)
+	}
+	return out
+}
+
+// reactionsFromCore converts aggregated reactions; never returns nil.
+func reactionsFromCore(reactions []core.Reaction) []proto.Reaction {
+	out := make([]proto.Reaction, 0, len(reactions))
+	for _, r := range reactions {
+		out = append(out, proto.Reaction{Emoji: r.Emoji, Count: r.Count})
+	}
+	return out
+}
+
+func attachmentsFromCore(attachments []core.Attachment) []proto.Attachment {
+	out := make([]proto.Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		out = append(out, proto.Attachment{
+			ID:          a.ID,
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        a.Size,
+			URL:         attachmentURL(a.ID),
+		})
+	}
+	return out
+}
+
+// rejectionOutbound builds the response to a command rejected before reaching the hub.
+// Sends carrying a client_msg_id get a msg_nack so the sender can match its pending send.
+func rejectionOutbound(cmd *core.Command, protoErr *proto.Error) proto.Outbound {
+	if cmd == nil || cmd.Kind != core.CommandSendRoomMessage || cmd.Message.ClientMsgID == "" {
+		return proto.Outbound{Type: "error", Error: protoErr}
+	}
+	return proto.Outbound{
+		Type:  "event",
+		Event: "msg_nack",
+		Data: proto.EventMsgNack{
+			Room:        cmd.Room,
+			ClientMsgID: cmd.Message.ClientMsgID,
+			Code:        protoErr.Code,
+			Msg:         protoErr.Msg,
+		},
+	}
+}
+
+// maxAttachments bounds how many uploads a single message may share.
+const maxAttachments = 10
+
+// maxClientMsgIDBytes bounds client_msg_id; enough for a UUID or ULID with a prefix.
+const maxClientMsgIDBytes = 64
+
+// maxEmojiBytes bounds reaction length; enough for multi-codepoint emoji sequences.
+const maxEmojiBytes = 64
+
+// validEmoji performs a cheap sanity check on a reaction value.
+// Any non-empty, whitespace-free string up to maxEmojiBytes is accepted.
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiBytes || !utf8.ValidString(emoji) {
+		return false
+	}
+	return !strings.ContainsFunc(emoji, unicode.IsSpace)
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -17,9 +18,12 @@ const (
 	ContextKeyUsername = "username"
 	// ContextKeyIsGuest is the context key for storing guest status.
 	ContextKeyIsGuest = "is_guest"
+	// ContextKeySessionID is the context key for storing the token's session ID (0 if it has none).
+	ContextKeySessionID = "session_id"
 )
 
-// AuthMiddleware creates a middleware that validates JWT tokens.
+// AuthMiddleware creates a middleware that validates JWT tokens and rejects
+// tokens whose session was revoked.
 func AuthMiddleware(authService *auth.Service, logger *zerolog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -47,11 +51,24 @@ func AuthMiddleware(authService *auth.Service, logger *zerolog.Logger) gin.Handl
 			c.Abort()
 			return
 		}
+		if err := authService.CheckSession(c.Request.Context(), claims); err != nil {
+			if errors.Is(err, auth.ErrSessionRevoked) {
+				logger.Debug().Int64("session_id", claims.SessionID).Msg("revoked session")
+				c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "session revoked"})
+				c.Abort()
+				return
+			}
+			logger.Error().Err(err).Int64("session_id", claims.SessionID).Msg("failed to check session")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			c.Abort()
+			return
+		}
 
 		// Store user info in context
 		c.Set(ContextKeyUserID, claims.UserID)
 		c.Set(ContextKeyUsername, claims.Username)
 		c.Set(ContextKeyIsGuest, claims.IsGuest)
+		c.Set(ContextKeySessionID, claims.SessionID)
 
 		c.Next()
 	}
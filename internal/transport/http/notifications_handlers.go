@@ -0,0 +1,232 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// NotificationHandlers provides HTTP handlers for mention notification endpoints.
+type NotificationHandlers struct {
+	store store.Store
+	log   *zerolog.Logger
+}
+
+// NewNotificationHandlers creates a new notification handlers instance.
+func NewNotificationHandlers(st store.Store, logger *zerolog.Logger) *NotificationHandlers {
+	return &NotificationHandlers{
+		store: st,
+		log:   logger,
+	}
+}
+
+// NotificationResponse is a mention of the caller in a room message.
+type NotificationResponse struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"` // "user" for @username, "room" for @room
+	RoomID    int64           `json:"room_id"`
+	Room      string          `json:"room"`
+	AuthorID  int64           `json:"author_id"`
+	Author    string          `json:"author"`
+	Message   MessageResponse `json:"message"`
+	ReadAt    string          `json:"read_at,omitempty"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// NotificationsResponse represents the response for the notifications endpoint.
+type NotificationsResponse struct {
+	Notifications []NotificationResponse `json:"notifications"`
+	UnreadCount   int                    `json:"unread_count"`
+	HasMore       bool                   `json:"has_more"`
+}
+
+// MarkNotificationsReadRequest represents the mark notifications read request body.
+// Without IDs every unread notification is marked.
+type MarkNotificationsReadRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// MarkNotificationsReadResponse represents the response for marking notifications read.
+type MarkNotificationsReadResponse struct {
+	Marked      int64 `json:"marked"`
+	UnreadCount int   `json:"unread_count"`
+}
+
+// ListNotifications handles GET /api/notifications.
+// Query parameters: unread (true to skip read notifications), before (notification ID) and limit.
+// Returns the caller's mentions, newest first, in rooms they are still a member of.
+func (h *NotificationHandlers) ListNotifications(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	// Parse query parameters (same rules as message history)
+	limit := 20 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	var beforeID *int64
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		var parsedBefore int64
+		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
+			beforeID = &parsedBefore
+		}
+	}
+	unreadOnly := c.Query("unread") == "true"
+
+	ctx := c.Request.Context()
+	mentions, err := h.store.ListMentions(ctx, uid, unreadOnly, limit+1, beforeID)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to list mentions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	unread, err := h.store.CountUnreadMentions(ctx, uid)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to count mentions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	response := NotificationsResponse{
+		Notifications: []NotificationResponse{},
+		UnreadCount:   unread,
+		HasMore:       len(mentions) > limit,
+	}
+	if response.HasMore {
+		mentions = mentions[:limit]
+	}
+
+	roomNames := make(map[int64]string)
+	authorNames := make(map[int64]string)
+	messages := make([]MessageResponse, 0, len(mentions))
+	for _, m := range mentions {
+		msg, err := h.store.GetMessage(ctx, m.MessageID)
+		if err != nil {
+			h.log.Error().Err(err).Int64("message_id", m.MessageID).Msg("failed to get mentioning message")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		if _, ok := roomNames[m.RoomID]; !ok {
+			room, err := h.store.GetRoomByID(ctx, m.RoomID)
+			if err != nil {
+				h.log.Error().Err(err).Int64("room_id", m.RoomID).Msg("failed to get room")
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+				return
+			}
+			roomNames[m.RoomID] = room.Name
+		}
+		if _, ok := authorNames[m.AuthorID]; !ok {
+			// Best-effort: a deleted author leaves the name empty
+			if author, err := h.store.GetUserByID(ctx, m.AuthorID); err == nil {
+				authorNames[m.AuthorID] = author.Username
+			} else {
+				authorNames[m.AuthorID] = ""
+			}
+		}
+		resp := messageResponseFromStore(msg)
+		resp.User = authorNames[m.AuthorID]
+		messages = append(messages, resp)
+	}
+	attachReactions(ctx, h.store, h.log, messages)
+	attachFiles(ctx, h.store, h.log, messages)
+
+	for i, m := range mentions {
+		n := NotificationResponse{
+			ID:        m.ID,
+			Kind:      string(m.Kind),
+			RoomID:    m.RoomID,
+			Room:      roomNames[m.RoomID],
+			AuthorID:  m.AuthorID,
+			Author:    authorNames[m.AuthorID],
+			Message:   messages[i],
+			CreatedAt: m.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+		if m.ReadAt != nil {
+			n.ReadAt = m.ReadAt.Format("2006-01-02T15:04:05Z07:00")
+		}
+		response.Notifications = append(response.Notifications, n)
+	}
+
+	h.log.Debug().
+		Int64("user_id", uid).
+		Int("notification_count", len(response.Notifications)).
+		Int("unread_count", unread).
+		Msg("notifications listed")
+	c.JSON(http.StatusOK, response)
+}
+
+// MarkNotificationsRead handles POST /api/notifications/read.
+// Marks the given notifications, or all of them if no IDs are sent, as read.
+// IDs that are not the caller's or already read are ignored.
+func (h *NotificationHandlers) MarkNotificationsRead(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var req MarkNotificationsReadRequest
+	// An empty body marks everything
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.log.Debug().Err(err).Msg("invalid mark notifications request")
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+	if len(req.IDs) > 100 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "at most 100 ids per request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	marked, err := h.store.MarkMentionsRead(ctx, uid, req.IDs, time.Now())
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to mark mentions read")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	unread, err := h.store.CountUnreadMentions(ctx, uid)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to count mentions")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Debug().Int64("user_id", uid).Int64("marked", marked).Msg("notifications marked read")
+	c.JSON(http.StatusOK, MarkNotificationsReadResponse{Marked: marked, UnreadCount: unread})
+}
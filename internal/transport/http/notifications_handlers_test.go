@@ -0,0 +1,206 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/rs/zerolog"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/core"
+	"github.com/vovakirdan/wirechat-server/internal/proto"
+)
+
+func TestMentionNotifications(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Users 1..3: owner, bob, carol
+	tokens := make([]string, 0, 3)
+	for _, name := range []string{"owner", "bob", "carol"} {
+		token, regErr := registerToken(context.Background(), authService, name, "password123")
+		if regErr != nil {
+			t.Fatalf("failed to register %s: %v", name, regErr)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken, carolToken := tokens[0], tokens[1], tokens[2]
+
+	rest := func(method, path, token, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var room RoomResponse
+	if code := rest(http.MethodPost, "/api/rooms", ownerToken, `{"name":"crew","type":"private"}`, &room); code != http.StatusCreated {
+		t.Fatalf("create room: expected 201, got %d", code)
+	}
+	if code := rest(http.MethodPost, fmt.Sprintf("/api/rooms/%d/members", room.ID), ownerToken, `{"user_id":2}`, nil); code != http.StatusOK {
+		t.Fatalf("add bob: expected 200, got %d", code)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	dial := func(user, token string) *websocket.Conn {
+		conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		raw, _ := json.Marshal(proto.HelloData{User: user, Token: token, Protocol: 1})
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "hello", Data: raw}); writeErr != nil {
+			t.Fatalf("send hello: %v", writeErr)
+		}
+		return conn
+	}
+	send := func(conn *websocket.Conn, msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// waitEvent skips outbound frames until the named event arrives.
+	waitEvent := func(conn *websocket.Conn, name string) map[string]any {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", name, readErr)
+			}
+			if outbound.Event != name {
+				continue
+			}
+			raw, _ := json.Marshal(outbound.Data)
+			var data map[string]any
+			if unmarshalErr := json.Unmarshal(raw, &data); unmarshalErr != nil {
+				t.Fatalf("decode %s: %v", name, unmarshalErr)
+			}
+			return data
+		}
+	}
+
+	ownerConn := dial("owner", ownerToken)
+	defer ownerConn.Close(websocket.StatusNormalClosure, "done")
+	// Bob is connected but never joins the room
+	bobConn := dial("bob", bobToken)
+	defer bobConn.Close(websocket.StatusNormalClosure, "done")
+
+	send(ownerConn, "join", proto.JoinData{Room: "crew"})
+	waitEvent(ownerConn, "user_joined")
+
+	// Carol is not a member and the author never notifies themselves
+	send(ownerConn, "msg", proto.MsgData{Room: "crew", Text: "hey @bob, @carol and @owner"})
+	waitEvent(ownerConn, "message")
+	mention := waitEvent(bobConn, "mention")
+	message, _ := mention["message"].(map[string]any)
+	if mention["kind"] != "user" || mention["room"] != "crew" || mention["user"] != "owner" || message["text"] != "hey @bob, @carol and @owner" {
+		t.Fatalf("unexpected mention event %v", mention)
+	}
+
+	send(ownerConn, "msg", proto.MsgData{Room: "crew", Text: "@room standup"})
+	waitEvent(ownerConn, "message")
+	if mention := waitEvent(bobConn, "mention"); mention["kind"] != "room" {
+		t.Fatalf("expected a room mention, got %v", mention)
+	}
+
+	var inbox NotificationsResponse
+	if code := rest(http.MethodGet, "/api/notifications", bobToken, "", &inbox); code != http.StatusOK {
+		t.Fatalf("notifications: expected 200, got %d", code)
+	}
+	if len(inbox.Notifications) != 2 || inbox.UnreadCount != 2 || inbox.HasMore {
+		t.Fatalf("unexpected inbox %+v", inbox)
+	}
+	newest := inbox.Notifications[0]
+	if newest.Kind != "room" || newest.Room != "crew" || newest.Author != "owner" || newest.Message.Body != "@room standup" || newest.ReadAt != "" {
+		t.Fatalf("unexpected notification %+v", newest)
+	}
+
+	for _, token := range []string{carolToken, ownerToken} {
+		var other NotificationsResponse
+		rest(http.MethodGet, "/api/notifications", token, "", &other)
+		if len(other.Notifications) != 0 || other.UnreadCount != 0 {
+			t.Fatalf("expected no notifications, got %+v", other)
+		}
+	}
+
+	// Marking someone else's notification does nothing
+	var marked MarkNotificationsReadResponse
+	rest(http.MethodPost, "/api/notifications/read", carolToken, fmt.Sprintf(`{"ids":[%d]}`, newest.ID), &marked)
+	if marked.Marked != 0 {
+		t.Fatalf("foreign mark: expected 0 marked, got %+v", marked)
+	}
+
+	if code := rest(http.MethodPost, "/api/notifications/read", bobToken, fmt.Sprintf(`{"ids":[%d]}`, newest.ID), &marked); code != http.StatusOK {
+		t.Fatalf("mark read: expected 200, got %d", code)
+	}
+	if marked.Marked != 1 || marked.UnreadCount != 1 {
+		t.Fatalf("unexpected mark result %+v", marked)
+	}
+	inbox = NotificationsResponse{}
+	rest(http.MethodGet, "/api/notifications?unread=true", bobToken, "", &inbox)
+	if len(inbox.Notifications) != 1 || inbox.Notifications[0].Kind != "user" {
+		t.Fatalf("unexpected unread inbox %+v", inbox)
+	}
+
+	// An empty body marks everything
+	rest(http.MethodPost, "/api/notifications/read", bobToken, "", &marked)
+	if marked.Marked != 1 || marked.UnreadCount != 0 {
+		t.Fatalf("unexpected mark-all result %+v", marked)
+	}
+
+	// Mentions disappear once the user leaves the room
+	if code := rest(http.MethodDelete, fmt.Sprintf("/api/rooms/%d/leave", room.ID), bobToken, "", nil); code != http.StatusOK {
+		t.Fatalf("leave: expected 200, got %d", code)
+	}
+	inbox = NotificationsResponse{}
+	rest(http.MethodGet, "/api/notifications", bobToken, "", &inbox)
+	if len(inbox.Notifications) != 0 {
+		t.Fatalf("expected no notifications after leaving, got %+v", inbox)
+	}
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vovakirdan/wirechat-server/internal/auth"
+	"github.com/vovakirdan/wirechat-server/internal/auth/oidc"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+)
+
+const (
+	// oidcStateCookie carries a login attempt, sealed, in the browser that started it.
+	oidcStateCookie = "oidc_state"
+	// oidcLoginTTL is how long a user has to finish signing in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// pendingOIDCLogin is a login attempt waiting for the provider callback.
+// It lives in the state cookie, so unfinished logins cost the server nothing.
+type pendingOIDCLogin struct {
+	State     string `json:"s"`
+	Verifier  string `json:"v"` // PKCE code verifier
+	Nonce     string `json:"n"`
+	ExpiresAt int64  `json:"e"` // Unix seconds
+}
+
+// OIDCHandlers provides HTTP handlers for single sign-on through an OpenID Connect provider.
+type OIDCHandlers struct {
+	authService *auth.Service
+	provider    *oidc.Provider
+	cfg         config.OIDCConfig
+	log         *zerolog.Logger
+	sealer      cipher.AEAD // seals state cookies
+}
+
+// NewOIDCHandlers creates a new OIDC handlers instance. The state cookie key is
+// derived from stateSecret, so logins survive restarts and can finish on any
+// replica configured with the same secret.
+func NewOIDCHandlers(authService *auth.Service, provider *oidc.Provider, cfg config.OIDCConfig, stateSecret string, logger *zerolog.Logger) *OIDCHandlers {
+	key, err := hkdf.Key(sha256.New, []byte(stateSecret), nil, "wirechat oidc state", 32)
+	if err != nil {
+		panic(err) // unreachable: 32 bytes is well within HKDF-SHA256's limit
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err) // unreachable: the key size is valid
+	}
+	sealer, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err) // unreachable: AES has a 16 byte block
+	}
+	return &OIDCHandlers{
+		authService: authService,
+		provider:    provider,
+		cfg:         cfg,
+		log:         logger,
+		sealer:      sealer,
+	}
+}
+
+// Login handles GET /api/oidc/login.
+// Redirects the browser to the provider to sign in.
+func (h *OIDCHandlers) Login(c *gin.Context) {
+	var values [3]string // state, nonce, PKCE verifier
+	for i := range values {
+		value, err := oidc.NewRandom()
+		if err != nil {
+			h.log.Error().Err(err).Msg("failed to start oidc login")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to reach oidc provider")
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "identity provider unavailable"})
+		return
+	}
+
+	sealed, err := h.seal(pendingOIDCLogin{
+		State:     state,
+		Verifier:  verifier,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(oidcLoginTTL).Unix(),
+	})
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to seal oidc login state")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode) // sent along with the provider's top-level redirect back
+	c.SetCookie(oidcStateCookie, sealed, int(oidcLoginTTL.Seconds()), "/api/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /api/oidc/callback.
+// Redeems the authorization code, signs in the linked user (creating or linking
+// one as configured) and returns tokens like POST /api/login, or redirects to
+// the configured client URL with the tokens in the fragment.
+func (h *OIDCHandlers) Callback(c *gin.Context) {
+	// The cookie is single use either way
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/oidc", "", c.Request.TLS != nil, true)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.log.Info().Str("error", providerErr).Str("description", c.Query("error_description")).Msg("oidc login refused by provider")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed: " + providerErr})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if state == "" || err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid login state"})
+		return
+	}
+	login, ok := h.open(cookie)
+	if !ok || subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid login state"})
+		return
+	}
+	if time.Now().Unix() >= login.ExpiresAt {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "login expired, please try again"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "missing authorization code"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	identity, err := h.provider.Exchange(ctx, code, login.Verifier, login.Nonce)
+	if err != nil {
+		h.log.Warn().Err(err).Msg("oidc code exchange failed")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+		return
+	}
+
+	tokens, err := h.authService.LoginExternal(ctx, auth.ExternalIdentity{
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		Username: identity.Username,
+	}, auth.ExternalLoginOptions{
+		LinkExisting:  h.cfg.LinkExisting,
+		AutoProvision: h.cfg.AutoProvision,
+	}, deviceFromRequest(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrNoLinkedAccount) {
+			h.log.Info().Str("subject", identity.Subject).Msg("oidc login without linked account")
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "no account is linked to this identity"})
+			return
+		}
+		h.log.Error().Err(err).Str("subject", identity.Subject).Msg("failed to sign in oidc user")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().Str("subject", identity.Subject).Int64("session_id", tokens.SessionID).Msg("user logged in via oidc")
+
+	if h.cfg.ClientRedirectURL == "" {
+		c.JSON(http.StatusOK, authResponse(tokens))
+		return
+	}
+	// The fragment never reaches servers, so tokens stay out of access logs
+	fragment := url.Values{}
+	fragment.Set("token", tokens.AccessToken)
+	fragment.Set("refresh_token", tokens.RefreshToken)
+	fragment.Set("expires_in", strconv.FormatInt(int64(tokens.ExpiresIn.Seconds()), 10))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, h.cfg.ClientRedirectURL+"#"+fragment.Encode())
+}
+
+// seal encrypts a login attempt for the state cookie.
+func (h *OIDCHandlers) seal(login pendingOIDCLogin) (string, error) {
+	plain, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, h.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(h.sealer.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// open decrypts a state cookie. Returns false if it was not sealed by this server.
+func (h *OIDCHandlers) open(value string) (pendingOIDCLogin, bool) {
+	size := h.sealer.NonceSize()
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < size {
+		return pendingOIDCLogin{}, false
+	}
+	plain, err := h.sealer.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return pendingOIDCLogin{}, false
+	}
+	var login pendingOIDCLogin
+	if err := json.Unmarshal(plain, &login); err != nil {
+		return pendingOIDCLogin{}, false
+	}
+	return login, true
+}
@@ -0,0 +1,289 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/vovakirdan/wirechat-server/internal/auth"
+	"github.com/vovakirdan/wirechat-server/internal/auth/oidc"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/core"
+)
+
+// stubGrant is what the stub issuer remembers about an authorization code.
+type stubGrant struct {
+	challenge string
+	nonce     string
+	subject   string
+	username  string
+}
+
+// stubIssuer is a minimal OpenID Connect provider for tests.
+type stubIssuer struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	grants map[string]stubGrant // by code
+}
+
+func newStubIssuer(t *testing.T, clientID string) *stubIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate issuer key: %v", err)
+	}
+	jwk, err := auth.NewSigningKey("stub-key", &key.PublicKey)
+	if err != nil {
+		t.Fatalf("issuer jwk: %v", err)
+	}
+
+	s := &stubIssuer{t: t, key: key, clientID: clientID, grants: make(map[string]stubGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.server.URL,
+			"authorization_endpoint": s.server.URL + "/authorize",
+			"token_endpoint":         s.server.URL + "/token",
+			"jwks_uri":               s.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(auth.JWKS{Keys: []auth.JWK{jwk.JWK()}})
+	})
+	mux.HandleFunc("/token", s.token)
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// authorize plays the provider's login page: it approves the request behind
+// authURL for subject and returns the code and state to send to the callback.
+func (s *stubIssuer) authorize(authURL, subject, username, nonceOverride string) (code, state string) {
+	s.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		s.t.Fatalf("parse auth url: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != s.clientID || q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+		s.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	nonce := q.Get("nonce")
+	if nonceOverride != "" {
+		nonce = nonceOverride
+	}
+
+	code, err = oidc.NewRandom()
+	if err != nil {
+		s.t.Fatalf("generate code: %v", err)
+	}
+	s.mu.Lock()
+	s.grants[code] = stubGrant{challenge: q.Get("code_challenge"), nonce: nonce, subject: subject, username: username}
+	s.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (s *stubIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	grant, ok := s.grants[r.PostForm.Get("code")]
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok || r.PostForm.Get("client_id") != s.clientID || oidc.Challenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                s.server.URL,
+		"aud":                s.clientID,
+		"sub":                grant.subject,
+		"nonce":              grant.nonce,
+		"preferred_username": grant.username,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	})
+	idToken.Header["kid"] = "stub-key"
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		s.t.Errorf("sign id token: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "token_type": "Bearer", "id_token": signed})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	authService := createTestAuthService(t, testStore, "test-secret")
+	issuer := newStubIssuer(t, "wirechat")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+		OIDC: config.OIDCConfig{
+			Enabled:       true,
+			Issuer:        issuer.server.URL,
+			ClientID:      "wirechat",
+			RedirectURL:   "http://wirechat.test/api/oidc/callback",
+			Scopes:        []string{"openid", "profile"},
+			AutoProvision: true,
+		},
+	}
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// start begins a login and returns the provider URL and the state cookie
+	start := func() (string, *http.Cookie) {
+		resp, err := client.Get(ts.URL + "/api/oidc/login")
+		if err != nil {
+			t.Fatalf("start login: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("start login: expected 302, got %d", resp.StatusCode)
+		}
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == oidcStateCookie {
+				return resp.Header.Get("Location"), cookie
+			}
+		}
+		t.Fatal("start login: no state cookie")
+		return "", nil
+	}
+	callback := func(code, state string, cookie *http.Cookie, out any) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+		if err != nil {
+			t.Fatalf("build callback: %v", err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("callback: %v", err)
+		}
+		defer resp.Body.Close()
+		if out != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("decode callback: %v", err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	// First login provisions a user named after the provider's username
+	authURL, cookie := start()
+	code, state := issuer.authorize(authURL, "sub-alice", "alice", "")
+	var first AuthResponse
+	if status := callback(code, state, cookie, &first); status != http.StatusOK {
+		t.Fatalf("first login: expected 200, got %d", status)
+	}
+	claims, err := authService.ValidateToken(first.Token)
+	if err != nil || claims.Username != "alice" || first.RefreshToken == "" {
+		t.Fatalf("first login tokens: %+v, %v", claims, err)
+	}
+
+	// The code is single use
+	if status := callback(code, state, cookie, nil); status != http.StatusUnauthorized {
+		t.Fatalf("replayed callback: expected 401, got %d", status)
+	}
+
+	// A state cookie that was not sealed by the server is rejected
+	if status := callback(code, state, &http.Cookie{Name: oidcStateCookie, Value: state}, nil); status != http.StatusBadRequest {
+		t.Fatalf("forged cookie: expected 400, got %d", status)
+	}
+
+	// Later logins find the same user by subject, whatever the username says now
+	authURL, cookie = start()
+	code, state = issuer.authorize(authURL, "sub-alice", "alice.renamed", "")
+	var second AuthResponse
+	if status := callback(code, state, cookie, &second); status != http.StatusOK {
+		t.Fatalf("second login: expected 200, got %d", status)
+	}
+	if again, err := authService.ValidateToken(second.Token); err != nil || again.UserID != claims.UserID {
+		t.Fatalf("second login: expected user %d, got %+v, %v", claims.UserID, again, err)
+	}
+
+	// Another replica with the same secret finishes a login started here
+	replica := httptest.NewServer(NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger).Handler)
+	defer replica.Close()
+	authURL, cookie = start()
+	code, state = issuer.authorize(authURL, "sub-alice", "alice", "")
+	req, err := http.NewRequest(http.MethodGet, replica.URL+"/api/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if err != nil {
+		t.Fatalf("build callback: %v", err)
+	}
+	req.AddCookie(cookie)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("replica callback: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("replica callback: expected 200, got %d", resp.StatusCode)
+	}
+
+	// A callback from another browser (no state cookie) is rejected
+	authURL, _ = start()
+	code, state = issuer.authorize(authURL, "sub-mallory", "mallory", "")
+	if status := callback(code, state, nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("callback without cookie: expected 400, got %d", status)
+	}
+
+	// An ID token issued for another login attempt is rejected
+	authURL, cookie = start()
+	code, state = issuer.authorize(authURL, "sub-bob", "bob", "other-nonce")
+	if status := callback(code, state, cookie, nil); status != http.StatusUnauthorized {
+		t.Fatalf("nonce mismatch: expected 401, got %d", status)
+	}
+
+	// A second provider account asking for a taken username gets a variant of it
+	authURL, cookie = start()
+	code, state = issuer.authorize(authURL, "sub-other-alice", "alice", "")
+	var other AuthResponse
+	if status := callback(code, state, cookie, &other); status != http.StatusOK {
+		t.Fatalf("other alice: expected 200, got %d", status)
+	}
+	if otherClaims, err := authService.ValidateToken(other.Token); err != nil || otherClaims.UserID == claims.UserID || otherClaims.Username == "alice" {
+		t.Fatalf("other alice: expected a new user, got %+v, %v", otherClaims, err)
+	}
+}
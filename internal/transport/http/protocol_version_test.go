@@ -25,14 +25,14 @@ func TestProtocolVersionMismatch(t *testing.T) {
 	cfg := config.Default()
 	authService := createTestAuthService(t, store, cfg.JWTSecret)
 
-	hub := core.NewHub(store, nil)
+	hub := core.NewHub(store, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go hub.Run(ctx)
 
 	disabledLogger := zerolog.New(nil)
 
-	server := NewServer(hub, authService, store, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, store, nil, nil, nil, nil, &cfg, &disabledLogger)
 	ts := httptest.NewServer(server.Handler)
 	defer ts.Close()
 
@@ -1,34 +1,127 @@
 package http
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 
+	"github.com/vovakirdan/wirechat-server/internal/core"
+	"github.com/vovakirdan/wirechat-server/internal/service/rooms"
 	"github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 // RoomHandlers provides HTTP handlers for room management endpoints.
 type RoomHandlers struct {
 	store store.Store
+	rooms *rooms.Service
+	hub   core.Hub
 	log   *zerolog.Logger
 }
 
 // NewRoomHandlers creates a new room handlers instance.
-func NewRoomHandlers(st store.Store, logger *zerolog.Logger) *RoomHandlers {
+// hub may be nil, in which case live WebSocket clients are not notified of changes.
+func NewRoomHandlers(st store.Store, roomsSvc *rooms.Service, hub core.Hub, logger *zerolog.Logger) *RoomHandlers {
 	return &RoomHandlers{
 		store: st,
+		rooms: roomsSvc,
+		hub:   hub,
 		log:   logger,
 	}
 }
 
+// parseRoomID reads the :id URL parameter.
+// Writes a 400 response and returns false if it is not a number.
+func (h *RoomHandlers) parseRoomID(c *gin.Context) (int64, bool) {
+	var rid int64
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &rid); err != nil {
+		h.log.Debug().Str("room_id", c.Param("id")).Msg("invalid room id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
+		return 0, false
+	}
+	return rid, true
+}
+
+// authorizeRoom parses the room ID from the URL and checks that the user may read the room.
+// Writes an error response and returns nil if the room cannot be used.
+func (h *RoomHandlers) authorizeRoom(c *gin.Context, uid int64) *store.Room {
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return nil
+	}
+	room, err := h.rooms.AuthorizeRead(c.Request.Context(), uid, rid)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return nil
+	}
+	return room
+}
+
+// writeRoomAccessError maps a rooms service error to an HTTP status.
+func (h *RoomHandlers) writeRoomAccessError(c *gin.Context, rid, uid int64, err error) {
+	switch {
+	case errors.Is(err, rooms.ErrRoomNotFound):
+		h.log.Debug().Int64("room_id", rid).Msg("room not found")
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
+	case errors.Is(err, rooms.ErrAccessDenied):
+		h.log.Warn().Int64("room_id", rid).Int64("user_id", uid).Msg("room access denied")
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "access denied"})
+	case errors.Is(err, rooms.ErrNotMember):
+		h.log.Debug().Int64("room_id", rid).Msg("target user is not a room member")
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "member not found"})
+	case errors.Is(err, rooms.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid role, must be 'admin', 'moderator' or 'member'"})
+	case errors.Is(err, rooms.ErrBanned):
+		h.log.Debug().Int64("room_id", rid).Int64("user_id", uid).Msg("user is banned from room")
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "user is banned from this room"})
+	case errors.Is(err, rooms.ErrNotBanned):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "ban not found"})
+	case errors.Is(err, rooms.ErrNotMuted):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "mute not found"})
+	case errors.Is(err, rooms.ErrInvalidMute):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid mute duration"})
+	case errors.Is(err, rooms.ErrInvalidAvatarURL):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "avatar_url must be an http or https URL"})
+	case errors.Is(err, rooms.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+	case errors.Is(err, rooms.ErrAlreadyPinned):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "message is already pinned"})
+	case errors.Is(err, rooms.ErrNotPinned):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "pin not found"})
+	case errors.Is(err, rooms.ErrInviteNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "invite not found"})
+	case errors.Is(err, rooms.ErrInviteInvalid):
+		c.JSON(http.StatusGone, ErrorResponse{Error: "invite is expired, used up or revoked"})
+	case errors.Is(err, rooms.ErrInvalidInvite):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid invite settings"})
+	case errors.Is(err, rooms.ErrInvalidGroup):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("a group needs %d to %d participants, including you", rooms.MinGroupSize, rooms.MaxGroupSize)})
+	case errors.Is(err, rooms.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, rooms.ErrGroupFull):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "group is full, convert it to a private room to add more people"})
+	case errors.Is(err, rooms.ErrNotGroup):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "only group rooms can be converted"})
+	case errors.Is(err, rooms.ErrNameTaken):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "room with this name already exists"})
+	case errors.Is(err, rooms.ErrTooManyPins):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("a room can have at most %d pinned messages", rooms.MaxPins)})
+	default:
+		h.log.Error().Err(err).Int64("room_id", rid).Int64("user_id", uid).Msg("failed to check room access")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+	}
+}
+
 // CreateRoomRequest represents the create room request body.
 type CreateRoomRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=64"`
-	Type string `json:"type,omitempty"` // "public" or "private", defaults to "public"
+	Type string `json:"type,omitempty"` // "public", "private" or "channel", defaults to "public"
 }
 
 // RoomResponse represents a room in API responses.
@@ -37,7 +130,34 @@ type RoomResponse struct {
 	Name      string `json:"name"`
 	Type      string `json:"type"`
 	OwnerID   *int64 `json:"owner_id,omitempty"`
+	CreatedBy *int64 `json:"created_by,omitempty"` // creator of a group, the participant who may convert it
 	CreatedAt string `json:"created_at"`
+	// Metadata, omitted when unset
+	Topic       string `json:"topic,omitempty"`
+	Description string `json:"description,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	// Read state, only populated by ListRooms
+	LastReadID  *int64 `json:"last_read_id,omitempty"`
+	UnreadCount *int   `json:"unread_count,omitempty"`
+	// Number of subscribers (members), only populated for channels
+	SubscriberCount *int `json:"subscriber_count,omitempty"`
+	// Name to show for direct and group rooms, built from the other participants' usernames
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// displayName names a direct or group room after its participants other than uid,
+// e.g. "bob" or "bob, carol". Other room types have no display name.
+func displayName(room *store.Room, uid int64, members []store.RoomMemberName) string {
+	if room.Type != store.RoomTypeDirect && room.Type != store.RoomTypeGroup {
+		return ""
+	}
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		if m.UserID != uid {
+			names = append(names, m.Username)
+		}
+	}
+	return strings.Join(names, ", ")
 }
 
 // CreateRoom handles room creation.
@@ -73,9 +193,11 @@ func (h *RoomHandlers) CreateRoom(c *gin.Context) {
 			roomType = store.RoomTypePublic
 		case "private":
 			roomType = store.RoomTypePrivate
+		case "channel":
+			roomType = store.RoomTypeChannel
 		default:
 			h.log.Debug().Str("type", req.Type).Msg("invalid room type")
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room type, must be 'public' or 'private'"})
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room type, must be 'public', 'private' or 'channel'"})
 			return
 		}
 	}
@@ -93,13 +215,20 @@ func (h *RoomHandlers) CreateRoom(c *gin.Context) {
 		return
 	}
 
-	// If private room, auto-add creator to room_members
-	if roomType == store.RoomTypePrivate {
+	// Private rooms and channels start with the creator as their only member (and publisher)
+	var subscriberCount *int
+	if roomType == store.RoomTypePrivate || roomType == store.RoomTypeChannel {
 		if err := h.store.AddMember(c.Request.Context(), uid, room.ID); err != nil {
 			h.log.Error().Err(err).Int64("room_id", room.ID).Int64("user_id", uid).Msg("failed to add creator to room_members")
 			// Don't fail the request, just log the error
+		} else if _, err := h.store.SetMemberRole(c.Request.Context(), uid, room.ID, store.RoomRoleOwner); err != nil {
+			h.log.Error().Err(err).Int64("room_id", room.ID).Int64("user_id", uid).Msg("failed to set creator role")
 		}
 	}
+	if roomType == store.RoomTypeChannel {
+		count := 1
+		subscriberCount = &count
+	}
 
 	h.log.Info().
 		Str("room_name", room.Name).
@@ -108,11 +237,12 @@ func (h *RoomHandlers) CreateRoom(c *gin.Context) {
 		Str("type", string(roomType)).
 		Msg("room created successfully")
 	c.JSON(http.StatusCreated, RoomResponse{
-		ID:        room.ID,
-		Name:      room.Name,
-		Type:      string(room.Type),
-		OwnerID:   room.OwnerID,
-		CreatedAt: room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ID:              room.ID,
+		Name:            room.Name,
+		Type:            string(room.Type),
+		OwnerID:         room.OwnerID,
+		CreatedAt:       room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		SubscriberCount: subscriberCount,
 	})
 }
 
@@ -141,23 +271,65 @@ func (h *RoomHandlers) ListRooms(c *gin.Context) {
 		return
 	}
 
+	roomIDs := make([]int64, 0, len(rooms))
+	var channelIDs, dmIDs []int64
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+		switch room.Type {
+		case store.RoomTypeChannel:
+			channelIDs = append(channelIDs, room.ID)
+		case store.RoomTypeDirect, store.RoomTypeGroup:
+			dmIDs = append(dmIDs, room.ID)
+		}
+	}
+	readStates, err := h.store.ListReadStates(c.Request.Context(), uid, roomIDs)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to list read states")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	subscriberCounts, err := h.store.CountMembers(c.Request.Context(), channelIDs)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to count channel subscribers")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	participants, err := h.store.ListMemberNames(c.Request.Context(), dmIDs)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to list participants")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
 	// Convert to response format
 	response := make([]RoomResponse, 0, len(rooms))
 	for _, room := range rooms {
-		response = append(response, RoomResponse{
-			ID:        room.ID,
-			Name:      room.Name,
-			Type:      string(room.Type),
-			OwnerID:   room.OwnerID,
-			CreatedAt: room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		state := readStates[room.ID]
+		resp := RoomResponse{
+			ID:          room.ID,
+			Name:        room.Name,
+			Type:        string(room.Type),
+			OwnerID:     room.OwnerID,
+			CreatedBy:   room.CreatedBy,
+			CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			Topic:       room.Topic,
+			Description: room.Description,
+			AvatarURL:   room.AvatarURL,
+			LastReadID:  &state.LastReadID,
+			UnreadCount: &state.UnreadCount,
+			DisplayName: displayName(room, uid, participants[room.ID]),
+		}
+		if count, ok := subscriberCounts[room.ID]; ok {
+			resp.SubscriberCount = &count
+		}
+		response = append(response, resp)
 	}
 
 	h.log.Debug().Int64("user_id", uid).Int("room_count", len(rooms)).Msg("rooms listed successfully")
 	c.JSON(http.StatusOK, response)
 }
 
-// JoinRoom handles joining a room.
+// JoinRoom handles joining a room (subscribing, for channels).
 // POST /api/rooms/:id/join
 func (h *RoomHandlers) JoinRoom(c *gin.Context) {
 	// Get authenticated user from context
@@ -175,27 +347,14 @@ func (h *RoomHandlers) JoinRoom(c *gin.Context) {
 		return
 	}
 
-	// Parse room ID from URL
-	roomID := c.Param("id")
-	var rid int64
-	if _, err := fmt.Sscanf(roomID, "%d", &rid); err != nil {
-		h.log.Debug().Str("room_id", roomID).Msg("invalid room id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
-		return
-	}
-
-	// Get room from database
-	room, err := h.store.GetRoomByID(c.Request.Context(), rid)
-	if err != nil {
-		h.log.Warn().Err(err).Int64("room_id", rid).Msg("room not found")
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
+	rid, ok := h.parseRoomID(c)
+	if !ok {
 		return
 	}
 
-	// Check if room is private (private rooms can't be joined via REST)
-	if room.Type == store.RoomTypePrivate {
-		h.log.Warn().Int64("room_id", rid).Int64("user_id", uid).Msg("cannot join private room via REST")
-		c.JSON(http.StatusForbidden, ErrorResponse{Error: "private rooms cannot be joined directly"})
+	// Only public rooms and channels can be joined via REST; private and direct rooms need an invite
+	if _, err := h.rooms.AuthorizeSelfJoin(c.Request.Context(), uid, rid); err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
 		return
 	}
 
@@ -228,12 +387,12 @@ func (h *RoomHandlers) LeaveRoom(c *gin.Context) {
 		return
 	}
 
-	// Parse room ID from URL
-	roomID := c.Param("id")
-	var rid int64
-	if _, err := fmt.Sscanf(roomID, "%d", &rid); err != nil {
-		h.log.Debug().Str("room_id", roomID).Msg("invalid room id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.rooms.GetRoom(c.Request.Context(), rid); err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
 		return
 	}
 
@@ -253,7 +412,7 @@ type AddMemberRequest struct {
 	UserID int64 `json:"user_id" binding:"required"`
 }
 
-// AddMember handles adding a member to a room (owner only).
+// AddMember handles adding a member to a room (moderator and above).
 // POST /api/rooms/:id/members
 func (h *RoomHandlers) AddMember(c *gin.Context) {
 	// Get authenticated user from context
@@ -271,27 +430,8 @@ func (h *RoomHandlers) AddMember(c *gin.Context) {
 		return
 	}
 
-	// Parse room ID from URL
-	roomID := c.Param("id")
-	var rid int64
-	if _, err := fmt.Sscanf(roomID, "%d", &rid); err != nil {
-		h.log.Debug().Str("room_id", roomID).Msg("invalid room id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
-		return
-	}
-
-	// Get room from database
-	room, err := h.store.GetRoomByID(c.Request.Context(), rid)
-	if err != nil {
-		h.log.Warn().Err(err).Int64("room_id", rid).Msg("room not found")
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
-		return
-	}
-
-	// Check if current user is the owner
-	if room.OwnerID == nil || *room.OwnerID != currentUID {
-		h.log.Warn().Int64("room_id", rid).Int64("user_id", currentUID).Msg("user is not room owner")
-		c.JSON(http.StatusForbidden, ErrorResponse{Error: "only room owner can add members"})
+	rid, ok := h.parseRoomID(c)
+	if !ok {
 		return
 	}
 
@@ -303,10 +443,9 @@ func (h *RoomHandlers) AddMember(c *gin.Context) {
 		return
 	}
 
-	// Add member to room
-	if err := h.store.AddMember(c.Request.Context(), req.UserID, rid); err != nil {
-		h.log.Error().Err(err).Int64("room_id", rid).Int64("user_id", req.UserID).Msg("failed to add member")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+	// Requires the invite permission (moderator and above)
+	if _, err := h.rooms.AddMember(c.Request.Context(), currentUID, rid, req.UserID); err != nil {
+		h.writeRoomAccessError(c, rid, currentUID, err)
 		return
 	}
 
@@ -314,7 +453,8 @@ func (h *RoomHandlers) AddMember(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "member added successfully"})
 }
 
-// RemoveMember handles removing a member from a room (owner only).
+// RemoveMember handles kicking a member from a room (moderator and above, lower-ranked members only).
+// Live connections are unsubscribed from the room and it receives a user_kicked event.
 // DELETE /api/rooms/:id/members/:userId
 func (h *RoomHandlers) RemoveMember(c *gin.Context) {
 	// Get authenticated user from context
@@ -332,74 +472,97 @@ func (h *RoomHandlers) RemoveMember(c *gin.Context) {
 		return
 	}
 
-	// Parse room ID from URL
-	roomID := c.Param("id")
-	var rid int64
-	if _, err := fmt.Sscanf(roomID, "%d", &rid); err != nil {
-		h.log.Debug().Str("room_id", roomID).Msg("invalid room id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
+	rid, ok := h.parseRoomID(c)
+	if !ok {
 		return
 	}
 
 	// Parse target user ID from URL
-	targetUserID := c.Param("userId")
-	var targetUID int64
-	if _, err := fmt.Sscanf(targetUserID, "%d", &targetUID); err != nil {
-		h.log.Debug().Str("user_id", targetUserID).Msg("invalid user id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user id"})
+	targetUID, ok := h.parseTargetUserID(c)
+	if !ok {
 		return
 	}
 
-	// Get room from database
-	room, err := h.store.GetRoomByID(c.Request.Context(), rid)
+	// Requires the kick permission and a higher role than the target
+	reason := c.Query("reason")
+	room, err := h.rooms.Kick(c.Request.Context(), currentUID, rid, targetUID, reason)
 	if err != nil {
-		h.log.Warn().Err(err).Int64("room_id", rid).Msg("room not found")
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
+		h.writeRoomAccessError(c, rid, currentUID, err)
 		return
 	}
+	if err := h.disconnectFromRoom(c.Request.Context(), room, currentUID, targetUID, reason, false); err != nil {
+		h.log.Error().Err(err).Int64("room_id", rid).Int64("user_id", targetUID).Msg("failed to disconnect removed member")
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "member removed, but live connections could not be updated"})
+		return
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("user_id", targetUID).Int64("removed_by", currentUID).Msg("member removed from room")
+	c.JSON(http.StatusOK, gin.H{"message": "member removed successfully"})
+}
+
+// MemberResponse represents a room member in API responses.
+type MemberResponse struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
 
-	// Check if current user is the owner
-	if room.OwnerID == nil || *room.OwnerID != currentUID {
-		h.log.Warn().Int64("room_id", rid).Int64("user_id", currentUID).Msg("user is not room owner")
-		c.JSON(http.StatusForbidden, ErrorResponse{Error: "only room owner can remove members"})
+// ListMembers handles listing a room's members with their roles.
+// GET /api/rooms/:id/members
+func (h *RoomHandlers) ListMembers(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
 		return
 	}
 
-	// Remove member from room
-	if err := h.store.RemoveMember(c.Request.Context(), targetUID, rid); err != nil {
-		h.log.Error().Err(err).Int64("room_id", rid).Int64("user_id", targetUID).Msg("failed to remove member")
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
 		return
 	}
 
-	h.log.Info().Int64("room_id", rid).Int64("user_id", targetUID).Int64("removed_by", currentUID).Msg("member removed from room")
-	c.JSON(http.StatusOK, gin.H{"message": "member removed successfully"})
-}
+	room := h.authorizeRoom(c, uid)
+	if room == nil {
+		return
+	}
 
-// MessageResponse represents a message in API responses.
-type MessageResponse struct {
-	ID        int64  `json:"id"`
-	RoomID    int64  `json:"room_id"`
-	UserID    int64  `json:"user_id"`
-	User      string `json:"user,omitempty"` // Username, populated via JOIN
-	Body      string `json:"body"`
-	CreatedAt string `json:"created_at"`
-}
+	members, err := h.store.ListRoomMembers(c.Request.Context(), room.ID)
+	if err != nil {
+		h.log.Error().Err(err).Int64("room_id", room.ID).Msg("failed to list members")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
 
-// MessagesResponse represents the response for message history endpoint.
-type MessagesResponse struct {
-	Messages []MessageResponse `json:"messages"`
-	HasMore  bool              `json:"has_more"`
+	response := make([]MemberResponse, 0, len(members))
+	for _, m := range members {
+		var username string
+		if user, err := h.store.GetUserByID(c.Request.Context(), m.UserID); err == nil {
+			username = user.Username
+		}
+		response = append(response, MemberResponse{
+			UserID:   m.UserID,
+			Username: username,
+			Role:     string(m.Role),
+			JoinedAt: m.JoinedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
-// CreateDirectRoomRequest represents the create direct room request body.
-type CreateDirectRoomRequest struct {
-	UserID int64 `json:"user_id" binding:"required"`
+// UpdateMemberRoleRequest represents the change role request body.
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
 }
 
-// CreateDirectRoom handles creating or getting a direct message room between two users.
-// POST /api/rooms/direct
-func (h *RoomHandlers) CreateDirectRoom(c *gin.Context) {
+// UpdateMemberRole handles promoting or demoting a member (admin and above).
+// PUT /api/rooms/:id/members/:userId/role
+func (h *RoomHandlers) UpdateMemberRole(c *gin.Context) {
 	// Get authenticated user from context
 	userID, exists := c.Get(ContextKeyUserID)
 	if !exists {
@@ -415,124 +578,1507 @@ func (h *RoomHandlers) CreateDirectRoom(c *gin.Context) {
 		return
 	}
 
-	// Parse request body
-	var req CreateDirectRoomRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		h.log.Debug().Err(err).Msg("invalid create direct room request")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	rid, ok := h.parseRoomID(c)
+	if !ok {
 		return
 	}
 
-	// Can't create direct room with yourself
-	if req.UserID == currentUID {
-		h.log.Debug().Int64("user_id", currentUID).Msg("cannot create direct room with self")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot create direct room with yourself"})
+	targetUID, ok := h.parseTargetUserID(c)
+	if !ok {
 		return
 	}
 
-	// Compute direct_key: dm:{minUserId}:{maxUserId}
-	var user1ID, user2ID int64
-	if currentUID < req.UserID {
-		user1ID = currentUID
-		user2ID = req.UserID
-	} else {
-		user1ID = req.UserID
-		user2ID = currentUID
+	var req UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid update role request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
 	}
-	directKey := fmt.Sprintf("dm:%d:%d", user1ID, user2ID)
 
-	// Create or get existing direct room
-	room, err := h.store.CreateDirectRoom(c.Request.Context(), directKey, user1ID, user2ID)
-	if err != nil {
-		h.log.Error().Err(err).Str("direct_key", directKey).Msg("failed to create direct room")
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+	role := store.RoomRole(req.Role)
+	if _, err := h.rooms.SetRole(c.Request.Context(), currentUID, rid, targetUID, role); err != nil {
+		h.writeRoomAccessError(c, rid, currentUID, err)
 		return
 	}
 
 	h.log.Info().
-		Int64("room_id", room.ID).
-		Str("room_name", room.Name).
-		Str("direct_key", directKey).
-		Int64("user1_id", user1ID).
-		Int64("user2_id", user2ID).
-		Msg("direct room created or retrieved")
+		Int64("room_id", rid).
+		Int64("user_id", targetUID).
+		Str("role", req.Role).
+		Int64("changed_by", currentUID).
+		Msg("member role changed")
+	c.JSON(http.StatusOK, gin.H{"message": "role updated successfully"})
+}
 
-	c.JSON(http.StatusOK, RoomResponse{
-		ID:        room.ID,
-		Name:      room.Name,
-		Type:      string(room.Type),
-		OwnerID:   room.OwnerID,
-		CreatedAt: room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+// disconnectFromRoom unsubscribes a kicked or banned user's live connections
+// from a room and tells everyone in it, the user included.
+// Returns an error if the hub did not take the kick in time.
+func (h *RoomHandlers) disconnectFromRoom(ctx context.Context, room *store.Room, actorID, userID int64, reason string, banned bool) error {
+	if h.hub == nil {
+		return nil
+	}
+	var actor, target string
+	if user, err := h.store.GetUserByID(ctx, actorID); err == nil {
+		actor = user.Username
+	}
+	if user, err := h.store.GetUserByID(ctx, userID); err == nil {
+		target = user.Username
+	}
+	return h.hub.KickFromRoom(ctx, room.Name, userID, &core.Event{
+		Kind:   core.EventUserKicked,
+		Room:   room.Name,
+		User:   target,
+		UserID: userID,
+		Kick: &core.KickEvent{
+			By:     actor,
+			Reason: reason,
+			Banned: banned,
+		},
 	})
 }
 
-// GetMessages retrieves message history for a room with cursor pagination.
-// GET /api/rooms/:id/messages?limit=50&before=123
-func (h *RoomHandlers) GetMessages(c *gin.Context) {
-	// Parse room ID from URL
-	roomID := c.Param("id")
-	var rid int64
-	if _, err := fmt.Sscanf(roomID, "%d", &rid); err != nil {
-		h.log.Debug().Str("room_id", roomID).Msg("invalid room id")
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
+// parseTargetUserID reads the :userId URL parameter.
+// Writes a 400 response and returns false if it is not a number.
+func (h *RoomHandlers) parseTargetUserID(c *gin.Context) (int64, bool) {
+	var uid int64
+	if _, err := fmt.Sscanf(c.Param("userId"), "%d", &uid); err != nil {
+		h.log.Debug().Str("user_id", c.Param("userId")).Msg("invalid user id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user id"})
+		return 0, false
+	}
+	return uid, true
+}
+
+// BanRequest represents the ban user request body.
+type BanRequest struct {
+	UserID int64  `json:"user_id" binding:"required"`
+	Reason string `json:"reason,omitempty" binding:"max=256"`
+}
+
+// BanResponse represents a room ban in API responses.
+type BanResponse struct {
+	UserID    int64  `json:"user_id"`
+	BannedBy  int64  `json:"banned_by"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// BanUser handles banning a user from a room (admin and above).
+// POST /api/rooms/:id/bans
+func (h *RoomHandlers) BanUser(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
 		return
 	}
 
-	// Parse query parameters
-	limit := 50 // default
-	if limitStr := c.Query("limit"); limitStr != "" {
-		var parsedLimit int
-		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
-			if parsedLimit > 0 && parsedLimit <= 100 {
-				limit = parsedLimit
-			} else if parsedLimit > 100 {
-				limit = 100 // cap at 100
-			}
-		}
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
 	}
 
-	var beforeID *int64
-	if beforeStr := c.Query("before"); beforeStr != "" {
-		var parsedBefore int64
-		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
-			beforeID = &parsedBefore
-		}
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
 	}
 
-	// Fetch messages from store (limit + 1 to determine has_more)
-	messages, err := h.store.ListMessages(c.Request.Context(), rid, limit+1, beforeID)
+	var req BanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid ban request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, err := h.rooms.Ban(c.Request.Context(), currentUID, rid, req.UserID, req.Reason)
 	if err != nil {
-		h.log.Error().Err(err).Int64("room_id", rid).Msg("failed to list messages")
+		h.writeRoomAccessError(c, rid, currentUID, err)
+		return
+	}
+	if err := h.disconnectFromRoom(c.Request.Context(), room, currentUID, req.UserID, req.Reason, true); err != nil {
+		h.log.Error().Err(err).Int64("room_id", rid).Int64("user_id", req.UserID).Msg("failed to disconnect banned user")
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "user banned, but live connections could not be updated"})
+		return
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("user_id", req.UserID).Int64("banned_by", currentUID).Msg("user banned from room")
+	c.JSON(http.StatusOK, gin.H{"message": "user banned successfully"})
+}
+
+// UnbanUser handles lifting a ban (admin and above).
+// DELETE /api/rooms/:id/bans/:userId
+func (h *RoomHandlers) UnbanUser(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
 		return
 	}
 
-	// Determine if there are more messages
-	hasMore := len(messages) > limit
-	if hasMore {
-		messages = messages[:limit]
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+	targetUID, ok := h.parseTargetUserID(c)
+	if !ok {
+		return
 	}
 
-	// Convert to response format
-	response := MessagesResponse{
-		Messages: make([]MessageResponse, 0, len(messages)),
-		HasMore:  hasMore,
+	if _, err := h.rooms.Unban(c.Request.Context(), currentUID, rid, targetUID); err != nil {
+		h.writeRoomAccessError(c, rid, currentUID, err)
+		return
 	}
 
-	for _, msg := range messages {
-		response.Messages = append(response.Messages, MessageResponse{
-			ID:        msg.ID,
-			RoomID:    msg.RoomID,
-			UserID:    msg.UserID,
-			Body:      msg.Body,
-			CreatedAt: msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+	h.log.Info().Int64("room_id", rid).Int64("user_id", targetUID).Int64("unbanned_by", currentUID).Msg("user unbanned from room")
+	c.JSON(http.StatusOK, gin.H{"message": "user unbanned successfully"})
+}
+
+// ListBans handles listing a room's bans (admin and above).
+// GET /api/rooms/:id/bans
+func (h *RoomHandlers) ListBans(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
 	}
 
-	h.log.Debug().
-		Int64("room_id", rid).
-		Int("message_count", len(response.Messages)).
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	bans, err := h.rooms.ListBans(c.Request.Context(), uid, rid)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	response := make([]BanResponse, 0, len(bans))
+	for _, ban := range bans {
+		response = append(response, BanResponse{
+			UserID:    ban.UserID,
+			BannedBy:  ban.BannedBy,
+			Reason:    ban.Reason,
+			CreatedAt: ban.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MuteRequest represents the mute user request body.
+type MuteRequest struct {
+	UserID          int64  `json:"user_id" binding:"required"`
+	DurationSeconds int64  `json:"duration_seconds" binding:"required,min=1"`
+	Reason          string `json:"reason,omitempty" binding:"max=256"`
+}
+
+// MuteResponse represents an active mute in API responses.
+type MuteResponse struct {
+	UserID    int64  `json:"user_id"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// MuteUser handles muting a user in a room for a while (moderator and above).
+// POST /api/rooms/:id/mutes
+func (h *RoomHandlers) MuteUser(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var req MuteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid mute request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if req.DurationSeconds > int64(rooms.MaxMuteDuration/time.Second) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid mute duration"})
+		return
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	mute, err := h.rooms.Mute(c.Request.Context(), currentUID, rid, req.UserID, duration, req.Reason)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, currentUID, err)
+		return
+	}
+
+	h.log.Info().
+		Int64("room_id", rid).
+		Int64("user_id", req.UserID).
+		Int64("muted_by", currentUID).
+		Time("expires_at", mute.ExpiresAt).
+		Msg("user muted in room")
+	c.JSON(http.StatusOK, MuteResponse{
+		UserID:    mute.UserID,
+		ExpiresAt: mute.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	})
+}
+
+// UnmuteUser handles lifting a mute early (moderator and above).
+// DELETE /api/rooms/:id/mutes/:userId
+func (h *RoomHandlers) UnmuteUser(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+	targetUID, ok := h.parseTargetUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.rooms.Unmute(c.Request.Context(), currentUID, rid, targetUID); err != nil {
+		h.writeRoomAccessError(c, rid, currentUID, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("user_id", targetUID).Int64("unmuted_by", currentUID).Msg("user unmuted in room")
+	c.JSON(http.StatusOK, gin.H{"message": "user unmuted successfully"})
+}
+
+// AuditEntryResponse represents an audit log entry in API responses.
+type AuditEntryResponse struct {
+	ID        int64  `json:"id"`
+	ActorID   int64  `json:"actor_id"`
+	Action    string `json:"action"`
+	TargetID  int64  `json:"target_id"`
+	Reason    string `json:"reason,omitempty"`
+	Details   string `json:"details,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AuditLogResponse represents a page of a room's audit log.
+type AuditLogResponse struct {
+	Entries []AuditEntryResponse `json:"entries"`
+	HasMore bool                 `json:"has_more"`
+}
+
+// GetAuditLog handles retrieving a room's moderation audit log (admin and above).
+// GET /api/rooms/:id/audit?limit=50&before=123
+func (h *RoomHandlers) GetAuditLog(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	// Parse query parameters (same rules as message history)
+	limit := 50 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	var beforeID *int64
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		var parsedBefore int64
+		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
+			beforeID = &parsedBefore
+		}
+	}
+
+	// Fetch one extra entry to detect whether another page exists
+	entries, err := h.rooms.ListAudit(c.Request.Context(), uid, rid, limit+1, beforeID)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	response := AuditLogResponse{
+		Entries: make([]AuditEntryResponse, 0, len(entries)),
+		HasMore: hasMore,
+	}
+	for _, e := range entries {
+		response.Entries = append(response.Entries, AuditEntryResponse{
+			ID:        e.ID,
+			ActorID:   e.ActorID,
+			Action:    string(e.Action),
+			TargetID:  e.TargetID,
+			Reason:    e.Reason,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MessageResponse represents a message in API responses.
+type MessageResponse struct {
+	ID          int64                `json:"id"`
+	RoomID      int64                `json:"room_id"`
+	UserID      int64                `json:"user_id"`
+	User        string               `json:"user,omitempty"` // Username, populated via JOIN
+	Body        string               `json:"body"`
+	CreatedAt   string               `json:"created_at"`
+	EditedAt    string               `json:"edited_at,omitempty"`
+	DeletedAt   string               `json:"deleted_at,omitempty"`
+	ReplyTo     *int64               `json:"reply_to,omitempty"`
+	Reactions   []ReactionResponse   `json:"reactions,omitempty"`
+	Attachments []AttachmentResponse `json:"attachments,omitempty"`
+}
+
+// ReactionResponse is the aggregated count of one emoji on a message.
+type ReactionResponse struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// attachReactions fills aggregated reactions into message responses in place.
+// Best-effort: on failure messages are returned without reactions.
+func attachReactions(ctx context.Context, st store.Store, log *zerolog.Logger, messages []MessageResponse) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	counts, err := st.ListReactionCounts(ctx, ids)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load reactions")
+		return
+	}
+	for i := range messages {
+		for _, rc := range counts[messages[i].ID] {
+			messages[i].Reactions = append(messages[i].Reactions, ReactionResponse{Emoji: rc.Emoji, Count: rc.Count})
+		}
+	}
+}
+
+// messageResponseFromStore converts a stored message into its API representation.
+func messageResponseFromStore(msg *store.Message) MessageResponse {
+	resp := MessageResponse{
+		ID:        msg.ID,
+		RoomID:    msg.RoomID,
+		UserID:    msg.UserID,
+		Body:      msg.Body,
+		CreatedAt: msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ReplyTo:   msg.ReplyTo,
+	}
+	if msg.EditedAt != nil {
+		resp.EditedAt = msg.EditedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if msg.DeletedAt != nil {
+		resp.DeletedAt = msg.DeletedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
+
+// attachFiles fills attachment metadata into message responses in place.
+// Best-effort: on failure messages are returned without attachments.
+func attachFiles(ctx context.Context, st store.Store, log *zerolog.Logger, messages []MessageResponse) {
+	if len(messages) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	attachments, err := st.ListAttachments(ctx, ids)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load attachments")
+		return
+	}
+	for i := range messages {
+		for _, a := range attachments[messages[i].ID] {
+			messages[i].Attachments = append(messages[i].Attachments, attachmentResponseFromStore(a))
+		}
+	}
+}
+
+// MessagesResponse represents the response for message history endpoint.
+type MessagesResponse struct {
+	Messages []MessageResponse `json:"messages"`
+	HasMore  bool              `json:"has_more"`
+}
+
+// CreateDirectRoomRequest represents the create direct room request body.
+type CreateDirectRoomRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// CreateDirectRoom handles creating or getting a direct message room between two users.
+// POST /api/rooms/direct
+func (h *RoomHandlers) CreateDirectRoom(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	// Parse request body
+	var req CreateDirectRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid create direct room request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	// Can't create direct room with yourself
+	if req.UserID == currentUID {
+		h.log.Debug().Int64("user_id", currentUID).Msg("cannot create direct room with self")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "cannot create direct room with yourself"})
+		return
+	}
+
+	// Compute direct_key: dm:{minUserId}:{maxUserId}
+	var user1ID, user2ID int64
+	if currentUID < req.UserID {
+		user1ID = currentUID
+		user2ID = req.UserID
+	} else {
+		user1ID = req.UserID
+		user2ID = currentUID
+	}
+	directKey := fmt.Sprintf("dm:%d:%d", user1ID, user2ID)
+
+	// Create or get existing direct room
+	room, err := h.store.CreateDirectRoom(c.Request.Context(), directKey, user1ID, user2ID)
+	if err != nil {
+		h.log.Error().Err(err).Str("direct_key", directKey).Msg("failed to create direct room")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().
+		Int64("room_id", room.ID).
+		Str("room_name", room.Name).
+		Str("direct_key", directKey).
+		Int64("user1_id", user1ID).
+		Int64("user2_id", user2ID).
+		Msg("direct room created or retrieved")
+
+	c.JSON(http.StatusOK, RoomResponse{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        string(room.Type),
+		OwnerID:     room.OwnerID,
+		CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		DisplayName: h.roomDisplayName(c.Request.Context(), room, currentUID),
+	})
+}
+
+// roomDisplayName is displayName for a single room. Best-effort: returns "" if members cannot be loaded.
+func (h *RoomHandlers) roomDisplayName(ctx context.Context, room *store.Room, uid int64) string {
+	names, err := h.store.ListMemberNames(ctx, []int64{room.ID})
+	if err != nil {
+		h.log.Warn().Err(err).Int64("room_id", room.ID).Msg("failed to list participants")
+		return ""
+	}
+	return displayName(room, uid, names[room.ID])
+}
+
+// CreateGroupRoomRequest represents the create group room request body.
+type CreateGroupRoomRequest struct {
+	UserIDs []int64 `json:"user_ids" binding:"required"` // other participants; the caller is always included
+}
+
+// CreateGroupRoom handles creating or getting a group DM between the caller and several users.
+// POST /api/rooms/group
+func (h *RoomHandlers) CreateGroupRoom(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	currentUID, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var req CreateGroupRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid create group room request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, err := h.rooms.CreateGroup(c.Request.Context(), currentUID, req.UserIDs)
+	if err != nil {
+		h.writeRoomAccessError(c, 0, currentUID, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Int64("user_id", currentUID).Msg("group room created or retrieved")
+	c.JSON(http.StatusOK, RoomResponse{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        string(room.Type),
+		OwnerID:     room.OwnerID,
+		CreatedBy:   room.CreatedBy,
+		CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Topic:       room.Topic,
+		Description: room.Description,
+		AvatarURL:   room.AvatarURL,
+		DisplayName: h.roomDisplayName(c.Request.Context(), room, currentUID),
+	})
+}
+
+// ConvertRoomRequest represents the convert group request body.
+type ConvertRoomRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=64"`
+}
+
+// ConvertRoom handles turning a group DM into a private room owned by the caller,
+// who must have created the group.
+// POST /api/rooms/:id/convert
+func (h *RoomHandlers) ConvertRoom(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var req ConvertRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid convert room request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, err := h.rooms.ConvertGroup(c.Request.Context(), uid, rid, req.Name)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Str("room_name", room.Name).Int64("owner_id", uid).Msg("group converted to private room")
+	c.JSON(http.StatusOK, RoomResponse{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        string(room.Type),
+		OwnerID:     room.OwnerID,
+		CreatedBy:   room.CreatedBy,
+		CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Topic:       room.Topic,
+		Description: room.Description,
+		AvatarURL:   room.AvatarURL,
+	})
+}
+
+// GetMessages retrieves message history for a room with cursor pagination.
+// With after, pages forward from that message instead (oldest first) to catch up after a reconnect.
+// GET /api/rooms/:id/messages?limit=50&before=123
+// GET /api/rooms/:id/messages?limit=50&after=123
+func (h *RoomHandlers) GetMessages(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	room := h.authorizeRoom(c, uid)
+	if room == nil {
+		return
+	}
+	rid := room.ID
+
+	// Parse query parameters
+	limit := 50 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	var beforeID *int64
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		var parsedBefore int64
+		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
+			beforeID = &parsedBefore
+		}
+	}
+
+	var afterID *int64
+	if afterStr := c.Query("after"); afterStr != "" {
+		var parsedAfter int64
+		if _, err := fmt.Sscanf(afterStr, "%d", &parsedAfter); err == nil {
+			afterID = &parsedAfter
+		}
+	}
+	if beforeID != nil && afterID != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "before and after cannot be combined"})
+		return
+	}
+
+	// Fetch messages from store (limit + 1 to determine has_more)
+	var messages []*store.Message
+	var err error
+	if afterID != nil {
+		messages, err = h.store.ListMessagesAfter(c.Request.Context(), rid, *afterID, limit+1)
+	} else {
+		messages, err = h.store.ListMessages(c.Request.Context(), rid, limit+1, beforeID)
+	}
+	if err != nil {
+		h.log.Error().Err(err).Int64("room_id", rid).Msg("failed to list messages")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	// Determine if there are more messages
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	// Convert to response format
+	response := MessagesResponse{
+		Messages: make([]MessageResponse, 0, len(messages)),
+		HasMore:  hasMore,
+	}
+
+	for _, msg := range messages {
+		response.Messages = append(response.Messages, messageResponseFromStore(msg))
+	}
+	attachReactions(c.Request.Context(), h.store, h.log, response.Messages)
+	attachFiles(c.Request.Context(), h.store, h.log, response.Messages)
+
+	h.log.Debug().
+		Int64("room_id", rid).
+		Int("message_count", len(response.Messages)).
 		Bool("has_more", hasMore).
 		Msg("messages retrieved successfully")
 	c.JSON(http.StatusOK, response)
 }
+
+// ThreadResponse represents the response for the thread endpoint.
+type ThreadResponse struct {
+	Root    MessageResponse   `json:"root"`
+	Replies []MessageResponse `json:"replies"`
+	HasMore bool              `json:"has_more"`
+}
+
+// GetThread retrieves replies to a root message with cursor pagination.
+// GET /api/rooms/:id/messages/:msgId/thread?limit=50&before=123
+func (h *RoomHandlers) GetThread(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	room := h.authorizeRoom(c, uid)
+	if room == nil {
+		return
+	}
+	rid := room.ID
+
+	// Parse message ID from URL
+	var mid int64
+	if _, err := fmt.Sscanf(c.Param("msgId"), "%d", &mid); err != nil {
+		h.log.Debug().Str("message_id", c.Param("msgId")).Msg("invalid message id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+		return
+	}
+
+	// Parse query parameters
+	limit := 50 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	var beforeID *int64
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		var parsedBefore int64
+		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
+			beforeID = &parsedBefore
+		}
+	}
+
+	// Root must exist in this room; a deleted root still anchors its thread
+	root, err := h.store.GetMessage(c.Request.Context(), mid)
+	if err != nil || root.RoomID != rid {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.log.Error().Err(err).Int64("message_id", mid).Msg("failed to get message")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+		return
+	}
+
+	// Fetch replies from store (limit + 1 to determine has_more)
+	replies, err := h.store.ListReplies(c.Request.Context(), mid, limit+1, beforeID)
+	if err != nil {
+		h.log.Error().Err(err).Int64("message_id", mid).Msg("failed to list replies")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	// Replies come back in chronological order; the extra row (if any) is the oldest
+	hasMore := len(replies) > limit
+	if hasMore {
+		replies = replies[1:]
+	}
+
+	response := ThreadResponse{
+		Root:    messageResponseFromStore(root),
+		Replies: make([]MessageResponse, 0, len(replies)),
+		HasMore: hasMore,
+	}
+	for _, reply := range replies {
+		response.Replies = append(response.Replies, messageResponseFromStore(reply))
+	}
+	attachReactions(c.Request.Context(), h.store, h.log, response.Replies)
+	attachFiles(c.Request.Context(), h.store, h.log, response.Replies)
+
+	h.log.Debug().
+		Int64("room_id", rid).
+		Int64("message_id", mid).
+		Int("reply_count", len(response.Replies)).
+		Bool("has_more", hasMore).
+		Msg("thread retrieved successfully")
+	c.JSON(http.StatusOK, response)
+}
+
+// EditMessageRequest represents the edit message request body.
+type EditMessageRequest struct {
+	Text string `json:"text" binding:"required,min=1"`
+}
+
+// loadMessage checks room access, parses the message ID from the URL and loads the target message.
+// Writes an error response and returns nil values if the message cannot be used.
+func (h *RoomHandlers) loadMessage(c *gin.Context, uid int64) (*store.Room, *store.Message) {
+	room := h.authorizeRoom(c, uid)
+	if room == nil {
+		return nil, nil
+	}
+
+	var mid int64
+	if _, err := fmt.Sscanf(c.Param("msgId"), "%d", &mid); err != nil {
+		h.log.Debug().Str("message_id", c.Param("msgId")).Msg("invalid message id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+		return nil, nil
+	}
+
+	msg, err := h.store.GetMessage(c.Request.Context(), mid)
+	if err != nil || msg.RoomID != room.ID || msg.DeletedAt != nil {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			h.log.Error().Err(err).Int64("message_id", mid).Msg("failed to get message")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return nil, nil
+		}
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+		return nil, nil
+	}
+	return room, msg
+}
+
+// EditMessage handles editing a message (author only).
+// PATCH /api/rooms/:id/messages/:msgId
+func (h *RoomHandlers) EditMessage(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid edit message request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, msg := h.loadMessage(c, uid)
+	if msg == nil {
+		return
+	}
+
+	if msg.UserID != uid {
+		h.log.Debug().Int64("message_id", msg.ID).Int64("user_id", uid).Msg("user is not message author")
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "only the author can edit a message"})
+		return
+	}
+
+	editedAt := time.Now()
+	if err := h.store.EditMessage(c.Request.Context(), msg.ID, req.Text, editedAt); err != nil {
+		h.log.Error().Err(err).Int64("message_id", msg.ID).Msg("failed to edit message")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	msg.Body = req.Text
+	msg.EditedAt = &editedAt
+
+	if h.hub != nil {
+		var author string
+		if user, err := h.store.GetUserByID(c.Request.Context(), uid); err == nil {
+			author = user.Username
+		}
+		h.hub.BroadcastToRoom(room.Name, &core.Event{
+			Kind: core.EventMessageEdited,
+			Room: room.Name,
+			Message: core.Message{
+				ID:        msg.ID,
+				Room:      room.Name,
+				From:      author,
+				Text:      msg.Body,
+				CreatedAt: msg.CreatedAt,
+				EditedAt:  editedAt,
+			},
+		})
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Int64("message_id", msg.ID).Int64("user_id", uid).Msg("message edited")
+	c.JSON(http.StatusOK, messageResponseFromStore(msg))
+}
+
+// DeleteMessage handles deleting a message (author, or moderator and above).
+// DELETE /api/rooms/:id/messages/:msgId
+func (h *RoomHandlers) DeleteMessage(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	room, msg := h.loadMessage(c, uid)
+	if msg == nil {
+		return
+	}
+
+	if msg.UserID != uid {
+		role, err := h.store.GetMemberRole(c.Request.Context(), uid, room.ID)
+		if err != nil {
+			h.log.Error().Err(err).Int64("room_id", room.ID).Int64("user_id", uid).Msg("failed to get member role")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		if !role.Can(store.RoomPermDeleteMessages) {
+			h.log.Debug().Int64("message_id", msg.ID).Int64("user_id", uid).Msg("user cannot delete message")
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "only the author or a room moderator can delete a message"})
+			return
+		}
+	}
+
+	if err := h.store.DeleteMessage(c.Request.Context(), msg.ID, time.Now()); err != nil {
+		h.log.Error().Err(err).Int64("message_id", msg.ID).Msg("failed to delete message")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	if h.hub != nil {
+		var actor string
+		if user, err := h.store.GetUserByID(c.Request.Context(), uid); err == nil {
+			actor = user.Username
+		}
+		h.hub.BroadcastToRoom(room.Name, &core.Event{
+			Kind: core.EventMessageDeleted,
+			Room: room.Name,
+			User: actor,
+			Message: core.Message{
+				ID:      msg.ID,
+				Room:    room.Name,
+				Deleted: true,
+			},
+		})
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Int64("message_id", msg.ID).Int64("user_id", uid).Msg("message deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "message deleted"})
+}
+
+// UpdateRoomRequest represents the update room request body.
+// Omitted fields are left unchanged; an empty string clears a field.
+type UpdateRoomRequest struct {
+	Topic       *string `json:"topic,omitempty" binding:"omitempty,max=256"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=2048"`
+	AvatarURL   *string `json:"avatar_url,omitempty" binding:"omitempty,max=512"`
+}
+
+// UpdateRoom handles editing a room's topic, description and avatar (admin and above).
+// PATCH /api/rooms/:id
+func (h *RoomHandlers) UpdateRoom(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid update room request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, err := h.rooms.UpdateMetadata(c.Request.Context(), uid, rid, rooms.MetadataUpdate{
+		Topic:       req.Topic,
+		Description: req.Description,
+		AvatarURL:   req.AvatarURL,
+	})
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	if h.hub != nil {
+		var actor string
+		if user, err := h.store.GetUserByID(c.Request.Context(), uid); err == nil {
+			actor = user.Username
+		}
+		h.hub.BroadcastToRoom(room.Name, &core.Event{
+			Kind:   core.EventRoomUpdated,
+			Room:   room.Name,
+			User:   actor,
+			UserID: uid,
+			RoomInfo: &core.RoomInfo{
+				Topic:       room.Topic,
+				Description: room.Description,
+				AvatarURL:   room.AvatarURL,
+			},
+		})
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Int64("user_id", uid).Msg("room updated")
+	c.JSON(http.StatusOK, RoomResponse{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        string(room.Type),
+		OwnerID:     room.OwnerID,
+		CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Topic:       room.Topic,
+		Description: room.Description,
+		AvatarURL:   room.AvatarURL,
+	})
+}
+
+// PinRequest represents the pin message request body.
+type PinRequest struct {
+	MessageID int64 `json:"message_id" binding:"required"`
+}
+
+// PinResponse represents a pinned message in API responses.
+type PinResponse struct {
+	Message  MessageResponse `json:"message"`
+	PinnedBy int64           `json:"pinned_by"`
+	PinnedAt string          `json:"pinned_at"`
+}
+
+// ListPins handles listing a room's pinned messages, newest pin first.
+// GET /api/rooms/:id/pins
+func (h *RoomHandlers) ListPins(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	pins, err := h.rooms.ListPins(c.Request.Context(), uid, rid)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	// Pins are capped at rooms.MaxPins, so loading messages one by one is cheap
+	response := make([]PinResponse, 0, len(pins))
+	messages := make([]MessageResponse, 0, len(pins))
+	for _, pin := range pins {
+		msg, err := h.store.GetMessage(c.Request.Context(), pin.MessageID)
+		if err != nil {
+			h.log.Error().Err(err).Int64("message_id", pin.MessageID).Msg("failed to get pinned message")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		messages = append(messages, messageResponseFromStore(msg))
+	}
+	attachReactions(c.Request.Context(), h.store, h.log, messages)
+	attachFiles(c.Request.Context(), h.store, h.log, messages)
+	for i, pin := range pins {
+		response = append(response, PinResponse{
+			Message:  messages[i],
+			PinnedBy: pin.PinnedBy,
+			PinnedAt: pin.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PinMessage handles pinning a message (moderator and above).
+// POST /api/rooms/:id/pins
+func (h *RoomHandlers) PinMessage(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var req PinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.log.Debug().Err(err).Msg("invalid pin request")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	room, msg, err := h.rooms.Pin(c.Request.Context(), uid, rid, req.MessageID)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	if h.hub != nil {
+		var actor, author string
+		if user, err := h.store.GetUserByID(c.Request.Context(), uid); err == nil {
+			actor = user.Username
+		}
+		if user, err := h.store.GetUserByID(c.Request.Context(), msg.UserID); err == nil {
+			author = user.Username
+		}
+		pinned := core.Message{
+			ID:        msg.ID,
+			Room:      room.Name,
+			From:      author,
+			Text:      msg.Body,
+			CreatedAt: msg.CreatedAt,
+		}
+		if msg.EditedAt != nil {
+			pinned.EditedAt = *msg.EditedAt
+		}
+		if msg.ReplyTo != nil {
+			pinned.ReplyTo = *msg.ReplyTo
+		}
+		h.hub.BroadcastToRoom(room.Name, &core.Event{
+			Kind:    core.EventMessagePinned,
+			Room:    room.Name,
+			User:    actor,
+			UserID:  uid,
+			Message: pinned,
+		})
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("message_id", msg.ID).Int64("pinned_by", uid).Msg("message pinned")
+	c.JSON(http.StatusOK, gin.H{"message": "message pinned"})
+}
+
+// UnpinMessage handles unpinning a message (moderator and above).
+// DELETE /api/rooms/:id/pins/:msgId
+func (h *RoomHandlers) UnpinMessage(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	var mid int64
+	if _, err := fmt.Sscanf(c.Param("msgId"), "%d", &mid); err != nil {
+		h.log.Debug().Str("message_id", c.Param("msgId")).Msg("invalid message id")
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+		return
+	}
+
+	room, err := h.rooms.Unpin(c.Request.Context(), uid, rid, mid)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	if h.hub != nil {
+		var actor string
+		if user, err := h.store.GetUserByID(c.Request.Context(), uid); err == nil {
+			actor = user.Username
+		}
+		h.hub.BroadcastToRoom(room.Name, &core.Event{
+			Kind:    core.EventMessageUnpinned,
+			Room:    room.Name,
+			User:    actor,
+			UserID:  uid,
+			Message: core.Message{ID: mid, Room: room.Name},
+		})
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("message_id", mid).Int64("unpinned_by", uid).Msg("message unpinned")
+	c.JSON(http.StatusOK, gin.H{"message": "message unpinned"})
+}
+
+// CreateInviteRequest represents the create invite request body.
+type CreateInviteRequest struct {
+	MaxUses          int   `json:"max_uses,omitempty" binding:"min=0"`           // 0 means unlimited
+	ExpiresInSeconds int64 `json:"expires_in_seconds,omitempty" binding:"min=0"` // 0 means the default lifetime
+}
+
+// InviteResponse represents an invite link in API responses.
+type InviteResponse struct {
+	Code      string `json:"code"`
+	RoomID    int64  `json:"room_id"`
+	CreatedBy int64  `json:"created_by"`
+	MaxUses   int    `json:"max_uses"`
+	Uses      int    `json:"uses"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+// inviteResponseFromStore converts a stored invite into its API representation.
+func inviteResponseFromStore(invite *store.RoomInvite) InviteResponse {
+	return InviteResponse{
+		Code:      invite.Code,
+		RoomID:    invite.RoomID,
+		CreatedBy: invite.CreatedBy,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		CreatedAt: invite.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+// CreateInvite handles creating an invite link (moderator and above).
+// POST /api/rooms/:id/invites
+func (h *RoomHandlers) CreateInvite(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional: no body means an unlimited invite with the default lifetime
+	var req CreateInviteRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.log.Debug().Err(err).Msg("invalid create invite request")
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+	if req.ExpiresInSeconds > int64(rooms.MaxInviteTTL/time.Second) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expires_in_seconds is too long"})
+		return
+	}
+
+	invite, err := h.rooms.CreateInvite(c.Request.Context(), uid, rid, req.MaxUses, time.Duration(req.ExpiresInSeconds)*time.Second)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("created_by", uid).Int("max_uses", invite.MaxUses).Msg("room invite created")
+	c.JSON(http.StatusCreated, inviteResponseFromStore(invite))
+}
+
+// ListInvites handles listing a room's active invite links (admin and above).
+// GET /api/rooms/:id/invites
+func (h *RoomHandlers) ListInvites(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	invites, err := h.rooms.ListInvites(c.Request.Context(), uid, rid)
+	if err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	response := make([]InviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		response = append(response, inviteResponseFromStore(invite))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvite handles revoking an invite link (its creator, or admin and above).
+// DELETE /api/rooms/:id/invites/:code
+func (h *RoomHandlers) RevokeInvite(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	rid, ok := h.parseRoomID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.rooms.RevokeInvite(c.Request.Context(), uid, rid, c.Param("code")); err != nil {
+		h.writeRoomAccessError(c, rid, uid, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", rid).Int64("revoked_by", uid).Msg("room invite revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "invite revoked"})
+}
+
+// AcceptInvite handles joining a room with an invite code.
+// POST /api/invites/:code/accept
+func (h *RoomHandlers) AcceptInvite(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	room, err := h.rooms.AcceptInvite(c.Request.Context(), uid, c.Param("code"))
+	if err != nil {
+		h.writeRoomAccessError(c, 0, uid, err)
+		return
+	}
+
+	h.log.Info().Int64("room_id", room.ID).Int64("user_id", uid).Msg("room invite accepted")
+	c.JSON(http.StatusOK, RoomResponse{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        string(room.Type),
+		OwnerID:     room.OwnerID,
+		CreatedAt:   room.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Topic:       room.Topic,
+		Description: room.Description,
+		AvatarURL:   room.AvatarURL,
+	})
+}
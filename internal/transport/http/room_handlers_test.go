@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,7 +26,7 @@ func TestCreateRoom(t *testing.T) {
 	// Create auth service
 	authService := createTestAuthService(t, testStore, "test-secret")
 
-	hub := core.NewHub(testStore, nil)
+	hub := core.NewHub(testStore, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go hub.Run(ctx)
@@ -38,12 +41,12 @@ func TestCreateRoom(t *testing.T) {
 		JWTSecret:         "test-secret",
 	}
 
-	server := NewServer(hub, authService, testStore, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
 	ts := httptest.NewServer(server.Handler)
 	defer ts.Close()
 
 	// Register a test user
-	token, err := authService.Register(context.Background(), "testuser", "password123")
+	token, err := registerToken(context.Background(), authService, "testuser", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user: %v", err)
 	}
@@ -110,7 +113,7 @@ func TestListRooms(t *testing.T) {
 	// Create auth service
 	authService := createTestAuthService(t, testStore, "test-secret")
 
-	hub := core.NewHub(testStore, nil)
+	hub := core.NewHub(testStore, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go hub.Run(ctx)
@@ -125,12 +128,12 @@ func TestListRooms(t *testing.T) {
 		JWTSecret:         "test-secret",
 	}
 
-	server := NewServer(hub, authService, testStore, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
 	ts := httptest.NewServer(server.Handler)
 	defer ts.Close()
 
 	// Register a test user
-	token, err := authService.Register(context.Background(), "testuser", "password123")
+	token, err := registerToken(context.Background(), authService, "testuser", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user: %v", err)
 	}
@@ -198,7 +201,7 @@ func TestCreateDirectRoom(t *testing.T) {
 	// Create auth service
 	authService := createTestAuthService(t, testStore, "test-secret")
 
-	hub := core.NewHub(testStore, nil)
+	hub := core.NewHub(testStore, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go hub.Run(ctx)
@@ -213,17 +216,17 @@ func TestCreateDirectRoom(t *testing.T) {
 		JWTSecret:         "test-secret",
 	}
 
-	server := NewServer(hub, authService, testStore, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
 	ts := httptest.NewServer(server.Handler)
 	defer ts.Close()
 
 	// Register two test users
-	token1, err := authService.Register(context.Background(), "user1", "password123")
+	token1, err := registerToken(context.Background(), authService, "user1", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user1: %v", err)
 	}
 
-	token2, err := authService.Register(context.Background(), "user2", "password123")
+	token2, err := registerToken(context.Background(), authService, "user2", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user2: %v", err)
 	}
@@ -334,3 +337,858 @@ func TestCreateDirectRoom(t *testing.T) {
 		t.Errorf("user1 should see direct room in their room list")
 	}
 }
+
+func TestEditAndDeleteMessage(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// owner creates the room, author writes a message, other is a bystander
+	ownerToken, err := registerToken(context.Background(), authService, "owner", "password123")
+	if err != nil {
+		t.Fatalf("failed to register owner: %v", err)
+	}
+	authorToken, err := registerToken(context.Background(), authService, "author", "password123")
+	if err != nil {
+		t.Fatalf("failed to register author: %v", err)
+	}
+	otherToken, err := registerToken(context.Background(), authService, "other", "password123")
+	if err != nil {
+		t.Fatalf("failed to register other: %v", err)
+	}
+
+	ownerID := int64(1)
+	room, err := testStore.CreateRoom(context.Background(), "edits", store.RoomTypePublic, &ownerID)
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	msg := &store.Message{RoomID: room.ID, UserID: 2, Body: "helo", CreatedAt: time.Now()}
+	if err := testStore.SaveMessage(context.Background(), msg); err != nil {
+		t.Fatalf("failed to save message: %v", err)
+	}
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if body != "" {
+			req = httptest.NewRequest(method, path, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	msgPath := fmt.Sprintf("/api/rooms/%d/messages/%d", room.ID, msg.ID)
+
+	// Test 1: Non-author cannot edit
+	resp := do(http.MethodPatch, msgPath, otherToken, `{"text":"hacked"}`)
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	// Test 2: Author edits the message
+	resp = do(http.MethodPatch, msgPath, authorToken, `{"text":"hello"}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var edited MessageResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &edited); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if edited.Body != "hello" || edited.EditedAt == "" {
+		t.Errorf("expected edited body 'hello' with edited_at, got %+v", edited)
+	}
+
+	// Test 3: Message in another room is not found
+	resp = do(http.MethodPatch, fmt.Sprintf("/api/rooms/1/messages/%d", msg.ID), authorToken, `{"text":"x"}`)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	// Test 4: Bystander cannot delete, room owner can
+	resp = do(http.MethodDelete, msgPath, otherToken, "")
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d: %s", resp.Code, resp.Body.String())
+	}
+	resp = do(http.MethodDelete, msgPath, ownerToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	// Test 5: Deleted message keeps its place in history with an empty body
+	resp = do(http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages", room.ID), authorToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var history MessagesResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(history.Messages) != 1 || history.Messages[0].Body != "" || history.Messages[0].DeletedAt == "" {
+		t.Errorf("expected one deleted message in history, got %+v", history.Messages)
+	}
+
+	// Test 6: Deleted message can no longer be edited
+	resp = do(http.MethodPatch, msgPath, authorToken, `{"text":"again"}`)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	token, err := registerToken(context.Background(), authService, "testuser", "password123")
+	if err != nil {
+		t.Fatalf("failed to register user: %v", err)
+	}
+
+	// Room 1 is "general" from the test schema
+	save := func(body string, replyTo *int64) *store.Message {
+		msg := &store.Message{RoomID: 1, UserID: 1, Body: body, CreatedAt: time.Now(), ReplyTo: replyTo}
+		if err := testStore.SaveMessage(context.Background(), msg); err != nil {
+			t.Fatalf("failed to save message: %v", err)
+		}
+		return msg
+	}
+	root := save("root", nil)
+	save("unrelated", nil)
+	reply1 := save("reply 1", &root.ID)
+	reply2 := save("reply 2", &root.ID)
+	reply3 := save("reply 3", &root.ID)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Test 1: First page holds the newest replies
+	resp := get(fmt.Sprintf("/api/rooms/1/messages/%d/thread?limit=2", root.ID))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var page ThreadResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if page.Root.ID != root.ID {
+		t.Errorf("expected root %d, got %d", root.ID, page.Root.ID)
+	}
+	if !page.HasMore || len(page.Replies) != 2 || page.Replies[0].ID != reply2.ID || page.Replies[1].ID != reply3.ID {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if page.Replies[0].ReplyTo == nil || *page.Replies[0].ReplyTo != root.ID {
+		t.Errorf("expected reply_to %d, got %v", root.ID, page.Replies[0].ReplyTo)
+	}
+
+	// Test 2: Second page via before cursor
+	resp = get(fmt.Sprintf("/api/rooms/1/messages/%d/thread?limit=2&before=%d", root.ID, reply2.ID))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	page = ThreadResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if page.HasMore || len(page.Replies) != 1 || page.Replies[0].ID != reply1.ID {
+		t.Errorf("unexpected second page: %+v", page)
+	}
+
+	// Test 3: Root in another room is not found
+	resp = get(fmt.Sprintf("/api/rooms/999/messages/%d/thread", root.ID))
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestRoomAccessEnforced(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	tokens := make([]string, 0, 3)
+	for _, name := range []string{"alice", "bob", "mallory"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	aliceToken, malloryToken := tokens[0], tokens[2]
+
+	// alice (1) owns a private room; alice and bob (2) share a DM; mallory (3) is in neither
+	aliceID := int64(1)
+	private, err := testStore.CreateRoom(context.Background(), "secret", store.RoomTypePrivate, &aliceID)
+	if err != nil {
+		t.Fatalf("failed to create private room: %v", err)
+	}
+	if err := testStore.AddMember(context.Background(), 1, private.ID); err != nil {
+		t.Fatalf("failed to add member: %v", err)
+	}
+	direct, err := testStore.CreateDirectRoom(context.Background(), "dm:1:2", 1, 2)
+	if err != nil {
+		t.Fatalf("failed to create direct room: %v", err)
+	}
+
+	msgIn := func(roomID int64) int64 {
+		msg := &store.Message{RoomID: roomID, UserID: 1, Body: "hi", CreatedAt: time.Now()}
+		if err := testStore.SaveMessage(context.Background(), msg); err != nil {
+			t.Fatalf("failed to save message: %v", err)
+		}
+		return msg.ID
+	}
+	publicMsg := msgIn(1)
+	privateMsg := msgIn(private.ID)
+	directMsg := msgIn(direct.ID)
+
+	do := func(method, path, token, body string) int {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"public history for non-member", http.MethodGet, "/api/rooms/1/messages", malloryToken, "", http.StatusOK},
+		{"public thread for non-member", http.MethodGet, fmt.Sprintf("/api/rooms/1/messages/%d/thread", publicMsg), malloryToken, "", http.StatusOK},
+		{"private history for member", http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages", private.ID), aliceToken, "", http.StatusOK},
+		{"private history for outsider", http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages", private.ID), malloryToken, "", http.StatusForbidden},
+		{"private thread for outsider", http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages/%d/thread", private.ID, privateMsg), malloryToken, "", http.StatusForbidden},
+		{"private delete for outsider", http.MethodDelete, fmt.Sprintf("/api/rooms/%d/messages/%d", private.ID, privateMsg), malloryToken, "", http.StatusForbidden},
+		{"private self-join", http.MethodPost, fmt.Sprintf("/api/rooms/%d/join", private.ID), malloryToken, "", http.StatusForbidden},
+		{"direct history for participant", http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages", direct.ID), aliceToken, "", http.StatusOK},
+		{"direct history for outsider", http.MethodGet, fmt.Sprintf("/api/rooms/%d/messages", direct.ID), malloryToken, "", http.StatusForbidden},
+		{"direct edit for outsider", http.MethodPatch, fmt.Sprintf("/api/rooms/%d/messages/%d", direct.ID, directMsg), malloryToken, `{"text":"pwned"}`, http.StatusForbidden},
+		{"direct self-join", http.MethodPost, fmt.Sprintf("/api/rooms/%d/join", direct.ID), malloryToken, "", http.StatusForbidden},
+		{"unknown room history", http.MethodGet, "/api/rooms/999/messages", malloryToken, "", http.StatusNotFound},
+		{"unknown room join", http.MethodPost, "/api/rooms/999/join", malloryToken, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(tt.method, tt.path, tt.token, tt.body); got != tt.want {
+				t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRoomRoles(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(nil, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// Users 1..4: owner, bob, carol, dave
+	tokens := make([]string, 0, 4)
+	for _, name := range []string{"owner", "bob", "carol", "dave"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken := tokens[0], tokens[1]
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/api/rooms", ownerToken, `{"name":"staff","type":"private"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("failed to create room: %d %s", resp.Code, resp.Body.String())
+	}
+	var room RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &room); err != nil {
+		t.Fatalf("failed to decode room: %v", err)
+	}
+	membersPath := fmt.Sprintf("/api/rooms/%d/members", room.ID)
+	rolePath := func(uid int) string { return fmt.Sprintf("%s/%d/role", membersPath, uid) }
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"owner adds bob", http.MethodPost, membersPath, ownerToken, `{"user_id":2}`, http.StatusOK},
+		{"owner adds carol", http.MethodPost, membersPath, ownerToken, `{"user_id":3}`, http.StatusOK},
+		{"member cannot invite", http.MethodPost, membersPath, bobToken, `{"user_id":4}`, http.StatusForbidden},
+		{"member cannot kick", http.MethodDelete, membersPath + "/3", bobToken, "", http.StatusForbidden},
+		{"owner promotes bob to moderator", http.MethodPut, rolePath(2), ownerToken, `{"role":"moderator"}`, http.StatusOK},
+		{"moderator invites dave", http.MethodPost, membersPath, bobToken, `{"user_id":4}`, http.StatusOK},
+		{"moderator kicks member", http.MethodDelete, membersPath + "/3", bobToken, "", http.StatusOK},
+		{"moderator cannot kick owner", http.MethodDelete, membersPath + "/1", bobToken, "", http.StatusForbidden},
+		{"moderator cannot manage roles", http.MethodPut, rolePath(4), bobToken, `{"role":"moderator"}`, http.StatusForbidden},
+		{"owner promotes bob to admin", http.MethodPut, rolePath(2), ownerToken, `{"role":"admin"}`, http.StatusOK},
+		{"admin promotes dave to moderator", http.MethodPut, rolePath(4), bobToken, `{"role":"moderator"}`, http.StatusOK},
+		{"admin cannot grant admin", http.MethodPut, rolePath(4), bobToken, `{"role":"admin"}`, http.StatusForbidden},
+		{"admin cannot demote owner", http.MethodPut, rolePath(1), bobToken, `{"role":"member"}`, http.StatusForbidden},
+		{"admin cannot change own role", http.MethodPut, rolePath(2), bobToken, `{"role":"member"}`, http.StatusForbidden},
+		{"ownership is not assignable", http.MethodPut, rolePath(4), ownerToken, `{"role":"owner"}`, http.StatusBadRequest},
+		{"unknown role", http.MethodPut, rolePath(4), ownerToken, `{"role":"king"}`, http.StatusBadRequest},
+		{"non-member cannot get a role", http.MethodPut, rolePath(3), ownerToken, `{"role":"member"}`, http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if resp := do(step.method, step.path, step.token, step.body); resp.Code != step.want {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.want, resp.Code, resp.Body.String())
+		}
+	}
+
+	resp = do(http.MethodGet, membersPath, bobToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to list members: %d %s", resp.Code, resp.Body.String())
+	}
+	var members []MemberResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &members); err != nil {
+		t.Fatalf("failed to decode members: %v", err)
+	}
+	roles := make(map[int64]string, len(members))
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	want := map[int64]string{1: "owner", 2: "admin", 4: "moderator"}
+	if len(roles) != len(want) {
+		t.Fatalf("expected members %v, got %v", want, roles)
+	}
+	for uid, role := range want {
+		if roles[uid] != role {
+			t.Errorf("expected user %d to be %s, got %q", uid, role, roles[uid])
+		}
+	}
+}
+
+// busyHub is a hub that never takes a kick.
+type busyHub struct {
+	core.Hub
+}
+
+func (busyHub) BroadcastToRoom(string, *core.Event) {}
+
+func (busyHub) KickFromRoom(context.Context, string, int64, *core.Event) error {
+	return core.ErrHubBusy
+}
+
+func TestKickReportsBusyHub(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	authService := createTestAuthService(t, testStore, "test-secret")
+	disabledLogger := zerolog.New(nil)
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+	server := NewServer(busyHub{}, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// Users 1..3: owner, bob, carol
+	tokens := make([]string, 0, 3)
+	for _, name := range []string{"owner", "bob", "carol"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken := tokens[0]
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+ownerToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/api/rooms", `{"name":"staff","type":"private"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("failed to create room: %d %s", resp.Code, resp.Body.String())
+	}
+	var room RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &room); err != nil {
+		t.Fatalf("failed to decode room: %v", err)
+	}
+	membersPath := fmt.Sprintf("/api/rooms/%d/members", room.ID)
+	for _, uid := range []int{2, 3} {
+		if resp := do(http.MethodPost, membersPath, fmt.Sprintf(`{"user_id":%d}`, uid)); resp.Code != http.StatusOK {
+			t.Fatalf("failed to add user %d: %d %s", uid, resp.Code, resp.Body.String())
+		}
+	}
+
+	// The kick and the ban are stored, but the caller learns the live
+	// connections were not updated
+	if resp := do(http.MethodDelete, membersPath+"/2", ""); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("kick: expected status 503, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, fmt.Sprintf("/api/rooms/%d/bans", room.ID), `{"user_id":3}`); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("ban: expected status 503, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestRoomInvites(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(nil, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// Users 1..4: owner, bob, carol, dave
+	tokens := make([]string, 0, 4)
+	for _, name := range []string{"owner", "bob", "carol", "dave"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken, carolToken, daveToken := tokens[0], tokens[1], tokens[2], tokens[3]
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+	resp := do(http.MethodPost, "/api/rooms", ownerToken, `{"name":"staff","type":"private"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("failed to create room: %d %s", resp.Code, resp.Body.String())
+	}
+	var room RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &room); err != nil {
+		t.Fatalf("failed to decode room: %v", err)
+	}
+	roomPath := fmt.Sprintf("/api/rooms/%d", room.ID)
+
+	createInvite := func(body string) InviteResponse {
+		t.Helper()
+		resp := do(http.MethodPost, roomPath+"/invites", ownerToken, body)
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("failed to create invite: %d %s", resp.Code, resp.Body.String())
+		}
+		var invite InviteResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &invite); err != nil {
+			t.Fatalf("failed to decode invite: %v", err)
+		}
+		return invite
+	}
+
+	twoUses := createInvite(`{"max_uses":2}`).Code
+	revoked := createInvite("").Code
+	banned := createInvite(`{"expires_in_seconds":3600}`).Code
+	if resp := do(http.MethodPost, roomPath+"/bans", ownerToken, `{"user_id":4}`); resp.Code != http.StatusOK {
+		t.Fatalf("failed to ban dave: %d %s", resp.Code, resp.Body.String())
+	}
+
+	accept := func(code string) string { return "/api/invites/" + code + "/accept" }
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"outsider cannot read", http.MethodGet, roomPath + "/messages", bobToken, "", http.StatusForbidden},
+		{"bob accepts", http.MethodPost, accept(twoUses), bobToken, "", http.StatusOK},
+		{"bob can read", http.MethodGet, roomPath + "/messages", bobToken, "", http.StatusOK},
+		{"accepting again is free", http.MethodPost, accept(twoUses), bobToken, "", http.StatusOK},
+		{"carol takes the last use", http.MethodPost, accept(twoUses), carolToken, "", http.StatusOK},
+		{"used up invite", http.MethodPost, accept(twoUses), daveToken, "", http.StatusGone},
+		{"banned user cannot accept", http.MethodPost, accept(banned), daveToken, "", http.StatusForbidden},
+		{"unknown code", http.MethodPost, accept("nope"), daveToken, "", http.StatusNotFound},
+		{"member cannot create", http.MethodPost, roomPath + "/invites", bobToken, "", http.StatusForbidden},
+		{"member cannot list", http.MethodGet, roomPath + "/invites", bobToken, "", http.StatusForbidden},
+		{"member cannot revoke", http.MethodDelete, roomPath + "/invites/" + revoked, bobToken, "", http.StatusForbidden},
+		{"expiry too long", http.MethodPost, roomPath + "/invites", ownerToken, `{"expires_in_seconds":99999999}`, http.StatusBadRequest},
+		{"owner revokes", http.MethodDelete, roomPath + "/invites/" + revoked, ownerToken, "", http.StatusOK},
+		{"revoke twice", http.MethodDelete, roomPath + "/invites/" + revoked, ownerToken, "", http.StatusNotFound},
+		{"revoked invite", http.MethodPost, accept(revoked), daveToken, "", http.StatusGone},
+	}
+	for _, step := range steps {
+		resp := do(step.method, step.path, step.token, step.body)
+		if resp.Code != step.want {
+			t.Fatalf("%s: expected %d, got %d: %s", step.name, step.want, resp.Code, resp.Body.String())
+		}
+	}
+
+	// Only the unused, unrevoked invite is still listed
+	resp = do(http.MethodGet, roomPath+"/invites", ownerToken, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to list invites: %d %s", resp.Code, resp.Body.String())
+	}
+	var invites []InviteResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &invites); err != nil {
+		t.Fatalf("failed to decode invites: %v", err)
+	}
+	if len(invites) != 1 || invites[0].Code != banned || invites[0].Uses != 0 {
+		t.Fatalf("expected only the ban-test invite, got %+v", invites)
+	}
+}
+
+// failingMembersStore fails AddMember while fail is set.
+type failingMembersStore struct {
+	store.Store
+	fail bool
+}
+
+func (s *failingMembersStore) AddMember(ctx context.Context, userID, roomID int64) error {
+	if s.fail {
+		return fmt.Errorf("database is locked")
+	}
+	return s.Store.AddMember(ctx, userID, roomID)
+}
+
+func TestInviteUseReturnedOnFailedAccept(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+	failing := &failingMembersStore{Store: testStore}
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(nil, authService, failing, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// Users 1..3: owner, bob, carol
+	tokens := make([]string, 0, 3)
+	for _, name := range []string{"owner", "bob", "carol"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken, carolToken := tokens[0], tokens[1], tokens[2]
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+	resp := do(http.MethodPost, "/api/rooms", ownerToken, `{"name":"staff","type":"private"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("failed to create room: %d %s", resp.Code, resp.Body.String())
+	}
+	var room RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &room); err != nil {
+		t.Fatalf("failed to decode room: %v", err)
+	}
+	resp = do(http.MethodPost, fmt.Sprintf("/api/rooms/%d/invites", room.ID), ownerToken, `{"max_uses":1}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("failed to create invite: %d %s", resp.Code, resp.Body.String())
+	}
+	var invite InviteResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &invite); err != nil {
+		t.Fatalf("failed to decode invite: %v", err)
+	}
+	accept := "/api/invites/" + invite.Code + "/accept"
+
+	// The failed accept gives its use back, so the single-use invite still works
+	failing.fail = true
+	if resp := do(http.MethodPost, accept, bobToken, ""); resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the failed accept to return 500, got %d: %s", resp.Code, resp.Body.String())
+	}
+	failing.fail = false
+	if resp := do(http.MethodPost, accept, bobToken, ""); resp.Code != http.StatusOK {
+		t.Fatalf("expected the invite to survive a failed accept, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, accept, carolToken, ""); resp.Code != http.StatusGone {
+		t.Fatalf("expected the invite to be used up, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestGroupRooms(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(nil, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	// Users 1..5: owner, bob, carol, dave, erin
+	tokens := make([]string, 0, 5)
+	for _, name := range []string{"owner", "bob", "carol", "dave", "erin"} {
+		token, err := registerToken(context.Background(), authService, name, "password123")
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken, daveToken, erinToken := tokens[0], tokens[1], tokens[3], tokens[4]
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		return resp
+	}
+	createGroup := func(token, body string) RoomResponse {
+		t.Helper()
+		resp := do(http.MethodPost, "/api/rooms/group", token, body)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("failed to create group %s: %d %s", body, resp.Code, resp.Body.String())
+		}
+		var room RoomResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &room); err != nil {
+			t.Fatalf("failed to decode room: %v", err)
+		}
+		return room
+	}
+
+	group := createGroup(ownerToken, `{"user_ids":[2,3]}`)
+	if group.Type != "group" || group.OwnerID != nil || group.CreatedBy == nil || *group.CreatedBy != 1 || group.DisplayName != "bob, carol" {
+		t.Fatalf("unexpected group %+v", group)
+	}
+	if again := createGroup(bobToken, `{"user_ids":[3,1,3]}`); again.ID != group.ID || again.DisplayName != "carol, owner" {
+		t.Fatalf("expected the same group named for bob, got %+v", again)
+	}
+
+	// ListRooms names the group after the other participants
+	resp := do(http.MethodGet, "/api/rooms", bobToken, "")
+	var rooms []RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &rooms); err != nil {
+		t.Fatalf("failed to decode rooms: %v", err)
+	}
+	found := false
+	for _, room := range rooms {
+		if room.ID == group.ID {
+			found = room.DisplayName == "carol, owner"
+		}
+	}
+	if !found {
+		t.Fatalf("expected group named \"carol, owner\" in %+v", rooms)
+	}
+
+	groupPath := fmt.Sprintf("/api/rooms/%d", group.ID)
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"too few participants", http.MethodPost, "/api/rooms/group", ownerToken, `{"user_ids":[2,1]}`, http.StatusBadRequest},
+		{"unknown participant", http.MethodPost, "/api/rooms/group", ownerToken, `{"user_ids":[2,99]}`, http.StatusNotFound},
+		{"outsider cannot read", http.MethodGet, groupPath + "/messages", daveToken, "", http.StatusForbidden},
+		{"outsider cannot add", http.MethodPost, groupPath + "/members", erinToken, `{"user_id":5}`, http.StatusForbidden},
+		{"participant adds dave", http.MethodPost, groupPath + "/members", bobToken, `{"user_id":4}`, http.StatusOK},
+		{"dave can read", http.MethodGet, groupPath + "/messages", daveToken, "", http.StatusOK},
+		{"groups have no invite links", http.MethodPost, groupPath + "/invites", bobToken, "", http.StatusForbidden},
+		{"outsider cannot convert", http.MethodPost, groupPath + "/convert", erinToken, `{"name":"crew"}`, http.StatusForbidden},
+		{"participant cannot convert", http.MethodPost, groupPath + "/convert", bobToken, `{"name":"crew"}`, http.StatusForbidden},
+		{"name must be free", http.MethodPost, groupPath + "/convert", ownerToken, `{"name":"general"}`, http.StatusConflict},
+	}
+	for _, step := range steps {
+		resp := do(step.method, step.path, step.token, step.body)
+		if resp.Code != step.want {
+			t.Fatalf("%s: expected %d, got %d: %s", step.name, step.want, resp.Code, resp.Body.String())
+		}
+	}
+
+	// The grown group now answers for the new participant set, and the old set gets a fresh group
+	if grown := createGroup(daveToken, `{"user_ids":[1,2,3]}`); grown.ID != group.ID {
+		t.Fatalf("expected the grown group %d, got %d", group.ID, grown.ID)
+	}
+	if fresh := createGroup(ownerToken, `{"user_ids":[2,3]}`); fresh.ID == group.ID {
+		t.Fatal("expected a new group for the original participants")
+	}
+
+	// Converting makes the creator owner of a private room with the same members
+	resp = do(http.MethodPost, groupPath+"/convert", ownerToken, `{"name":"crew"}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to convert: %d %s", resp.Code, resp.Body.String())
+	}
+	var converted RoomResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &converted); err != nil {
+		t.Fatalf("failed to decode room: %v", err)
+	}
+	if converted.Type != "private" || converted.Name != "crew" || converted.OwnerID == nil || *converted.OwnerID != 1 {
+		t.Fatalf("unexpected converted room %+v", converted)
+	}
+	if resp := do(http.MethodGet, groupPath+"/messages", daveToken, ""); resp.Code != http.StatusOK {
+		t.Fatalf("expected dave to stay a member, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, groupPath+"/invites", bobToken, ""); resp.Code != http.StatusForbidden {
+		t.Fatalf("expected bob to stay an ordinary member, got %d", resp.Code)
+	}
+	if resp := do(http.MethodPost, groupPath+"/invites", ownerToken, ""); resp.Code != http.StatusCreated {
+		t.Fatalf("expected the new owner to create invites, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := do(http.MethodPost, groupPath+"/convert", ownerToken, `{"name":"crew2"}`); resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected converting twice to fail with 400, got %d", resp.Code)
+	}
+}
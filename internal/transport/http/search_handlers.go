@@ -0,0 +1,177 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vovakirdan/wirechat-server/internal/service/rooms"
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+// SearchHandlers provides HTTP handlers for message search.
+type SearchHandlers struct {
+	store store.Store
+	rooms *rooms.Service
+	log   *zerolog.Logger
+}
+
+// NewSearchHandlers creates a new search handlers instance.
+func NewSearchHandlers(st store.Store, roomsSvc *rooms.Service, logger *zerolog.Logger) *SearchHandlers {
+	return &SearchHandlers{
+		store: st,
+		rooms: roomsSvc,
+		log:   logger,
+	}
+}
+
+// MaxSearchQueryLength caps the length of a message search query.
+const MaxSearchQueryLength = 200
+
+// SearchHitResponse is a message matching a search. Snippet is an HTML-escaped
+// excerpt of the body with matched terms wrapped in <mark> tags.
+type SearchHitResponse struct {
+	Message MessageResponse `json:"message"`
+	Snippet string          `json:"snippet"`
+}
+
+// SearchResponse represents the response for the message search endpoint.
+type SearchResponse struct {
+	Results []SearchHitResponse `json:"results"`
+	HasMore bool                `json:"has_more"`
+}
+
+// snippetHTML escapes a store snippet and turns its match markers into <mark> tags.
+func snippetHTML(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, store.SnippetMatchStart, "<mark>")
+	return strings.ReplaceAll(escaped, store.SnippetMatchEnd, "</mark>")
+}
+
+// SearchMessages handles GET /api/search/messages.
+// Query parameters: q (required), room_id, from (username), before (message ID) and limit.
+// Only messages from rooms the caller can read are returned, newest first.
+func (h *SearchHandlers) SearchMessages(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query is required"})
+		return
+	}
+	if len(query) > MaxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("query must be at most %d characters", MaxSearchQueryLength)})
+		return
+	}
+
+	var rid int64
+	if roomStr := c.Query("room_id"); roomStr != "" {
+		if _, err := fmt.Sscanf(roomStr, "%d", &rid); err != nil || rid <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid room id"})
+			return
+		}
+	}
+
+	// Parse query parameters (same rules as message history)
+	limit := 20 // default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var parsedLimit int
+		if _, err := fmt.Sscanf(limitStr, "%d", &parsedLimit); err == nil {
+			if parsedLimit > 0 && parsedLimit <= 100 {
+				limit = parsedLimit
+			} else if parsedLimit > 100 {
+				limit = 100 // cap at 100
+			}
+		}
+	}
+
+	search := store.MessageSearch{Query: query, Limit: limit + 1}
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		var parsedBefore int64
+		if _, err := fmt.Sscanf(beforeStr, "%d", &parsedBefore); err == nil {
+			search.BeforeID = &parsedBefore
+		}
+	}
+
+	response := SearchResponse{Results: []SearchHitResponse{}}
+
+	if from := c.Query("from"); from != "" {
+		sender, err := h.store.GetUserByUsername(c.Request.Context(), from)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Nobody by that name, so nothing they could have written
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		if err != nil {
+			h.log.Error().Err(err).Str("username", from).Msg("failed to get user")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		search.UserID = &sender.ID
+	}
+
+	hits, err := h.rooms.SearchMessages(c.Request.Context(), uid, rid, search)
+	if err != nil {
+		if errors.Is(err, store.ErrSearchUnavailable) {
+			c.JSON(http.StatusNotImplemented, ErrorResponse{Error: "message search is not available"})
+			return
+		}
+		switch {
+		case errors.Is(err, rooms.ErrRoomNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "room not found"})
+		case errors.Is(err, rooms.ErrAccessDenied):
+			h.log.Warn().Int64("room_id", rid).Int64("user_id", uid).Msg("room access denied")
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "access denied"})
+		case errors.Is(err, rooms.ErrBanned):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "user is banned from this room"})
+		default:
+			h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to search messages")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		}
+		return
+	}
+
+	response.HasMore = len(hits) > limit
+	if response.HasMore {
+		hits = hits[:limit]
+	}
+
+	messages := make([]MessageResponse, 0, len(hits))
+	for _, hit := range hits {
+		messages = append(messages, messageResponseFromStore(hit.Message))
+	}
+	attachReactions(c.Request.Context(), h.store, h.log, messages)
+	attachFiles(c.Request.Context(), h.store, h.log, messages)
+	for i, hit := range hits {
+		response.Results = append(response.Results, SearchHitResponse{
+			Message: messages[i],
+			Snippet: snippetHTML(hit.Snippet),
+		})
+	}
+
+	h.log.Debug().
+		Int64("user_id", uid).
+		Int("result_count", len(response.Results)).
+		Bool("has_more", response.HasMore).
+		Msg("messages searched")
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/store"
+)
+
+func TestSearchMessages(t *testing.T) {
+	// Create test store with schema and search index
+	testStore := createSearchTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	disabledLogger := zerolog.New(nil)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(nil, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ctx := context.Background()
+
+	// Users 1..2: alice, bob
+	aliceToken, err := registerToken(ctx, authService, "alice", "password123")
+	if err != nil {
+		t.Fatalf("failed to register alice: %v", err)
+	}
+	bobToken, err := registerToken(ctx, authService, "bob", "password123")
+	if err != nil {
+		t.Fatalf("failed to register bob: %v", err)
+	}
+
+	aliceID := int64(1)
+	secret, err := testStore.CreateRoom(ctx, "secret", store.RoomTypePrivate, &aliceID)
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+	if err := testStore.AddMember(ctx, 1, secret.ID); err != nil {
+		t.Fatalf("failed to add member: %v", err)
+	}
+
+	save := func(roomID, userID int64, body string) int64 {
+		t.Helper()
+		msg := &store.Message{RoomID: roomID, UserID: userID, Body: body, CreatedAt: time.Now()}
+		if err := testStore.SaveMessage(ctx, msg); err != nil {
+			t.Fatalf("failed to save message: %v", err)
+		}
+		return msg.ID
+	}
+	deploy := save(1, 1, "Deploying the new release tonight")
+	notes := save(1, 2, "Release notes are in <b>draft</b>")
+	plan := save(secret.ID, 1, "secret release plan")
+
+	search := func(token, query string) SearchResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search/messages?"+query, http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("search %q: expected 200, got %d %s", query, resp.Code, resp.Body.String())
+		}
+		var result SearchResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode search response: %v", err)
+		}
+		return result
+	}
+	ids := func(result SearchResponse) []int64 {
+		out := make([]int64, 0, len(result.Results))
+		for _, hit := range result.Results {
+			out = append(out, hit.Message.ID)
+		}
+		return out
+	}
+	expectIDs := func(name string, result SearchResponse, want ...int64) {
+		t.Helper()
+		if got := ids(result); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected messages %v, got %v", name, want, got)
+		}
+	}
+
+	expectIDs("alice sees every room", search(aliceToken, "q=release"), plan, notes, deploy)
+	expectIDs("bob skips private rooms", search(bobToken, "q=release"), notes, deploy)
+	expectIDs("prefix match", search(bobToken, "q=relea"), notes, deploy)
+	expectIDs("all terms must match", search(bobToken, "q=release+tonight"), deploy)
+	expectIDs("query syntax is escaped", search(bobToken, "q=%22release+OR+NEAR("))
+	expectIDs("room filter", search(aliceToken, fmt.Sprintf("q=release&room_id=%d", secret.ID)), plan)
+	expectIDs("sender filter", search(aliceToken, "q=release&from=bob"), notes)
+	expectIDs("unknown sender", search(aliceToken, "q=release&from=nobody"))
+
+	result := search(aliceToken, "q=release&from=bob")
+	if snippet := result.Results[0].Snippet; snippet != "<mark>Release</mark> notes are in &lt;b&gt;draft&lt;/b&gt;" {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+
+	page := search(aliceToken, "q=release&limit=2")
+	expectIDs("first page", page, plan, notes)
+	if !page.HasMore {
+		t.Error("expected has_more on first page")
+	}
+	page = search(aliceToken, fmt.Sprintf("q=release&limit=2&before=%d", notes))
+	expectIDs("second page", page, deploy)
+	if page.HasMore {
+		t.Error("expected no more results after second page")
+	}
+
+	// The index follows edits and deletes
+	if err := testStore.EditMessage(ctx, deploy, "Deploying tomorrow instead", time.Now()); err != nil {
+		t.Fatalf("failed to edit message: %v", err)
+	}
+	if err := testStore.DeleteMessage(ctx, notes, time.Now()); err != nil {
+		t.Fatalf("failed to delete message: %v", err)
+	}
+	expectIDs("after edit and delete", search(aliceToken, "q=release"), plan)
+	expectIDs("edited body is indexed", search(aliceToken, "q=tomorrow"), deploy)
+
+	// Banned users lose search access to the room
+	if err := testStore.BanUser(ctx, &store.RoomBan{RoomID: 1, UserID: 2, BannedBy: 1, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to ban bob: %v", err)
+	}
+	expectIDs("banned room is skipped", search(bobToken, "q=tomorrow"))
+
+	// An owner who left a private room cannot search it any more
+	if err := testStore.RemoveMember(ctx, 1, secret.ID); err != nil {
+		t.Fatalf("failed to remove alice: %v", err)
+	}
+	expectIDs("owner who left", search(aliceToken, "q=release"))
+
+	errorCases := []struct {
+		name  string
+		token string
+		query string
+		want  int
+	}{
+		{"missing query", aliceToken, "q=+", http.StatusBadRequest},
+		{"too long", aliceToken, "q=" + strings.Repeat("a", MaxSearchQueryLength+1), http.StatusBadRequest},
+		{"invalid room", aliceToken, "q=release&room_id=abc", http.StatusBadRequest},
+		{"private room", bobToken, fmt.Sprintf("q=release&room_id=%d", secret.ID), http.StatusForbidden},
+		{"banned room", bobToken, "q=release&room_id=1", http.StatusForbidden},
+		{"missing room", aliceToken, "q=release&room_id=999", http.StatusNotFound},
+	}
+	for _, tc := range errorCases {
+		req := httptest.NewRequest(http.MethodGet, "/api/search/messages?"+tc.query, http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		resp := httptest.NewRecorder()
+		server.Handler.ServeHTTP(resp, req)
+		if resp.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.want, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+// noSearchStore is a store whose driver was built without FTS5.
+type noSearchStore struct {
+	store.Store
+}
+
+func (noSearchStore) SearchMessages(context.Context, store.MessageSearch) ([]*store.MessageSearchHit, error) {
+	return nil, store.ErrSearchUnavailable
+}
+
+func TestSearchUnavailable(t *testing.T) {
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	authService := createTestAuthService(t, testStore, "test-secret")
+	disabledLogger := zerolog.New(nil)
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+	server := NewServer(nil, authService, noSearchStore{testStore}, nil, nil, nil, nil, &cfg, &disabledLogger)
+
+	token, err := registerToken(context.Background(), authService, "alice", "password123")
+	if err != nil {
+		t.Fatalf("failed to register alice: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/search/messages?q=release", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp := httptest.NewRecorder()
+	server.Handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d %s", resp.Code, resp.Body.String())
+	}
+}
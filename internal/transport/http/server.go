@@ -1,17 +1,22 @@
 package http
 
 import (
+	"expvar"
 	stdhttp "net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 
 	"github.com/vovakirdan/wirechat-server/internal/auth"
+	"github.com/vovakirdan/wirechat-server/internal/auth/oidc"
 	"github.com/vovakirdan/wirechat-server/internal/config"
 	"github.com/vovakirdan/wirechat-server/internal/core"
 	"github.com/vovakirdan/wirechat-server/internal/service/calls"
 	"github.com/vovakirdan/wirechat-server/internal/service/friends"
+	"github.com/vovakirdan/wirechat-server/internal/service/presence"
+	"github.com/vovakirdan/wirechat-server/internal/service/rooms"
 	"github.com/vovakirdan/wirechat-server/internal/store"
+	"github.com/vovakirdan/wirechat-server/internal/uploads"
 )
 
 // NewServer builds an HTTP server with REST API and WebSocket routes.
@@ -21,6 +26,8 @@ func NewServer(
 	st store.Store,
 	friendsSvc *friends.Service,
 	callsSvc *calls.Service,
+	presenceSvc *presence.Service,
+	uploadStorage uploads.Storage,
 	cfg *config.Config,
 	logger *zerolog.Logger,
 ) *stdhttp.Server {
@@ -29,13 +36,18 @@ func NewServer(
 
 	// Gin router for REST API
 	ginRouter := gin.New()
+	// Client IPs feed login protection, so X-Forwarded-For is only believed from known proxies
+	if err := ginRouter.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Error().Err(err).Msg("invalid trusted_proxies, trusting none")
+		_ = ginRouter.SetTrustedProxies(nil) //nolint:errcheck // nil cannot fail
+	}
 	ginRouter.Use(gin.Recovery())
 	ginRouter.Use(LoggerMiddleware(logger))
 
 	// CORS middleware for web clients
 	ginRouter.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Client-Type")
 
 		if c.Request.Method == "OPTIONS" {
@@ -48,6 +60,8 @@ func NewServer(
 
 	// API endpoints
 	apiHandlers := NewAPIHandlers(authService, logger)
+	ginRouter.GET("/.well-known/jwks.json", apiHandlers.JWKS)
+
 	api := ginRouter.Group("/api")
 	api.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "pong"})
@@ -55,21 +69,90 @@ func NewServer(
 	api.POST("/register", apiHandlers.Register)
 	api.POST("/login", apiHandlers.Login)
 	api.POST("/guest", apiHandlers.GuestLogin)
+	api.POST("/token/refresh", apiHandlers.Refresh)
+	api.POST("/password/forgot", apiHandlers.ForgotPassword)
+	api.POST("/password/reset", apiHandlers.ResetPassword)
+
+	// Single sign-on (only when configured)
+	if cfg.OIDC.Enabled {
+		provider := oidc.New(oidc.Config{
+			Issuer:        cfg.OIDC.Issuer,
+			ClientID:      cfg.OIDC.ClientID,
+			ClientSecret:  cfg.OIDC.ClientSecret,
+			RedirectURL:   cfg.OIDC.RedirectURL,
+			Scopes:        cfg.OIDC.Scopes,
+			UsernameClaim: cfg.OIDC.UsernameClaim,
+		}, nil)
+		stateSecret := cfg.OIDC.StateKey
+		if stateSecret == "" {
+			stateSecret = cfg.JWTSecret
+		}
+		oidcHandlers := NewOIDCHandlers(authService, provider, cfg.OIDC, stateSecret, logger)
+		api.GET("/oidc/login", oidcHandlers.Login)
+		api.GET("/oidc/callback", oidcHandlers.Callback)
+	}
 
-	// Room endpoints (require authentication)
-	roomHandlers := NewRoomHandlers(st, logger)
+	// Session and account endpoints (require authentication)
 	authMiddleware := AuthMiddleware(authService, logger)
+	api.POST("/logout", authMiddleware, apiHandlers.Logout)
+	api.GET("/sessions", authMiddleware, apiHandlers.ListSessions)
+	api.DELETE("/sessions", authMiddleware, apiHandlers.RevokeOtherSessions)
+	api.DELETE("/sessions/:id", authMiddleware, apiHandlers.RevokeSession)
+	api.POST("/me/password", authMiddleware, apiHandlers.ChangePassword)
+	api.PUT("/me/email", authMiddleware, apiHandlers.SetEmail)
+	api.GET("/me/login-failures", authMiddleware, apiHandlers.ListLoginFailures)
+
+	// Room endpoints (require authentication)
+	// Room access rules shared by REST handlers and WebSocket joins
+	roomsSvc := rooms.New(st)
+
+	roomHandlers := NewRoomHandlers(st, roomsSvc, hub, logger)
 	api.POST("/rooms", authMiddleware, roomHandlers.CreateRoom)
 	api.GET("/rooms", authMiddleware, roomHandlers.ListRooms)
 	api.POST("/rooms/direct", authMiddleware, roomHandlers.CreateDirectRoom)
+	api.POST("/rooms/group", authMiddleware, roomHandlers.CreateGroupRoom)
+	api.POST("/rooms/:id/convert", authMiddleware, roomHandlers.ConvertRoom)
+	api.PATCH("/rooms/:id", authMiddleware, roomHandlers.UpdateRoom)
 	api.POST("/rooms/:id/join", authMiddleware, roomHandlers.JoinRoom)
 	api.DELETE("/rooms/:id/leave", authMiddleware, roomHandlers.LeaveRoom)
+	api.GET("/rooms/:id/members", authMiddleware, roomHandlers.ListMembers)
 	api.POST("/rooms/:id/members", authMiddleware, roomHandlers.AddMember)
 	api.DELETE("/rooms/:id/members/:userId", authMiddleware, roomHandlers.RemoveMember)
+	api.PUT("/rooms/:id/members/:userId/role", authMiddleware, roomHandlers.UpdateMemberRole)
+	api.GET("/rooms/:id/bans", authMiddleware, roomHandlers.ListBans)
+	api.POST("/rooms/:id/bans", authMiddleware, roomHandlers.BanUser)
+	api.DELETE("/rooms/:id/bans/:userId", authMiddleware, roomHandlers.UnbanUser)
+	api.POST("/rooms/:id/mutes", authMiddleware, roomHandlers.MuteUser)
+	api.DELETE("/rooms/:id/mutes/:userId", authMiddleware, roomHandlers.UnmuteUser)
+	api.GET("/rooms/:id/audit", authMiddleware, roomHandlers.GetAuditLog)
+	api.GET("/rooms/:id/pins", authMiddleware, roomHandlers.ListPins)
+	api.POST("/rooms/:id/pins", authMiddleware, roomHandlers.PinMessage)
+	api.DELETE("/rooms/:id/pins/:msgId", authMiddleware, roomHandlers.UnpinMessage)
+	api.GET("/rooms/:id/invites", authMiddleware, roomHandlers.ListInvites)
+	api.POST("/rooms/:id/invites", authMiddleware, roomHandlers.CreateInvite)
+	api.DELETE("/rooms/:id/invites/:code", authMiddleware, roomHandlers.RevokeInvite)
+	api.POST("/invites/:code/accept", authMiddleware, roomHandlers.AcceptInvite)
 	api.GET("/rooms/:id/messages", authMiddleware, roomHandlers.GetMessages)
+	api.GET("/rooms/:id/messages/:msgId/thread", authMiddleware, roomHandlers.GetThread)
+	api.PATCH("/rooms/:id/messages/:msgId", authMiddleware, roomHandlers.EditMessage)
+	api.DELETE("/rooms/:id/messages/:msgId", authMiddleware, roomHandlers.DeleteMessage)
+
+	// Search endpoints (require authentication)
+	searchHandlers := NewSearchHandlers(st, roomsSvc, logger)
+	api.GET("/search/messages", authMiddleware, searchHandlers.SearchMessages)
+
+	// Notification endpoints (require authentication)
+	notificationHandlers := NewNotificationHandlers(st, logger)
+	api.GET("/notifications", authMiddleware, notificationHandlers.ListNotifications)
+	api.POST("/notifications/read", authMiddleware, notificationHandlers.MarkNotificationsRead)
+
+	// Upload endpoints (require authentication)
+	uploadHandlers := NewUploadHandlers(st, roomsSvc, uploadStorage, cfg.Uploads, logger)
+	api.POST("/uploads", authMiddleware, uploadHandlers.Upload)
+	api.GET("/attachments/:id", authMiddleware, uploadHandlers.Download)
 
 	// Friends endpoints (require authentication)
-	friendsHandlers := NewFriendsHandlers(friendsSvc, st, logger)
+	friendsHandlers := NewFriendsHandlers(friendsSvc, presenceSvc, st, logger)
 	friendsGroup := api.Group("/friends")
 	friendsGroup.Use(authMiddleware)
 	friendsGroup.POST("/requests", friendsHandlers.SendRequest)
@@ -81,10 +164,11 @@ func NewServer(
 	friendsGroup.DELETE("/:userId/unblock", friendsHandlers.UnblockUser)
 
 	// User endpoints (require authentication)
-	userHandlers := NewUserHandlers(st, logger)
+	userHandlers := NewUserHandlers(st, presenceSvc, logger)
 	userGroup := api.Group("/users")
 	userGroup.Use(authMiddleware)
 	userGroup.GET("/search", userHandlers.SearchUsers)
+	userGroup.GET("/:id/presence", userHandlers.GetPresence)
 
 	// Calls endpoints (require authentication)
 	callsHandlers := NewCallsHandlers(callsSvc, logger)
@@ -109,12 +193,16 @@ func NewServer(
 		}
 	})
 
+	// Runtime metrics (expvar), including slow-consumer drop counters
+	mux.Handle("/debug/vars", expvar.Handler())
+
 	// WebSocket endpoint - direct handler, no Gin wrapper
-	wsHandler := NewWSHandler(hub, authService, st, cfg, logger)
+	wsHandler := NewWSHandler(hub, authService, st, roomsSvc, cfg, logger)
 	mux.Handle("/ws", wsHandler)
 
 	// API endpoints - handled by Gin
 	mux.Handle("/api/", ginRouter)
+	mux.Handle("/.well-known/jwks.json", ginRouter)
 
 	return &stdhttp.Server{
 		Addr:              cfg.Addr,
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"context"
 	"database/sql"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,19 +12,17 @@ import (
 	"github.com/vovakirdan/wirechat-server/internal/store/sqlite"
 )
 
-// createTestStore creates an in-memory SQLite store with schema applied.
-func createTestStore(t *testing.T) store.Store {
-	t.Helper()
-
-	// Apply schema manually (instead of using goose migrations in tests)
-	schema := `
+// testSchema is applied manually instead of running goose migrations in tests.
+const testSchema = `
 	CREATE TABLE users (
 		id            INTEGER PRIMARY KEY AUTOINCREMENT,
 		username      TEXT NOT NULL UNIQUE,
 		password_hash TEXT NOT NULL,
 		is_guest      BOOLEAN NOT NULL DEFAULT 0,
 		session_id    TEXT,
-		created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		email         TEXT,
+		created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at  DATETIME
 	);
 
 	CREATE TABLE rooms (
@@ -31,6 +31,10 @@ func createTestStore(t *testing.T) store.Store {
 		type       TEXT NOT NULL DEFAULT 'public',
 		owner_id   INTEGER,
 		direct_key TEXT,
+		created_by INTEGER,
+		topic       TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		avatar_url  TEXT NOT NULL DEFAULT '',
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (owner_id) REFERENCES users(id)
 	);
@@ -40,6 +44,7 @@ func createTestStore(t *testing.T) store.Store {
 	CREATE TABLE room_members (
 		room_id    INTEGER NOT NULL,
 		user_id    INTEGER NOT NULL,
+		role       TEXT NOT NULL DEFAULT 'member',
 		joined_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY (room_id, user_id),
 		FOREIGN KEY (room_id) REFERENCES rooms(id),
@@ -52,18 +57,159 @@ func createTestStore(t *testing.T) store.Store {
 		user_id    INTEGER NOT NULL,
 		body       TEXT NOT NULL,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		edited_at  DATETIME,
+		deleted_at DATETIME,
+		reply_to   INTEGER REFERENCES messages(id),
+		client_msg_id TEXT,
 		FOREIGN KEY (room_id) REFERENCES rooms(id),
 		FOREIGN KEY (user_id) REFERENCES users(id)
 	);
 
+	CREATE TABLE message_reactions (
+		message_id INTEGER NOT NULL,
+		user_id    INTEGER NOT NULL,
+		emoji      TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id, emoji)
+	);
+
+	CREATE TABLE room_read_state (
+		user_id      INTEGER NOT NULL,
+		room_id      INTEGER NOT NULL,
+		last_read_id INTEGER NOT NULL DEFAULT 0,
+		updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, room_id)
+	);
+
+	CREATE TABLE room_bans (
+		room_id    INTEGER NOT NULL,
+		user_id    INTEGER NOT NULL,
+		banned_by  INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (room_id, user_id)
+	);
+
+	CREATE TABLE room_mutes (
+		room_id    INTEGER NOT NULL,
+		user_id    INTEGER NOT NULL,
+		muted_by   INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (room_id, user_id)
+	);
+
+	CREATE TABLE room_audit_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id    INTEGER NOT NULL,
+		actor_id   INTEGER NOT NULL,
+		action     TEXT NOT NULL,
+		target_id  INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		details    TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE room_pins (
+		room_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		pinned_by  INTEGER NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (room_id, message_id)
+	);
+
+	CREATE TABLE room_invites (
+		code       TEXT PRIMARY KEY,
+		room_id    INTEGER NOT NULL,
+		created_by INTEGER NOT NULL,
+		max_uses   INTEGER NOT NULL DEFAULT 0,
+		uses       INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE attachments (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL,
+		message_id   INTEGER,
+		position     INTEGER NOT NULL DEFAULT 0,
+		storage_key  TEXT NOT NULL UNIQUE,
+		filename     TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE mentions (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		room_id    INTEGER NOT NULL,
+		author_id  INTEGER NOT NULL,
+		kind       TEXT NOT NULL,
+		read_at    DATETIME,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (message_id, user_id)
+	);
+
+	CREATE TABLE sessions (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id           INTEGER NOT NULL,
+		refresh_hash      TEXT NOT NULL UNIQUE,
+		prev_refresh_hash TEXT,
+		user_agent        TEXT NOT NULL DEFAULT '',
+		ip                TEXT NOT NULL DEFAULT '',
+		created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at        DATETIME NOT NULL,
+		revoked_at        DATETIME
+	);
+
+	CREATE TABLE password_resets (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at    DATETIME
+	);
+
+	CREATE TABLE login_failures (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		username   TEXT NOT NULL,
+		user_id    INTEGER,
+		ip         TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		reason     TEXT NOT NULL,
+		locked     BOOLEAN NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE user_identities (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL,
+		issuer     TEXT NOT NULL,
+		subject    TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (issuer, subject),
+		UNIQUE (user_id, issuer)
+	);
+
 	CREATE INDEX idx_messages_room ON messages(room_id, created_at DESC);
+	CREATE UNIQUE INDEX idx_messages_user_client_msg_id ON messages(user_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
 	CREATE INDEX idx_room_members_user ON room_members(user_id);
 
 	INSERT INTO rooms (name, type, owner_id) VALUES ('general', 'public', NULL);
-	`
+`
+
+// createTestStore creates an in-memory SQLite store with schema applied.
+func createTestStore(t *testing.T) store.Store {
+	t.Helper()
 
 	st, err := sqlite.NewWithSetup(":memory:", func(db *sql.DB) error {
-		_, err := db.Exec(schema)
+		_, err := db.Exec(testSchema)
 		return err
 	})
 	if err != nil {
@@ -73,6 +219,48 @@ func createTestStore(t *testing.T) store.Store {
 	return st
 }
 
+// searchSchema mirrors migrations/016_add_message_search.sql.
+const searchSchema = `
+	CREATE VIRTUAL TABLE messages_fts USING fts5(
+		body,
+		content = 'messages',
+		content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+
+	CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+	END;
+
+	CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+	END;
+
+	CREATE TRIGGER messages_fts_update AFTER UPDATE OF body ON messages BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+		INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+	END;
+`
+
+// createSearchTestStore creates a test store with the message search index.
+// Skips the test when the sqlite driver was built without FTS5 (-tags sqlite_fts5).
+func createSearchTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	st, err := sqlite.NewWithSetup(":memory:", func(db *sql.DB) error {
+		_, err := db.Exec(testSchema + searchSchema)
+		return err
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			t.Skip("sqlite built without FTS5; run with -tags sqlite_fts5")
+		}
+		t.Fatalf("failed to create test store: %v", err)
+	}
+
+	return st
+}
+
 // createTestAuthService creates an auth service for testing.
 func createTestAuthService(t *testing.T, st store.Store, jwtSecret string) *auth.Service {
 	t.Helper()
@@ -86,3 +274,12 @@ func createTestAuthService(t *testing.T, st store.Store, jwtSecret string) *auth
 
 	return auth.NewService(st, jwtConfig)
 }
+
+// registerToken registers a user and returns their access token.
+func registerToken(ctx context.Context, authService *auth.Service, username, password string) (string, error) {
+	tokens, err := authService.Register(ctx, username, password, auth.Device{})
+	if err != nil {
+		return "", err
+	}
+	return tokens.AccessToken, nil
+}
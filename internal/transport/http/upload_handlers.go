@@ -0,0 +1,320 @@
+package http
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/service/rooms"
+	"github.com/vovakirdan/wirechat-server/internal/store"
+	"github.com/vovakirdan/wirechat-server/internal/uploads"
+)
+
+// maxFilenameBytes bounds the stored name of an uploaded file.
+const maxFilenameBytes = 255
+
+// multipartOverhead is allowed on top of the file size for multipart headers and boundaries.
+const multipartOverhead = 64 << 10
+
+// UploadHandlers provides HTTP handlers for file uploads and attachment downloads.
+type UploadHandlers struct {
+	store   store.Store
+	rooms   *rooms.Service
+	storage uploads.Storage // nil if uploads are disabled
+	cfg     config.UploadsConfig
+	log     *zerolog.Logger
+}
+
+// NewUploadHandlers creates a new upload handlers instance.
+func NewUploadHandlers(st store.Store, roomsSvc *rooms.Service, storage uploads.Storage, cfg config.UploadsConfig, logger *zerolog.Logger) *UploadHandlers {
+	return &UploadHandlers{
+		store:   st,
+		rooms:   roomsSvc,
+		storage: storage,
+		cfg:     cfg,
+		log:     logger,
+	}
+}
+
+// AttachmentResponse represents an uploaded file in API responses.
+type AttachmentResponse struct {
+	ID          int64  `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// attachmentURL is the download path of an attachment.
+func attachmentURL(id int64) string {
+	return fmt.Sprintf("/api/attachments/%d", id)
+}
+
+func attachmentResponseFromStore(a *store.Attachment) AttachmentResponse {
+	return AttachmentResponse{
+		ID:          a.ID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		URL:         attachmentURL(a.ID),
+	}
+}
+
+// cleanFilename reduces a client-supplied file name to a safe display name.
+func cleanFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimSpace(filepath.Base("/" + name))
+	if name == "/" || name == "." {
+		return "file"
+	}
+	for len(name) > maxFilenameBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Upload handles POST /api/uploads.
+// Expects a multipart form with a single "file" part. The content type is
+// detected from the file contents and must be allowed by the uploads config.
+// The upload stays private to the uploader until it is shared in a message.
+func (h *UploadHandlers) Upload(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "uploads are disabled"})
+		return
+	}
+
+	tooLarge := ErrorResponse{Error: fmt.Sprintf("file must be at most %d bytes", h.cfg.MaxBytes)}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.cfg.MaxBytes+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expected a multipart/form-data body"})
+		return
+	}
+
+	var part io.ReadCloser
+	var filename string
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "missing file part"})
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename = p, cleanFilename(p.FileName())
+			break
+		}
+		p.Close()
+	}
+	defer part.Close()
+
+	// Sniff the type from the first bytes instead of trusting the client
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "failed to read file"})
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !uploads.AllowedType(contentType, h.cfg.AllowedTypes) {
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: fmt.Sprintf("file type %s is not allowed", contentType)})
+		return
+	}
+
+	key, err := uploads.NewKey()
+	if err != nil {
+		h.log.Error().Err(err).Msg("failed to generate upload key")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	counter := &countingReader{r: io.LimitReader(buffered, h.cfg.MaxBytes+1)}
+	if err := h.storage.Put(ctx, key, counter); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to store upload")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	if counter.n > h.cfg.MaxBytes {
+		h.discard(c, key)
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+
+	attachment := &store.Attachment{
+		UserID:      uid,
+		StorageKey:  key,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        counter.n,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.store.CreateAttachment(ctx, attachment); err != nil {
+		h.discard(c, key)
+		h.log.Error().Err(err).Int64("user_id", uid).Msg("failed to save attachment")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	h.log.Info().
+		Int64("user_id", uid).
+		Int64("attachment_id", attachment.ID).
+		Str("content_type", contentType).
+		Int64("size", attachment.Size).
+		Msg("file uploaded")
+	c.JSON(http.StatusCreated, attachmentResponseFromStore(attachment))
+}
+
+// discard removes stored contents of an upload that was rejected after all.
+func (h *UploadHandlers) discard(c *gin.Context, key string) {
+	if err := h.storage.Delete(c.Request.Context(), key); err != nil {
+		h.log.Warn().Err(err).Str("key", key).Msg("failed to delete rejected upload")
+	}
+}
+
+// Download handles GET /api/attachments/:id.
+// Attachments shared in a message can be downloaded by anyone who can read its
+// room; unshared uploads only by their uploader. Attachments of deleted messages are gone.
+func (h *UploadHandlers) Download(c *gin.Context) {
+	// Get authenticated user from context
+	userID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := userID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "uploads are disabled"})
+		return
+	}
+
+	var id int64
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid attachment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	notFound := ErrorResponse{Error: "attachment not found"}
+	attachment, err := h.store.GetAttachment(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		h.log.Error().Err(err).Int64("attachment_id", id).Msg("failed to get attachment")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	if attachment.MessageID == nil {
+		if attachment.UserID != uid {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+	} else {
+		msg, err := h.store.GetMessage(ctx, *attachment.MessageID)
+		if err != nil {
+			h.log.Error().Err(err).Int64("attachment_id", id).Msg("failed to get attachment message")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+		if msg.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, notFound)
+			return
+		}
+		if _, err := h.rooms.AuthorizeRead(ctx, uid, msg.RoomID); err != nil {
+			if errors.Is(err, rooms.ErrRoomNotFound) {
+				c.JSON(http.StatusNotFound, notFound)
+				return
+			}
+			if errors.Is(err, rooms.ErrAccessDenied) || errors.Is(err, rooms.ErrBanned) {
+				h.log.Warn().Int64("attachment_id", id).Int64("user_id", uid).Msg("attachment access denied")
+				c.JSON(http.StatusForbidden, ErrorResponse{Error: "access denied"})
+				return
+			}
+			h.log.Error().Err(err).Int64("attachment_id", id).Msg("failed to check room access")
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+			return
+		}
+	}
+
+	contents, err := h.storage.Open(ctx, attachment.StorageKey)
+	if err != nil {
+		h.log.Error().Err(err).Int64("attachment_id", id).Msg("failed to open attachment")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	defer contents.Close()
+
+	// Only media is shown inline; everything else is downloaded
+	disposition := "attachment"
+	if uploads.AllowedType(attachment.ContentType, []string{"image/*", "audio/*", "video/*"}) {
+		disposition = "inline"
+	}
+	if withName := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}); withName != "" {
+		disposition = withName
+	}
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, contents, map[string]string{
+		"Content-Disposition":    disposition,
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=3600",
+	})
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/rs/zerolog"
+	"github.com/vovakirdan/wirechat-server/internal/config"
+	"github.com/vovakirdan/wirechat-server/internal/core"
+	"github.com/vovakirdan/wirechat-server/internal/proto"
+	"github.com/vovakirdan/wirechat-server/internal/uploads/local"
+)
+
+// pngHeader is enough of a PNG file for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadsAndAttachments(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	storage, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create upload storage: %v", err)
+	}
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+		Uploads: config.UploadsConfig{
+			MaxBytes:     1024,
+			AllowedTypes: []string{"image/*", "text/plain"},
+		},
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, storage, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Users 1..3: owner, bob, carol
+	tokens := make([]string, 0, 3)
+	for _, name := range []string{"owner", "bob", "carol"} {
+		token, regErr := registerToken(context.Background(), authService, name, "password123")
+		if regErr != nil {
+			t.Fatalf("failed to register %s: %v", name, regErr)
+		}
+		tokens = append(tokens, token)
+	}
+	ownerToken, bobToken, carolToken := tokens[0], tokens[1], tokens[2]
+
+	rest := func(method, path, token, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+	upload := func(token, field, filename string, contents []byte) (int, AttachmentResponse) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, formErr := form.CreateFormFile(field, filename)
+		if formErr != nil {
+			t.Fatalf("create form file: %v", formErr)
+		}
+		if _, writeErr := part.Write(contents); writeErr != nil {
+			t.Fatalf("write form file: %v", writeErr)
+		}
+		if closeErr := form.Close(); closeErr != nil {
+			t.Fatalf("close form: %v", closeErr)
+		}
+
+		req, reqErr := http.NewRequest(http.MethodPost, ts.URL+"/api/uploads", &body)
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("upload: %v", doErr)
+		}
+		defer resp.Body.Close()
+		var attachment AttachmentResponse
+		if resp.StatusCode == http.StatusCreated {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(&attachment); decodeErr != nil {
+				t.Fatalf("decode upload: %v", decodeErr)
+			}
+		}
+		return resp.StatusCode, attachment
+	}
+	download := func(token, url string) (int, []byte, http.Header) {
+		req, reqErr := http.NewRequest(http.MethodGet, ts.URL+url, http.NoBody)
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("download: %v", doErr)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, data, resp.Header
+	}
+
+	// Limits: size, sniffed type and the form field
+	if code, _ := upload(ownerToken, "file", "big.txt", bytes.Repeat([]byte("a"), 2048)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: expected 413, got %d", code)
+	}
+	if code, _ := upload(ownerToken, "file", "fake.png", []byte("%PDF-1.4 not an image")); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("disallowed type: expected 415, got %d", code)
+	}
+	if code, _ := upload(ownerToken, "other", "photo.png", pngHeader); code != http.StatusBadRequest {
+		t.Fatalf("missing file part: expected 400, got %d", code)
+	}
+
+	code, photo := upload(ownerToken, "file", "../../photo.png", pngHeader)
+	if code != http.StatusCreated {
+		t.Fatalf("upload: expected 201, got %d", code)
+	}
+	if photo.Filename != "photo.png" || photo.ContentType != "image/png" || photo.Size != int64(len(pngHeader)) {
+		t.Fatalf("unexpected attachment %+v", photo)
+	}
+
+	// Unshared uploads are private to the uploader
+	if code, _, _ := download(bobToken, photo.URL); code != http.StatusNotFound {
+		t.Fatalf("other user before sharing: expected 404, got %d", code)
+	}
+	code, data, header := download(ownerToken, photo.URL)
+	if code != http.StatusOK || !bytes.Equal(data, pngHeader) {
+		t.Fatalf("owner download: got %d %q", code, data)
+	}
+	if header.Get("Content-Type") != "image/png" || !strings.HasPrefix(header.Get("Content-Disposition"), "inline") {
+		t.Fatalf("unexpected download headers %v", header)
+	}
+
+	var room RoomResponse
+	if code := rest(http.MethodPost, "/api/rooms", ownerToken, `{"name":"vault","type":"private"}`, &room); code != http.StatusCreated {
+		t.Fatalf("create room: expected 201, got %d", code)
+	}
+	roomPath := "/api/rooms/" + strconv.FormatInt(room.ID, 10)
+	if code := rest(http.MethodPost, roomPath+"/members", ownerToken, `{"user_id":2}`, nil); code != http.StatusOK {
+		t.Fatalf("add bob: expected 200, got %d", code)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// waitEvent skips outbound frames until the named event arrives.
+	waitEvent := func(name string) map[string]any {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", name, readErr)
+			}
+			if outbound.Event != name {
+				continue
+			}
+			raw, _ := json.Marshal(outbound.Data)
+			var data map[string]any
+			if unmarshalErr := json.Unmarshal(raw, &data); unmarshalErr != nil {
+				t.Fatalf("decode %s: %v", name, unmarshalErr)
+			}
+			return data
+		}
+	}
+
+	send("hello", proto.HelloData{User: "owner", Token: ownerToken, Protocol: 1})
+	send("join", proto.JoinData{Room: "vault"})
+	waitEvent("user_joined")
+
+	send("msg", proto.MsgData{Room: "vault", Text: "look", Attachments: []int64{photo.ID}})
+	msgData := waitEvent("message")
+	attachments, _ := msgData["attachments"].([]any)
+	if len(attachments) != 1 {
+		t.Fatalf("expected one attachment on the message, got %v", msgData)
+	}
+	first, _ := attachments[0].(map[string]any)
+	if first["url"] != photo.URL || first["filename"] != "photo.png" || first["content_type"] != "image/png" {
+		t.Fatalf("unexpected attachment %v", first)
+	}
+	messageID := int64(msgData["id"].(float64))
+
+	// An upload can only be shared once, and only by its uploader
+	send("msg", proto.MsgData{Room: "vault", Text: "again", Attachments: []int64{photo.ID}, ClientMsgID: "again"})
+	if nack := waitEvent("msg_nack"); nack["code"] != core.ErrCodeBadRequest {
+		t.Fatalf("reused attachment: expected bad_request nack, got %v", nack)
+	}
+	_, bobUpload := upload(bobToken, "file", "notes.txt", []byte("bob's notes"))
+	send("msg", proto.MsgData{Room: "vault", Text: "stolen", Attachments: []int64{bobUpload.ID}, ClientMsgID: "stolen"})
+	if nack := waitEvent("msg_nack"); nack["code"] != core.ErrCodeBadRequest {
+		t.Fatalf("foreign attachment: expected bad_request nack, got %v", nack)
+	}
+
+	// Shared attachments follow room access
+	if code, data, _ := download(bobToken, photo.URL); code != http.StatusOK || !bytes.Equal(data, pngHeader) {
+		t.Fatalf("member download: got %d", code)
+	}
+	if code, _, _ := download(carolToken, photo.URL); code != http.StatusForbidden {
+		t.Fatalf("outsider download: expected 403, got %d", code)
+	}
+
+	var history MessagesResponse
+	if code := rest(http.MethodGet, roomPath+"/messages", bobToken, "", &history); code != http.StatusOK {
+		t.Fatalf("history: expected 200, got %d", code)
+	}
+	if len(history.Messages) != 1 || len(history.Messages[0].Attachments) != 1 || history.Messages[0].Attachments[0].ID != photo.ID {
+		t.Fatalf("unexpected history %+v", history.Messages)
+	}
+
+	// Deleting the message takes its attachments with it
+	msgPath := roomPath + "/messages/" + strconv.FormatInt(messageID, 10)
+	if code := rest(http.MethodDelete, msgPath, ownerToken, "", nil); code != http.StatusOK {
+		t.Fatalf("delete message: expected 200, got %d", code)
+	}
+	if code, _, _ := download(ownerToken, photo.URL); code != http.StatusNotFound {
+		t.Fatalf("download after delete: expected 404, got %d", code)
+	}
+	history = MessagesResponse{}
+	rest(http.MethodGet, roomPath+"/messages", bobToken, "", &history)
+	if len(history.Messages) != 1 || len(history.Messages[0].Attachments) != 0 {
+		t.Fatalf("deleted message should have no attachments: %+v", history.Messages)
+	}
+}
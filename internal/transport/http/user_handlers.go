@@ -1,26 +1,30 @@
 package http
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 
+	"github.com/vovakirdan/wirechat-server/internal/service/presence"
 	"github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 // UserHandlers provides HTTP handlers for user operations.
 type UserHandlers struct {
-	store store.Store
-	log   *zerolog.Logger
+	store    store.Store
+	presence *presence.Service // nil if presence tracking is disabled
+	log      *zerolog.Logger
 }
 
 // NewUserHandlers creates a new user handlers instance.
-func NewUserHandlers(st store.Store, logger *zerolog.Logger) *UserHandlers {
+func NewUserHandlers(st store.Store, presenceSvc *presence.Service, logger *zerolog.Logger) *UserHandlers {
 	return &UserHandlers{
-		store: st,
-		log:   logger,
+		store:    st,
+		presence: presenceSvc,
+		log:      logger,
 	}
 }
 
@@ -31,6 +35,13 @@ type UserResponse struct {
 	Name     string `json:"name"` // Fallback to username for now
 }
 
+// PresenceResponse represents a user's presence in API responses.
+type PresenceResponse struct {
+	UserID     int64   `json:"user_id"`
+	Status     string  `json:"status"`
+	LastSeenAt *string `json:"last_seen_at,omitempty"`
+}
+
 // SearchUsers handles searching for users.
 // GET /api/users/search?q=query
 func (h *UserHandlers) SearchUsers(c *gin.Context) {
@@ -79,3 +90,62 @@ func (h *UserHandlers) SearchUsers(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// GetPresence handles getting a user's presence status.
+// Only the user themselves and their accepted friends may see it.
+// GET /api/users/:id/presence
+func (h *UserHandlers) GetPresence(c *gin.Context) {
+	currentUserID, exists := c.Get(ContextKeyUserID)
+	if !exists {
+		h.log.Error().Msg("user_id not found in context")
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	uid, ok := currentUserID.(int64)
+	if !ok {
+		h.log.Error().Msg("invalid user_id type in context")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	var targetID int64
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &targetID); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	if h.presence == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "presence is not available"})
+		return
+	}
+
+	allowed, err := h.presence.CanView(c.Request.Context(), uid, targetID)
+	if err != nil {
+		h.log.Error().Err(err).Int64("user_id", uid).Int64("target_id", targetID).Msg("failed to check presence access")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "presence is visible to friends only"})
+		return
+	}
+
+	p, err := h.presence.Get(c.Request.Context(), targetID)
+	if err != nil {
+		h.log.Error().Err(err).Int64("target_id", targetID).Msg("failed to get presence")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	resp := PresenceResponse{
+		UserID: p.UserID,
+		Status: string(p.Status),
+	}
+	if p.LastSeenAt != nil {
+		lastSeen := p.LastSeenAt.Format("2006-01-02T15:04:05Z07:00")
+		resp.LastSeenAt = &lastSeen
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
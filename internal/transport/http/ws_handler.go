@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	stdhttp "net/http"
+	"sync"
 	"time"
 
 	"github.com/coder/websocket"
@@ -15,28 +16,102 @@ import (
 	"github.com/vovakirdan/wirechat-server/internal/config"
 	"github.com/vovakirdan/wirechat-server/internal/core"
 	"github.com/vovakirdan/wirechat-server/internal/proto"
+	"github.com/vovakirdan/wirechat-server/internal/service/rooms"
 	"github.com/vovakirdan/wirechat-server/internal/store"
 	"github.com/vovakirdan/wirechat-server/internal/utils"
 )
 
+// closeStatusSlowConsumer is sent when a client falls too far behind on outbound
+// events under the "disconnect" slow-consumer policy. Clients should reconnect
+// and re-join with since to resume.
+const closeStatusSlowConsumer websocket.StatusCode = 4008
+
+// closeStatusSessionRevoked is sent when the session the client authenticated
+// with was revoked (logout, a killed device or refresh token reuse).
+// Clients should not reconnect with the same tokens.
+const closeStatusSessionRevoked websocket.StatusCode = 4401
+
+// errSlowConsumer ends the write loop when the client's outbound queue overflowed.
+var errSlowConsumer = errors.New("slow consumer")
+
+// errSessionRevoked ends the write loop when the client's session was revoked.
+var errSessionRevoked = errors.New("session revoked")
+
+// sessionConns tracks live connections by the auth session they authenticated
+// with, so that revoking a session closes its sockets.
+type sessionConns struct {
+	mu    sync.Mutex
+	conns map[string]*sessionConn // by client ID
+}
+
+type sessionConn struct {
+	sessionID int64
+	revoked   chan struct{} // closed when the session is revoked
+}
+
+func newSessionConns() *sessionConns {
+	return &sessionConns{conns: make(map[string]*sessionConn)}
+}
+
+// add tracks a client under a session, replacing any earlier session of the client.
+func (s *sessionConns) add(clientID string, sessionID int64, revoked chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[clientID] = &sessionConn{sessionID: sessionID, revoked: revoked}
+}
+
+// remove stops tracking a client.
+func (s *sessionConns) remove(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, clientID)
+}
+
+// revoke signals every connection of the given sessions to close.
+func (s *sessionConns) revoke(sessionIDs []int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for clientID, conn := range s.conns {
+		for _, id := range sessionIDs {
+			if conn.sessionID == id {
+				// A client re-sending hello may be tracked again with its closed channel
+				select {
+				case <-conn.revoked:
+				default:
+					close(conn.revoked)
+				}
+				delete(s.conns, clientID)
+				break
+			}
+		}
+	}
+}
+
 // WSHandler upgrades HTTP connections and bridges them to core.Client.
 type WSHandler struct {
 	hub         core.Hub
 	authService *auth.Service
 	store       store.Store
+	rooms       *rooms.Service
+	sessions    *sessionConns
 	log         *zerolog.Logger
 	config      *config.Config
 }
 
 // NewWSHandler builds a new WebSocket handler.
-func NewWSHandler(hub core.Hub, authService *auth.Service, st store.Store, cfg *config.Config, logger *zerolog.Logger) stdhttp.Handler {
-	return &WSHandler{
+// Connections are closed when the session they authenticated with is revoked.
+func NewWSHandler(hub core.Hub, authService *auth.Service, st store.Store, roomsSvc *rooms.Service, cfg *config.Config, logger *zerolog.Logger) stdhttp.Handler {
+	h := &WSHandler{
 		hub:         hub,
 		authService: authService,
 		store:       st,
+		rooms:       roomsSvc,
+		sessions:    newSessionConns(),
 		log:         logger,
 		config:      cfg,
 	}
+	authService.OnSessionsRevoked(h.sessions.revoke)
+	return h
 }
 
 func (h *WSHandler) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
@@ -57,9 +132,14 @@ func (h *WSHandler) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	}
 
 	// Create client without user info - will be set in handleHello
-	client := core.NewClient(utils.NewID(), "", 0, false)
+	client := core.NewClientWithQueue(utils.NewID(), "", 0, false, h.config.ClientQueueSize)
+	if h.config.SlowConsumerPolicy == "gap" {
+		client.SlowPolicy = core.SlowConsumerGap
+	}
 	h.hub.RegisterClient(client)
 	defer h.hub.UnregisterClient(client)
+	revoked := make(chan struct{})
+	defer h.sessions.remove(client.ID)
 
 	h.log.Info().
 		Str("client_id", client.ID).
@@ -72,20 +152,48 @@ func (h *WSHandler) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 	errCh := make(chan error, 2)
 	stopRate := make(chan struct{})
 	go func() {
-		errCh <- h.readLoop(ctx, conn, client, stopRate)
+		errCh <- h.readLoop(ctx, conn, client, revoked, stopRate)
 	}()
 	go func() {
-		errCh <- h.writeLoop(ctx, conn, client)
+		errCh <- h.writeLoop(ctx, conn, client, revoked)
 	}()
 
 	err = <-errCh
+	// Server-initiated closes need their status sent before cancelling:
+	// a cancelled read drops the connection without a close frame.
+	switch {
+	case errors.Is(err, errSlowConsumer):
+		conn.Close(closeStatusSlowConsumer, errSlowConsumer.Error())
+	case errors.Is(err, errSessionRevoked):
+		conn.Close(closeStatusSessionRevoked, errSessionRevoked.Error())
+	}
 	cancel() // stop the other goroutine
 	<-errCh
 	close(stopRate)
 
+	// Keep draining until the hub closes the queue, so it never blocks on a gone client.
+	go func() {
+		for range client.Events {
+		}
+	}()
+
 	status := websocket.StatusNormalClosure
 	reason := "closing"
-	if err != nil && !errors.Is(err, context.Canceled) {
+	if errors.Is(err, errSlowConsumer) {
+		status = closeStatusSlowConsumer
+		reason = errSlowConsumer.Error()
+		h.log.Warn().
+			Str("client_id", client.ID).
+			Str("remote", remote).
+			Msg("disconnecting slow consumer")
+	} else if errors.Is(err, errSessionRevoked) {
+		status = closeStatusSessionRevoked
+		reason = errSessionRevoked.Error()
+		h.log.Info().
+			Str("client_id", client.ID).
+			Int64("user_id", client.UserID).
+			Msg("disconnecting revoked session")
+	} else if err != nil && !errors.Is(err, context.Canceled) {
 		if errors.Is(err, io.EOF) {
 			err = nil
 		}
@@ -118,13 +226,20 @@ func (h *WSHandler) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		Msg("ws disconnected")
 }
 
-func (h *WSHandler) readLoop(ctx context.Context, conn *websocket.Conn, client *core.Client, stopRate <-chan struct{}) error {
+func (h *WSHandler) readLoop(ctx context.Context, conn *websocket.Conn, client *core.Client, revoked chan struct{}, stopRate <-chan struct{}) error {
 	joinLimiter := newRateLimiter(h.config.RateLimitJoinPerMin)
 	msgLimiter := newRateLimiter(h.config.RateLimitMsgPerMin)
+	typingLimiter := newRateLimiter(h.config.RateLimitTypingPerMin)
+	presenceLimiter := newRateLimiter(h.config.RateLimitPresencePerMin)
 	joinLimiter.startReset(stopRate)
 	msgLimiter.startReset(stopRate)
+	typingLimiter.startReset(stopRate)
+	presenceLimiter.startReset(stopRate)
 
 	authenticated := !h.config.JWTRequired
+	// helloDone is set once a hello is accepted. The hub indexes the connection
+	// under that user, so its identity must not change afterwards.
+	helloDone := false
 
 	for {
 		var inbound proto.Inbound
@@ -155,10 +270,17 @@ func (h *WSHandler) readLoop(ctx context.Context, conn *websocket.Conn, client *
 		}
 
 		cmd, protoErr, err := inboundToCommand(client, inbound)
-		if inbound.Type == proto.InboundTypeHello && err == nil {
-			protoErr, err = h.handleHello(client, inbound)
+		if inbound.Type == proto.InboundTypeHello && err == nil && helloDone {
+			protoErr = &proto.Error{Code: "already_authenticated", Msg: "hello already sent on this connection"}
+		} else if inbound.Type == proto.InboundTypeHello && err == nil {
+			protoErr, err = h.handleHello(ctx, client, inbound, revoked)
 			if err == nil && protoErr == nil {
 				authenticated = true
+				helloDone = true
+				// Register this connection under its user so targeted events reach every device
+				if client.UserID > 0 {
+					cmd = &core.Command{Kind: core.CommandIdentify}
+				}
 			}
 		}
 
@@ -177,10 +299,19 @@ func (h *WSHandler) readLoop(ctx context.Context, conn *websocket.Conn, client *
 				if !joinLimiter.allow() {
 					protoErr = &proto.Error{Code: "rate_limited", Msg: "too many join requests"}
 				}
-			case core.CommandSendRoomMessage:
+			case core.CommandSendRoomMessage, core.CommandEditMessage, core.CommandDeleteMessage,
+				core.CommandAddReaction, core.CommandRemoveReaction:
 				if !msgLimiter.allow() {
 					protoErr = &proto.Error{Code: "rate_limited", Msg: "too many messages"}
 				}
+			case core.CommandTypingStart, core.CommandTypingStop:
+				if !typingLimiter.allow() {
+					protoErr = &proto.Error{Code: "rate_limited", Msg: "too many typing updates"}
+				}
+			case core.CommandSetPresence:
+				if !presenceLimiter.allow() {
+					protoErr = &proto.Error{Code: "rate_limited", Msg: "too many presence updates"}
+				}
 			case core.CommandCallInvite, core.CommandCallAccept, core.CommandCallReject,
 				core.CommandCallJoin, core.CommandCallLeave, core.CommandCallEnd:
 				// Call commands require authenticated (non-guest) user
@@ -195,89 +326,15 @@ func (h *WSHandler) readLoop(ctx context.Context, conn *websocket.Conn, client *
 				Str("code", protoErr.Code).
 				Str("msg", protoErr.Msg).
 				Msg("protocol error")
-			if writeErr := wsjson.Write(ctx, conn, proto.Outbound{
-				Type:  "error",
-				Error: protoErr,
-			}); writeErr != nil {
+			if writeErr := wsjson.Write(ctx, conn, rejectionOutbound(cmd, protoErr)); writeErr != nil {
 				return writeErr
 			}
 			continue
 		}
 		if cmd != nil {
-			// For join commands, check room type and membership (Iteration 3.2: public + private rooms)
+			// For join commands, check room access with the same rules as the REST API
 			if cmd.Kind == core.CommandJoinRoom {
-				room, err := h.store.GetRoomByName(ctx, cmd.Room)
-				if err != nil {
-					h.log.Warn().Err(err).Str("room", cmd.Room).Msg("room not found")
-					protoErr = &proto.Error{Code: "room_not_found", Msg: "room does not exist"}
-					if writeErr := wsjson.Write(ctx, conn, proto.Outbound{
-						Type:  "error",
-						Error: protoErr,
-					}); writeErr != nil {
-						return writeErr
-					}
-					continue
-				}
-
-				// Check room access based on type
-				switch room.Type {
-				case store.RoomTypePublic:
-					// Public room: anyone can join
-					h.log.Debug().
-						Str("client_id", client.ID).
-						Str("room", cmd.Room).
-						Int64("room_id", room.ID).
-						Msg("allowing join to public room")
-				case store.RoomTypePrivate, store.RoomTypeDirect:
-					// Private/Direct room: check membership
-					roomTypeStr := "private"
-					if room.Type == store.RoomTypeDirect {
-						roomTypeStr = "direct"
-					}
-
-					isMember, err := h.store.IsMember(ctx, client.UserID, room.ID)
-					if err != nil {
-						h.log.Error().Err(err).Int64("user_id", client.UserID).Int64("room_id", room.ID).Msg("failed to check membership")
-						protoErr = &proto.Error{Code: "internal_error", Msg: "internal server error"}
-						if writeErr := wsjson.Write(ctx, conn, proto.Outbound{
-							Type:  "error",
-							Error: protoErr,
-						}); writeErr != nil {
-							return writeErr
-						}
-						continue
-					}
-					if !isMember {
-						h.log.Warn().
-							Str("client_id", client.ID).
-							Int64("user_id", client.UserID).
-							Str("room", cmd.Room).
-							Int64("room_id", room.ID).
-							Str("room_type", roomTypeStr).
-							Msg("access denied: not a member of room")
-						protoErr = &proto.Error{Code: "access_denied", Msg: "access denied"}
-						if writeErr := wsjson.Write(ctx, conn, proto.Outbound{
-							Type:  "error",
-							Error: protoErr,
-						}); writeErr != nil {
-							return writeErr
-						}
-						continue
-					}
-					h.log.Debug().
-						Str("client_id", client.ID).
-						Int64("user_id", client.UserID).
-						Str("room", cmd.Room).
-						Str("room_type", roomTypeStr).
-						Msg("allowing join to room (user is member)")
-				default:
-					// Other unsupported room types - deny
-					h.log.Warn().
-						Str("client_id", client.ID).
-						Str("room", cmd.Room).
-						Str("room_type", string(room.Type)).
-						Msg("access denied: unsupported room type")
-					protoErr = &proto.Error{Code: "access_denied", Msg: "access denied"}
+				if protoErr := h.authorizeJoin(ctx, client, cmd.Room); protoErr != nil {
 					if writeErr := wsjson.Write(ctx, conn, proto.Outbound{
 						Type:  "error",
 						Error: protoErr,
@@ -313,7 +370,43 @@ func isExpectedClose(err error) bool {
 	}
 }
 
-func (h *WSHandler) writeLoop(ctx context.Context, conn *websocket.Conn, client *core.Client) error {
+// authorizeJoin checks that the client may subscribe to a room.
+// Returns the protocol error to send back, or nil if the join may proceed.
+func (h *WSHandler) authorizeJoin(ctx context.Context, client *core.Client, roomName string) *proto.Error {
+	room, err := h.rooms.AuthorizeReadByName(ctx, client.UserID, roomName)
+	switch {
+	case err == nil:
+		h.log.Debug().
+			Str("client_id", client.ID).
+			Int64("user_id", client.UserID).
+			Str("room", roomName).
+			Str("room_type", string(room.Type)).
+			Msg("allowing join to room")
+		return nil
+	case errors.Is(err, rooms.ErrRoomNotFound):
+		h.log.Warn().Str("room", roomName).Msg("room not found")
+		return &proto.Error{Code: core.ErrCodeRoomNotFound, Msg: "room does not exist"}
+	case errors.Is(err, rooms.ErrBanned):
+		h.log.Warn().
+			Str("client_id", client.ID).
+			Int64("user_id", client.UserID).
+			Str("room", roomName).
+			Msg("banned user tried to join room")
+		return &proto.Error{Code: core.ErrCodeBanned, Msg: "banned from this room"}
+	case errors.Is(err, rooms.ErrAccessDenied):
+		h.log.Warn().
+			Str("client_id", client.ID).
+			Int64("user_id", client.UserID).
+			Str("room", roomName).
+			Msg("access denied to room")
+		return &proto.Error{Code: "access_denied", Msg: "access denied"}
+	default:
+		h.log.Error().Err(err).Int64("user_id", client.UserID).Str("room", roomName).Msg("failed to check room access")
+		return &proto.Error{Code: core.ErrCodeInternal, Msg: "internal server error"}
+	}
+}
+
+func (h *WSHandler) writeLoop(ctx context.Context, conn *websocket.Conn, client *core.Client, revoked <-chan struct{}) error {
 	// Setup ping ticker if ping interval is configured
 	var pingTicker *time.Ticker
 	var pingCh <-chan time.Time
@@ -340,6 +433,10 @@ func (h *WSHandler) writeLoop(ctx context.Context, conn *websocket.Conn, client
 				h.log.Error().Err(err).Str("client_id", client.ID).Msg("write ws event")
 				return err
 			}
+		case <-client.Slow():
+			return errSlowConsumer
+		case <-revoked:
+			return errSessionRevoked
 		case <-pingCh:
 			// Send WebSocket ping to keep connection alive
 			if err := conn.Ping(ctx); err != nil {
@@ -358,8 +455,24 @@ func commandKindString(kind core.CommandKind) string {
 		return "join"
 	case core.CommandLeaveRoom:
 		return "leave"
+	case core.CommandIdentify:
+		return "identify"
 	case core.CommandSendRoomMessage:
 		return "msg"
+	case core.CommandEditMessage:
+		return "msg.edit"
+	case core.CommandDeleteMessage:
+		return "msg.delete"
+	case core.CommandAddReaction:
+		return "reaction.add"
+	case core.CommandRemoveReaction:
+		return "reaction.remove"
+	case core.CommandMarkRead:
+		return "read"
+	case core.CommandTypingStart, core.CommandTypingStop:
+		return "typing"
+	case core.CommandSetPresence:
+		return "presence"
 	case core.CommandCallInvite:
 		return "call.invite"
 	case core.CommandCallAccept:
@@ -377,7 +490,9 @@ func commandKindString(kind core.CommandKind) string {
 	}
 }
 
-func (h *WSHandler) handleHello(client *core.Client, inbound proto.Inbound) (*proto.Error, error) {
+// handleHello authenticates the connection. A token with a session ties the
+// connection to it: revoked closes once the session is revoked.
+func (h *WSHandler) handleHello(ctx context.Context, client *core.Client, inbound proto.Inbound, revoked chan struct{}) (*proto.Error, error) {
 	var hello proto.HelloData
 	if err := json.Unmarshal(inbound.Data, &hello); err != nil {
 		return nil, err
@@ -390,6 +505,13 @@ func (h *WSHandler) handleHello(client *core.Client, inbound proto.Inbound) (*pr
 	// Try to validate JWT token
 	if hello.Token != "" {
 		claims, err := h.authService.ValidateToken(hello.Token)
+		if err == nil && claims.SessionID != 0 {
+			// Track before checking, so a revocation in between still closes the socket
+			h.sessions.add(client.ID, claims.SessionID, revoked)
+			if err = h.authService.CheckSession(ctx, claims); err != nil {
+				h.sessions.remove(client.ID)
+			}
+		}
 		if err != nil {
 			h.log.Warn().Err(err).Msg("invalid jwt token")
 			if h.config.JWTRequired {
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/vovakirdan/wirechat-server/internal/config"
 	"github.com/vovakirdan/wirechat-server/internal/core"
 	"github.com/vovakirdan/wirechat-server/internal/proto"
+	storepkg "github.com/vovakirdan/wirechat-server/internal/store"
 )
 
 func startTestServer(t *testing.T) (*httptest.Server, context.CancelFunc) {
@@ -28,7 +30,7 @@ func startTestServer(t *testing.T) (*httptest.Server, context.CancelFunc) {
 	// Create auth service
 	authService := createTestAuthService(t, store, "test-secret")
 
-	hub := core.NewHub(store, nil)
+	hub := core.NewHub(store, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	go hub.Run(ctx)
 
@@ -41,7 +43,7 @@ func startTestServer(t *testing.T) (*httptest.Server, context.CancelFunc) {
 		MaxMessageBytes:   1 << 20,
 	}
 
-	server := NewServer(hub, authService, store, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, store, nil, nil, nil, nil, &cfg, &disabledLogger)
 
 	ts := httptest.NewServer(server.Handler)
 	t.Cleanup(ts.Close)
@@ -59,13 +61,13 @@ func startTestServerWithConfig(t *testing.T, cfg config.Config) (*httptest.Serve
 	// Create auth service
 	authService := createTestAuthService(t, store, cfg.JWTSecret)
 
-	hub := core.NewHub(store, nil)
+	hub := core.NewHub(store, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	go hub.Run(ctx)
 
 	disabledLogger := zerolog.New(io.Discard)
 
-	server := NewServer(hub, authService, store, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, store, nil, nil, nil, nil, &cfg, &disabledLogger)
 
 	ts := httptest.NewServer(server.Handler)
 	t.Cleanup(ts.Close)
@@ -187,6 +189,62 @@ func TestWebSocketHelloAndMessage(t *testing.T) {
 	}
 }
 
+func TestWebSocketSecondHelloRejected(t *testing.T) {
+	ts, cancel := startTestServer(t)
+	defer cancel()
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+
+	ctx, closeCtx := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCtx()
+
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(kind string, data any) {
+		payload, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(ctx, conn, proto.Inbound{Type: kind, Data: payload}); writeErr != nil {
+			t.Fatalf("send %s: %v", kind, writeErr)
+		}
+	}
+	read := func(kind string) proto.Outbound {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(ctx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound: %v", readErr)
+			}
+			if outbound.Type == kind {
+				return outbound
+			}
+		}
+	}
+
+	// The connection keeps the identity of its first hello
+	send("hello", proto.HelloData{User: "alice"})
+	send("hello", proto.HelloData{User: "mallory"})
+	if outbound := read("error"); outbound.Error == nil || outbound.Error.Code != "already_authenticated" {
+		t.Fatalf("expected already_authenticated error, got %+v", outbound)
+	}
+
+	send("join", proto.JoinData{Room: "general"})
+	send("msg", proto.MsgData{Room: "general", Text: "still me"})
+	outbound := read("event")
+	for outbound.Event != "message" {
+		outbound = read("event")
+	}
+	msgData, _ := json.Marshal(outbound.Data)
+	var event proto.EventMessage
+	if unmarshalErr := json.Unmarshal(msgData, &event); unmarshalErr != nil {
+		t.Fatalf("unmarshal event data: %v", unmarshalErr)
+	}
+	if event.User != "alice" {
+		t.Fatalf("expected the message from alice, got %+v", event)
+	}
+}
+
 func TestWebSocketMessageTooLarge(t *testing.T) {
 	cfg := config.Config{
 		Addr:                ":0",
@@ -319,6 +377,67 @@ func TestWebSocketRateLimitMessage(t *testing.T) {
 	}
 }
 
+func TestWebSocketRateLimitPresenceSeparately(t *testing.T) {
+	cfg := config.Config{
+		Addr:                    ":0",
+		ReadHeaderTimeout:       time.Second,
+		ShutdownTimeout:         time.Second,
+		MaxMessageBytes:         1 << 20,
+		RateLimitJoinPerMin:     10,
+		RateLimitTypingPerMin:   1, // allow only one typing update
+		RateLimitPresencePerMin: 1,
+	}
+	ts, cancel := startTestServerWithConfig(t, cfg)
+	defer cancel()
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+
+	ctx, closeCtx := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCtx()
+
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(kind string, data any) {
+		payload, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(ctx, conn, proto.Inbound{Type: kind, Data: payload}); writeErr != nil {
+			t.Fatalf("send %s: %v", kind, writeErr)
+		}
+	}
+	nextError := func() *proto.Error {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(ctx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound: %v", readErr)
+			}
+			if outbound.Type == "error" && outbound.Error != nil {
+				return outbound.Error
+			}
+		}
+	}
+
+	send("hello", proto.HelloData{User: "typist"})
+	send("join", proto.JoinData{Room: "general"})
+	send("typing", proto.TypingData{Room: "general"})
+	send("typing", proto.TypingData{Room: "general"})
+	if protoErr := nextError(); protoErr.Code != "rate_limited" {
+		t.Fatalf("expected the second typing update to be rate limited, got %+v", protoErr)
+	}
+
+	// Typing used up its own budget, not the one for presence (guests are then refused by the hub)
+	send("presence", proto.PresenceData{Status: "away"})
+	if protoErr := nextError(); protoErr.Code != core.ErrCodeUnauthorized {
+		t.Fatalf("expected the presence change to pass the rate limit, got %+v", protoErr)
+	}
+	send("presence", proto.PresenceData{Status: "dnd"})
+	if protoErr := nextError(); protoErr.Code != "rate_limited" {
+		t.Fatalf("expected the second presence change to be rate limited, got %+v", protoErr)
+	}
+}
+
 // TestWebSocketDirectRoomJoin tests WebSocket join functionality for direct message rooms
 func TestWebSocketDirectRoomJoin(t *testing.T) {
 	// Create test store with schema
@@ -328,7 +447,7 @@ func TestWebSocketDirectRoomJoin(t *testing.T) {
 	// Create auth service
 	authService := createTestAuthService(t, testStore, "test-secret")
 
-	hub := core.NewHub(testStore, nil)
+	hub := core.NewHub(testStore, nil, nil)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go hub.Run(ctx)
@@ -343,22 +462,22 @@ func TestWebSocketDirectRoomJoin(t *testing.T) {
 		JWTSecret:         "test-secret",
 	}
 
-	server := NewServer(hub, authService, testStore, nil, nil, &cfg, &disabledLogger)
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
 	ts := httptest.NewServer(server.Handler)
 	defer ts.Close()
 
 	// Register three test users
-	token1, err := authService.Register(context.Background(), "user1", "password123")
+	token1, err := registerToken(context.Background(), authService, "user1", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user1: %v", err)
 	}
 
-	token2, err := authService.Register(context.Background(), "user2", "password123")
+	token2, err := registerToken(context.Background(), authService, "user2", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user2: %v", err)
 	}
 
-	token3, err := authService.Register(context.Background(), "user3", "password123")
+	token3, err := registerToken(context.Background(), authService, "user3", "password123")
 	if err != nil {
 		t.Fatalf("failed to register user3: %v", err)
 	}
@@ -513,3 +632,926 @@ func TestWebSocketDirectRoomJoin(t *testing.T) {
 
 	t.Log("TestWebSocketDirectRoomJoin: All tests passed")
 }
+
+// TestWebSocketReactions tests adding and removing reactions and their aggregation in history.
+func TestWebSocketReactions(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	aliceToken, err := registerToken(context.Background(), authService, "alice", "password123")
+	if err != nil {
+		t.Fatalf("failed to register alice: %v", err)
+	}
+	bobToken, err := registerToken(context.Background(), authService, "bob", "password123")
+	if err != nil {
+		t.Fatalf("failed to register bob: %v", err)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	connect := func(user, token string) *websocket.Conn {
+		conn, _, dialErr := websocket.Dial(wsCtx, wsURL, nil)
+		if dialErr != nil {
+			t.Fatalf("dial %s: %v", user, dialErr)
+		}
+		helloData, _ := json.Marshal(proto.HelloData{User: user, Token: token, Protocol: 1})
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "hello", Data: helloData}); writeErr != nil {
+			t.Fatalf("send hello %s: %v", user, writeErr)
+		}
+		joinData, _ := json.Marshal(proto.JoinData{Room: "general"})
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "join", Data: joinData}); writeErr != nil {
+			t.Fatalf("send join %s: %v", user, writeErr)
+		}
+		return conn
+	}
+
+	waitFor := func(conn *websocket.Conn, expectEvent string) json.RawMessage {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound: %v", readErr)
+			}
+			if outbound.Type == "error" {
+				t.Fatalf("unexpected error: %+v", outbound.Error)
+			}
+			if outbound.Event != expectEvent {
+				continue
+			}
+			data, _ := json.Marshal(outbound.Data)
+			return data
+		}
+	}
+
+	react := func(conn *websocket.Conn, kind string, id int64, emoji string) {
+		data, _ := json.Marshal(proto.ReactionData{Room: "general", ID: id, Emoji: emoji})
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: kind, Data: data}); writeErr != nil {
+			t.Fatalf("send %s: %v", kind, writeErr)
+		}
+	}
+
+	alice := connect("alice", aliceToken)
+	defer alice.Close(websocket.StatusNormalClosure, "done")
+	waitFor(alice, "user_joined")
+	bob := connect("bob", bobToken)
+	defer bob.Close(websocket.StatusNormalClosure, "done")
+	waitFor(bob, "user_joined")
+
+	msgData, _ := json.Marshal(proto.MsgData{Room: "general", Text: "ship it?"})
+	if writeErr := wsjson.Write(wsCtx, alice, proto.Inbound{Type: "msg", Data: msgData}); writeErr != nil {
+		t.Fatalf("send msg: %v", writeErr)
+	}
+	var msg proto.EventMessage
+	if unmarshalErr := json.Unmarshal(waitFor(bob, "message"), &msg); unmarshalErr != nil {
+		t.Fatalf("unmarshal message: %v", unmarshalErr)
+	}
+
+	// Both users react; every room member sees each update in order
+	react(bob, proto.InboundTypeReactionAdd, msg.ID, "👍")
+	waitFor(alice, "reaction_updated")
+	waitFor(bob, "reaction_updated")
+
+	react(alice, proto.InboundTypeReactionAdd, msg.ID, "👍")
+	waitFor(alice, "reaction_updated")
+	var updated proto.EventReactionUpdated
+	if unmarshalErr := json.Unmarshal(waitFor(bob, "reaction_updated"), &updated); unmarshalErr != nil {
+		t.Fatalf("unmarshal reaction: %v", unmarshalErr)
+	}
+	if updated.Action != "added" || updated.User != "alice" || len(updated.Reactions) != 1 || updated.Reactions[0].Count != 2 {
+		t.Fatalf("unexpected reaction update: %+v", updated)
+	}
+
+	react(bob, proto.InboundTypeReactionRemove, msg.ID, "👍")
+	updated = proto.EventReactionUpdated{}
+	if unmarshalErr := json.Unmarshal(waitFor(alice, "reaction_updated"), &updated); unmarshalErr != nil {
+		t.Fatalf("unmarshal reaction: %v", unmarshalErr)
+	}
+	if updated.Action != "removed" || updated.User != "bob" || len(updated.Reactions) != 1 || updated.Reactions[0].Count != 1 {
+		t.Fatalf("unexpected reaction removal: %+v", updated)
+	}
+
+	// History over REST includes the aggregated counts
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms/1/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+	var history MessagesResponse
+	if unmarshalErr := json.Unmarshal(rec.Body.Bytes(), &history); unmarshalErr != nil {
+		t.Fatalf("unmarshal history: %v", unmarshalErr)
+	}
+	if len(history.Messages) != 1 || len(history.Messages[0].Reactions) != 1 ||
+		history.Messages[0].Reactions[0].Emoji != "👍" || history.Messages[0].Reactions[0].Count != 1 {
+		t.Fatalf("unexpected history reactions: %+v", history.Messages)
+	}
+}
+
+// TestWebSocketReadReceipts tests read receipts in a direct room and unread counters in the room list.
+func TestWebSocketReadReceipts(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	token1, err := registerToken(context.Background(), authService, "user1", "password123")
+	if err != nil {
+		t.Fatalf("failed to register user1: %v", err)
+	}
+	token2, err := registerToken(context.Background(), authService, "user2", "password123")
+	if err != nil {
+		t.Fatalf("failed to register user2: %v", err)
+	}
+
+	dm, err := testStore.CreateDirectRoom(context.Background(), "1:2", 1, 2)
+	if err != nil {
+		t.Fatalf("failed to create direct room: %v", err)
+	}
+	var msgIDs []int64
+	for _, body := range []string{"one", "two", "three"} {
+		msg := &storepkg.Message{RoomID: dm.ID, UserID: 2, Body: body, CreatedAt: time.Now()}
+		if saveErr := testStore.SaveMessage(context.Background(), msg); saveErr != nil {
+			t.Fatalf("failed to save message: %v", saveErr)
+		}
+		msgIDs = append(msgIDs, msg.ID)
+	}
+
+	dmState := func() RoomResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+		req.Header.Set("Authorization", "Bearer "+token1)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		var rooms []RoomResponse
+		if unmarshalErr := json.Unmarshal(rec.Body.Bytes(), &rooms); unmarshalErr != nil {
+			t.Fatalf("unmarshal rooms: %v", unmarshalErr)
+		}
+		for _, room := range rooms {
+			if room.ID == dm.ID {
+				if room.UnreadCount == nil || room.LastReadID == nil {
+					t.Fatalf("room list is missing read state: %+v", room)
+				}
+				return room
+			}
+		}
+		t.Fatalf("direct room %d not listed", dm.ID)
+		return RoomResponse{}
+	}
+
+	if state := dmState(); *state.UnreadCount != 3 || *state.LastReadID != 0 {
+		t.Fatalf("expected 3 unread before reading, got unread=%d last_read=%d", *state.UnreadCount, *state.LastReadID)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	dial := func(user, token string) *websocket.Conn {
+		conn, _, dialErr := websocket.Dial(wsCtx, wsURL, nil)
+		if dialErr != nil {
+			t.Fatalf("dial %s: %v", user, dialErr)
+		}
+		helloData, _ := json.Marshal(proto.HelloData{User: user, Token: token, Protocol: 1})
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "hello", Data: helloData}); writeErr != nil {
+			t.Fatalf("send hello %s: %v", user, writeErr)
+		}
+		return conn
+	}
+
+	// user2 is connected but has not joined the room; receipts reach them anyway
+	conn2 := dial("user2", token2)
+	defer conn2.Close(websocket.StatusNormalClosure, "done")
+	conn1 := dial("user1", token1)
+	defer conn1.Close(websocket.StatusNormalClosure, "done")
+
+	joinData, _ := json.Marshal(proto.JoinData{Room: dm.Name})
+	if writeErr := wsjson.Write(wsCtx, conn1, proto.Inbound{Type: "join", Data: joinData}); writeErr != nil {
+		t.Fatalf("send join: %v", writeErr)
+	}
+	readData, _ := json.Marshal(proto.ReadData{Room: dm.Name, LastReadID: msgIDs[1]})
+	if writeErr := wsjson.Write(wsCtx, conn1, proto.Inbound{Type: "read", Data: readData}); writeErr != nil {
+		t.Fatalf("send read: %v", writeErr)
+	}
+
+	var receipt proto.EventReadReceipt
+	for {
+		var outbound proto.Outbound
+		if readErr := wsjson.Read(wsCtx, conn2, &outbound); readErr != nil {
+			t.Fatalf("read outbound: %v", readErr)
+		}
+		if outbound.Event != "read_receipt" {
+			continue
+		}
+		data, _ := json.Marshal(outbound.Data)
+		if unmarshalErr := json.Unmarshal(data, &receipt); unmarshalErr != nil {
+			t.Fatalf("unmarshal receipt: %v", unmarshalErr)
+		}
+		break
+	}
+	if receipt.Room != dm.Name || receipt.UserID != 1 || receipt.LastReadID != msgIDs[1] {
+		t.Fatalf("unexpected read receipt: %+v", receipt)
+	}
+
+	if state := dmState(); *state.UnreadCount != 1 || *state.LastReadID != msgIDs[1] {
+		t.Fatalf("expected 1 unread after reading, got unread=%d last_read=%d", *state.UnreadCount, *state.LastReadID)
+	}
+}
+
+func TestWebSocketJoinResumeSince(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	token, err := registerToken(context.Background(), authService, "user1", "password123")
+	if err != nil {
+		t.Fatalf("failed to register user1: %v", err)
+	}
+
+	// More than one replay page was posted while the client was offline
+	var msgIDs []int64
+	for i := range 105 {
+		msg := &storepkg.Message{RoomID: 1, UserID: 1, Body: "msg " + strconv.Itoa(i), CreatedAt: time.Now()}
+		if saveErr := testStore.SaveMessage(context.Background(), msg); saveErr != nil {
+			t.Fatalf("failed to save message: %v", saveErr)
+		}
+		msgIDs = append(msgIDs, msg.ID)
+	}
+	since := msgIDs[2]
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	helloData, _ := json.Marshal(proto.HelloData{User: "user1", Token: token, Protocol: 1})
+	if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "hello", Data: helloData}); writeErr != nil {
+		t.Fatalf("send hello: %v", writeErr)
+	}
+	joinData, _ := json.Marshal(proto.JoinData{Room: "general", Since: since})
+	if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: "join", Data: joinData}); writeErr != nil {
+		t.Fatalf("send join: %v", writeErr)
+	}
+
+	var replayed []int64
+	pages := 0
+	for {
+		var outbound proto.Outbound
+		if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+			t.Fatalf("read outbound: %v", readErr)
+		}
+		if outbound.Event != "history" {
+			continue
+		}
+		var history proto.EventHistory
+		data, _ := json.Marshal(outbound.Data)
+		if unmarshalErr := json.Unmarshal(data, &history); unmarshalErr != nil {
+			t.Fatalf("unmarshal history: %v", unmarshalErr)
+		}
+		if history.Since != since {
+			t.Fatalf("expected since %d, got %d", since, history.Since)
+		}
+		pages++
+		for _, m := range history.Messages {
+			replayed = append(replayed, m.ID)
+		}
+		if !history.HasMore {
+			break
+		}
+	}
+
+	if pages != 2 {
+		t.Fatalf("expected 2 replay pages, got %d", pages)
+	}
+	want := msgIDs[3:]
+	if len(replayed) != len(want) {
+		t.Fatalf("expected %d replayed messages, got %d", len(want), len(replayed))
+	}
+	for i := range want {
+		if replayed[i] != want[i] {
+			t.Fatalf("replay out of order at %d: got %d, want %d", i, replayed[i], want[i])
+		}
+	}
+}
+
+func TestWebSocketClientMsgIDAckAndDedup(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	token, err := registerToken(context.Background(), authService, "user1", "password123")
+	if err != nil {
+		t.Fatalf("failed to register user1: %v", err)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// readEvent skips everything until the named event and decodes its data.
+	readEvent := func(name string, out any) {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", name, readErr)
+			}
+			if outbound.Event != name {
+				continue
+			}
+			data, _ := json.Marshal(outbound.Data)
+			if unmarshalErr := json.Unmarshal(data, out); unmarshalErr != nil {
+				t.Fatalf("unmarshal %s: %v", name, unmarshalErr)
+			}
+			return
+		}
+	}
+
+	send("hello", proto.HelloData{User: "user1", Token: token, Protocol: 1})
+
+	// Sending before joining is rejected with a nack carrying the error code
+	send("msg", proto.MsgData{Room: "general", Text: "early", ClientMsgID: "c-0"})
+	var nack proto.EventMsgNack
+	readEvent("msg_nack", &nack)
+	if nack.ClientMsgID != "c-0" || nack.Code != core.ErrCodeNotInRoom {
+		t.Fatalf("unexpected nack: %+v", nack)
+	}
+
+	send("join", proto.JoinData{Room: "general"})
+	send("msg", proto.MsgData{Room: "general", Text: "hello", ClientMsgID: "c-1"})
+
+	var msg proto.EventMessage
+	readEvent("message", &msg)
+	if msg.ClientMsgID != "c-1" {
+		t.Fatalf("expected broadcast to echo client_msg_id, got %+v", msg)
+	}
+	var ack proto.EventMsgAck
+	readEvent("msg_ack", &ack)
+	if ack.ClientMsgID != "c-1" || ack.ID != msg.ID || ack.ID == 0 || ack.Duplicate {
+		t.Fatalf("unexpected ack: %+v (message id %d)", ack, msg.ID)
+	}
+
+	// A retry with the same client_msg_id is acknowledged, not stored again
+	send("msg", proto.MsgData{Room: "general", Text: "hello", ClientMsgID: "c-1"})
+	var retryAck proto.EventMsgAck
+	readEvent("msg_ack", &retryAck)
+	if retryAck.ID != ack.ID || !retryAck.Duplicate {
+		t.Fatalf("unexpected retry ack: %+v", retryAck)
+	}
+
+	messages, err := testStore.ListMessages(context.Background(), 1, 10, nil)
+	if err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 stored message, got %d", len(messages))
+	}
+}
+
+func TestWebSocketModeration(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	ownerToken, err := registerToken(context.Background(), authService, "owner", "password123")
+	if err != nil {
+		t.Fatalf("failed to register owner: %v", err)
+	}
+	bobToken, err := registerToken(context.Background(), authService, "bob", "password123")
+	if err != nil {
+		t.Fatalf("failed to register bob: %v", err)
+	}
+	ownerID := int64(1)
+	room, err := testStore.CreateRoom(context.Background(), "town", storepkg.RoomTypePublic, &ownerID)
+	if err != nil {
+		t.Fatalf("failed to create room: %v", err)
+	}
+
+	rest := func(method, path, token, body string) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// readUntil skips outbound frames until match accepts one.
+	readUntil := func(what string, match func(proto.Outbound) bool) proto.Outbound {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", what, readErr)
+			}
+			if match(outbound) {
+				return outbound
+			}
+		}
+	}
+	readError := func(code string) {
+		out := readUntil(code, func(o proto.Outbound) bool { return o.Type == "error" })
+		if out.Error == nil || out.Error.Code != code {
+			t.Fatalf("expected %s error, got %+v", code, out.Error)
+		}
+	}
+
+	send("hello", proto.HelloData{User: "bob", Token: bobToken, Protocol: 1})
+	send("join", proto.JoinData{Room: "town"})
+	readUntil("user_joined", func(o proto.Outbound) bool { return o.Event == "user_joined" })
+
+	// Bob cannot moderate
+	if code := rest(http.MethodPost, "/api/rooms/"+strconv.FormatInt(room.ID, 10)+"/mutes", bobToken, `{"user_id":1,"duration_seconds":60}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member mute, got %d", code)
+	}
+
+	// Muted: sends are rejected
+	if code := rest(http.MethodPost, "/api/rooms/"+strconv.FormatInt(room.ID, 10)+"/mutes", ownerToken, `{"user_id":2,"duration_seconds":60,"reason":"spam"}`); code != http.StatusOK {
+		t.Fatalf("mute: expected 200, got %d", code)
+	}
+	send("msg", proto.MsgData{Room: "town", Text: "still here"})
+	readError(core.ErrCodeMuted)
+
+	// Banned: the live connection is dropped from the room and cannot rejoin
+	if code := rest(http.MethodPost, "/api/rooms/"+strconv.FormatInt(room.ID, 10)+"/bans", ownerToken, `{"user_id":2,"reason":"spam"}`); code != http.StatusOK {
+		t.Fatalf("ban: expected 200, got %d", code)
+	}
+	out := readUntil("user_kicked", func(o proto.Outbound) bool { return o.Event == "user_kicked" })
+	data, _ := json.Marshal(out.Data)
+	var kicked proto.EventUserKicked
+	if err := json.Unmarshal(data, &kicked); err != nil {
+		t.Fatalf("unmarshal user_kicked: %v", err)
+	}
+	if kicked.UserID != 2 || kicked.By != "owner" || !kicked.Banned || kicked.Reason != "spam" {
+		t.Fatalf("unexpected user_kicked: %+v", kicked)
+	}
+
+	send("msg", proto.MsgData{Room: "town", Text: "let me back"})
+	readError(core.ErrCodeNotInRoom)
+	send("join", proto.JoinData{Room: "town"})
+	readError(core.ErrCodeBanned)
+
+	// The audit log records both actions, newest first
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/rooms/"+strconv.FormatInt(room.ID, 10)+"/audit", nil)
+	req.Header.Set("Authorization", "Bearer "+ownerToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get audit log: %v", err)
+	}
+	defer resp.Body.Close()
+	var audit AuditLogResponse
+	if err := json.NewDecoder(resp.Body).Decode(&audit); err != nil {
+		t.Fatalf("decode audit log: %v", err)
+	}
+	if len(audit.Entries) != 2 || audit.Entries[0].Action != "ban" || audit.Entries[1].Action != "mute" {
+		t.Fatalf("unexpected audit log: %+v", audit.Entries)
+	}
+	if audit.Entries[1].TargetID != 2 || audit.Entries[1].Reason != "spam" || audit.Entries[1].Details == "" {
+		t.Fatalf("unexpected mute entry: %+v", audit.Entries[1])
+	}
+
+	// Lifting the ban lets bob back in
+	if code := rest(http.MethodDelete, "/api/rooms/"+strconv.FormatInt(room.ID, 10)+"/bans/2", ownerToken, ""); code != http.StatusOK {
+		t.Fatalf("unban: expected 200, got %d", code)
+	}
+	send("join", proto.JoinData{Room: "town"})
+	readUntil("user_joined", func(o proto.Outbound) bool { return o.Event == "user_joined" })
+}
+
+func TestWebSocketChannelPublishing(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	ownerToken, err := registerToken(context.Background(), authService, "owner", "password123")
+	if err != nil {
+		t.Fatalf("failed to register owner: %v", err)
+	}
+	bobToken, err := registerToken(context.Background(), authService, "bob", "password123")
+	if err != nil {
+		t.Fatalf("failed to register bob: %v", err)
+	}
+
+	rest := func(method, path, token, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var channel RoomResponse
+	if code := rest(http.MethodPost, "/api/rooms", ownerToken, `{"name":"news","type":"channel"}`, &channel); code != http.StatusCreated {
+		t.Fatalf("create channel: expected 201, got %d", code)
+	}
+	channelPath := "/api/rooms/" + strconv.FormatInt(channel.ID, 10)
+
+	// Anyone can subscribe, and the subscriber count follows
+	if code := rest(http.MethodPost, channelPath+"/join", bobToken, "", nil); code != http.StatusOK {
+		t.Fatalf("subscribe: expected 200, got %d", code)
+	}
+	var rooms []RoomResponse
+	if code := rest(http.MethodGet, "/api/rooms", bobToken, "", &rooms); code != http.StatusOK {
+		t.Fatalf("list rooms: expected 200, got %d", code)
+	}
+	var listed *RoomResponse
+	for i := range rooms {
+		if rooms[i].ID == channel.ID {
+			listed = &rooms[i]
+		}
+	}
+	if listed == nil || listed.SubscriberCount == nil || *listed.SubscriberCount != 2 {
+		t.Fatalf("expected channel with 2 subscribers in %+v", rooms)
+	}
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// readUntil skips outbound frames until match accepts one.
+	readUntil := func(what string, match func(proto.Outbound) bool) proto.Outbound {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", what, readErr)
+			}
+			if match(outbound) {
+				return outbound
+			}
+		}
+	}
+
+	send("hello", proto.HelloData{User: "bob", Token: bobToken, Protocol: 1})
+	send("join", proto.JoinData{Room: "news"})
+	readUntil("user_joined", func(o proto.Outbound) bool { return o.Event == "user_joined" })
+
+	// Subscribers read but cannot post
+	send("msg", proto.MsgData{Room: "news", Text: "first!"})
+	out := readUntil("error", func(o proto.Outbound) bool { return o.Type == "error" })
+	if out.Error == nil || out.Error.Code != core.ErrCodeForbidden {
+		t.Fatalf("expected forbidden error, got %+v", out.Error)
+	}
+
+	// Admins publish
+	if code := rest(http.MethodPut, channelPath+"/members/2/role", ownerToken, `{"role":"admin"}`, nil); code != http.StatusOK {
+		t.Fatalf("promote: expected 200, got %d", code)
+	}
+	send("msg", proto.MsgData{Room: "news", Text: "breaking"})
+	out = readUntil("message", func(o proto.Outbound) bool { return o.Event == "message" || o.Type == "error" })
+	if out.Event != "message" {
+		t.Fatalf("expected message from admin, got %+v", out)
+	}
+}
+
+func TestWebSocketRoomMetadataAndPins(t *testing.T) {
+	// Create test store with schema
+	testStore := createTestStore(t)
+	defer testStore.Close()
+
+	// Create auth service
+	authService := createTestAuthService(t, testStore, "test-secret")
+
+	hub := core.NewHub(testStore, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	disabledLogger := zerolog.New(io.Discard)
+
+	cfg := config.Config{
+		Addr:              ":0",
+		ReadHeaderTimeout: time.Second,
+		ShutdownTimeout:   time.Second,
+		MaxMessageBytes:   1 << 20,
+		JWTSecret:         "test-secret",
+	}
+
+	server := NewServer(hub, authService, testStore, nil, nil, nil, nil, &cfg, &disabledLogger)
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	ownerToken, err := registerToken(context.Background(), authService, "owner", "password123")
+	if err != nil {
+		t.Fatalf("failed to register owner: %v", err)
+	}
+	bobToken, err := registerToken(context.Background(), authService, "bob", "password123")
+	if err != nil {
+		t.Fatalf("failed to register bob: %v", err)
+	}
+
+	rest := func(method, path, token, body string, out any) int {
+		req, reqErr := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if reqErr != nil {
+			t.Fatalf("build request: %v", reqErr)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatalf("%s %s: %v", method, path, doErr)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if decodeErr := json.NewDecoder(resp.Body).Decode(out); decodeErr != nil {
+				t.Fatalf("decode %s %s: %v", method, path, decodeErr)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var room RoomResponse
+	if code := rest(http.MethodPost, "/api/rooms", ownerToken, `{"name":"lobby"}`, &room); code != http.StatusCreated {
+		t.Fatalf("create room: expected 201, got %d", code)
+	}
+	roomPath := "/api/rooms/" + strconv.FormatInt(room.ID, 10)
+
+	wsURL := strings.Replace(ts.URL, "http", "ws", 1) + "/ws"
+	wsCtx, wsCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wsCancel()
+
+	conn, _, err := websocket.Dial(wsCtx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "done")
+
+	send := func(msgType string, data any) {
+		raw, _ := json.Marshal(data)
+		if writeErr := wsjson.Write(wsCtx, conn, proto.Inbound{Type: msgType, Data: raw}); writeErr != nil {
+			t.Fatalf("send %s: %v", msgType, writeErr)
+		}
+	}
+	// waitEvent skips outbound frames until the named event arrives.
+	waitEvent := func(name string) map[string]any {
+		for {
+			var outbound proto.Outbound
+			if readErr := wsjson.Read(wsCtx, conn, &outbound); readErr != nil {
+				t.Fatalf("read outbound waiting for %s: %v", name, readErr)
+			}
+			if outbound.Event != name {
+				continue
+			}
+			raw, _ := json.Marshal(outbound.Data)
+			var data map[string]any
+			if unmarshalErr := json.Unmarshal(raw, &data); unmarshalErr != nil {
+				t.Fatalf("decode %s: %v", name, unmarshalErr)
+			}
+			return data
+		}
+	}
+
+	send("hello", proto.HelloData{User: "bob", Token: bobToken, Protocol: 1})
+	send("join", proto.JoinData{Room: "lobby"})
+	waitEvent("user_joined")
+
+	// Metadata: owners edit it live, members cannot, avatars must be web URLs
+	if code := rest(http.MethodPatch, roomPath, bobToken, `{"topic":"mine now"}`, nil); code != http.StatusForbidden {
+		t.Fatalf("member update: expected 403, got %d", code)
+	}
+	if code := rest(http.MethodPatch, roomPath, ownerToken, `{"avatar_url":"javascript:alert(1)"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("bad avatar: expected 400, got %d", code)
+	}
+	var updated RoomResponse
+	if code := rest(http.MethodPatch, roomPath, ownerToken, `{"topic":"Release day","description":"Ship it"}`, &updated); code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d", code)
+	}
+	if updated.Topic != "Release day" || updated.Description != "Ship it" {
+		t.Fatalf("unexpected updated room %+v", updated)
+	}
+	data := waitEvent("room_updated")
+	if data["topic"] != "Release day" || data["description"] != "Ship it" || data["user"] != "owner" {
+		t.Fatalf("unexpected room_updated %v", data)
+	}
+
+	// Pins: moderators and above pin, everyone sees them
+	send("msg", proto.MsgData{Room: "lobby", Text: "pin me"})
+	msgID := int64(waitEvent("message")["id"].(float64))
+	pinBody := `{"message_id":` + strconv.FormatInt(msgID, 10) + `}`
+
+	if code := rest(http.MethodPost, roomPath+"/pins", bobToken, pinBody, nil); code != http.StatusForbidden {
+		t.Fatalf("member pin: expected 403, got %d", code)
+	}
+	if code := rest(http.MethodPost, roomPath+"/pins", ownerToken, pinBody, nil); code != http.StatusOK {
+		t.Fatalf("pin: expected 200, got %d", code)
+	}
+	data = waitEvent("message_pinned")
+	if pinned, _ := data["message"].(map[string]any); pinned == nil || pinned["text"] != "pin me" || data["user"] != "owner" {
+		t.Fatalf("unexpected message_pinned %v", data)
+	}
+	if code := rest(http.MethodPost, roomPath+"/pins", ownerToken, pinBody, nil); code != http.StatusConflict {
+		t.Fatalf("pin twice: expected 409, got %d", code)
+	}
+
+	var pins []PinResponse
+	if code := rest(http.MethodGet, roomPath+"/pins", bobToken, "", &pins); code != http.StatusOK {
+		t.Fatalf("list pins: expected 200, got %d", code)
+	}
+	if len(pins) != 1 || pins[0].Message.ID != msgID || pins[0].Message.Body != "pin me" {
+		t.Fatalf("unexpected pins %+v", pins)
+	}
+
+	pinPath := roomPath + "/pins/" + strconv.FormatInt(msgID, 10)
+	if code := rest(http.MethodDelete, pinPath, ownerToken, "", nil); code != http.StatusOK {
+		t.Fatalf("unpin: expected 200, got %d", code)
+	}
+	if id := waitEvent("message_unpinned")["id"]; id != float64(msgID) {
+		t.Fatalf("unexpected message_unpinned id %v", id)
+	}
+	if code := rest(http.MethodDelete, pinPath, ownerToken, "", nil); code != http.StatusNotFound {
+		t.Fatalf("unpin twice: expected 404, got %d", code)
+	}
+	pins = nil
+	if code := rest(http.MethodGet, roomPath+"/pins", bobToken, "", &pins); code != http.StatusOK || len(pins) != 0 {
+		t.Fatalf("expected no pins, got %d %+v", code, pins)
+	}
+}
@@ -0,0 +1,95 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/vovakirdan/wirechat-server/internal/uploads"
+)
+
+// Storage implements uploads.Storage on the local filesystem.
+// Files are spread over subdirectories named after the first two key characters.
+type Storage struct {
+	dir string
+}
+
+// New creates a filesystem storage rooted at dir, creating it if needed.
+func New(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create upload dir: %w", err)
+	}
+	return &Storage{dir: dir}, nil
+}
+
+// path maps a key to its file, rejecting keys that could escape the root.
+func (s *Storage) path(key string) (string, error) {
+	if !uploads.ValidKey(key) {
+		return "", fmt.Errorf("invalid upload key %q", key)
+	}
+	return filepath.Join(s.dir, key[:2], key), nil
+}
+
+// Put writes the contents of r to a temporary file and renames it into place,
+// so a failed upload never leaves a partial file under key.
+func (s *Storage) Put(_ context.Context, key string, r io.Reader) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return fmt.Errorf("create upload dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create upload file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // no-op once renamed
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write upload file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close upload file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("rename upload file: %w", err)
+	}
+	return nil
+}
+
+// Open opens the file stored under key.
+func (s *Storage) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, uploads.ErrNotFound
+		}
+		return nil, fmt.Errorf("open upload file: %w", err)
+	}
+	return f, nil
+}
+
+// Delete removes the file stored under key.
+func (s *Storage) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove upload file: %w", err)
+	}
+	return nil
+}
+
+// Ensure Storage implements uploads.Storage
+var _ uploads.Storage = (*Storage)(nil)
@@ -0,0 +1,60 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vovakirdan/wirechat-server/internal/uploads"
+)
+
+func TestStorageRoundTrip(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	ctx := context.Background()
+
+	key, err := uploads.NewKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err := s.Put(ctx, key, strings.NewReader("hello")); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	r, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("read back %q, %v", data, err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Open(ctx, key); !errors.Is(err, uploads.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing key should succeed, got %v", err)
+	}
+}
+
+func TestStorageRejectsInvalidKeys(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	for _, key := range []string{"", "../../etc/passwd", "abc", strings.Repeat("z", 32)} {
+		if err := s.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("expected Put(%q) to fail", key)
+		}
+	}
+}
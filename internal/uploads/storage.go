@@ -0,0 +1,63 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by Storage.Open when nothing is stored under a key.
+var ErrNotFound = errors.New("upload not found")
+
+// Storage abstracts where uploaded file contents live.
+// Keys come from NewKey; backends may rely on their format.
+type Storage interface {
+	// Put stores the contents of r under key.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Open returns a reader for the contents stored under key, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the contents stored under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// keyBytes is the amount of randomness in a storage key.
+const keyBytes = 16
+
+// NewKey generates a random storage key for a new upload.
+func NewKey() (string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ValidKey reports whether key has the format NewKey produces, so backends can
+// safely use it in file paths or object names.
+func ValidKey(key string) bool {
+	if len(key) != 2*keyBytes {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// AllowedType reports whether contentType matches one of the allowed patterns.
+// A pattern is either an exact MIME type ("application/pdf") or a
+// type wildcard ("image/*"). Parameters such as charset are ignored.
+func AllowedType(contentType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, pattern := range allowed {
+		if ok, err := path.Match(strings.ToLower(pattern), mediaType); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
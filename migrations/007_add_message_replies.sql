@@ -0,0 +1,9 @@
+-- +goose Up
+-- Threaded replies: a message may reply to another message in the same room
+
+ALTER TABLE messages ADD COLUMN reply_to INTEGER REFERENCES messages(id);
+CREATE INDEX idx_messages_reply_to ON messages(reply_to) WHERE reply_to IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_reply_to;
+ALTER TABLE messages DROP COLUMN reply_to;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Per-user read position in each room (read receipts and unread counters)
+
+CREATE TABLE room_read_state (
+    user_id      INTEGER NOT NULL,
+    room_id      INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, room_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (room_id) REFERENCES rooms(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS room_read_state;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Presence: remember when a user's last connection closed
+
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN last_seen_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Client-generated message IDs make sends idempotent: a retried send with the
+-- same client_msg_id from the same user is acknowledged instead of stored twice
+
+ALTER TABLE messages ADD COLUMN client_msg_id TEXT;
+CREATE UNIQUE INDEX idx_messages_user_client_msg_id ON messages(user_id, client_msg_id) WHERE client_msg_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_user_client_msg_id;
+ALTER TABLE messages DROP COLUMN client_msg_id;
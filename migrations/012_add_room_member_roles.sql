@@ -0,0 +1,13 @@
+-- +goose Up
+-- Room roles let owners delegate moderation: owner > admin > moderator > member
+
+ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+UPDATE room_members SET role = 'owner'
+WHERE EXISTS (
+  SELECT 1 FROM rooms
+  WHERE rooms.id = room_members.room_id AND rooms.owner_id = room_members.user_id
+);
+
+-- +goose Down
+ALTER TABLE room_members DROP COLUMN role;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- Room moderation: bans keep users out, mutes stop them posting for a while,
+-- and every moderation action is recorded in a per-room audit log
+
+CREATE TABLE room_bans (
+  room_id    INTEGER NOT NULL,
+  user_id    INTEGER NOT NULL,
+  banned_by  INTEGER NOT NULL,
+  reason     TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (room_id, user_id),
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (banned_by) REFERENCES users(id)
+);
+
+CREATE TABLE room_mutes (
+  room_id    INTEGER NOT NULL,
+  user_id    INTEGER NOT NULL,
+  muted_by   INTEGER NOT NULL,
+  reason     TEXT NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (room_id, user_id),
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (muted_by) REFERENCES users(id)
+);
+
+CREATE TABLE room_audit_log (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  room_id    INTEGER NOT NULL,
+  actor_id   INTEGER NOT NULL,
+  action     TEXT NOT NULL,
+  target_id  INTEGER NOT NULL,
+  reason     TEXT NOT NULL DEFAULT '',
+  details    TEXT NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_room_audit_log_room ON room_audit_log(room_id, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_room_audit_log_room;
+DROP TABLE IF EXISTS room_audit_log;
+DROP TABLE IF EXISTS room_mutes;
+DROP TABLE IF EXISTS room_bans;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Room metadata editable by admins, and messages pinned to the top of a room
+
+ALTER TABLE rooms ADD COLUMN topic TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE room_pins (
+  room_id    INTEGER NOT NULL,
+  message_id INTEGER NOT NULL,
+  pinned_by  INTEGER NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (room_id, message_id),
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (message_id) REFERENCES messages(id),
+  FOREIGN KEY (pinned_by) REFERENCES users(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS room_pins;
+ALTER TABLE rooms DROP COLUMN avatar_url;
+ALTER TABLE rooms DROP COLUMN description;
+ALTER TABLE rooms DROP COLUMN topic;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Invite links: expiring, optionally usage-limited codes that add the holder to a room
+
+CREATE TABLE room_invites (
+  code       TEXT PRIMARY KEY,
+  room_id    INTEGER NOT NULL,
+  created_by INTEGER NOT NULL,
+  max_uses   INTEGER NOT NULL DEFAULT 0, -- 0 means unlimited
+  uses       INTEGER NOT NULL DEFAULT 0,
+  expires_at DATETIME NOT NULL,
+  revoked_at DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_room_invites_room ON room_invites(room_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_room_invites_room;
+DROP TABLE IF EXISTS room_invites;
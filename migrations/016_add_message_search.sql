@@ -0,0 +1,37 @@
+-- +goose Up
+-- Full-text search over message bodies (requires SQLite built with FTS5)
+
+CREATE VIRTUAL TABLE messages_fts USING fts5(
+  body,
+  content = 'messages',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO messages_fts (rowid, body) SELECT id, body FROM messages;
+
+-- +goose StatementBegin
+CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+  INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+END;
+-- +goose StatementEnd
+
+-- Edits and soft deletes (which clear the body) both go through this trigger
+-- +goose StatementBegin
+CREATE TRIGGER messages_fts_update AFTER UPDATE OF body ON messages BEGIN
+  INSERT INTO messages_fts (messages_fts, rowid, body) VALUES ('delete', old.id, old.body);
+  INSERT INTO messages_fts (rowid, body) VALUES (new.id, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER IF EXISTS messages_fts_update;
+DROP TRIGGER IF EXISTS messages_fts_delete;
+DROP TRIGGER IF EXISTS messages_fts_insert;
+DROP TABLE IF EXISTS messages_fts;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Uploaded files. A row is created on upload and linked to a message when one shares it.
+
+CREATE TABLE attachments (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id      INTEGER NOT NULL,
+  message_id   INTEGER, -- NULL until a message uses the upload
+  position     INTEGER NOT NULL DEFAULT 0, -- order within the message
+  storage_key  TEXT NOT NULL UNIQUE,
+  filename     TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size         INTEGER NOT NULL,
+  created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (message_id) REFERENCES messages(id)
+);
+
+CREATE INDEX idx_attachments_message ON attachments(message_id, position) WHERE message_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_attachments_message;
+DROP TABLE IF EXISTS attachments;
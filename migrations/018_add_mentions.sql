@@ -0,0 +1,26 @@
+-- +goose Up
+-- Mentions: one row per user pinged by a message, read state kept per row
+
+CREATE TABLE mentions (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL, -- mentioned user
+  message_id INTEGER NOT NULL,
+  room_id    INTEGER NOT NULL,
+  author_id  INTEGER NOT NULL,
+  kind       TEXT NOT NULL, -- 'user' (@username) or 'room' (@room)
+  read_at    DATETIME,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (message_id, user_id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (message_id) REFERENCES messages(id),
+  FOREIGN KEY (room_id) REFERENCES rooms(id),
+  FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_mentions_user ON mentions(user_id, id);
+CREATE INDEX idx_mentions_user_unread ON mentions(user_id) WHERE read_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_mentions_user_unread;
+DROP INDEX IF EXISTS idx_mentions_user;
+DROP TABLE IF EXISTS mentions;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- Login sessions, one per signed-in device. Access tokens carry the session ID;
+-- the refresh token is stored only as a SHA-256 hash and rotated on every use.
+
+CREATE TABLE sessions (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id           INTEGER NOT NULL,
+  refresh_hash      TEXT NOT NULL UNIQUE,
+  prev_refresh_hash TEXT, -- hash rotated out by the last refresh, to detect reuse
+  user_agent        TEXT NOT NULL DEFAULT '',
+  ip                TEXT NOT NULL DEFAULT '',
+  created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at        DATETIME NOT NULL,
+  revoked_at        DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+CREATE INDEX idx_sessions_prev_refresh ON sessions(prev_refresh_hash) WHERE prev_refresh_hash IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_prev_refresh;
+DROP INDEX IF EXISTS idx_sessions_user;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Accounts at external identity providers (OIDC) linked to users. The subject is
+-- only unique per issuer, and a user has at most one account per issuer.
+
+CREATE TABLE user_identities (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL,
+  issuer     TEXT NOT NULL,
+  subject    TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (issuer, subject),
+  UNIQUE (user_id, issuer),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Optional email for password resets, and single-use reset tokens. Tokens are
+-- stored only as a SHA-256 hash.
+
+ALTER TABLE users ADD COLUMN email TEXT;
+CREATE UNIQUE INDEX idx_users_email ON users(email COLLATE NOCASE) WHERE email IS NOT NULL;
+
+CREATE TABLE password_resets (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id    INTEGER NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME NOT NULL,
+  used_at    DATETIME,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_password_resets_user ON password_resets(user_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_password_resets_user;
+DROP TABLE IF EXISTS password_resets;
+DROP INDEX IF EXISTS idx_users_email;
+ALTER TABLE users DROP COLUMN email;
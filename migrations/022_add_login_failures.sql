@@ -0,0 +1,23 @@
+-- +goose Up
+-- Audit trail of failed password logins, including attempts on usernames that
+-- do not exist (user_id NULL).
+
+CREATE TABLE login_failures (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  username   TEXT NOT NULL, -- as entered
+  user_id    INTEGER,
+  ip         TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  reason     TEXT NOT NULL, -- unknown_user, bad_password
+  locked     BOOLEAN NOT NULL DEFAULT 0, -- this failure locked the username or IP
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_login_failures_user ON login_failures(user_id, created_at) WHERE user_id IS NOT NULL;
+CREATE INDEX idx_login_failures_ip ON login_failures(ip, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_login_failures_ip;
+DROP INDEX IF EXISTS idx_login_failures_user;
+DROP TABLE IF EXISTS login_failures;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- The participant who created a group DM: only they may convert it to a private
+-- room. Groups created before this migration have no creator and cannot be converted.
+
+ALTER TABLE rooms ADD COLUMN created_by INTEGER REFERENCES users(id);
+
+-- +goose Down
+ALTER TABLE rooms DROP COLUMN created_by;